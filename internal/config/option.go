@@ -1,24 +1,131 @@
 package config
 
 import (
+	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
 )
 
 type Options struct {
-	AppName           string
-	ListenAddressHTTP string
-	DatabaseHost      string
-	DatabaseUser      string
-	DatabasePass      string
-	DatabaseName      string
-	DatabasePort      int
-	DatabaseSSLMode   string
-	DatabaseTimezone  string
-	JWTSigningMethod  jwt.SigningMethod
-	JWTSigningKey     []byte
-	JWTAllowMethod    authservice.AllowSigningMethod
-	JWTExpiredIn      time.Duration
+	AppName              string
+	ListenAddressHTTP    string
+	DatabaseHost         string
+	DatabaseUser         string
+	DatabasePass         string
+	DatabaseName         string
+	DatabasePort         int
+	DatabaseSSLMode      string
+	DatabaseTimezone     string
+	JWTSigningMethod     jwt.SigningMethod
+	JWTSigningKey        interface{}
+	JWTVerifyKey         interface{}
+	JWTAllowMethod       authservice.AllowSigningMethod
+	JWTAudience          []string
+	JWTExpiredIn         time.Duration
+	JWTRefreshExpiredIn  time.Duration
+	LoginMaxAttempts     int
+	LoginIPMaxAttempts   int
+	LoginBackoff         time.Duration
+	LoginLockoutDuration time.Duration
+	// TrustedProxies are the addresses or CIDRs whose X-Forwarded-For header
+	// is believed for the client address lockouts count per. No proxy is
+	// trusted when empty.
+	TrustedProxies      []string
+	MFAPendingExpiredIn time.Duration
+	// AuthCookie sets the tokens as HttpOnly cookies rather than answering
+	// them, for browser clients. Requests authorized by the cookie which
+	// change state need the CSRF token in the X-CSRF-Token header.
+	AuthCookie         bool
+	AuthCookieDomain   string
+	AuthCookieSecure   bool
+	AuthCookieSameSite http.SameSite
+	// SessionTouchInterval is how often the last seen time of a session is
+	// written, requests in between only read the session.
+	SessionTouchInterval time.Duration
+	// ImpersonationExpiredIn is how long an admin can act as a user with
+	// the token of POST /users/:id/impersonate, it can not be refreshed.
+	ImpersonationExpiredIn time.Duration
+	PasswordPolicy         userservice.PasswordPolicy
+	PasswordHasher         userservice.PasswordHasher
+	// MePasswordUpdate allows PUT /me to change the password without the
+	// current one.
+	MePasswordUpdate       bool
+	PasswordResetExpiredIn time.Duration
+	// PasswordResetURL is the page the reset token is sent to, as the token
+	// query parameter.
+	PasswordResetURL string
+	MailDriver       string
+	MailFrom         string
+	MailFile         string
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	// OAuthIssuerURL is the public base URL of this service when it acts as
+	// an OpenID Connect provider.
+	OAuthIssuerURL string
+	// OAuthAuthorizeURL is the login page which collects the user and posts
+	// to /oauth/authorize.
+	OAuthAuthorizeURL     string
+	OAuthCodeExpiredIn    time.Duration
+	OAuthIDTokenExpiredIn time.Duration
+	// OIDCIssuerURL is the external OpenID Connect provider users can sign
+	// in with. Signing in with it is disabled when empty.
+	OIDCIssuerURL    string
+	OIDCClientID     string
+	OIDCClientSecret string
+	// OIDCRedirectURL is the page the provider sends code and state to,
+	// which posts them to /auth/oidc/callback.
+	OIDCRedirectURL    string
+	OIDCScopes         []string
+	OIDCStateExpiredIn time.Duration
+	// OIDCLinkByEmail links a new identity to the user with the same email
+	// when the provider has verified it, rather than creating a user.
+	OIDCLinkByEmail bool
+	// LoginAuthenticators are the backends POST /auth/login asks in order,
+	// local and ldap.
+	LoginAuthenticators []string
+	// LDAPURL is the directory server, ldap:// or ldaps://.
+	LDAPURL      string
+	LDAPStartTLS bool
+	// LDAPBindDN is the account searching for the user's entry, the search
+	// is anonymous when empty.
+	LDAPBindDN       string
+	LDAPBindPassword string
+	LDAPBaseDN       string
+	// LDAPUserFilter finds the user's entry, %s is the username.
+	LDAPUserFilter           string
+	LDAPUsernameAttribute    string
+	LDAPDisplayNameAttribute string
+	LDAPEmailAttribute       string
+}
+
+func (o Options) DatabaseDSN() string {
+	return fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
+		o.DatabaseHost,
+		o.DatabaseUser,
+		o.DatabasePass,
+		o.DatabaseName,
+		o.DatabasePort,
+		o.DatabaseSSLMode,
+		o.DatabaseTimezone,
+	)
+}
+
+// TokenLifetime is the longest lifetime of the tokens the keyring signs,
+// which is how long a retired key has to keep verifying them.
+func (o Options) TokenLifetime() time.Duration {
+	lifetime := o.JWTExpiredIn
+	for _, d := range []time.Duration{o.MFAPendingExpiredIn, o.ImpersonationExpiredIn, o.OAuthIDTokenExpiredIn} {
+		if d > lifetime {
+			lifetime = d
+		}
+	}
+
+	return lifetime
 }
@@ -2,12 +2,10 @@ package database
 
 import (
 	"database/sql"
-	"fmt"
 
 	migrate "github.com/golang-migrate/migrate/v4"
 	migratepg "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"github.com/maetad/baroness-api/internal/config"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -18,20 +16,14 @@ type DatabaseInterface interface {
 	Find(dest interface{}, conds ...interface{}) (tx *gorm.DB)
 	Save(value interface{}) (tx *gorm.DB)
 	Delete(value interface{}, conds ...interface{}) (tx *gorm.DB)
+	// Scopes builds the queries the methods above can not express, such as
+	// ordered and limited ones.
+	Scopes(funcs ...func(*gorm.DB) *gorm.DB) (tx *gorm.DB)
+	FindInBatches(dest interface{}, batchSize int, fc func(tx *gorm.DB, batch int) error) (tx *gorm.DB)
+	Transaction(fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) (err error)
 }
 
-func Connect(options config.Options) (*gorm.DB, error) {
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
-		options.DatabaseHost,
-		options.DatabaseUser,
-		options.DatabasePass,
-		options.DatabaseName,
-		options.DatabasePort,
-		options.DatabaseSSLMode,
-		options.DatabaseTimezone,
-	)
-
+func Connect(dsn string) (*gorm.DB, error) {
 	return gorm.Open(postgres.Open(dsn), &gorm.Config{})
 }
 
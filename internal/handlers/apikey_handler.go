@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maetad/baroness-api/internal/services/apikeyservice"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/sirupsen/logrus"
+)
+
+type APIKeyHandler struct {
+	log           *logrus.Entry
+	apikeyservice apikeyservice.APIKeyServiceInterface
+	roleservice   roleservice.RoleServiceInterface
+}
+
+func NewAPIKeyHandler(
+	log *logrus.Entry,
+	apikeyservice apikeyservice.APIKeyServiceInterface,
+	roleservice roleservice.RoleServiceInterface,
+) *APIKeyHandler {
+	return &APIKeyHandler{log, apikeyservice, roleservice}
+}
+
+func (h *APIKeyHandler) List(c *gin.Context) {
+	var (
+		user *userservice.User
+		ok   bool
+	)
+
+	if user, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`List(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := h.apikeyservice.List(user.ID)
+	if err != nil {
+		h.log.WithError(err).Errorf("List(): h.apikeyservice.List error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// Create issues a key scoped to permissions the user holds. Neither keys nor
+// OAuth clients can create more keys.
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var (
+		user *userservice.User
+		ok   bool
+	)
+
+	if user, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`Create(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if isDelegated(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	var r apikeyservice.APIKeyCreateRequest
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	access, err := h.roleservice.GetUserAccess(user.ID)
+	if err != nil {
+		h.log.WithError(err).Errorf("Create(): h.roleservice.GetUserAccess error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	for _, scope := range r.Scopes {
+		if !access.Can(scope) {
+			c.AbortWithStatus(http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	apiKey, key, err := h.apikeyservice.Create(user.ID, r)
+	if err != nil {
+		h.log.WithError(err).Errorf("Create(): h.apikeyservice.Create error %v", err)
+		if errors.Is(err, apikeyservice.ErrExpiresAtInvalid) {
+			c.AbortWithStatus(http.StatusUnprocessableEntity)
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": apiKey,
+		"key":     key,
+	})
+}
+
+func (h *APIKeyHandler) Delete(c *gin.Context) {
+	var (
+		user   *userservice.User
+		ok     bool
+		id     int
+		err    error
+		apiKey *apikeyservice.APIKey
+	)
+
+	if user, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`Delete(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if isDelegated(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if apiKey, err = h.apikeyservice.Get(user.ID, uint(id)); err != nil {
+		h.log.WithError(err).Errorf("Delete(): h.apikeyservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if err = h.apikeyservice.Delete(apiKey); err != nil {
+		h.log.WithError(err).Errorf("Delete(): h.apikeyservice.Delete error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
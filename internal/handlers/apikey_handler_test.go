@@ -0,0 +1,285 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maetad/baroness-api/internal/handlers"
+	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/apikeyservice"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+)
+
+func newAPIKeyContext(user interface{}, id string, body string) *gin.Context {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	c.Request = &http.Request{
+		URL:    &url.URL{},
+		Header: make(http.Header),
+		Body:   io.NopCloser(strings.NewReader(body)),
+	}
+
+	c.Params = gin.Params{
+		{
+			Key:   "id",
+			Value: id,
+		},
+	}
+
+	c.Set("user", user)
+
+	return c
+}
+
+func TestAPIKeyHandler_List(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &userservice.User{Model: model.Model{ID: 1}}
+
+	tests := []struct {
+		name          string
+		apikeyservice func() *mocks.APIKeyServiceInterface
+		c             *gin.Context
+		want          int
+	}{
+		{
+			name:          "current user is incorrect",
+			apikeyservice: func() *mocks.APIKeyServiceInterface { return nil },
+			c:             newAPIKeyContext("user", "", ""),
+			want:          http.StatusUnauthorized,
+		},
+		{
+			name: "list fail",
+			apikeyservice: func() *mocks.APIKeyServiceInterface {
+				a := &mocks.APIKeyServiceInterface{}
+				a.On("List", uint(1)).
+					Return(nil, errors.New("database error"))
+
+				return a
+			},
+			c:    newAPIKeyContext(user, "", ""),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "keys found",
+			apikeyservice: func() *mocks.APIKeyServiceInterface {
+				a := &mocks.APIKeyServiceInterface{}
+				a.On("List", uint(1)).
+					Return([]apikeyservice.APIKey{{Name: "batch"}}, nil)
+
+				return a
+			},
+			c:    newAPIKeyContext(user, "", ""),
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewAPIKeyHandler(logrus.WithContext(context.TODO()), tt.apikeyservice(), nil)
+			h.List(tt.c)
+
+			if tt.c.Writer.Status() != tt.want {
+				t.Errorf("List() = %v, want %v", tt.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyHandler_Create(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &userservice.User{Model: model.Model{ID: 1}}
+	body := `{"name":"batch","scopes":["users.read"]}`
+
+	roles := func() *mocks.RoleServiceInterface {
+		r := &mocks.RoleServiceInterface{}
+		r.On("GetUserAccess", uint(1)).
+			Return(roleservice.Access{Permissions: []string{"users.read"}}, nil)
+
+		return r
+	}
+
+	created := func(err error) func() *mocks.APIKeyServiceInterface {
+		return func() *mocks.APIKeyServiceInterface {
+			a := &mocks.APIKeyServiceInterface{}
+			a.On("Create", uint(1), mock.AnythingOfType("apikeyservice.APIKeyCreateRequest")).
+				Return(&apikeyservice.APIKey{Name: "batch"}, "bk_00000000_secret", err)
+
+			return a
+		}
+	}
+
+	withKey := func() *gin.Context {
+		c := newAPIKeyContext(user, "", body)
+		c.Set("api_key", &apikeyservice.APIKey{})
+
+		return c
+	}
+
+	tests := []struct {
+		name          string
+		apikeyservice func() *mocks.APIKeyServiceInterface
+		roleservice   func() *mocks.RoleServiceInterface
+		c             *gin.Context
+		want          int
+	}{
+		{
+			name:          "current user is incorrect",
+			apikeyservice: func() *mocks.APIKeyServiceInterface { return nil },
+			roleservice:   func() *mocks.RoleServiceInterface { return nil },
+			c:             newAPIKeyContext("user", "", body),
+			want:          http.StatusUnauthorized,
+		},
+		{
+			name:          "authorized by api key",
+			apikeyservice: func() *mocks.APIKeyServiceInterface { return nil },
+			roleservice:   func() *mocks.RoleServiceInterface { return nil },
+			c:             withKey(),
+			want:          http.StatusForbidden,
+		},
+		{
+			name:          "invalid payload",
+			apikeyservice: func() *mocks.APIKeyServiceInterface { return nil },
+			roleservice:   func() *mocks.RoleServiceInterface { return nil },
+			c:             newAPIKeyContext(user, "", `{"scopes":["users.read"]}`),
+			want:          http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "scope not granted",
+			apikeyservice: func() *mocks.APIKeyServiceInterface { return nil },
+			roleservice:   roles,
+			c:             newAPIKeyContext(user, "", `{"name":"batch","scopes":["users.delete"]}`),
+			want:          http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "expiry in the past",
+			apikeyservice: created(apikeyservice.ErrExpiresAtInvalid),
+			roleservice:   roles,
+			c:             newAPIKeyContext(user, "", body),
+			want:          http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "create fail",
+			apikeyservice: created(errors.New("database error")),
+			roleservice:   roles,
+			c:             newAPIKeyContext(user, "", body),
+			want:          http.StatusInternalServerError,
+		},
+		{
+			name:          "key created",
+			apikeyservice: created(nil),
+			roleservice:   roles,
+			c:             newAPIKeyContext(user, "", body),
+			want:          http.StatusCreated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewAPIKeyHandler(logrus.WithContext(context.TODO()), tt.apikeyservice(), tt.roleservice())
+			h.Create(tt.c)
+
+			if tt.c.Writer.Status() != tt.want {
+				t.Errorf("Create() = %v, want %v", tt.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyHandler_Delete(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &userservice.User{Model: model.Model{ID: 1}}
+	apiKey := &apikeyservice.APIKey{ID: 2, UserID: 1}
+
+	deleted := func(err error) func() *mocks.APIKeyServiceInterface {
+		return func() *mocks.APIKeyServiceInterface {
+			a := &mocks.APIKeyServiceInterface{}
+			a.On("Get", uint(1), uint(2)).
+				Return(apiKey, nil)
+			a.On("Delete", apiKey).
+				Return(err)
+
+			return a
+		}
+	}
+
+	withKey := func() *gin.Context {
+		c := newAPIKeyContext(user, "2", "")
+		c.Set("api_key", &apikeyservice.APIKey{})
+
+		return c
+	}
+
+	tests := []struct {
+		name          string
+		apikeyservice func() *mocks.APIKeyServiceInterface
+		c             *gin.Context
+		want          int
+	}{
+		{
+			name:          "current user is incorrect",
+			apikeyservice: func() *mocks.APIKeyServiceInterface { return nil },
+			c:             newAPIKeyContext("user", "2", ""),
+			want:          http.StatusUnauthorized,
+		},
+		{
+			name:          "api key",
+			apikeyservice: func() *mocks.APIKeyServiceInterface { return nil },
+			c:             withKey(),
+			want:          http.StatusForbidden,
+		},
+		{
+			name:          "id is not int",
+			apikeyservice: func() *mocks.APIKeyServiceInterface { return nil },
+			c:             newAPIKeyContext(user, "two", ""),
+			want:          http.StatusNotFound,
+		},
+		{
+			name: "key not found",
+			apikeyservice: func() *mocks.APIKeyServiceInterface {
+				a := &mocks.APIKeyServiceInterface{}
+				a.On("Get", uint(1), uint(2)).
+					Return(nil, errors.New("record not found"))
+
+				return a
+			},
+			c:    newAPIKeyContext(user, "2", ""),
+			want: http.StatusNotFound,
+		},
+		{
+			name:          "delete fail",
+			apikeyservice: deleted(errors.New("database error")),
+			c:             newAPIKeyContext(user, "2", ""),
+			want:          http.StatusInternalServerError,
+		},
+		{
+			name:          "key deleted",
+			apikeyservice: deleted(nil),
+			c:             newAPIKeyContext(user, "2", ""),
+			want:          http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewAPIKeyHandler(logrus.WithContext(context.TODO()), tt.apikeyservice(), nil)
+			h.Delete(tt.c)
+			tt.c.Writer.WriteHeaderNow()
+
+			if tt.c.Writer.Status() != tt.want {
+				t.Errorf("Delete() = %v, want %v", tt.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
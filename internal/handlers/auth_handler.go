@@ -1,22 +1,49 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/maetad/baroness-api/internal/config"
+	"github.com/maetad/baroness-api/internal/services/apikeyservice"
 	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/lockoutservice"
+	"github.com/maetad/baroness-api/internal/services/loginservice"
+	"github.com/maetad/baroness-api/internal/services/mfaservice"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
 	"github.com/maetad/baroness-api/internal/services/userservice"
 	"github.com/sirupsen/logrus"
 )
 
+// Cookies holding the tokens in cookie mode. The refresh token is only sent
+// to the /auth endpoints.
+const (
+	accessTokenCookie  = "access_token"
+	refreshTokenCookie = "refresh_token"
+	csrfTokenCookie    = "csrf_token"
+	csrfTokenHeader    = "X-CSRF-Token"
+)
+
 type AuthHandler struct {
-	log         *logrus.Entry
-	options     config.Options
-	authservice authservice.AuthServiceInterface
-	userservice userservice.UserServiceInterface
+	log            *logrus.Entry
+	options        config.Options
+	authservice    authservice.AuthServiceInterface
+	userservice    userservice.UserServiceInterface
+	lockoutservice lockoutservice.LockoutServiceInterface
+	mfaservice     mfaservice.MFAServiceInterface
+	roleservice    roleservice.RoleServiceInterface
+	apikeyservice  apikeyservice.APIKeyServiceInterface
+	loginservice   loginservice.LoginServiceInterface
 }
 
 func NewAuthHandler(
@@ -24,8 +51,13 @@ func NewAuthHandler(
 	options config.Options,
 	authservice authservice.AuthServiceInterface,
 	userservice userservice.UserServiceInterface,
+	lockoutservice lockoutservice.LockoutServiceInterface,
+	mfaservice mfaservice.MFAServiceInterface,
+	roleservice roleservice.RoleServiceInterface,
+	apikeyservice apikeyservice.APIKeyServiceInterface,
+	loginservice loginservice.LoginServiceInterface,
 ) *AuthHandler {
-	return &AuthHandler{log, options, authservice, userservice}
+	return &AuthHandler{log, options, authservice, userservice, lockoutservice, mfaservice, roleservice, apikeyservice, loginservice}
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -40,36 +72,340 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	var (
-		user userservice.UserInterface
-		err  error
+		user       userservice.UserInterface
+		retryAfter time.Duration
+		err        error
 	)
 
-	if user, err = h.userservice.GetByUsername(req.Username); err != nil {
-		h.log.WithError(err).Errorf("Login(): h.userservice.GetByUsername error %v", err)
+	if retryAfter, err = h.lockoutservice.Attempt(req.Username, c.ClientIP()); err != nil {
+		h.log.WithError(err).Errorf("Login(): h.lockoutservice.Attempt error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.AbortWithStatus(http.StatusTooManyRequests)
+		return
+	}
+
+	if user, err = h.loginservice.Authenticate(req.Username, req.Password); err != nil {
+		h.log.WithError(err).Errorf("Login(): h.loginservice.Authenticate error %v", err)
+		if errors.Is(err, loginservice.ErrCredentialsInvalid) {
+			h.loginFailed(c, req.Username)
+			return
+		}
+
+		h.releaseAttempt(c, "Login", req.Username)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// the lockout is only cleared once the second factor is verified too,
+	// otherwise a known password would allow unlimited code guesses
+	if user.(*userservice.User).TOTPEnabled {
+		h.releaseAttempt(c, "Login", req.Username)
+		h.requireMFA(c, "Login", user.(*userservice.User))
+		return
+	}
+
+	if err = h.lockoutservice.RecordSuccess(req.Username, c.ClientIP()); err != nil {
+		h.log.WithError(err).Errorf("Login(): h.lockoutservice.RecordSuccess error %v", err)
+	}
+
+	h.issueTokens(c, "Login", user.(*userservice.User))
+}
+
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	var (
+		claims     jwt.MapClaims
+		user       userservice.UserInterface
+		retryAfter time.Duration
+		err        error
+	)
+
+	if claims, err = h.authservice.ParseToken(req.MFAToken); err != nil {
+		h.log.WithError(err).Errorf("LoginMFA(): h.authservice.ParseToken error %v", err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if pending, _ := claims["mfa_pending"].(bool); !pending {
+		h.log.Error("LoginMFA(): token is not an mfa token")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	sub, _ := claims["sub"].(string)
+	id, err := strconv.ParseUint(sub, 10, 64)
+	if err != nil {
+		h.log.WithError(err).Errorf("LoginMFA(): claims sub is not user id %v", err)
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
-	if err = user.ValidatePassword(req.Password); err != nil {
-		h.log.WithError(err).Errorf("Login(): user.ValidatePassword error %v", err)
+	if user, err = h.userservice.Get(uint(id)); err != nil {
+		h.log.WithError(err).Errorf("LoginMFA(): h.userservice.Get error %v", err)
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
-	token, err := h.authservice.GenerateToken(user.(*userservice.User), h.options.JWTExpiredIn)
+	revoked, err := h.authservice.IsTokenRevoked(claims, user.(*userservice.User).ID)
 	if err != nil {
-		h.log.WithError(err).Errorf("Login(): h.authservice.GenerateToken error %v", err)
+		h.log.WithError(err).Errorf("LoginMFA(): h.authservice.IsTokenRevoked error %v", err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	if revoked {
+		h.log.Error("LoginMFA(): token has been revoked")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	username := user.(*userservice.User).Username
+	if retryAfter, err = h.lockoutservice.Attempt(username, c.ClientIP()); err != nil {
+		h.log.WithError(err).Errorf("LoginMFA(): h.lockoutservice.Attempt error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.AbortWithStatus(http.StatusTooManyRequests)
+		return
+	}
+
+	if err = h.mfaservice.Verify(user, req.Code); err != nil {
+		h.log.WithError(err).Errorf("LoginMFA(): h.mfaservice.Verify error %v", err)
+		if errors.Is(err, mfaservice.ErrCodeInvalid) || errors.Is(err, mfaservice.ErrNotEnrolled) {
+			h.loginFailed(c, username)
+			return
+		}
+
+		h.releaseAttempt(c, "LoginMFA", username)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// the mfa token can only be exchanged once, concurrent exchanges of the
+	// same token all but one fail here
+	if err = h.authservice.ConsumeToken(claims); err != nil {
+		h.log.WithError(err).Errorf("LoginMFA(): h.authservice.ConsumeToken error %v", err)
+		h.releaseAttempt(c, "LoginMFA", username)
+		if errors.Is(err, authservice.ErrTokenInvalid) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err = h.lockoutservice.RecordSuccess(username, c.ClientIP()); err != nil {
+		h.log.WithError(err).Errorf("LoginMFA(): h.lockoutservice.RecordSuccess error %v", err)
+	}
+
+	h.issueTokens(c, "LoginMFA", user.(*userservice.User))
+}
+
+// requireMFA answers with a token which LoginMFA exchanges for the tokens
+// once the second factor is verified.
+func (h *AuthHandler) requireMFA(c *gin.Context, method string, user *userservice.User) {
+	token, err := h.authservice.GenerateToken(authservice.Claims{
+		"sub":         strconv.FormatUint(uint64(user.ID), 10),
+		"mfa_pending": true,
+	}, h.options.MFAPendingExpiredIn)
+	if err != nil {
+		h.log.WithError(err).Errorf("%s(): h.authservice.GenerateToken error %v", method, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": token})
+}
+
+func (h *AuthHandler) issueTokens(c *gin.Context, method string, user *userservice.User) {
+	claims, err := accessClaims(h.roleservice, user)
+	if err != nil {
+		h.log.WithError(err).Errorf("%s(): h.roleservice.GetUserAccess error %v", method, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	session, err := h.authservice.CreateSession(user.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		h.log.WithError(err).Errorf("%s(): h.authservice.CreateSession error %v", method, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	claims["sid"] = strconv.FormatUint(uint64(session.ID), 10)
+
+	token, err := h.authservice.GenerateToken(claims, h.options.JWTExpiredIn)
+	if err != nil {
+		h.log.WithError(err).Errorf("%s(): h.authservice.GenerateToken error %v", method, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := h.authservice.GenerateRefreshToken(user.ID, session.ID, h.options.JWTRefreshExpiredIn)
+	if err != nil {
+		h.log.WithError(err).Errorf("%s(): h.authservice.GenerateRefreshToken error %v", method, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err = respondTokens(c, h.options, token, refreshToken); err != nil {
+		h.log.WithError(err).Errorf("%s(): respondTokens error %v", method, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
 }
 
+func (h *AuthHandler) loginFailed(c *gin.Context, username string) {
+	if err := h.lockoutservice.RecordFailure(username, c.ClientIP()); err != nil {
+		h.log.WithError(err).Errorf("Login(): h.lockoutservice.RecordFailure error %v", err)
+	}
+
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
+
+// releaseAttempt takes back the attempt counted for a login which neither
+// failed nor succeeded.
+func (h *AuthHandler) releaseAttempt(c *gin.Context, method string, username string) {
+	if err := h.lockoutservice.Release(username, c.ClientIP()); err != nil {
+		h.log.WithError(err).Errorf("%s(): h.lockoutservice.Release error %v", method, err)
+	}
+}
+
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	// the body is empty when the refresh token is sent as cookie
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if req.RefreshToken == "" && h.options.AuthCookie {
+		if cookie, err := c.Cookie(refreshTokenCookie); err == nil {
+			if !validCSRF(c) {
+				h.log.Error("Refresh(): csrf token is invalid")
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+
+			req.RefreshToken = cookie
+		}
+	}
+
+	if req.RefreshToken == "" {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	rotated, refreshToken, err := h.authservice.RotateRefreshToken(req.RefreshToken, h.options.JWTRefreshExpiredIn)
+	if err != nil {
+		h.log.WithError(err).Errorf("Refresh(): h.authservice.RotateRefreshToken error %v", err)
+		if errors.Is(err, authservice.ErrRefreshTokenInvalid) || errors.Is(err, authservice.ErrRefreshTokenReused) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.userservice.Get(rotated.UserID)
+	if err != nil {
+		h.log.WithError(err).Errorf("Refresh(): h.userservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := accessClaims(h.roleservice, user.(*userservice.User))
+	if err != nil {
+		h.log.WithError(err).Errorf("Refresh(): h.roleservice.GetUserAccess error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// refresh tokens issued before sessions were tracked have none
+	if rotated.SessionID != nil {
+		if err = h.authservice.TouchSession(*rotated.SessionID, h.options.SessionTouchInterval); err != nil {
+			h.log.WithError(err).Errorf("Refresh(): h.authservice.TouchSession error %v", err)
+			if errors.Is(err, authservice.ErrSessionNotFound) {
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		claims["sid"] = strconv.FormatUint(uint64(*rotated.SessionID), 10)
+	}
+
+	token, err := h.authservice.GenerateToken(claims, h.options.JWTExpiredIn)
+	if err != nil {
+		h.log.WithError(err).Errorf("Refresh(): h.authservice.GenerateToken error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err = respondTokens(c, h.options, token, refreshToken); err != nil {
+		h.log.WithError(err).Errorf("Refresh(): respondTokens error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
+
+// Authorize accepts either a Bearer token, an API key in the X-API-Key
+// header or, in cookie mode, the access token cookie. Tokens issued to OAuth
+// clients are refused, see AuthorizeClient.
 func (h *AuthHandler) Authorize(c *gin.Context) {
+	h.authorize(c, false)
+}
+
+// AuthorizeClient is Authorize which also accepts the tokens issued to OAuth
+// clients, for the endpoints they are meant to call.
+func (h *AuthHandler) AuthorizeClient(c *gin.Context) {
+	h.authorize(c, true)
+}
+
+func (h *AuthHandler) authorize(c *gin.Context, clients bool) {
+	if key := c.Request.Header.Get("X-API-Key"); key != "" {
+		h.authorizeAPIKey(c, key)
+		return
+	}
+
 	s := c.Request.Header.Get("Authorization")
 	token := strings.TrimPrefix(s, "Bearer ")
 
+	// browsers send the cookie along with requests any site makes, those
+	// changing state have to prove they can read the CSRF cookie
+	if s == "" && h.options.AuthCookie {
+		if cookie, err := c.Cookie(accessTokenCookie); err == nil {
+			if !validCSRF(c) {
+				h.log.Error("Authorize(): csrf token is invalid")
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+
+			token = cookie
+		}
+	}
+
 	var (
 		claims jwt.MapClaims
 		user   userservice.UserInterface
@@ -82,25 +418,571 @@ func (h *AuthHandler) Authorize(c *gin.Context) {
 		return
 	}
 
-	if claims["username"] == nil {
-		h.log.Error("Authorize(): claims username not exists")
+	if pending, _ := claims["mfa_pending"].(bool); pending {
+		h.log.Error("Authorize(): mfa token can not be used for authorization")
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
-	if _, ok := claims["username"].(string); !ok {
-		h.log.Error("Authorize(): claims usernamed is not string")
+	// ID tokens pass the audience check when no audience is configured, they
+	// must not grant access whatever it is
+	if use, _ := claims["token_use"].(string); use == idTokenUse {
+		h.log.Error("Authorize(): id token can not be used for authorization")
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
-	if user, err = h.userservice.GetByUsername(claims["username"].(string)); err != nil {
+	// an OAuth client is only granted identity scopes, it can not act as the
+	// user anywhere else
+	if _, ok := claims["client_id"]; ok && !clients {
+		h.log.Error("Authorize(): client token can not be used here")
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	if claims["sub"] == nil {
+		h.log.Error("Authorize(): claims sub not exists")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	sub, ok := claims["sub"].(string)
+	if !ok {
+		h.log.Error("Authorize(): claims sub is not string")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseUint(sub, 10, 64)
+	if err != nil {
+		h.log.WithError(err).Errorf("Authorize(): claims sub is not user id %v", err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if user, err = h.userservice.Get(uint(id)); err != nil {
 		h.log.WithError(err).Errorf("Authorize(): h.userservice.Get error %v", err)
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
+	revoked, err := h.authservice.IsTokenRevoked(claims, user.(*userservice.User).ID)
+	if err != nil {
+		h.log.WithError(err).Errorf("Authorize(): h.authservice.IsTokenRevoked error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if revoked {
+		h.log.Error("Authorize(): token has been revoked")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	// a token of Impersonate stops working once the admin acting as the user
+	// is signed out or no longer allowed to
+	if _, ok = claims["act"]; ok {
+		actor, ok := h.authorizeActor(c, claims)
+		if !ok {
+			return
+		}
+
+		c.Set("actor", actor)
+	}
+
+	if _, ok = claims["sid"]; ok {
+		sessionID, ok := sessionID(claims)
+		if !ok {
+			h.log.Error("Authorize(): claims sid is not session id")
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		if err = h.authservice.TouchSession(sessionID, h.options.SessionTouchInterval); err != nil {
+			h.log.WithError(err).Errorf("Authorize(): h.authservice.TouchSession error %v", err)
+			if errors.Is(err, authservice.ErrSessionNotFound) {
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+
 	c.Set("user", user)
+	c.Set("claims", claims)
 
 	c.Next()
 }
+
+func (h *AuthHandler) authorizeActor(c *gin.Context, claims jwt.MapClaims) (*userservice.User, bool) {
+	id, ok := actorID(claims)
+	if !ok {
+		h.log.Error("Authorize(): claims act is not user id")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	actor, err := h.userservice.Get(id)
+	if err != nil {
+		h.log.WithError(err).Errorf("Authorize(): h.userservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	revoked, err := h.authservice.IsTokenRevoked(claims, id)
+	if err != nil {
+		h.log.WithError(err).Errorf("Authorize(): h.authservice.IsTokenRevoked error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if revoked {
+		h.log.Error("Authorize(): token has been revoked for the actor")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	access, err := h.roleservice.GetUserAccess(id)
+	if err != nil {
+		h.log.WithError(err).Errorf("Authorize(): h.roleservice.GetUserAccess error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if !access.Can(roleservice.PermissionUsersImpersonate) {
+		h.log.Error("Authorize(): actor is no longer allowed to impersonate")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return actor.(*userservice.User), true
+}
+
+func (h *AuthHandler) authorizeAPIKey(c *gin.Context, key string) {
+	apiKey, err := h.apikeyservice.Authenticate(key)
+	if err != nil {
+		h.log.WithError(err).Errorf("Authorize(): h.apikeyservice.Authenticate error %v", err)
+		if errors.Is(err, apikeyservice.ErrKeyInvalid) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.userservice.Get(apiKey.UserID)
+	if err != nil {
+		h.log.WithError(err).Errorf("Authorize(): h.userservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	c.Set("user", user)
+	c.Set("api_key", apiKey)
+
+	c.Next()
+}
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var (
+		req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		claims jwt.MapClaims
+		ok     bool
+	)
+
+	// API keys are not sessions, they are deleted instead
+	if _, ok = c.Get("api_key"); ok {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if claims, ok = c.MustGet("claims").(jwt.MapClaims); !ok {
+		h.log.Error(`Logout(): c.MustGet("claims") is not jwt.MapClaims`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	// the refresh token is optional, so an empty body is accepted
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := h.authservice.RevokeToken(claims); err != nil {
+		h.log.WithError(err).Errorf("Logout(): h.authservice.RevokeToken error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if id, ok := sessionID(claims); ok {
+		if err := h.authservice.RevokeSession(&authservice.Session{ID: id}); err != nil {
+			h.log.WithError(err).Errorf("Logout(): h.authservice.RevokeSession error %v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.RefreshToken == "" && h.options.AuthCookie {
+		req.RefreshToken, _ = c.Cookie(refreshTokenCookie)
+	}
+
+	if req.RefreshToken != "" {
+		if err := h.authservice.RevokeRefreshToken(req.RefreshToken); err != nil && !errors.Is(err, authservice.ErrRefreshTokenInvalid) {
+			h.log.WithError(err).Errorf("Logout(): h.authservice.RevokeRefreshToken error %v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if h.options.AuthCookie {
+		clearAuthCookies(c, h.options)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) RevokeSessions(c *gin.Context) {
+	var (
+		id   int
+		user userservice.UserInterface
+		err  error
+	)
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if user, err = h.userservice.Get(uint(id)); err != nil {
+		h.log.WithError(err).Errorf("RevokeSessions(): h.userservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if !canActOn(c, h.log, h.roleservice, uint(id)) {
+		return
+	}
+
+	if err = h.authservice.RevokeUserTokens(user.(*userservice.User).ID); err != nil {
+		h.log.WithError(err).Errorf("RevokeSessions(): h.authservice.RevokeUserTokens error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RequirePermission only lets requests through when the roles of the current
+// user grant permission, and the API key used, if any, is scoped to it. It has
+// to run after Authorize. Roles are looked up on every request, so a change
+// applies without waiting for tokens to expire.
+func (h *AuthHandler) RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := c.MustGet("user").(*userservice.User)
+		if !ok {
+			h.log.Error(`RequirePermission(): c.MustGet("user") is not *userservice.User`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		access, err := h.roleservice.GetUserAccess(user.ID)
+		if err != nil {
+			h.log.WithError(err).Errorf("RequirePermission(): h.roleservice.GetUserAccess error %v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		// tokens issued to an OAuth client only grant identity scopes
+		if !access.Can(permission) || isClientToken(c) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		if apiKey, ok := c.Get("api_key"); ok && !apiKey.(*apikeyservice.APIKey).Allows(permission) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		c.Set("access", access)
+		c.Next()
+	}
+}
+
+// Impersonate issues a token to act as the user, naming the current user in
+// the act claim. It can not be refreshed, and every one is recorded.
+func (h *AuthHandler) Impersonate(c *gin.Context) {
+	var (
+		actor *userservice.User
+		ok    bool
+		id    int
+		user  userservice.UserInterface
+		err   error
+	)
+
+	if actor, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`Impersonate(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	// neither API keys, OAuth clients nor an impersonation can start one
+	if isDelegated(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if user, err = h.userservice.Get(uint(id)); err != nil {
+		h.log.WithError(err).Errorf("Impersonate(): h.userservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	target := user.(*userservice.User)
+	if target.ID == actor.ID {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	// acting as the user must not grant permissions the actor lacks
+	if !canActOn(c, h.log, h.roleservice, target.ID) {
+		return
+	}
+
+	claims, err := accessClaims(h.roleservice, target)
+	if err != nil {
+		h.log.WithError(err).Errorf("Impersonate(): h.roleservice.GetUserAccess error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	claims["act"] = map[string]interface{}{"sub": strconv.FormatUint(uint64(actor.ID), 10)}
+
+	expiresAt := time.Now().Add(h.options.ImpersonationExpiredIn)
+	if _, err = h.authservice.RecordImpersonation(actor.ID, target.ID, c.ClientIP(), c.Request.UserAgent(), expiresAt); err != nil {
+		h.log.WithError(err).Errorf("Impersonate(): h.authservice.RecordImpersonation error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	token, err := h.authservice.GenerateToken(claims, h.options.ImpersonationExpiredIn)
+	if err != nil {
+		h.log.WithError(err).Errorf("Impersonate(): h.authservice.GenerateToken error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	h.log.WithFields(logrus.Fields{"actor_id": actor.ID, "user_id": target.ID}).Info("Impersonation started")
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "expires_at": expiresAt})
+}
+
+// Impersonations returns the record of every admin who acted as the user.
+func (h *AuthHandler) Impersonations(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	impersonations, err := h.authservice.ListImpersonations(uint(id))
+	if err != nil {
+		h.log.WithError(err).Errorf("Impersonations(): h.authservice.ListImpersonations error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, impersonations)
+}
+
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, h.authservice.JWKS())
+}
+
+func (h *AuthHandler) Unlock(c *gin.Context) {
+	var (
+		id   int
+		user userservice.UserInterface
+		err  error
+	)
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if user, err = h.userservice.Get(uint(id)); err != nil {
+		h.log.WithError(err).Errorf("Unlock(): h.userservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if !canActOn(c, h.log, h.roleservice, uint(id)) {
+		return
+	}
+
+	if err = h.lockoutservice.Unlock(user.(*userservice.User).Username); err != nil {
+		h.log.WithError(err).Errorf("Unlock(): h.lockoutservice.Unlock error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// accessClaims are the claims of an access token for user, including the
+// roles and permissions it grants.
+func accessClaims(roleservice roleservice.RoleServiceInterface, user *userservice.User) (authservice.Claims, error) {
+	access, err := roleservice.GetUserAccess(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := authservice.Claims{}
+	for k, v := range user.GetClaims() {
+		claims[k] = v
+	}
+	claims["roles"] = access.Roles
+	claims["permissions"] = access.Permissions
+
+	return claims, nil
+}
+
+// sessionID returns the session the token is issued for. Tokens issued
+// before sessions were tracked, or to an OAuth client, have none.
+func sessionID(claims jwt.MapClaims) (uint, bool) {
+	sid, ok := claims["sid"].(string)
+	if !ok {
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(sid, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+// actorID is the user id in the act claim of a token of Impersonate.
+func actorID(claims jwt.MapClaims) (uint, bool) {
+	act, ok := claims["act"].(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+
+	sub, ok := act["sub"].(string)
+	if !ok {
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(sub, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+// respondTokens answers with the tokens. In cookie mode they are set as
+// cookies scripts can not read instead, and the CSRF token is answered.
+func respondTokens(c *gin.Context, options config.Options, token string, refreshToken string) error {
+	if !options.AuthCookie {
+		c.JSON(http.StatusOK, gin.H{"token": token, "refresh_token": refreshToken})
+		return nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	csrfToken := base64.RawURLEncoding.EncodeToString(b)
+
+	setCookie(c, options, accessTokenCookie, token, options.JWTExpiredIn, "/", true)
+	setCookie(c, options, refreshTokenCookie, refreshToken, options.JWTRefreshExpiredIn, "/auth", true)
+	setCookie(c, options, csrfTokenCookie, csrfToken, options.JWTRefreshExpiredIn, "/", false)
+
+	c.JSON(http.StatusOK, gin.H{"csrf_token": csrfToken})
+
+	return nil
+}
+
+func clearAuthCookies(c *gin.Context, options config.Options) {
+	setCookie(c, options, accessTokenCookie, "", -1, "/", true)
+	setCookie(c, options, refreshTokenCookie, "", -1, "/auth", true)
+	setCookie(c, options, csrfTokenCookie, "", -1, "/", false)
+}
+
+// setCookie sets a cookie expiring after maxAge, or removes it when maxAge is
+// negative.
+func setCookie(c *gin.Context, options config.Options, name string, value string, maxAge time.Duration, path string, httpOnly bool) {
+	age := int(maxAge.Seconds())
+	if maxAge < 0 {
+		age = -1
+	}
+
+	c.SetSameSite(options.AuthCookieSameSite)
+	c.SetCookie(name, value, age, path, options.AuthCookieDomain, options.AuthCookieSecure, httpOnly)
+}
+
+// validCSRF implements the double submit check: the header has to repeat the
+// CSRF cookie, which only pages of the site can read. Safe methods need no
+// token.
+func validCSRF(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := c.Cookie(csrfTokenCookie)
+	if err != nil || cookie == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(c.GetHeader(csrfTokenHeader))) == 1
+}
+
+// isDelegated tells whether the request is made on behalf of the user by an
+// API key, an OAuth client or an impersonating admin, rather than by the user
+// themselves.
+func isDelegated(c *gin.Context) bool {
+	if _, ok := c.Get("api_key"); ok {
+		return true
+	}
+
+	return isClientToken(c) || isImpersonated(c)
+}
+
+// isImpersonated tells whether the request carries a token of Impersonate.
+func isImpersonated(c *gin.Context) bool {
+	_, ok := c.Get("actor")
+
+	return ok
+}
+
+// isClientToken tells whether the request carries a token issued to an OAuth
+// client.
+func isClientToken(c *gin.Context) bool {
+	claims, ok := c.Get("claims")
+	if !ok {
+		return false
+	}
+
+	mapClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+
+	_, ok = mapClaims["client_id"]
+
+	return ok
+}
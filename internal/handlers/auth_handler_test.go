@@ -10,12 +10,19 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/maetad/baroness-api/internal/config"
 	"github.com/maetad/baroness-api/internal/handlers"
+	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/apikeyservice"
 	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/lockoutservice"
+	"github.com/maetad/baroness-api/internal/services/loginservice"
+	"github.com/maetad/baroness-api/internal/services/mfaservice"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
 	"github.com/maetad/baroness-api/internal/services/userservice"
 	"github.com/maetad/baroness-api/mocks"
 	"github.com/sirupsen/logrus"
@@ -24,10 +31,15 @@ import (
 
 func TestNewAuthHandler(t *testing.T) {
 	type args struct {
-		log         *logrus.Entry
-		options     config.Options
-		authservice authservice.AuthServiceInterface
-		userservice userservice.UserServiceInterface
+		log            *logrus.Entry
+		options        config.Options
+		authservice    authservice.AuthServiceInterface
+		userservice    userservice.UserServiceInterface
+		lockoutservice lockoutservice.LockoutServiceInterface
+		mfaservice     mfaservice.MFAServiceInterface
+		roleservice    roleservice.RoleServiceInterface
+		apikeyservice  apikeyservice.APIKeyServiceInterface
+		loginservice   loginservice.LoginServiceInterface
 	}
 	tests := []struct {
 		name string
@@ -40,7 +52,7 @@ func TestNewAuthHandler(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := handlers.NewAuthHandler(tt.args.log, tt.args.options, tt.args.authservice, tt.args.userservice); reflect.TypeOf(got) != reflect.TypeOf(&handlers.AuthHandler{}) {
+			if got := handlers.NewAuthHandler(tt.args.log, tt.args.options, tt.args.authservice, tt.args.userservice, tt.args.lockoutservice, tt.args.mfaservice, tt.args.roleservice, tt.args.apikeyservice, tt.args.loginservice); reflect.TypeOf(got) != reflect.TypeOf(&handlers.AuthHandler{}) {
 				t.Errorf("New() = %v, want %v", got, tt.want)
 			}
 		})
@@ -51,20 +63,50 @@ func TestAuthHandler_Login(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	type fields struct {
-		log         *logrus.Entry
-		authservice authservice.AuthServiceInterface
-		userservice userservice.UserServiceInterface
-		options     config.Options
+		log            *logrus.Entry
+		authservice    authservice.AuthServiceInterface
+		userservice    userservice.UserServiceInterface
+		lockoutservice lockoutservice.LockoutServiceInterface
+		mfaservice     mfaservice.MFAServiceInterface
+		roleservice    roleservice.RoleServiceInterface
+		apikeyservice  apikeyservice.APIKeyServiceInterface
+		loginservice   loginservice.LoginServiceInterface
+		options        config.Options
 	}
 	type args struct {
 		c *gin.Context
 	}
 
+	lockout := func() *mocks.LockoutServiceInterface {
+		l := &mocks.LockoutServiceInterface{}
+		l.On("Attempt", mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+			Return(time.Duration(0), nil)
+		l.On("RecordFailure", mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+			Return(nil)
+		l.On("RecordSuccess", mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+			Return(nil)
+		l.On("Release", mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+			Return(nil)
+
+		return l
+	}
+
+	session := &authservice.Session{ID: 7}
+
+	roles := func() *mocks.RoleServiceInterface {
+		r := &mocks.RoleServiceInterface{}
+		r.On("GetUserAccess", mock.AnythingOfType("uint")).
+			Return(roleservice.Access{Roles: []string{"admin"}, Permissions: []string{"users.read"}}, nil)
+
+		return r
+	}
+
 	tests := []struct {
-		name   string
-		fields fields
-		args   args
-		want   int
+		name           string
+		fields         fields
+		args           args
+		want           int
+		wantRetryAfter string
 	}{
 		{
 			name: "invalid payload",
@@ -83,18 +125,16 @@ func TestAuthHandler_Login(t *testing.T) {
 			want: http.StatusUnprocessableEntity,
 		},
 		{
-			name: "user not found",
+			name: "count attempt fail",
 			fields: func() fields {
-				userservice := &mocks.UserServiceInterface{}
-				userservice.On("GetByUsername", mock.AnythingOfType("string")).
-					Return(nil, errors.New("user not found"))
+				l := &mocks.LockoutServiceInterface{}
+				l.On("Attempt", "username", mock.AnythingOfType("string")).
+					Return(time.Duration(0), errors.New("count fail"))
 
-				f := fields{
-					log:         logrus.WithContext(context.TODO()),
-					userservice: userservice,
+				return fields{
+					log:            logrus.WithContext(context.TODO()),
+					lockoutservice: l,
 				}
-
-				return f
 			}(),
 			args: func() args {
 				w := httptest.NewRecorder()
@@ -108,22 +148,46 @@ func TestAuthHandler_Login(t *testing.T) {
 
 				return args{c}
 			}(),
-			want: http.StatusUnauthorized,
+			want: http.StatusInternalServerError,
 		},
 		{
-			name: "user password incorrect",
+			name: "account locked",
 			fields: func() fields {
-				user := &mocks.UserInterface{}
-				userservice := &mocks.UserServiceInterface{}
-				user.On("ValidatePassword", mock.AnythingOfType("string")).
-					Return(errors.New("password incorrect"))
+				l := &mocks.LockoutServiceInterface{}
+				l.On("Attempt", "username", mock.AnythingOfType("string")).
+					Return(1500*time.Millisecond, nil)
 
-				userservice.On("GetByUsername", mock.AnythingOfType("string")).
-					Return(user, nil)
+				return fields{
+					log:            logrus.WithContext(context.TODO()),
+					lockoutservice: l,
+				}
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+					Body:   io.NopCloser(strings.NewReader(`{"username":"username","password":"password"}`)),
+				}
+
+				return args{c}
+			}(),
+			want:           http.StatusTooManyRequests,
+			wantRetryAfter: "2",
+		},
+		{
+			name: "credentials invalid",
+			fields: func() fields {
+				login := &mocks.LoginServiceInterface{}
+				login.On("Authenticate", "username", "password").
+					Return(nil, loginservice.ErrCredentialsInvalid)
 
 				f := fields{
-					log:         logrus.WithContext(context.TODO()),
-					userservice: userservice,
+					lockoutservice: lockout(),
+					log:            logrus.WithContext(context.TODO()),
+					loginservice:   login,
 				}
 
 				return f
@@ -143,26 +207,23 @@ func TestAuthHandler_Login(t *testing.T) {
 			want: http.StatusUnauthorized,
 		},
 		{
-			name: "generate token fail",
+			name: "authenticator unavailable",
 			fields: func() fields {
-				user := &userservice.User{
-					Username:    "admin",
-					DisplayName: "administrator",
-				}
-				user.SetPassword("password")
-				userservice := &mocks.UserServiceInterface{}
-				authservice := &mocks.AuthServiceInterface{}
-
-				userservice.On("GetByUsername", mock.AnythingOfType("string")).
-					Return(user, nil)
+				// the directory being down is not a failed attempt
+				l := &mocks.LockoutServiceInterface{}
+				l.On("Attempt", mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+					Return(time.Duration(0), nil)
+				l.On("Release", "username", mock.AnythingOfType("string")).
+					Return(nil)
 
-				authservice.On("GenerateToken", mock.Anything, mock.Anything).
-					Return("", errors.New("generate token fail"))
+				login := &mocks.LoginServiceInterface{}
+				login.On("Authenticate", "username", "password").
+					Return(nil, errors.New("connection refused"))
 
 				f := fields{
-					log:         logrus.WithContext(context.TODO()),
-					userservice: userservice,
-					authservice: authservice,
+					lockoutservice: l,
+					log:            logrus.WithContext(context.TODO()),
+					loginservice:   login,
 				}
 
 				return f
@@ -182,26 +243,26 @@ func TestAuthHandler_Login(t *testing.T) {
 			want: http.StatusInternalServerError,
 		},
 		{
-			name: "logged in",
+			name: "get user access fail",
 			fields: func() fields {
 				user := &userservice.User{
 					Username:    "admin",
 					DisplayName: "administrator",
 				}
-				user.SetPassword("password")
-
-				userservice := &mocks.UserServiceInterface{}
-				authservice := &mocks.AuthServiceInterface{}
 
-				userservice.On("GetByUsername", mock.AnythingOfType("string")).
+				login := &mocks.LoginServiceInterface{}
+				login.On("Authenticate", "username", "password").
 					Return(user, nil)
 
-				authservice.On("GenerateToken", mock.Anything, mock.Anything).
-					Return("token", nil)
+				r := &mocks.RoleServiceInterface{}
+				r.On("GetUserAccess", mock.AnythingOfType("uint")).
+					Return(roleservice.Access{}, errors.New("database error"))
 
 				f := fields{
-					userservice: userservice,
-					authservice: authservice,
+					lockoutservice: lockout(),
+					log:            logrus.WithContext(context.TODO()),
+					loginservice:   login,
+					roleservice:    r,
 				}
 
 				return f
@@ -218,55 +279,29 @@ func TestAuthHandler_Login(t *testing.T) {
 
 				return args{c}
 			}(),
-			want: http.StatusOK,
+			want: http.StatusInternalServerError,
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			h := handlers.NewAuthHandler(
-				tt.fields.log,
-				tt.fields.options,
-				tt.fields.authservice,
-				tt.fields.userservice,
-			)
-			h.Login(tt.args.c)
-
-			if tt.args.c.Writer.Status() != tt.want {
-				t.Errorf("Login() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
-			}
-		})
-	}
-}
-
-func TestAuthHandler_Authorize(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-
-	type fields struct {
-		log         *logrus.Entry
-		options     config.Options
-		authservice authservice.AuthServiceInterface
-		userservice userservice.UserServiceInterface
-	}
-	type args struct {
-		c *gin.Context
-	}
-	tests := []struct {
-		name   string
-		fields fields
-		args   args
-		want   int
-	}{
 		{
-			name: "token invalid",
+			name: "create session fail",
 			fields: func() fields {
-				authservice := &mocks.AuthServiceInterface{}
+				user := &userservice.User{
+					Username:    "admin",
+					DisplayName: "administrator",
+				}
+				login := &mocks.LoginServiceInterface{}
+				login.On("Authenticate", "username", "password").
+					Return(user, nil)
 
-				authservice.On("ParseToken", "jwttoken").
-					Return(nil, errors.New("cannot parse"))
+				authservice := &mocks.AuthServiceInterface{}
+				authservice.On("CreateSession", uint(0), mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+					Return(nil, errors.New("database error"))
 
 				f := fields{
-					log:         logrus.WithContext(context.TODO()),
-					authservice: authservice,
+					lockoutservice: lockout(),
+					log:            logrus.WithContext(context.TODO()),
+					loginservice:   login,
+					authservice:    authservice,
+					roleservice:    roles(),
 				}
 
 				return f
@@ -278,25 +313,37 @@ func TestAuthHandler_Authorize(t *testing.T) {
 				c.Request = &http.Request{
 					URL:    &url.URL{},
 					Header: make(http.Header),
+					Body:   io.NopCloser(strings.NewReader(`{"username":"username","password":"password"}`)),
 				}
 
-				c.Request.Header.Set("Authorization", "Bearer jwttoken")
-
 				return args{c}
 			}(),
-			want: http.StatusUnauthorized,
+			want: http.StatusInternalServerError,
 		},
 		{
-			name: "claim id not exists",
+			name: "generate token fail",
 			fields: func() fields {
+				user := &userservice.User{
+					Username:    "admin",
+					DisplayName: "administrator",
+				}
 				authservice := &mocks.AuthServiceInterface{}
 
-				authservice.On("ParseToken", "jwttoken").
-					Return(jwt.MapClaims{}, nil)
+				login := &mocks.LoginServiceInterface{}
+				login.On("Authenticate", "username", "password").
+					Return(user, nil)
+
+				authservice.On("CreateSession", uint(0), mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+					Return(session, nil)
+				authservice.On("GenerateToken", mock.Anything, mock.Anything).
+					Return("", errors.New("generate token fail"))
 
 				f := fields{
-					log:         logrus.WithContext(context.TODO()),
-					authservice: authservice,
+					lockoutservice: lockout(),
+					log:            logrus.WithContext(context.TODO()),
+					loginservice:   login,
+					authservice:    authservice,
+					roleservice:    roles(),
 				}
 
 				return f
@@ -308,25 +355,39 @@ func TestAuthHandler_Authorize(t *testing.T) {
 				c.Request = &http.Request{
 					URL:    &url.URL{},
 					Header: make(http.Header),
+					Body:   io.NopCloser(strings.NewReader(`{"username":"username","password":"password"}`)),
 				}
 
-				c.Request.Header.Set("Authorization", "Bearer jwttoken")
-
 				return args{c}
 			}(),
-			want: http.StatusUnauthorized,
+			want: http.StatusInternalServerError,
 		},
 		{
-			name: "claim username invalid",
+			name: "generate refresh token fail",
 			fields: func() fields {
+				user := &userservice.User{
+					Username:    "admin",
+					DisplayName: "administrator",
+				}
 				authservice := &mocks.AuthServiceInterface{}
 
-				authservice.On("ParseToken", "jwttoken").
-					Return(jwt.MapClaims{"username": nil}, nil)
+				login := &mocks.LoginServiceInterface{}
+				login.On("Authenticate", "username", "password").
+					Return(user, nil)
+
+				authservice.On("CreateSession", uint(0), mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+					Return(session, nil)
+				authservice.On("GenerateToken", mock.Anything, mock.Anything).
+					Return("token", nil)
+				authservice.On("GenerateRefreshToken", uint(0), uint(7), mock.Anything).
+					Return("", errors.New("generate refresh token fail"))
 
 				f := fields{
-					log:         logrus.WithContext(context.TODO()),
-					authservice: authservice,
+					lockoutservice: lockout(),
+					log:            logrus.WithContext(context.TODO()),
+					loginservice:   login,
+					authservice:    authservice,
+					roleservice:    roles(),
 				}
 
 				return f
@@ -338,30 +399,43 @@ func TestAuthHandler_Authorize(t *testing.T) {
 				c.Request = &http.Request{
 					URL:    &url.URL{},
 					Header: make(http.Header),
+					Body:   io.NopCloser(strings.NewReader(`{"username":"username","password":"password"}`)),
 				}
 
-				c.Request.Header.Set("Authorization", "Bearer jwttoken")
-
 				return args{c}
 			}(),
-			want: http.StatusUnauthorized,
+			want: http.StatusInternalServerError,
 		},
 		{
-			name: "user not found",
+			name: "mfa required",
 			fields: func() fields {
+				user := &userservice.User{
+					Username:    "admin",
+					DisplayName: "administrator",
+					TOTPEnabled: true,
+				}
+
 				authservice := &mocks.AuthServiceInterface{}
 
-				authservice.On("ParseToken", "jwttoken").
-					Return(jwt.MapClaims{"username": "admin"}, nil)
+				// RecordSuccess must wait for the second factor, the correct
+				// password is only taken back
+				l := &mocks.LockoutServiceInterface{}
+				l.On("Attempt", mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+					Return(time.Duration(0), nil)
+				l.On("Release", "username", mock.AnythingOfType("string")).
+					Return(nil)
 
-				u := &mocks.UserServiceInterface{}
-				u.On("GetByUsername", "admin").
-					Return(nil, errors.New("user not found"))
+				login := &mocks.LoginServiceInterface{}
+				login.On("Authenticate", "username", "password").
+					Return(user, nil)
+
+				authservice.On("GenerateToken", mock.AnythingOfType("authservice.Claims"), mock.Anything).
+					Return("mfa-token", nil)
 
 				f := fields{
-					log:         logrus.WithContext(context.TODO()),
-					authservice: authservice,
-					userservice: u,
+					lockoutservice: l,
+					loginservice:   login,
+					authservice:    authservice,
 				}
 
 				return f
@@ -373,30 +447,39 @@ func TestAuthHandler_Authorize(t *testing.T) {
 				c.Request = &http.Request{
 					URL:    &url.URL{},
 					Header: make(http.Header),
+					Body:   io.NopCloser(strings.NewReader(`{"username":"username","password":"password"}`)),
 				}
 
-				c.Request.Header.Set("Authorization", "Bearer jwttoken")
-
 				return args{c}
 			}(),
-			want: http.StatusUnauthorized,
+			want: http.StatusOK,
 		},
 		{
-			name: "token valid",
+			name: "logged in",
 			fields: func() fields {
+				user := &userservice.User{
+					Username:    "admin",
+					DisplayName: "administrator",
+				}
+
 				authservice := &mocks.AuthServiceInterface{}
 
-				authservice.On("ParseToken", "jwttoken").
-					Return(jwt.MapClaims{"username": "admin"}, nil)
+				login := &mocks.LoginServiceInterface{}
+				login.On("Authenticate", "username", "password").
+					Return(user, nil)
 
-				u := &mocks.UserServiceInterface{}
-				u.On("GetByUsername", "admin").
-					Return(&userservice.User{}, nil)
+				authservice.On("CreateSession", uint(0), mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+					Return(session, nil)
+				authservice.On("GenerateToken", mock.Anything, mock.Anything).
+					Return("token", nil)
+				authservice.On("GenerateRefreshToken", uint(0), uint(7), mock.Anything).
+					Return("refresh-token", nil)
 
 				f := fields{
-					log:         logrus.WithContext(context.TODO()),
-					authservice: authservice,
-					userservice: u,
+					lockoutservice: lockout(),
+					loginservice:   login,
+					authservice:    authservice,
+					roleservice:    roles(),
 				}
 
 				return f
@@ -408,10 +491,9 @@ func TestAuthHandler_Authorize(t *testing.T) {
 				c.Request = &http.Request{
 					URL:    &url.URL{},
 					Header: make(http.Header),
+					Body:   io.NopCloser(strings.NewReader(`{"username":"username","password":"password"}`)),
 				}
 
-				c.Request.Header.Set("Authorization", "Bearer jwttoken")
-
 				return args{c}
 			}(),
 			want: http.StatusOK,
@@ -424,11 +506,2400 @@ func TestAuthHandler_Authorize(t *testing.T) {
 				tt.fields.options,
 				tt.fields.authservice,
 				tt.fields.userservice,
+				tt.fields.lockoutservice,
+				tt.fields.mfaservice,
+				tt.fields.roleservice,
+				tt.fields.apikeyservice,
+				tt.fields.loginservice,
 			)
-			h.Authorize(tt.args.c)
+			h.Login(tt.args.c)
 
 			if tt.args.c.Writer.Status() != tt.want {
-				t.Errorf("Authorize() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+				t.Errorf("Login() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+
+			if got := tt.args.c.Writer.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Login() Retry-After = %v, want %v", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_LoginMFA(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type fields struct {
+		log            *logrus.Entry
+		authservice    authservice.AuthServiceInterface
+		userservice    userservice.UserServiceInterface
+		lockoutservice lockoutservice.LockoutServiceInterface
+		mfaservice     mfaservice.MFAServiceInterface
+		roleservice    roleservice.RoleServiceInterface
+		apikeyservice  apikeyservice.APIKeyServiceInterface
+		loginservice   loginservice.LoginServiceInterface
+		options        config.Options
+	}
+	type args struct {
+		c *gin.Context
+	}
+
+	request := func(body string) args {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		c.Request = &http.Request{
+			URL:    &url.URL{},
+			Header: make(http.Header),
+			Body:   io.NopCloser(strings.NewReader(body)),
+		}
+
+		return args{c}
+	}
+
+	claims := jwt.MapClaims{"sub": "1", "mfa_pending": true}
+	user := &userservice.User{Model: model.Model{ID: 1}, Username: "admin", TOTPEnabled: true}
+
+	auth := func() *mocks.AuthServiceInterface {
+		a := &mocks.AuthServiceInterface{}
+		a.On("ParseToken", "mfa-token").
+			Return(claims, nil)
+		a.On("IsTokenRevoked", claims, uint(1)).
+			Return(false, nil)
+
+		return a
+	}
+
+	users := func() *mocks.UserServiceInterface {
+		u := &mocks.UserServiceInterface{}
+		u.On("Get", uint(1)).
+			Return(user, nil)
+
+		return u
+	}
+
+	lockout := func() *mocks.LockoutServiceInterface {
+		l := &mocks.LockoutServiceInterface{}
+		l.On("Attempt", "admin", mock.AnythingOfType("string")).
+			Return(time.Duration(0), nil)
+		l.On("RecordFailure", "admin", mock.AnythingOfType("string")).
+			Return(nil)
+		l.On("RecordSuccess", "admin", mock.AnythingOfType("string")).
+			Return(nil)
+		l.On("Release", "admin", mock.AnythingOfType("string")).
+			Return(nil)
+
+		return l
+	}
+
+	roles := func() *mocks.RoleServiceInterface {
+		r := &mocks.RoleServiceInterface{}
+		r.On("GetUserAccess", mock.AnythingOfType("uint")).
+			Return(roleservice.Access{Roles: []string{"admin"}, Permissions: []string{"users.read"}}, nil)
+
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   int
+	}{
+		{
+			name: "invalid payload",
+			args: request(`{"mfa_token":"mfa-token"}`),
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "token invalid",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("ParseToken", "mfa-token").
+					Return(nil, errors.New("cannot parse"))
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+				}
+			}(),
+			args: request(`{"mfa_token":"mfa-token","code":"123456"}`),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "access token",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("ParseToken", "mfa-token").
+					Return(jwt.MapClaims{"sub": "1"}, nil)
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+				}
+			}(),
+			args: request(`{"mfa_token":"mfa-token","code":"123456"}`),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "user not found",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(nil, errors.New("user not found"))
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: auth(),
+					userservice: u,
+				}
+			}(),
+			args: request(`{"mfa_token":"mfa-token","code":"123456"}`),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "token already used",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("ParseToken", "mfa-token").
+					Return(claims, nil)
+				a.On("IsTokenRevoked", claims, uint(1)).
+					Return(true, nil)
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+					userservice: users(),
+				}
+			}(),
+			args: request(`{"mfa_token":"mfa-token","code":"123456"}`),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "account locked",
+			fields: func() fields {
+				l := &mocks.LockoutServiceInterface{}
+				l.On("Attempt", "admin", mock.AnythingOfType("string")).
+					Return(time.Minute, nil)
+
+				return fields{
+					log:            logrus.WithContext(context.TODO()),
+					authservice:    auth(),
+					userservice:    users(),
+					lockoutservice: l,
+				}
+			}(),
+			args: request(`{"mfa_token":"mfa-token","code":"123456"}`),
+			want: http.StatusTooManyRequests,
+		},
+		{
+			name: "code invalid",
+			fields: func() fields {
+				m := &mocks.MFAServiceInterface{}
+				m.On("Verify", user, "123456").
+					Return(mfaservice.ErrCodeInvalid)
+
+				return fields{
+					log:            logrus.WithContext(context.TODO()),
+					authservice:    auth(),
+					userservice:    users(),
+					lockoutservice: lockout(),
+					mfaservice:     m,
+				}
+			}(),
+			args: request(`{"mfa_token":"mfa-token","code":"123456"}`),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "verify fail",
+			fields: func() fields {
+				m := &mocks.MFAServiceInterface{}
+				m.On("Verify", user, "123456").
+					Return(errors.New("verify fail"))
+
+				return fields{
+					log:            logrus.WithContext(context.TODO()),
+					authservice:    auth(),
+					userservice:    users(),
+					lockoutservice: lockout(),
+					mfaservice:     m,
+				}
+			}(),
+			args: request(`{"mfa_token":"mfa-token","code":"123456"}`),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "token exchanged concurrently",
+			fields: func() fields {
+				a := auth()
+				a.On("ConsumeToken", claims).
+					Return(authservice.ErrTokenInvalid)
+
+				m := &mocks.MFAServiceInterface{}
+				m.On("Verify", user, "123456").
+					Return(nil)
+
+				return fields{
+					log:            logrus.WithContext(context.TODO()),
+					authservice:    a,
+					userservice:    users(),
+					lockoutservice: lockout(),
+					mfaservice:     m,
+				}
+			}(),
+			args: request(`{"mfa_token":"mfa-token","code":"123456"}`),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "consume fail",
+			fields: func() fields {
+				a := auth()
+				a.On("ConsumeToken", claims).
+					Return(errors.New("consume fail"))
+
+				m := &mocks.MFAServiceInterface{}
+				m.On("Verify", user, "123456").
+					Return(nil)
+
+				return fields{
+					log:            logrus.WithContext(context.TODO()),
+					authservice:    a,
+					userservice:    users(),
+					lockoutservice: lockout(),
+					mfaservice:     m,
+				}
+			}(),
+			args: request(`{"mfa_token":"mfa-token","code":"123456"}`),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "logged in",
+			fields: func() fields {
+				a := auth()
+				a.On("ConsumeToken", claims).
+					Return(nil)
+				a.On("CreateSession", uint(1), mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+					Return(&authservice.Session{ID: 7, UserID: 1}, nil)
+				a.On("GenerateToken", authservice.Claims{
+					"sub":          "1",
+					"username":     "admin",
+					"display_name": "",
+					"roles":        []string{"admin"},
+					"permissions":  []string{"users.read"},
+					"sid":          "7",
+				}, mock.Anything).
+					Return("token", nil)
+				a.On("GenerateRefreshToken", uint(1), uint(7), mock.Anything).
+					Return("refresh-token", nil)
+
+				m := &mocks.MFAServiceInterface{}
+				m.On("Verify", user, "123456").
+					Return(nil)
+
+				return fields{
+					log:            logrus.WithContext(context.TODO()),
+					authservice:    a,
+					userservice:    users(),
+					lockoutservice: lockout(),
+					mfaservice:     m,
+					roleservice:    roles(),
+				}
+			}(),
+			args: request(`{"mfa_token":"mfa-token","code":"123456"}`),
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewAuthHandler(
+				tt.fields.log,
+				tt.fields.options,
+				tt.fields.authservice,
+				tt.fields.userservice,
+				tt.fields.lockoutservice,
+				tt.fields.mfaservice,
+				tt.fields.roleservice,
+				tt.fields.apikeyservice,
+				tt.fields.loginservice,
+			)
+			h.LoginMFA(tt.args.c)
+
+			if tt.args.c.Writer.Status() != tt.want {
+				t.Errorf("LoginMFA() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_Refresh(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type fields struct {
+		log            *logrus.Entry
+		options        config.Options
+		authservice    authservice.AuthServiceInterface
+		userservice    userservice.UserServiceInterface
+		lockoutservice lockoutservice.LockoutServiceInterface
+		mfaservice     mfaservice.MFAServiceInterface
+		roleservice    roleservice.RoleServiceInterface
+		apikeyservice  apikeyservice.APIKeyServiceInterface
+		loginservice   loginservice.LoginServiceInterface
+	}
+	type args struct {
+		c *gin.Context
+	}
+
+	newContext := func(body string) args {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		c.Request = &http.Request{
+			URL:    &url.URL{},
+			Header: make(http.Header),
+			Body:   io.NopCloser(strings.NewReader(body)),
+		}
+
+		return args{c}
+	}
+
+	roles := func() *mocks.RoleServiceInterface {
+		r := &mocks.RoleServiceInterface{}
+		r.On("GetUserAccess", mock.AnythingOfType("uint")).
+			Return(roleservice.Access{Roles: []string{"admin"}, Permissions: []string{"users.read"}}, nil)
+
+		return r
+	}
+
+	session := uint(7)
+
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   int
+	}{
+		{
+			name: "invalid payload",
+			args: newContext(`{"token":"refresh"}`),
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "refresh token invalid",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RotateRefreshToken", "refresh", mock.Anything).
+					Return(nil, "", authservice.ErrRefreshTokenInvalid)
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+				}
+			}(),
+			args: newContext(`{"refresh_token":"refresh"}`),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "refresh token reused",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RotateRefreshToken", "refresh", mock.Anything).
+					Return(nil, "", authservice.ErrRefreshTokenReused)
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+				}
+			}(),
+			args: newContext(`{"refresh_token":"refresh"}`),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "rotate fail",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RotateRefreshToken", "refresh", mock.Anything).
+					Return(nil, "", errors.New("database error"))
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+				}
+			}(),
+			args: newContext(`{"refresh_token":"refresh"}`),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "user not found",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RotateRefreshToken", "refresh", mock.Anything).
+					Return(&authservice.RefreshToken{UserID: 1}, "new-refresh", nil)
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(nil, errors.New("user not found"))
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+					userservice: u,
+				}
+			}(),
+			args: newContext(`{"refresh_token":"refresh"}`),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "generate token fail",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RotateRefreshToken", "refresh", mock.Anything).
+					Return(&authservice.RefreshToken{UserID: 1}, "new-refresh", nil)
+				a.On("GenerateToken", mock.Anything, mock.Anything).
+					Return("", errors.New("generate token fail"))
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{}, nil)
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+					userservice: u,
+					roleservice: roles(),
+				}
+			}(),
+			args: newContext(`{"refresh_token":"refresh"}`),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "session revoked",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RotateRefreshToken", "refresh", mock.Anything).
+					Return(&authservice.RefreshToken{UserID: 1, SessionID: &session}, "new-refresh", nil)
+				a.On("TouchSession", session, mock.Anything).
+					Return(authservice.ErrSessionNotFound)
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{}, nil)
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+					userservice: u,
+					roleservice: roles(),
+				}
+			}(),
+			args: newContext(`{"refresh_token":"refresh"}`),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "refreshed without session",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RotateRefreshToken", "refresh", mock.Anything).
+					Return(&authservice.RefreshToken{UserID: 1}, "new-refresh", nil)
+				a.On("GenerateToken", mock.Anything, mock.Anything).
+					Return("token", nil)
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{}, nil)
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+					userservice: u,
+					roleservice: roles(),
+				}
+			}(),
+			args: newContext(`{"refresh_token":"refresh"}`),
+			want: http.StatusOK,
+		},
+		{
+			name: "refreshed",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RotateRefreshToken", "refresh", mock.Anything).
+					Return(&authservice.RefreshToken{UserID: 1, SessionID: &session}, "new-refresh", nil)
+				a.On("TouchSession", session, mock.Anything).
+					Return(nil)
+				a.On("GenerateToken", mock.MatchedBy(func(c authservice.Claims) bool {
+					return c["sid"] == "7"
+				}), mock.Anything).
+					Return("token", nil)
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{}, nil)
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+					userservice: u,
+					roleservice: roles(),
+				}
+			}(),
+			args: newContext(`{"refresh_token":"refresh"}`),
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewAuthHandler(
+				tt.fields.log,
+				tt.fields.options,
+				tt.fields.authservice,
+				tt.fields.userservice,
+				tt.fields.lockoutservice,
+				tt.fields.mfaservice,
+				tt.fields.roleservice,
+				tt.fields.apikeyservice,
+				tt.fields.loginservice,
+			)
+			h.Refresh(tt.args.c)
+
+			if tt.args.c.Writer.Status() != tt.want {
+				t.Errorf("Refresh() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_Authorize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type fields struct {
+		log            *logrus.Entry
+		options        config.Options
+		authservice    authservice.AuthServiceInterface
+		userservice    userservice.UserServiceInterface
+		lockoutservice lockoutservice.LockoutServiceInterface
+		mfaservice     mfaservice.MFAServiceInterface
+		roleservice    roleservice.RoleServiceInterface
+		apikeyservice  apikeyservice.APIKeyServiceInterface
+		loginservice   loginservice.LoginServiceInterface
+	}
+	type args struct {
+		c *gin.Context
+	}
+
+	sessionRevoked := authservice.ErrSessionNotFound
+
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   int
+	}{
+		{
+			name: "token invalid",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(nil, errors.New("cannot parse"))
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "mfa token",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(jwt.MapClaims{"sub": "1", "mfa_pending": true}, nil)
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "id token",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(jwt.MapClaims{"sub": "1", "aud": "first", "token_use": "id"}, nil)
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "claim id not exists",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(jwt.MapClaims{}, nil)
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "claim sub invalid",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(jwt.MapClaims{"sub": nil}, nil)
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "claim sub is not user id",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(jwt.MapClaims{"sub": "admin"}, nil)
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "user not found",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(jwt.MapClaims{"sub": "1"}, nil)
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(nil, errors.New("user not found"))
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+					userservice: u,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "revocation check fail",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(jwt.MapClaims{"sub": "1"}, nil)
+				authservice.On("IsTokenRevoked", mock.Anything, uint(0)).
+					Return(false, errors.New("store error"))
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{}, nil)
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+					userservice: u,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "token revoked",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(jwt.MapClaims{"sub": "1"}, nil)
+				authservice.On("IsTokenRevoked", mock.Anything, uint(0)).
+					Return(true, nil)
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{}, nil)
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+					userservice: u,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "claims sid is not session id",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(jwt.MapClaims{"sub": "1", "sid": "session"}, nil)
+				authservice.On("IsTokenRevoked", mock.Anything, uint(0)).
+					Return(false, nil)
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{}, nil)
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+					userservice: u,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "session revoked",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(jwt.MapClaims{"sub": "1", "sid": "7"}, nil)
+				authservice.On("IsTokenRevoked", mock.Anything, uint(0)).
+					Return(false, nil)
+				authservice.On("TouchSession", uint(7), mock.Anything).
+					Return(sessionRevoked)
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{}, nil)
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+					userservice: u,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "touch session fail",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(jwt.MapClaims{"sub": "1", "sid": "7"}, nil)
+				authservice.On("IsTokenRevoked", mock.Anything, uint(0)).
+					Return(false, nil)
+				authservice.On("TouchSession", uint(7), mock.Anything).
+					Return(errors.New("database error"))
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{}, nil)
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+					userservice: u,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "token valid in session",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(jwt.MapClaims{"sub": "1", "sid": "7"}, nil)
+				authservice.On("IsTokenRevoked", mock.Anything, uint(0)).
+					Return(false, nil)
+				authservice.On("TouchSession", uint(7), mock.Anything).
+					Return(nil)
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{}, nil)
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+					userservice: u,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusOK,
+		},
+		{
+			name: "token valid",
+			fields: func() fields {
+				authservice := &mocks.AuthServiceInterface{}
+
+				authservice.On("ParseToken", "jwttoken").
+					Return(jwt.MapClaims{"sub": "1"}, nil)
+				authservice.On("IsTokenRevoked", mock.Anything, uint(0)).
+					Return(false, nil)
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{}, nil)
+
+				f := fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: authservice,
+					userservice: u,
+				}
+
+				return f
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+				}
+
+				c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+				return args{c}
+			}(),
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewAuthHandler(
+				tt.fields.log,
+				tt.fields.options,
+				tt.fields.authservice,
+				tt.fields.userservice,
+				tt.fields.lockoutservice,
+				tt.fields.mfaservice,
+				tt.fields.roleservice,
+				tt.fields.apikeyservice,
+				tt.fields.loginservice,
+			)
+			h.Authorize(tt.args.c)
+
+			if tt.args.c.Writer.Status() != tt.want {
+				t.Errorf("Authorize() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_AuthorizeAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newContext := func(key string) *gin.Context {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		c.Request = &http.Request{
+			URL:    &url.URL{},
+			Header: make(http.Header),
+		}
+
+		c.Request.Header.Set("X-API-Key", key)
+
+		return c
+	}
+
+	apiKey := &apikeyservice.APIKey{ID: 1, UserID: 1}
+
+	tests := []struct {
+		name          string
+		apikeyservice func() *mocks.APIKeyServiceInterface
+		userservice   func() *mocks.UserServiceInterface
+		want          int
+	}{
+		{
+			name: "key invalid",
+			apikeyservice: func() *mocks.APIKeyServiceInterface {
+				a := &mocks.APIKeyServiceInterface{}
+				a.On("Authenticate", "key").
+					Return(nil, apikeyservice.ErrKeyInvalid)
+
+				return a
+			},
+			userservice: func() *mocks.UserServiceInterface { return nil },
+			want:        http.StatusUnauthorized,
+		},
+		{
+			name: "authenticate fail",
+			apikeyservice: func() *mocks.APIKeyServiceInterface {
+				a := &mocks.APIKeyServiceInterface{}
+				a.On("Authenticate", "key").
+					Return(nil, errors.New("database error"))
+
+				return a
+			},
+			userservice: func() *mocks.UserServiceInterface { return nil },
+			want:        http.StatusInternalServerError,
+		},
+		{
+			name: "owner not found",
+			apikeyservice: func() *mocks.APIKeyServiceInterface {
+				a := &mocks.APIKeyServiceInterface{}
+				a.On("Authenticate", "key").
+					Return(apiKey, nil)
+
+				return a
+			},
+			userservice: func() *mocks.UserServiceInterface {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(nil, errors.New("record not found"))
+
+				return u
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "authorized",
+			apikeyservice: func() *mocks.APIKeyServiceInterface {
+				a := &mocks.APIKeyServiceInterface{}
+				a.On("Authenticate", "key").
+					Return(apiKey, nil)
+
+				return a
+			},
+			userservice: func() *mocks.UserServiceInterface {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{Model: model.Model{ID: 1}}, nil)
+
+				return u
+			},
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newContext("key")
+
+			h := handlers.NewAuthHandler(logrus.WithContext(context.TODO()), config.Options{}, nil, tt.userservice(), nil, nil, nil, tt.apikeyservice(), nil)
+			h.Authorize(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Authorize() = %v, want %v", c.Writer.Status(), tt.want)
+			}
+
+			if _, ok := c.Get("api_key"); ok != (tt.want == http.StatusOK) {
+				t.Errorf("Authorize() api_key set = %v", ok)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type fields struct {
+		log            *logrus.Entry
+		options        config.Options
+		authservice    authservice.AuthServiceInterface
+		userservice    userservice.UserServiceInterface
+		lockoutservice lockoutservice.LockoutServiceInterface
+		mfaservice     mfaservice.MFAServiceInterface
+		roleservice    roleservice.RoleServiceInterface
+		apikeyservice  apikeyservice.APIKeyServiceInterface
+		loginservice   loginservice.LoginServiceInterface
+	}
+	type args struct {
+		c *gin.Context
+	}
+
+	claims := jwt.MapClaims{"jti": "jti", "exp": float64(1000)}
+	newContext := func(body string) args {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		c.Request = &http.Request{
+			URL:    &url.URL{},
+			Header: make(http.Header),
+			Body:   io.NopCloser(strings.NewReader(body)),
+		}
+		c.Set("claims", claims)
+
+		return args{c}
+	}
+
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   int
+	}{
+		{
+			name: "claims invalid",
+			fields: fields{
+				log: logrus.WithContext(context.TODO()),
+			},
+			args: func() args {
+				a := newContext("")
+				a.c.Set("claims", nil)
+
+				return a
+			}(),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "invalid payload",
+			args: newContext(`{"refresh_token":1}`),
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "revoke fail",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RevokeToken", claims).
+					Return(errors.New("revoke fail"))
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+				}
+			}(),
+			args: newContext(""),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "revoke refresh token fail",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RevokeToken", claims).
+					Return(nil)
+				a.On("RevokeRefreshToken", "refresh").
+					Return(errors.New("revoke fail"))
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+				}
+			}(),
+			args: newContext(`{"refresh_token":"refresh"}`),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "logged out",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RevokeToken", claims).
+					Return(nil)
+
+				return fields{
+					authservice: a,
+				}
+			}(),
+			args: newContext(""),
+			want: http.StatusNoContent,
+		},
+		{
+			name: "end session fail",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RevokeToken", mock.Anything).
+					Return(nil)
+				a.On("RevokeSession", &authservice.Session{ID: 7}).
+					Return(errors.New("database error"))
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+				}
+			}(),
+			args: func() args {
+				a := newContext("")
+				a.c.Set("claims", jwt.MapClaims{"jti": "jti", "exp": float64(1000), "sid": "7"})
+
+				return a
+			}(),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "session ended",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RevokeToken", mock.Anything).
+					Return(nil)
+				a.On("RevokeSession", &authservice.Session{ID: 7}).
+					Return(nil)
+
+				return fields{
+					authservice: a,
+				}
+			}(),
+			args: func() args {
+				a := newContext("")
+				a.c.Set("claims", jwt.MapClaims{"jti": "jti", "exp": float64(1000), "sid": "7"})
+
+				return a
+			}(),
+			want: http.StatusNoContent,
+		},
+		{
+			name: "logged out with unknown refresh token",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RevokeToken", claims).
+					Return(nil)
+				a.On("RevokeRefreshToken", "refresh").
+					Return(authservice.ErrRefreshTokenInvalid)
+
+				return fields{
+					authservice: a,
+				}
+			}(),
+			args: newContext(`{"refresh_token":"refresh"}`),
+			want: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewAuthHandler(
+				tt.fields.log,
+				tt.fields.options,
+				tt.fields.authservice,
+				tt.fields.userservice,
+				tt.fields.lockoutservice,
+				tt.fields.mfaservice,
+				tt.fields.roleservice,
+				tt.fields.apikeyservice,
+				tt.fields.loginservice,
+			)
+			h.Logout(tt.args.c)
+
+			if tt.args.c.Writer.Status() != tt.want {
+				t.Errorf("Logout() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_RevokeSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type fields struct {
+		log            *logrus.Entry
+		options        config.Options
+		authservice    authservice.AuthServiceInterface
+		userservice    userservice.UserServiceInterface
+		lockoutservice lockoutservice.LockoutServiceInterface
+		mfaservice     mfaservice.MFAServiceInterface
+		roleservice    roleservice.RoleServiceInterface
+		apikeyservice  apikeyservice.APIKeyServiceInterface
+		loginservice   loginservice.LoginServiceInterface
+	}
+	type args struct {
+		c *gin.Context
+	}
+
+	newContext := func(id string) args {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		c.Request = &http.Request{
+			URL:    &url.URL{},
+			Header: make(http.Header),
+		}
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		c.Set("user", &userservice.User{Model: model.Model{ID: 9}})
+
+		return args{c}
+	}
+
+	admin := withAccess(map[uint][]string{9: {"users.security"}, 1: {}})
+
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   int
+	}{
+		{
+			name: "invalid id",
+			args: newContext("id"),
+			want: http.StatusNotFound,
+		},
+		{
+			name: "user not found",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(nil, errors.New("user not found"))
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					userservice: u,
+				}
+			}(),
+			args: newContext("1"),
+			want: http.StatusNotFound,
+		},
+		{
+			name: "target more privileged",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{Model: model.Model{ID: 1}}, nil)
+
+				return fields{
+					userservice: u,
+					roleservice: withAccess(map[uint][]string{9: {"users.security"}, 1: {"users.security", "roles.update"}}),
+				}
+			}(),
+			args: newContext("1"),
+			want: http.StatusForbidden,
+		},
+		{
+			name: "revoke fail",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{Model: model.Model{ID: 1}}, nil)
+
+				a := &mocks.AuthServiceInterface{}
+				a.On("RevokeUserTokens", uint(1)).
+					Return(errors.New("revoke fail"))
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					authservice: a,
+					userservice: u,
+					roleservice: admin,
+				}
+			}(),
+			args: newContext("1"),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "revoked",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{Model: model.Model{ID: 1}}, nil)
+
+				a := &mocks.AuthServiceInterface{}
+				a.On("RevokeUserTokens", uint(1)).
+					Return(nil)
+
+				return fields{
+					authservice: a,
+					userservice: u,
+					roleservice: admin,
+				}
+			}(),
+			args: newContext("1"),
+			want: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewAuthHandler(
+				tt.fields.log,
+				tt.fields.options,
+				tt.fields.authservice,
+				tt.fields.userservice,
+				tt.fields.lockoutservice,
+				tt.fields.mfaservice,
+				tt.fields.roleservice,
+				tt.fields.apikeyservice,
+				tt.fields.loginservice,
+			)
+			h.RevokeSessions(tt.args.c)
+
+			if tt.args.c.Writer.Status() != tt.want {
+				t.Errorf("RevokeSessions() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_RequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newContext := func(user interface{}) *gin.Context {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		c.Request = &http.Request{
+			URL:    &url.URL{},
+			Header: make(http.Header),
+		}
+
+		c.Set("user", user)
+
+		return c
+	}
+
+	user := &userservice.User{Model: model.Model{ID: 1}}
+
+	withKey := func(scopes ...string) *gin.Context {
+		c := newContext(user)
+		c.Set("api_key", &apikeyservice.APIKey{Scopes: scopes})
+
+		return c
+	}
+
+	access := func(access roleservice.Access, err error) *mocks.RoleServiceInterface {
+		r := &mocks.RoleServiceInterface{}
+		r.On("GetUserAccess", uint(1)).
+			Return(access, err)
+
+		return r
+	}
+
+	tests := []struct {
+		name        string
+		roleservice roleservice.RoleServiceInterface
+		c           *gin.Context
+		want        int
+	}{
+		{
+			name: "current user is incorrect",
+			c:    newContext("user"),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:        "get user access fail",
+			roleservice: access(roleservice.Access{}, errors.New("database error")),
+			c:           newContext(user),
+			want:        http.StatusInternalServerError,
+		},
+		{
+			name:        "permission missing",
+			roleservice: access(roleservice.Access{Permissions: []string{"users.read"}}, nil),
+			c:           newContext(user),
+			want:        http.StatusForbidden,
+		},
+		{
+			name:        "permission granted",
+			roleservice: access(roleservice.Access{Permissions: []string{"users.read", "users.delete"}}, nil),
+			c:           newContext(user),
+			want:        http.StatusOK,
+		},
+		{
+			name:        "api key not scoped",
+			roleservice: access(roleservice.Access{Permissions: []string{"users.read", "users.delete"}}, nil),
+			c:           withKey("users.read"),
+			want:        http.StatusForbidden,
+		},
+		{
+			name:        "api key scoped",
+			roleservice: access(roleservice.Access{Permissions: []string{"users.read", "users.delete"}}, nil),
+			c:           withKey("users.delete"),
+			want:        http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewAuthHandler(logrus.WithContext(context.TODO()), config.Options{}, nil, nil, nil, nil, tt.roleservice, nil, nil)
+			h.RequirePermission(roleservice.PermissionUsersDelete)(tt.c)
+			tt.c.Writer.WriteHeaderNow()
+
+			if tt.c.Writer.Status() != tt.want {
+				t.Errorf("RequirePermission() = %v, want %v", tt.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_JWKS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	a := &mocks.AuthServiceInterface{}
+	a.On("JWKS").Return(authservice.JSONWebKeySet{
+		Keys: []authservice.JSONWebKey{{Kty: "RSA", Kid: "kid"}},
+	})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = &http.Request{
+		URL:    &url.URL{},
+		Header: make(http.Header),
+	}
+
+	h := handlers.NewAuthHandler(logrus.WithContext(context.TODO()), config.Options{}, a, nil, nil, nil, nil, nil, nil)
+	h.JWKS(c)
+
+	if c.Writer.Status() != http.StatusOK {
+		t.Errorf("JWKS() = %v, want %v", c.Writer.Status(), http.StatusOK)
+	}
+
+	if want := `{"keys":[{"kty":"RSA","kid":"kid"}]}`; w.Body.String() != want {
+		t.Errorf("JWKS() body = %v, want %v", w.Body.String(), want)
+	}
+}
+
+func TestAuthHandler_Unlock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type fields struct {
+		log            *logrus.Entry
+		options        config.Options
+		authservice    authservice.AuthServiceInterface
+		userservice    userservice.UserServiceInterface
+		lockoutservice lockoutservice.LockoutServiceInterface
+		mfaservice     mfaservice.MFAServiceInterface
+		roleservice    roleservice.RoleServiceInterface
+		apikeyservice  apikeyservice.APIKeyServiceInterface
+		loginservice   loginservice.LoginServiceInterface
+	}
+	type args struct {
+		c *gin.Context
+	}
+
+	newContext := func(id string) args {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		c.Request = &http.Request{
+			URL:    &url.URL{},
+			Header: make(http.Header),
+		}
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		c.Set("user", &userservice.User{Model: model.Model{ID: 9}})
+
+		return args{c}
+	}
+
+	admin := withAccess(map[uint][]string{9: {"users.security"}, 1: {}})
+
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   int
+	}{
+		{
+			name: "invalid id",
+			args: newContext("id"),
+			want: http.StatusNotFound,
+		},
+		{
+			name: "user not found",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(nil, errors.New("user not found"))
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					userservice: u,
+				}
+			}(),
+			args: newContext("1"),
+			want: http.StatusNotFound,
+		},
+		{
+			name: "target more privileged",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{Username: "admin"}, nil)
+
+				return fields{
+					userservice: u,
+					roleservice: withAccess(map[uint][]string{9: {"users.security"}, 1: {"users.security", "roles.update"}}),
+				}
+			}(),
+			args: newContext("1"),
+			want: http.StatusForbidden,
+		},
+		{
+			name: "unlock fail",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{Username: "admin"}, nil)
+
+				l := &mocks.LockoutServiceInterface{}
+				l.On("Unlock", "admin").
+					Return(errors.New("unlock fail"))
+
+				return fields{
+					log:            logrus.WithContext(context.TODO()),
+					userservice:    u,
+					roleservice:    admin,
+					lockoutservice: l,
+				}
+			}(),
+			args: newContext("1"),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "unlocked",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).
+					Return(&userservice.User{Username: "admin"}, nil)
+
+				l := &mocks.LockoutServiceInterface{}
+				l.On("Unlock", "admin").
+					Return(nil)
+
+				return fields{
+					userservice:    u,
+					roleservice:    admin,
+					lockoutservice: l,
+				}
+			}(),
+			args: newContext("1"),
+			want: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewAuthHandler(
+				tt.fields.log,
+				tt.fields.options,
+				tt.fields.authservice,
+				tt.fields.userservice,
+				tt.fields.lockoutservice,
+				tt.fields.mfaservice,
+				tt.fields.roleservice,
+				tt.fields.apikeyservice,
+				tt.fields.loginservice,
+			)
+			h.Unlock(tt.args.c)
+
+			if tt.args.c.Writer.Status() != tt.want {
+				t.Errorf("Unlock() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_LoginCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &userservice.User{Model: model.Model{ID: 1}, Username: "admin"}
+	options := config.Options{
+		AuthCookie:          true,
+		AuthCookieSecure:    true,
+		AuthCookieSameSite:  http.SameSiteStrictMode,
+		JWTExpiredIn:        time.Minute,
+		JWTRefreshExpiredIn: time.Hour,
+	}
+
+	l := &mocks.LockoutServiceInterface{}
+	l.On("Attempt", "admin", mock.AnythingOfType("string")).
+		Return(time.Duration(0), nil)
+	l.On("RecordSuccess", "admin", mock.AnythingOfType("string")).
+		Return(nil)
+
+	login := &mocks.LoginServiceInterface{}
+	login.On("Authenticate", "admin", "password").
+		Return(user, nil)
+
+	r := &mocks.RoleServiceInterface{}
+	r.On("GetUserAccess", uint(1)).
+		Return(roleservice.Access{Roles: []string{"user"}}, nil)
+
+	a := &mocks.AuthServiceInterface{}
+	a.On("CreateSession", uint(1), mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+		Return(&authservice.Session{ID: 7, UserID: 1}, nil)
+	a.On("GenerateToken", mock.Anything, time.Minute).
+		Return("token", nil)
+	a.On("GenerateRefreshToken", uint(1), uint(7), time.Hour).
+		Return("refresh-token", nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = &http.Request{
+		URL:    &url.URL{},
+		Header: make(http.Header),
+		Body:   io.NopCloser(strings.NewReader(`{"username":"admin","password":"password"}`)),
+	}
+
+	h := handlers.NewAuthHandler(logrus.WithContext(context.TODO()), options, a, nil, l, nil, r, nil, login)
+	h.Login(c)
+
+	if c.Writer.Status() != http.StatusOK {
+		t.Fatalf("Login() = %v, want %v", c.Writer.Status(), http.StatusOK)
+	}
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	access, refresh, csrf := cookies["access_token"], cookies["refresh_token"], cookies["csrf_token"]
+	if access == nil || access.Value != "token" || !access.HttpOnly || !access.Secure || access.SameSite != http.SameSiteStrictMode || access.MaxAge != 60 {
+		t.Errorf("Login() access token cookie = %+v", access)
+	}
+
+	if refresh == nil || refresh.Value != "refresh-token" || !refresh.HttpOnly || refresh.Path != "/auth" || refresh.MaxAge != 3600 {
+		t.Errorf("Login() refresh token cookie = %+v", refresh)
+	}
+
+	if csrf == nil || csrf.Value == "" || csrf.HttpOnly {
+		t.Errorf("Login() csrf token cookie = %+v", csrf)
+	}
+
+	if strings.Contains(w.Body.String(), "refresh-token") || !strings.Contains(w.Body.String(), csrf.Value) {
+		t.Errorf("Login() body = %v, want only the csrf token", w.Body.String())
+	}
+}
+
+func TestAuthHandler_AuthorizeCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newContext := func(method string, csrfCookie string, csrfHeader string) *gin.Context {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		c.Request = &http.Request{
+			Method: method,
+			URL:    &url.URL{},
+			Header: make(http.Header),
+		}
+		c.Request.AddCookie(&http.Cookie{Name: "access_token", Value: "jwttoken"})
+		if csrfCookie != "" {
+			c.Request.AddCookie(&http.Cookie{Name: "csrf_token", Value: csrfCookie})
+		}
+		if csrfHeader != "" {
+			c.Request.Header.Set("X-CSRF-Token", csrfHeader)
+		}
+
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		options config.Options
+		c       *gin.Context
+		want    int
+	}{
+		{
+			name: "cookie mode disabled",
+			c:    newContext(http.MethodGet, "", ""),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:    "safe method without csrf token",
+			options: config.Options{AuthCookie: true},
+			c:       newContext(http.MethodGet, "", ""),
+			want:    http.StatusOK,
+		},
+		{
+			name:    "csrf token missing",
+			options: config.Options{AuthCookie: true},
+			c:       newContext(http.MethodPost, "csrf", ""),
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "csrf token mismatch",
+			options: config.Options{AuthCookie: true},
+			c:       newContext(http.MethodPost, "csrf", "other"),
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "csrf token repeated",
+			options: config.Options{AuthCookie: true},
+			c:       newContext(http.MethodPost, "csrf", "csrf"),
+			want:    http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &mocks.AuthServiceInterface{}
+			a.On("ParseToken", "jwttoken").
+				Return(jwt.MapClaims{"sub": "1"}, nil)
+			a.On("ParseToken", "").
+				Return(nil, errors.New("token contains an invalid number of segments"))
+			a.On("IsTokenRevoked", mock.Anything, uint(0)).
+				Return(false, nil)
+
+			u := &mocks.UserServiceInterface{}
+			u.On("Get", uint(1)).
+				Return(&userservice.User{}, nil)
+
+			h := handlers.NewAuthHandler(logrus.WithContext(context.TODO()), tt.options, a, u, nil, nil, nil, nil, nil)
+			h.Authorize(tt.c)
+
+			if tt.c.Writer.Status() != tt.want {
+				t.Errorf("Authorize() = %v, want %v", tt.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_RefreshCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	options := config.Options{AuthCookie: true, JWTRefreshExpiredIn: time.Hour}
+
+	tests := []struct {
+		name       string
+		csrfHeader string
+		want       int
+	}{
+		{
+			name: "csrf token missing",
+			want: http.StatusForbidden,
+		},
+		{
+			name:       "refreshed",
+			csrfHeader: "csrf",
+			want:       http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &mocks.AuthServiceInterface{}
+			a.On("RotateRefreshToken", "refresh", time.Hour).
+				Return(&authservice.RefreshToken{UserID: 1}, "new-refresh", nil)
+			a.On("GenerateToken", mock.Anything, mock.Anything).
+				Return("token", nil)
+
+			u := &mocks.UserServiceInterface{}
+			u.On("Get", uint(1)).
+				Return(&userservice.User{}, nil)
+
+			r := &mocks.RoleServiceInterface{}
+			r.On("GetUserAccess", mock.AnythingOfType("uint")).
+				Return(roleservice.Access{}, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Method: http.MethodPost,
+				URL:    &url.URL{},
+				Header: make(http.Header),
+				Body:   io.NopCloser(strings.NewReader("")),
+			}
+			c.Request.AddCookie(&http.Cookie{Name: "refresh_token", Value: "refresh"})
+			c.Request.AddCookie(&http.Cookie{Name: "csrf_token", Value: "csrf"})
+			if tt.csrfHeader != "" {
+				c.Request.Header.Set("X-CSRF-Token", tt.csrfHeader)
+			}
+
+			h := handlers.NewAuthHandler(logrus.WithContext(context.TODO()), options, a, u, nil, nil, r, nil, nil)
+			h.Refresh(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Refresh() = %v, want %v", c.Writer.Status(), tt.want)
+				return
+			}
+
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			for _, cookie := range w.Result().Cookies() {
+				if cookie.Name == "refresh_token" && cookie.Value == "new-refresh" {
+					return
+				}
+			}
+
+			t.Errorf("Refresh() cookies = %v, want the rotated refresh token", w.Result().Cookies())
+		})
+	}
+}
+
+func TestAuthHandler_LogoutCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	claims := jwt.MapClaims{"jti": "jti", "exp": float64(1000)}
+
+	a := &mocks.AuthServiceInterface{}
+	a.On("RevokeToken", claims).
+		Return(nil)
+	a.On("RevokeRefreshToken", "refresh").
+		Return(nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = &http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{},
+		Header: make(http.Header),
+		Body:   io.NopCloser(strings.NewReader("")),
+	}
+	c.Request.AddCookie(&http.Cookie{Name: "refresh_token", Value: "refresh"})
+	c.Set("claims", claims)
+
+	h := handlers.NewAuthHandler(logrus.WithContext(context.TODO()), config.Options{AuthCookie: true}, a, nil, nil, nil, nil, nil, nil)
+	h.Logout(c)
+	c.Writer.WriteHeaderNow()
+
+	if c.Writer.Status() != http.StatusNoContent {
+		t.Fatalf("Logout() = %v, want %v", c.Writer.Status(), http.StatusNoContent)
+	}
+
+	a.AssertCalled(t, "RevokeRefreshToken", "refresh")
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge >= 0 || cookie.Value != "" {
+			t.Errorf("Logout() cookie %v = %+v, want removed", cookie.Name, cookie)
+		}
+	}
+
+	if len(w.Result().Cookies()) != 3 {
+		t.Errorf("Logout() cookies = %v, want 3 removed", w.Result().Cookies())
+	}
+}
+
+func TestAuthHandler_Impersonate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	options := config.Options{ImpersonationExpiredIn: 15 * time.Minute}
+	admin := &userservice.User{Model: model.Model{ID: 1}}
+	adminAccess := roleservice.Access{Roles: []string{"admin"}, Permissions: []string{"users.read", "users.impersonate"}}
+
+	newContext := func(user interface{}, id string) (*gin.Context, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		c.Request = &http.Request{
+			URL:    &url.URL{},
+			Header: make(http.Header),
+		}
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		c.Set("user", user)
+
+		return c, w
+	}
+
+	users := func() *mocks.UserServiceInterface {
+		u := &mocks.UserServiceInterface{}
+		u.On("Get", uint(2)).
+			Return(&userservice.User{Model: model.Model{ID: 2}, Username: "user"}, nil)
+		u.On("Get", uint(3)).
+			Return(nil, errors.New("record not found"))
+		u.On("Get", uint(1)).
+			Return(admin, nil)
+
+		return u
+	}
+
+	roles := func(targetAccess roleservice.Access) func() *mocks.RoleServiceInterface {
+		return func() *mocks.RoleServiceInterface {
+			r := &mocks.RoleServiceInterface{}
+			r.On("GetUserAccess", uint(1)).
+				Return(adminAccess, nil)
+			r.On("GetUserAccess", uint(2)).
+				Return(targetAccess, nil)
+
+			return r
+		}
+	}
+
+	recorded := func(err error) func() *mocks.AuthServiceInterface {
+		return func() *mocks.AuthServiceInterface {
+			a := &mocks.AuthServiceInterface{}
+			a.On("RecordImpersonation", uint(1), uint(2), "", "", mock.AnythingOfType("time.Time")).
+				Return(&authservice.Impersonation{ID: 1}, err)
+			a.On("GenerateToken", mock.MatchedBy(func(claims authservice.Claims) bool {
+				act, _ := claims["act"].(map[string]interface{})
+				return claims["sub"] == "2" && act["sub"] == "1"
+			}), 15*time.Minute).
+				Return("jwttoken", nil)
+
+			return a
+		}
+	}
+
+	userAccess := roleservice.Access{Roles: []string{"user"}, Permissions: []string{"users.read"}}
+
+	tests := []struct {
+		name        string
+		authservice func() *mocks.AuthServiceInterface
+		roleservice func() *mocks.RoleServiceInterface
+		user        interface{}
+		actor       bool
+		id          string
+		want        int
+	}{
+		{
+			name:        "current user is incorrect",
+			authservice: func() *mocks.AuthServiceInterface { return nil },
+			roleservice: func() *mocks.RoleServiceInterface { return nil },
+			user:        "user",
+			id:          "2",
+			want:        http.StatusUnauthorized,
+		},
+		{
+			name:        "already impersonating",
+			authservice: func() *mocks.AuthServiceInterface { return nil },
+			roleservice: func() *mocks.RoleServiceInterface { return nil },
+			user:        admin,
+			actor:       true,
+			id:          "2",
+			want:        http.StatusForbidden,
+		},
+		{
+			name:        "user not found",
+			authservice: func() *mocks.AuthServiceInterface { return nil },
+			roleservice: func() *mocks.RoleServiceInterface { return nil },
+			user:        admin,
+			id:          "3",
+			want:        http.StatusNotFound,
+		},
+		{
+			name:        "impersonate themselves",
+			authservice: func() *mocks.AuthServiceInterface { return nil },
+			roleservice: func() *mocks.RoleServiceInterface { return nil },
+			user:        admin,
+			id:          "1",
+			want:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "user has permissions the actor lacks",
+			authservice: func() *mocks.AuthServiceInterface { return nil },
+			roleservice: roles(roleservice.Access{Permissions: []string{"users.read", "roles.delete"}}),
+			user:        admin,
+			id:          "2",
+			want:        http.StatusForbidden,
+		},
+		{
+			name:        "record fail",
+			authservice: recorded(errors.New("database error")),
+			roleservice: roles(userAccess),
+			user:        admin,
+			id:          "2",
+			want:        http.StatusInternalServerError,
+		},
+		{
+			name:        "impersonation started",
+			authservice: recorded(nil),
+			roleservice: roles(userAccess),
+			user:        admin,
+			id:          "2",
+			want:        http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := newContext(tt.user, tt.id)
+			if tt.actor {
+				c.Set("actor", &userservice.User{Model: model.Model{ID: 4}})
+			}
+
+			h := handlers.NewAuthHandler(logrus.WithContext(context.TODO()), options, tt.authservice(), users(), nil, nil, tt.roleservice(), nil, nil)
+			h.Impersonate(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Impersonate() = %v, want %v", c.Writer.Status(), tt.want)
+				return
+			}
+
+			if tt.want == http.StatusOK && !strings.Contains(w.Body.String(), `"token":"jwttoken"`) {
+				t.Errorf("Impersonate() body = %v", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthHandler_AuthorizeImpersonation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	claims := func(act interface{}) jwt.MapClaims {
+		return jwt.MapClaims{"sub": "2", "act": act}
+	}
+
+	tests := []struct {
+		name      string
+		claims    jwt.MapClaims
+		revoked   bool
+		access    roleservice.Access
+		want      int
+		wantActor bool
+	}{
+		{
+			name:   "act is not a user",
+			claims: claims(map[string]interface{}{"sub": "admin"}),
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "actor not found",
+			claims: claims(map[string]interface{}{"sub": "3"}),
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:    "actor signed out",
+			claims:  claims(map[string]interface{}{"sub": "1"}),
+			revoked: true,
+			access:  roleservice.Access{Permissions: []string{"users.impersonate"}},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:   "actor no longer allowed",
+			claims: claims(map[string]interface{}{"sub": "1"}),
+			access: roleservice.Access{Permissions: []string{"users.read"}},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:      "both identities set",
+			claims:    claims(map[string]interface{}{"sub": "1"}),
+			access:    roleservice.Access{Permissions: []string{"users.impersonate"}},
+			want:      http.StatusOK,
+			wantActor: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			c.Request = &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+			a := &mocks.AuthServiceInterface{}
+			a.On("ParseToken", "jwttoken").
+				Return(tt.claims, nil)
+			a.On("IsTokenRevoked", tt.claims, uint(2)).
+				Return(false, nil)
+			a.On("IsTokenRevoked", tt.claims, uint(1)).
+				Return(tt.revoked, nil)
+
+			u := &mocks.UserServiceInterface{}
+			u.On("Get", uint(2)).
+				Return(&userservice.User{Model: model.Model{ID: 2}}, nil)
+			u.On("Get", uint(1)).
+				Return(&userservice.User{Model: model.Model{ID: 1}}, nil)
+			u.On("Get", uint(3)).
+				Return(nil, errors.New("record not found"))
+
+			r := &mocks.RoleServiceInterface{}
+			r.On("GetUserAccess", uint(1)).
+				Return(tt.access, nil)
+
+			h := handlers.NewAuthHandler(logrus.WithContext(context.TODO()), config.Options{}, a, u, nil, nil, r, nil, nil)
+			h.Authorize(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Authorize() = %v, want %v", c.Writer.Status(), tt.want)
+				return
+			}
+
+			if _, ok := c.Get("actor"); ok != tt.wantActor {
+				t.Errorf("Authorize() actor set = %v, want %v", ok, tt.wantActor)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_AuthorizeClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		client bool
+		want   int
+	}{
+		{
+			name:   "client token refused",
+			claims: jwt.MapClaims{"sub": "1", "client_id": "third", "scope": "openid"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "client token for a client endpoint",
+			claims: jwt.MapClaims{"sub": "1", "client_id": "third", "scope": "openid"},
+			client: true,
+			want:   http.StatusOK,
+		},
+		{
+			name:   "first party token for a client endpoint",
+			claims: jwt.MapClaims{"sub": "1"},
+			client: true,
+			want:   http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			c.Request = &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			c.Request.Header.Set("Authorization", "Bearer jwttoken")
+
+			a := &mocks.AuthServiceInterface{}
+			a.On("ParseToken", "jwttoken").
+				Return(tt.claims, nil)
+			a.On("IsTokenRevoked", tt.claims, uint(1)).
+				Return(false, nil)
+
+			u := &mocks.UserServiceInterface{}
+			u.On("Get", uint(1)).
+				Return(&userservice.User{Model: model.Model{ID: 1}}, nil)
+
+			h := handlers.NewAuthHandler(logrus.WithContext(context.TODO()), config.Options{}, a, u, nil, nil, nil, nil, nil)
+			if tt.client {
+				h.AuthorizeClient(c)
+			} else {
+				h.Authorize(c)
+			}
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Authorize() = %v, want %v", c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_Impersonations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		id   string
+		err  error
+		want int
+	}{
+		{
+			name: "id is not int",
+			id:   "two",
+			want: http.StatusNotFound,
+		},
+		{
+			name: "list fail",
+			id:   "2",
+			err:  errors.New("database error"),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "impersonations found",
+			id:   "2",
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			c.Request = &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			c.Params = gin.Params{{Key: "id", Value: tt.id}}
+
+			a := &mocks.AuthServiceInterface{}
+			a.On("ListImpersonations", uint(2)).
+				Return([]authservice.Impersonation{{ID: 1}}, tt.err)
+
+			h := handlers.NewAuthHandler(logrus.WithContext(context.TODO()), config.Options{}, a, nil, nil, nil, nil, nil, nil)
+			h.Impersonations(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Impersonations() = %v, want %v", c.Writer.Status(), tt.want)
 			}
 		})
 	}
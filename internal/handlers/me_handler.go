@@ -2,22 +2,32 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/maetad/baroness-api/internal/config"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
 	"github.com/maetad/baroness-api/internal/services/userservice"
 	"github.com/sirupsen/logrus"
 )
 
 type MeHandler struct {
 	log         *logrus.Entry
+	options     config.Options
+	authservice authservice.AuthServiceInterface
 	userservice userservice.UserServiceInterface
+	roleservice roleservice.RoleServiceInterface
 }
 
 func NewMeHandler(
 	log *logrus.Entry,
+	options config.Options,
+	authservice authservice.AuthServiceInterface,
 	userservice userservice.UserServiceInterface,
+	roleservice roleservice.RoleServiceInterface,
 ) *MeHandler {
-	return &MeHandler{log, userservice}
+	return &MeHandler{log, options, authservice, userservice, roleservice}
 }
 
 func (h *MeHandler) Get(c *gin.Context) {
@@ -53,12 +63,116 @@ func (h *MeHandler) Update(c *gin.Context) {
 		return
 	}
 
+	if r.Password != "" && !h.options.MePasswordUpdate {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"errors": []userservice.PasswordViolation{
+			{Field: "password", Rule: "not_allowed", Message: "password can only be changed with PUT /me/password"},
+		}})
+		return
+	}
+
+	// neither an admin acting as the user nor an API key or OAuth client
+	// may take over the account
+	if r.Password != "" && isDelegated(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
 	u, err := h.userservice.Update(user, r)
 	if err != nil {
 		h.log.WithError(err).Errorf("Update(): h.userservice.Update error %v", err)
+		if abortOnPasswordPolicy(c, err) {
+			return
+		}
+
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
 	c.JSON(http.StatusOK, u)
 }
+
+// ChangePassword requires the current password, so a stolen token alone can
+// not take over the account. Every other session is signed out and the
+// caller gets a fresh pair of tokens.
+func (h *MeHandler) ChangePassword(c *gin.Context) {
+	var (
+		user *userservice.User
+		r    userservice.UserChangePasswordRequest
+		ok   bool
+	)
+
+	if user, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`ChangePassword(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	// neither an admin acting as the user nor an API key or OAuth client
+	// may take over the account
+	if isDelegated(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := user.ValidatePassword(r.CurrentPassword); err != nil {
+		h.log.WithError(err).Errorf("ChangePassword(): user.ValidatePassword error %v", err)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	if err := h.userservice.ChangePassword(user, r.Password); err != nil {
+		h.log.WithError(err).Errorf("ChangePassword(): h.userservice.ChangePassword error %v", err)
+		if abortOnPasswordPolicy(c, err) {
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.authservice.RevokeUserTokens(user.ID); err != nil {
+		h.log.WithError(err).Errorf("ChangePassword(): h.authservice.RevokeUserTokens error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	claims, err := accessClaims(h.roleservice, user)
+	if err != nil {
+		h.log.WithError(err).Errorf("ChangePassword(): h.roleservice.GetUserAccess error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// every session has ended, this device continues in a new one
+	session, err := h.authservice.CreateSession(user.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		h.log.WithError(err).Errorf("ChangePassword(): h.authservice.CreateSession error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	claims["sid"] = strconv.FormatUint(uint64(session.ID), 10)
+
+	token, err := h.authservice.GenerateToken(claims, h.options.JWTExpiredIn)
+	if err != nil {
+		h.log.WithError(err).Errorf("ChangePassword(): h.authservice.GenerateToken error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := h.authservice.GenerateRefreshToken(user.ID, session.ID, h.options.JWTRefreshExpiredIn)
+	if err != nil {
+		h.log.WithError(err).Errorf("ChangePassword(): h.authservice.GenerateRefreshToken error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err = respondTokens(c, h.options, token, refreshToken); err != nil {
+		h.log.WithError(err).Errorf("ChangePassword(): respondTokens error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
@@ -2,6 +2,7 @@ package handlers_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
@@ -9,13 +10,21 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/maetad/baroness-api/internal/config"
 	"github.com/maetad/baroness-api/internal/handlers"
+	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/apikeyservice"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
 	"github.com/maetad/baroness-api/internal/services/userservice"
 	"github.com/maetad/baroness-api/mocks"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
 )
 
 func TestMeHandler_Get(t *testing.T) {
@@ -79,7 +88,7 @@ func TestMeHandler_Get(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			h := handlers.NewMeHandler(tt.fields.log, tt.fields.userservice)
+			h := handlers.NewMeHandler(tt.fields.log, config.Options{}, nil, tt.fields.userservice, nil)
 			h.Get(tt.args.c)
 
 			if tt.args.c.Writer.Status() != tt.want {
@@ -92,6 +101,7 @@ func TestMeHandler_Get(t *testing.T) {
 func TestMeHandler_Update(t *testing.T) {
 	type fields struct {
 		log         *logrus.Entry
+		options     config.Options
 		userservice userservice.UserServiceInterface
 	}
 	type args struct {
@@ -119,6 +129,7 @@ func TestMeHandler_Update(t *testing.T) {
 
 				return fields{
 					log:         logrus.WithContext(context.TODO()),
+					options:     config.Options{MePasswordUpdate: true},
 					userservice: u,
 				}
 			}(),
@@ -138,6 +149,79 @@ func TestMeHandler_Update(t *testing.T) {
 			}(),
 			want: http.StatusOK,
 		},
+		{
+			name: "me update password not allowed",
+			fields: func() fields {
+				return fields{
+					log: logrus.WithContext(context.TODO()),
+				}
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+					Body:   io.NopCloser(strings.NewReader(`{"display_name":"display_name","password":"password"}`)),
+				}
+
+				c.Set("user", &userservice.User{})
+
+				return args{c}
+			}(),
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "me update password impersonated",
+			fields: func() fields {
+				return fields{
+					log:     logrus.WithContext(context.TODO()),
+					options: config.Options{MePasswordUpdate: true},
+				}
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+					Body:   io.NopCloser(strings.NewReader(`{"display_name":"display_name","password":"password"}`)),
+				}
+
+				c.Set("user", &userservice.User{})
+				c.Set("actor", &userservice.User{Model: model.Model{ID: 2}})
+
+				return args{c}
+			}(),
+			want: http.StatusForbidden,
+		},
+		{
+			name: "me update password with api key",
+			fields: func() fields {
+				return fields{
+					log:     logrus.WithContext(context.TODO()),
+					options: config.Options{MePasswordUpdate: true},
+				}
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+					Body:   io.NopCloser(strings.NewReader(`{"display_name":"display_name","password":"password"}`)),
+				}
+
+				c.Set("user", &userservice.User{})
+				c.Set("api_key", &apikeyservice.APIKey{})
+
+				return args{c}
+			}(),
+			want: http.StatusForbidden,
+		},
 		{
 			name: "current user is incorrect",
 			fields: func() fields {
@@ -197,6 +281,7 @@ func TestMeHandler_Update(t *testing.T) {
 
 				return fields{
 					log:         logrus.WithContext(context.TODO()),
+					options:     config.Options{MePasswordUpdate: true},
 					userservice: u,
 				}
 			}(),
@@ -219,7 +304,7 @@ func TestMeHandler_Update(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			h := handlers.NewMeHandler(tt.fields.log, tt.fields.userservice)
+			h := handlers.NewMeHandler(tt.fields.log, tt.fields.options, nil, tt.fields.userservice, nil)
 			h.Update(tt.args.c)
 		})
 
@@ -228,3 +313,233 @@ func TestMeHandler_Update(t *testing.T) {
 		}
 	}
 }
+
+func TestMeHandler_ChangePassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type fields struct {
+		authservice authservice.AuthServiceInterface
+		userservice userservice.UserServiceInterface
+		roleservice roleservice.RoleServiceInterface
+	}
+	type args struct {
+		c *gin.Context
+	}
+
+	request := func(user interface{}, body string) args {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		c.Request = &http.Request{
+			URL:    &url.URL{},
+			Header: make(http.Header),
+			Body:   io.NopCloser(strings.NewReader(body)),
+		}
+
+		c.Set("user", user)
+
+		return args{c}
+	}
+
+	user := func() *userservice.User {
+		u := &userservice.User{Model: model.Model{ID: 1}}
+		u.SetPassword("password")
+
+		return u
+	}
+
+	changed := func() *mocks.UserServiceInterface {
+		u := &mocks.UserServiceInterface{}
+		u.On("ChangePassword", mock.AnythingOfType("*userservice.User"), "n3w-Password").
+			Return(nil)
+
+		return u
+	}
+
+	body := `{"current_password":"password","password":"n3w-Password"}`
+
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   int
+	}{
+		{
+			name: "current user is incorrect",
+			args: request("1", body),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "impersonated",
+			args: func() args {
+				a := request(user(), body)
+				a.c.Set("actor", &userservice.User{Model: model.Model{ID: 2}})
+
+				return a
+			}(),
+			want: http.StatusForbidden,
+		},
+		{
+			name: "invalid payload",
+			args: request(user(), `{"password":"n3w-Password"}`),
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "current password incorrect",
+			args: request(user(), `{"current_password":"Password","password":"n3w-Password"}`),
+			want: http.StatusForbidden,
+		},
+		{
+			name: "password policy",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("ChangePassword", mock.AnythingOfType("*userservice.User"), "n3w-Password").
+					Return(&userservice.PasswordPolicyError{})
+
+				return fields{userservice: u}
+			}(),
+			args: request(user(), body),
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "change password fail",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("ChangePassword", mock.AnythingOfType("*userservice.User"), "n3w-Password").
+					Return(errors.New("save fail"))
+
+				return fields{userservice: u}
+			}(),
+			args: request(user(), body),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "revoke sessions fail",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RevokeUserTokens", uint(1)).
+					Return(errors.New("revoke fail"))
+
+				return fields{a, changed(), nil}
+			}(),
+			args: request(user(), body),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "password changed",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RevokeUserTokens", uint(1)).
+					Return(nil)
+				a.On("CreateSession", uint(1), mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+					Return(&authservice.Session{ID: 7, UserID: 1}, nil)
+				a.On("GenerateToken", mock.AnythingOfType("authservice.Claims"), mock.Anything).
+					Return("token", nil)
+				a.On("GenerateRefreshToken", uint(1), uint(7), mock.Anything).
+					Return("refresh-token", nil)
+
+				r := &mocks.RoleServiceInterface{}
+				r.On("GetUserAccess", uint(1)).
+					Return(roleservice.Access{Roles: []string{"user"}}, nil)
+
+				return fields{a, changed(), r}
+			}(),
+			args: request(user(), body),
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewMeHandler(logrus.WithContext(context.TODO()), config.Options{}, tt.fields.authservice, tt.fields.userservice, tt.fields.roleservice)
+			h.ChangePassword(tt.args.c)
+
+			if tt.args.c.Writer.Status() != tt.want {
+				t.Errorf("ChangePassword() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+// the token answered for the device which changed the password is issued
+// after the revocation of the others, within the same second
+func TestMeHandler_ChangePasswordTokenAuthorized(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &userservice.User{Model: model.Model{ID: 1}}
+	user.SetPassword("password")
+
+	db := &mocks.DatabaseInterface{}
+	db.On("Find", mock.AnythingOfType("*[]authservice.RefreshToken"), "user_id = ? AND revoked_at IS NULL", uint(1)).
+		Return(&gorm.DB{})
+	db.On("Delete", mock.AnythingOfType("*authservice.Session"), "user_id = ?", uint(1)).
+		Return(&gorm.DB{})
+	db.On("Create", mock.AnythingOfType("*authservice.Session")).
+		Run(func(args mock.Arguments) {
+			args.Get(0).(*authservice.Session).ID = 7
+		}).
+		Return(&gorm.DB{})
+	db.On("Create", mock.AnythingOfType("*authservice.RefreshToken")).
+		Return(&gorm.DB{})
+	db.On("First", mock.AnythingOfType("*authservice.Session"), "id = ?", uint(7)).
+		Run(func(args mock.Arguments) {
+			*args.Get(0).(*authservice.Session) = authservice.Session{ID: 7, UserID: 1, LastSeenAt: time.Now()}
+		}).
+		Return(&gorm.DB{})
+
+	auth := authservice.New(
+		db,
+		authservice.NewMemoryRevocationStore(),
+		authservice.NewKeyring(authservice.NewSigningKey(jwt.SigningMethodHS256, []byte("signing-key"), nil), time.Minute),
+		authservice.AllowSigningMethod{HMAC: true},
+		"",
+		nil,
+	)
+
+	u := &mocks.UserServiceInterface{}
+	u.On("ChangePassword", user, "n3w-Password").
+		Return(nil)
+	u.On("Get", uint(1)).
+		Return(user, nil)
+
+	r := &mocks.RoleServiceInterface{}
+	r.On("GetUserAccess", uint(1)).
+		Return(roleservice.Access{Roles: []string{"user"}}, nil)
+
+	options := config.Options{JWTExpiredIn: time.Minute, SessionTouchInterval: time.Minute}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = &http.Request{
+		URL:    &url.URL{},
+		Header: make(http.Header),
+		Body:   io.NopCloser(strings.NewReader(`{"current_password":"password","password":"n3w-Password"}`)),
+	}
+	c.Set("user", user)
+
+	handlers.NewMeHandler(logrus.WithContext(context.TODO()), options, auth, u, r).ChangePassword(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("ChangePassword() = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var tokens struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+		t.Fatal(err)
+	}
+
+	authHandler := handlers.NewAuthHandler(logrus.WithContext(context.TODO()), options, auth, u, nil, nil, r, nil, nil)
+	router := gin.New()
+	router.GET("/me", authHandler.Authorize, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.Token)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Authorize() with the token of ChangePassword() = %v, want %v", w.Code, http.StatusOK)
+	}
+}
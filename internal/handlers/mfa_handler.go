@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maetad/baroness-api/internal/services/mfaservice"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/sirupsen/logrus"
+)
+
+type MFAHandler struct {
+	log         *logrus.Entry
+	mfaservice  mfaservice.MFAServiceInterface
+	userservice userservice.UserServiceInterface
+	roleservice roleservice.RoleServiceInterface
+}
+
+func NewMFAHandler(
+	log *logrus.Entry,
+	mfaservice mfaservice.MFAServiceInterface,
+	userservice userservice.UserServiceInterface,
+	roleservice roleservice.RoleServiceInterface,
+) *MFAHandler {
+	return &MFAHandler{log, mfaservice, userservice, roleservice}
+}
+
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	var (
+		user *userservice.User
+		ok   bool
+	)
+
+	if user, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`Enroll(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	// only the user can change how they sign in, not an API key, an
+	// OAuth client or an admin acting as them
+	if isDelegated(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	enrollment, err := h.mfaservice.Enroll(user)
+	if err != nil {
+		h.log.WithError(err).Errorf("Enroll(): h.mfaservice.Enroll error %v", err)
+		if errors.Is(err, mfaservice.ErrAlreadyEnabled) {
+			c.AbortWithStatus(http.StatusConflict)
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	var (
+		user *userservice.User
+		req  struct {
+			Code string `json:"code" binding:"required"`
+		}
+		ok bool
+	)
+
+	if user, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`Confirm(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if isDelegated(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	codes, err := h.mfaservice.Confirm(user, req.Code)
+	if err != nil {
+		h.log.WithError(err).Errorf("Confirm(): h.mfaservice.Confirm error %v", err)
+		switch {
+		case errors.Is(err, mfaservice.ErrAlreadyEnabled), errors.Is(err, mfaservice.ErrNotEnrolled):
+			c.AbortWithStatus(http.StatusConflict)
+		case errors.Is(err, mfaservice.ErrCodeInvalid):
+			c.AbortWithStatus(http.StatusUnprocessableEntity)
+		default:
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// Disable turns off two-factor authentication for the current user, who has
+// to prove they still hold the second factor.
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var (
+		user *userservice.User
+		req  struct {
+			Code string `json:"code" binding:"required"`
+		}
+		ok bool
+	)
+
+	if user, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`Disable(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if isDelegated(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := h.mfaservice.Verify(user, req.Code); err != nil {
+		h.log.WithError(err).Errorf("Disable(): h.mfaservice.Verify error %v", err)
+		switch {
+		case errors.Is(err, mfaservice.ErrNotEnrolled):
+			c.AbortWithStatus(http.StatusConflict)
+		case errors.Is(err, mfaservice.ErrCodeInvalid):
+			c.AbortWithStatus(http.StatusUnprocessableEntity)
+		default:
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := h.mfaservice.Disable(user); err != nil {
+		h.log.WithError(err).Errorf("Disable(): h.mfaservice.Disable error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Reset turns off two-factor authentication for a user who lost both their
+// authenticator and recovery codes.
+func (h *MFAHandler) Reset(c *gin.Context) {
+	var (
+		id   int
+		user userservice.UserInterface
+		err  error
+	)
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if user, err = h.userservice.Get(uint(id)); err != nil {
+		h.log.WithError(err).Errorf("Reset(): h.userservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if !canActOn(c, h.log, h.roleservice, uint(id)) {
+		return
+	}
+
+	if err = h.mfaservice.Disable(user); err != nil {
+		h.log.WithError(err).Errorf("Reset(): h.mfaservice.Disable error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
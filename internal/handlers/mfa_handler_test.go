@@ -0,0 +1,366 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maetad/baroness-api/internal/handlers"
+	"github.com/maetad/baroness-api/internal/services/apikeyservice"
+	"github.com/maetad/baroness-api/internal/services/mfaservice"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+)
+
+func mfaContext(user interface{}, body string) *gin.Context {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	c.Request = &http.Request{
+		URL:    &url.URL{},
+		Header: make(http.Header),
+		Body:   io.NopCloser(strings.NewReader(body)),
+	}
+
+	c.Set("user", user)
+
+	return c
+}
+
+// mfaKeyContext is mfaContext authorized by an API key.
+func mfaKeyContext(body string) *gin.Context {
+	c := mfaContext(&userservice.User{}, body)
+	c.Set("api_key", &apikeyservice.APIKey{})
+
+	return c
+}
+
+func TestMFAHandler_Enroll(t *testing.T) {
+	type fields struct {
+		mfaservice mfaservice.MFAServiceInterface
+	}
+	type args struct {
+		c *gin.Context
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   int
+	}{
+		{
+			name: "current user is incorrect",
+			args: args{mfaContext("1", "")},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "api key",
+			args: args{mfaKeyContext("")},
+			want: http.StatusForbidden,
+		},
+		{
+			name: "already enabled",
+			fields: func() fields {
+				m := &mocks.MFAServiceInterface{}
+				m.On("Enroll", mock.AnythingOfType("*userservice.User")).
+					Return(mfaservice.Enrollment{}, mfaservice.ErrAlreadyEnabled)
+
+				return fields{m}
+			}(),
+			args: args{mfaContext(&userservice.User{}, "")},
+			want: http.StatusConflict,
+		},
+		{
+			name: "enroll fail",
+			fields: func() fields {
+				m := &mocks.MFAServiceInterface{}
+				m.On("Enroll", mock.AnythingOfType("*userservice.User")).
+					Return(mfaservice.Enrollment{}, errors.New("enroll fail"))
+
+				return fields{m}
+			}(),
+			args: args{mfaContext(&userservice.User{}, "")},
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "enrolled",
+			fields: func() fields {
+				m := &mocks.MFAServiceInterface{}
+				m.On("Enroll", mock.AnythingOfType("*userservice.User")).
+					Return(mfaservice.Enrollment{Secret: "secret", URI: "otpauth://totp/admin?secret=secret"}, nil)
+
+				return fields{m}
+			}(),
+			args: args{mfaContext(&userservice.User{}, "")},
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewMFAHandler(logrus.WithContext(context.TODO()), tt.fields.mfaservice, nil, nil)
+			h.Enroll(tt.args.c)
+
+			if tt.args.c.Writer.Status() != tt.want {
+				t.Errorf("Enroll() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMFAHandler_Confirm(t *testing.T) {
+	type fields struct {
+		mfaservice mfaservice.MFAServiceInterface
+	}
+	type args struct {
+		c *gin.Context
+	}
+
+	confirm := func(err error) fields {
+		m := &mocks.MFAServiceInterface{}
+		m.On("Confirm", mock.AnythingOfType("*userservice.User"), "123456").
+			Return([]string{"abcd-efgh"}, err)
+
+		return fields{m}
+	}
+
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   int
+	}{
+		{
+			name: "current user is incorrect",
+			args: args{mfaContext("1", `{"code":"123456"}`)},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "invalid payload",
+			args: args{mfaContext(&userservice.User{}, `{}`)},
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "api key",
+			args: args{mfaKeyContext(`{"code":"123456"}`)},
+			want: http.StatusForbidden,
+		},
+		{
+			name:   "not enrolled",
+			fields: confirm(mfaservice.ErrNotEnrolled),
+			args:   args{mfaContext(&userservice.User{}, `{"code":"123456"}`)},
+			want:   http.StatusConflict,
+		},
+		{
+			name:   "code invalid",
+			fields: confirm(mfaservice.ErrCodeInvalid),
+			args:   args{mfaContext(&userservice.User{}, `{"code":"123456"}`)},
+			want:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "confirm fail",
+			fields: confirm(errors.New("confirm fail")),
+			args:   args{mfaContext(&userservice.User{}, `{"code":"123456"}`)},
+			want:   http.StatusInternalServerError,
+		},
+		{
+			name:   "confirmed",
+			fields: confirm(nil),
+			args:   args{mfaContext(&userservice.User{}, `{"code":"123456"}`)},
+			want:   http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewMFAHandler(logrus.WithContext(context.TODO()), tt.fields.mfaservice, nil, nil)
+			h.Confirm(tt.args.c)
+
+			if tt.args.c.Writer.Status() != tt.want {
+				t.Errorf("Confirm() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMFAHandler_Disable(t *testing.T) {
+	type fields struct {
+		mfaservice mfaservice.MFAServiceInterface
+	}
+	type args struct {
+		c *gin.Context
+	}
+
+	disable := func(verifyErr error, disableErr error) fields {
+		m := &mocks.MFAServiceInterface{}
+		m.On("Verify", mock.AnythingOfType("*userservice.User"), "123456").
+			Return(verifyErr)
+		m.On("Disable", mock.AnythingOfType("*userservice.User")).
+			Return(disableErr)
+
+		return fields{m}
+	}
+
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   int
+	}{
+		{
+			name: "current user is incorrect",
+			args: args{mfaContext("1", `{"code":"123456"}`)},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "invalid payload",
+			args: args{mfaContext(&userservice.User{}, `{}`)},
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "api key",
+			args: args{mfaKeyContext(`{"code":"123456"}`)},
+			want: http.StatusForbidden,
+		},
+		{
+			name:   "not enrolled",
+			fields: disable(mfaservice.ErrNotEnrolled, nil),
+			args:   args{mfaContext(&userservice.User{}, `{"code":"123456"}`)},
+			want:   http.StatusConflict,
+		},
+		{
+			name:   "code invalid",
+			fields: disable(mfaservice.ErrCodeInvalid, nil),
+			args:   args{mfaContext(&userservice.User{}, `{"code":"123456"}`)},
+			want:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "disable fail",
+			fields: disable(nil, errors.New("disable fail")),
+			args:   args{mfaContext(&userservice.User{}, `{"code":"123456"}`)},
+			want:   http.StatusInternalServerError,
+		},
+		{
+			name:   "disabled",
+			fields: disable(nil, nil),
+			args:   args{mfaContext(&userservice.User{}, `{"code":"123456"}`)},
+			want:   http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewMFAHandler(logrus.WithContext(context.TODO()), tt.fields.mfaservice, nil, nil)
+			h.Disable(tt.args.c)
+
+			if tt.args.c.Writer.Status() != tt.want {
+				t.Errorf("Disable() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMFAHandler_Reset(t *testing.T) {
+	type fields struct {
+		mfaservice  mfaservice.MFAServiceInterface
+		userservice userservice.UserServiceInterface
+		roleservice roleservice.RoleServiceInterface
+	}
+	type args struct {
+		c *gin.Context
+	}
+
+	admin := withAccess(map[uint][]string{0: {"users.security"}, 2: {}})
+
+	reset := func(id string) args {
+		c := mfaContext(&userservice.User{}, "")
+		c.Params = []gin.Param{{Key: "id", Value: id}}
+
+		return args{c}
+	}
+
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   int
+	}{
+		{
+			name: "invalid id",
+			args: reset("abc"),
+			want: http.StatusNotFound,
+		},
+		{
+			name: "user not found",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(2)).
+					Return(nil, errors.New("user not found"))
+
+				return fields{userservice: u}
+			}(),
+			args: reset("2"),
+			want: http.StatusNotFound,
+		},
+		{
+			name: "target more privileged",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(2)).
+					Return(&userservice.User{}, nil)
+
+				return fields{nil, u, withAccess(map[uint][]string{0: {"users.security"}, 2: {"users.security", "roles.update"}})}
+			}(),
+			args: reset("2"),
+			want: http.StatusForbidden,
+		},
+		{
+			name: "disable fail",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(2)).
+					Return(&userservice.User{}, nil)
+
+				m := &mocks.MFAServiceInterface{}
+				m.On("Disable", mock.AnythingOfType("*userservice.User")).
+					Return(errors.New("disable fail"))
+
+				return fields{m, u, admin}
+			}(),
+			args: reset("2"),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "reset",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(2)).
+					Return(&userservice.User{}, nil)
+
+				m := &mocks.MFAServiceInterface{}
+				m.On("Disable", mock.AnythingOfType("*userservice.User")).
+					Return(nil)
+
+				return fields{m, u, admin}
+			}(),
+			args: reset("2"),
+			want: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewMFAHandler(logrus.WithContext(context.TODO()), tt.fields.mfaservice, tt.fields.userservice, tt.fields.roleservice)
+			h.Reset(tt.args.c)
+
+			if tt.args.c.Writer.Status() != tt.want {
+				t.Errorf("Reset() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/maetad/baroness-api/internal/config"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/oauthservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/sirupsen/logrus"
+)
+
+// idTokenUse marks ID tokens, which are signed like access tokens but only
+// tell the client who signed in.
+const idTokenUse = "id"
+
+type OAuthHandler struct {
+	log          *logrus.Entry
+	options      config.Options
+	authservice  authservice.AuthServiceInterface
+	userservice  userservice.UserServiceInterface
+	oauthservice oauthservice.OAuthServiceInterface
+}
+
+func NewOAuthHandler(
+	log *logrus.Entry,
+	options config.Options,
+	authservice authservice.AuthServiceInterface,
+	userservice userservice.UserServiceInterface,
+	oauthservice oauthservice.OAuthServiceInterface,
+) *OAuthHandler {
+	return &OAuthHandler{log, options, authservice, userservice, oauthservice}
+}
+
+func (h *OAuthHandler) Discovery(c *gin.Context) {
+	issuer := h.options.OAuthIssuerURL
+
+	algorithms := []string{}
+	if h.options.JWTSigningMethod != nil {
+		algorithms = append(algorithms, h.options.JWTSigningMethod.Alg())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                issuer,
+		"authorization_endpoint":                h.options.OAuthAuthorizeURL,
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": algorithms,
+		"scopes_supported":                      oauthservice.SupportedScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "preferred_username", "name", "email", "email_verified"},
+	})
+}
+
+// Authorize is called by the login page on behalf of the signed in user. It
+// answers with the redirect_uri to send the browser to, carrying either the
+// code or an error, or asks for consent when a third party client requests
+// scopes the user has not agreed to yet.
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	var (
+		user *userservice.User
+		ok   bool
+		r    oauthservice.AuthorizeRequest
+	)
+
+	if user, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`Authorize(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if isDelegated(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	// without a known client and redirect URI there is nowhere safe to
+	// redirect the error to
+	client, err := h.oauthservice.GetClientByClientID(r.ClientID)
+	if err != nil {
+		h.log.WithError(err).Errorf("Authorize(): h.oauthservice.GetClientByClientID error %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_client"})
+		return
+	}
+
+	if !client.HasRedirectURI(r.RedirectURI) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "redirect_uri is not registered"})
+		return
+	}
+
+	if r.ResponseType != "code" {
+		h.redirect(c, r, url.Values{"error": {"unsupported_response_type"}})
+		return
+	}
+
+	if r.CodeChallenge == "" || r.CodeChallengeMethod != "S256" {
+		h.redirect(c, r, url.Values{"error": {"invalid_request"}, "error_description": {"code_challenge with S256 is required"}})
+		return
+	}
+
+	scope, err := oauthservice.ParseScope(r.Scope)
+	if err != nil {
+		h.redirect(c, r, url.Values{"error": {"invalid_scope"}})
+		return
+	}
+
+	if !client.FirstParty {
+		consented, err := h.oauthservice.HasConsent(user.ID, client, scope)
+		if err != nil {
+			h.log.WithError(err).Errorf("Authorize(): h.oauthservice.HasConsent error %v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		if !consented && !r.Consent {
+			c.JSON(http.StatusOK, gin.H{
+				"consent_required": true,
+				"client":           client.Name,
+				"scope":            scope,
+			})
+			return
+		}
+
+		if !consented {
+			if err = h.oauthservice.GrantConsent(user.ID, client, scope); err != nil {
+				h.log.WithError(err).Errorf("Authorize(): h.oauthservice.GrantConsent error %v", err)
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	code, err := h.oauthservice.CreateCode(user.ID, client, r)
+	if err != nil {
+		h.log.WithError(err).Errorf("Authorize(): h.oauthservice.CreateCode error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	h.redirect(c, r, url.Values{"code": {code}})
+}
+
+// Token exchanges an authorization code, RFC 6749 section 4.1.3.
+func (h *OAuthHandler) Token(c *gin.Context) {
+	var r oauthservice.TokenRequest
+
+	c.Header("Cache-Control", "no-store")
+
+	if err := c.ShouldBind(&r); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+		return
+	}
+
+	if r.GrantType != "authorization_code" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
+		return
+	}
+
+	clientID, secret := r.ClientID, r.ClientSecret
+	if id, s, ok := c.Request.BasicAuth(); ok {
+		clientID, secret = id, s
+	}
+
+	client, err := h.oauthservice.GetClientByClientID(clientID)
+	if err != nil {
+		h.log.WithError(err).Errorf("Token(): h.oauthservice.GetClientByClientID error %v", err)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return
+	}
+
+	if err = h.oauthservice.AuthenticateClient(client, secret); err != nil {
+		h.log.WithError(err).Errorf("Token(): h.oauthservice.AuthenticateClient error %v", err)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return
+	}
+
+	code, err := h.oauthservice.ExchangeCode(client, r.Code, r.RedirectURI, r.CodeVerifier)
+	if err != nil {
+		h.log.WithError(err).Errorf("Token(): h.oauthservice.ExchangeCode error %v", err)
+		if errors.Is(err, oauthservice.ErrCodeReused) {
+			h.revokeCodeToken(code)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+			return
+		}
+
+		if errors.Is(err, oauthservice.ErrCodeInvalid) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	u, err := h.userservice.Get(code.UserID)
+	if err != nil {
+		h.log.WithError(err).Errorf("Token(): h.userservice.Get error %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+
+	user := u.(*userservice.User)
+	scope := strings.Fields(code.Scope)
+
+	claims := authservice.Claims{}
+	for k, v := range user.GetClaims() {
+		claims[k] = v
+	}
+	claims["client_id"] = client.ClientID
+	claims["scope"] = code.Scope
+
+	token, err := h.authservice.GenerateToken(claims, h.options.JWTExpiredIn)
+	if err != nil {
+		h.log.WithError(err).Errorf("Token(): h.authservice.GenerateToken error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	tokenClaims, err := h.authservice.ParseToken(token)
+	if err != nil {
+		h.log.WithError(err).Errorf("Token(): h.authservice.ParseToken error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	jti, _ := tokenClaims["jti"].(string)
+	exp, _ := tokenClaims["exp"].(float64)
+	if err = h.oauthservice.AttachToken(code, jti, time.Unix(int64(exp), 0)); err != nil {
+		h.log.WithError(err).Errorf("Token(): h.oauthservice.AttachToken error %v", err)
+		if errors.Is(err, oauthservice.ErrCodeReused) {
+			if err = h.authservice.RevokeToken(tokenClaims); err != nil {
+				h.log.WithError(err).Errorf("Token(): h.authservice.RevokeToken error %v", err)
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	res := gin.H{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(h.options.JWTExpiredIn.Seconds()),
+		"scope":        code.Scope,
+	}
+
+	if contains(scope, oauthservice.ScopeOpenID) {
+		idClaims := authservice.Claims{}
+		for k, v := range userInfo(user, scope) {
+			idClaims[k] = v
+		}
+		idClaims["aud"] = client.ClientID
+		idClaims["azp"] = client.ClientID
+		idClaims["token_use"] = idTokenUse
+		if h.options.OAuthIssuerURL != "" {
+			idClaims["iss"] = h.options.OAuthIssuerURL
+		}
+		if code.Nonce != "" {
+			idClaims["nonce"] = code.Nonce
+		}
+
+		idToken, err := h.authservice.GenerateToken(idClaims, h.options.OAuthIDTokenExpiredIn)
+		if err != nil {
+			h.log.WithError(err).Errorf("Token(): h.authservice.GenerateToken error %v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		res["id_token"] = idToken
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// UserInfo returns the claims the token has been granted. Tokens which were
+// not issued to an OAuth client see every claim.
+func (h *OAuthHandler) UserInfo(c *gin.Context) {
+	var (
+		user *userservice.User
+		ok   bool
+	)
+
+	if user, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`UserInfo(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	scope := oauthservice.SupportedScopes
+	if claims, ok := c.Get("claims"); ok {
+		if s, ok := claims.(jwt.MapClaims)["scope"].(string); ok {
+			scope = strings.Fields(s)
+		}
+	}
+
+	c.JSON(http.StatusOK, userInfo(user, scope))
+}
+
+func (h *OAuthHandler) ListClients(c *gin.Context) {
+	clients, err := h.oauthservice.ListClients()
+	if err != nil {
+		h.log.WithError(err).Errorf("ListClients(): h.oauthservice.ListClients error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, clients)
+}
+
+// CreateClient registers a client. The secret of a confidential client is
+// only returned once.
+func (h *OAuthHandler) CreateClient(c *gin.Context) {
+	var r oauthservice.ClientCreateRequest
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	client, secret, err := h.oauthservice.CreateClient(r)
+	if err != nil {
+		h.log.WithError(err).Errorf("CreateClient(): h.oauthservice.CreateClient error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	res := gin.H{"client": client}
+	if secret != "" {
+		res["client_secret"] = secret
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (h *OAuthHandler) GetClient(c *gin.Context) {
+	var (
+		id  int
+		err error
+	)
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	client, err := h.oauthservice.GetClient(uint(id))
+	if err != nil {
+		h.log.WithError(err).Errorf("GetClient(): h.oauthservice.GetClient error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, client)
+}
+
+func (h *OAuthHandler) DeleteClient(c *gin.Context) {
+	var (
+		id     int
+		err    error
+		client *oauthservice.Client
+	)
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if client, err = h.oauthservice.GetClient(uint(id)); err != nil {
+		h.log.WithError(err).Errorf("DeleteClient(): h.oauthservice.GetClient error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if err = h.oauthservice.DeleteClient(client); err != nil {
+		h.log.WithError(err).Errorf("DeleteClient(): h.oauthservice.DeleteClient error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// redirect answers with the redirect_uri of r carrying params and the state.
+func (h *OAuthHandler) redirect(c *gin.Context, r oauthservice.AuthorizeRequest, params url.Values) {
+	u, err := url.Parse(r.RedirectURI)
+	if err != nil {
+		h.log.WithError(err).Errorf("redirect(): url.Parse error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if r.State != "" {
+		q.Set("state", r.State)
+	}
+	u.RawQuery = q.Encode()
+
+	c.JSON(http.StatusOK, gin.H{"redirect_uri": u.String()})
+}
+
+// userInfo are the standard claims of user released by scope.
+func userInfo(user *userservice.User, scope []string) map[string]interface{} {
+	info := map[string]interface{}{
+		"sub": strconv.FormatUint(uint64(user.ID), 10),
+	}
+
+	if contains(scope, oauthservice.ScopeProfile) {
+		info["preferred_username"] = user.Username
+		info["name"] = user.DisplayName
+	}
+
+	if contains(scope, oauthservice.ScopeEmail) && user.Email != "" {
+		info["email"] = user.Email
+		info["email_verified"] = false
+	}
+
+	return info
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// revokeCodeToken revokes the access token issued from a code which has been
+// redeemed again, as the code has probably leaked.
+func (h *OAuthHandler) revokeCodeToken(code *oauthservice.AuthorizationCode) {
+	if code == nil || code.TokenJTI == "" || code.TokenExpiresAt == nil {
+		return
+	}
+
+	claims := jwt.MapClaims{"jti": code.TokenJTI, "exp": float64(code.TokenExpiresAt.Unix())}
+	if err := h.authservice.RevokeToken(claims); err != nil {
+		h.log.WithError(err).Errorf("revokeCodeToken(): h.authservice.RevokeToken error %v", err)
+	}
+}
@@ -0,0 +1,477 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/maetad/baroness-api/internal/config"
+	"github.com/maetad/baroness-api/internal/handlers"
+	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/apikeyservice"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/oauthservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+)
+
+func newOAuthContext(user interface{}, body string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	c.Request = &http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{},
+		Header: make(http.Header),
+		Body:   io.NopCloser(strings.NewReader(body)),
+	}
+
+	if user != nil {
+		c.Set("user", user)
+	}
+
+	return c, w
+}
+
+func TestOAuthHandler_Discovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, w := newOAuthContext(nil, "")
+
+	h := handlers.NewOAuthHandler(logrus.WithContext(context.TODO()), config.Options{
+		OAuthIssuerURL:    "https://id.example.com",
+		OAuthAuthorizeURL: "https://id.example.com/login",
+		JWTSigningMethod:  jwt.SigningMethodRS256,
+	}, nil, nil, nil)
+	h.Discovery(c)
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Discovery() body %v", w.Body.String())
+	}
+
+	if got["issuer"] != "https://id.example.com" ||
+		got["authorization_endpoint"] != "https://id.example.com/login" ||
+		got["token_endpoint"] != "https://id.example.com/oauth/token" {
+		t.Errorf("Discovery() = %v", got)
+	}
+}
+
+func TestOAuthHandler_Authorize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &userservice.User{Model: model.Model{ID: 1}}
+	firstParty := &oauthservice.Client{ID: 2, ClientID: "first", RedirectURIs: []string{"https://app.example.com/callback"}, FirstParty: true}
+	thirdParty := &oauthservice.Client{ID: 3, ClientID: "third", Name: "Third", RedirectURIs: []string{"https://app.example.com/callback"}}
+
+	request := func(clientID string, change func(r map[string]interface{})) string {
+		r := map[string]interface{}{
+			"response_type":         "code",
+			"client_id":             clientID,
+			"redirect_uri":          "https://app.example.com/callback",
+			"scope":                 "openid profile",
+			"state":                 "xyz",
+			"code_challenge":        "challenge",
+			"code_challenge_method": "S256",
+		}
+		if change != nil {
+			change(r)
+		}
+
+		b, _ := json.Marshal(r)
+		return string(b)
+	}
+
+	clients := func(extra func(o *mocks.OAuthServiceInterface)) func() *mocks.OAuthServiceInterface {
+		return func() *mocks.OAuthServiceInterface {
+			o := &mocks.OAuthServiceInterface{}
+			o.On("GetClientByClientID", "first").
+				Return(firstParty, nil)
+			o.On("GetClientByClientID", "third").
+				Return(thirdParty, nil)
+			o.On("GetClientByClientID", "unknown").
+				Return(nil, errors.New("record not found"))
+			if extra != nil {
+				extra(o)
+			}
+
+			return o
+		}
+	}
+
+	withKey := func() *gin.Context {
+		c, _ := newOAuthContext(user, request("first", nil))
+		c.Set("api_key", &apikeyservice.APIKey{})
+
+		return c
+	}
+
+	tests := []struct {
+		name         string
+		oauthservice func() *mocks.OAuthServiceInterface
+		c            *gin.Context
+		body         string
+		want         int
+		wantRedirect string
+		wantConsent  bool
+	}{
+		{
+			name:         "authorized by api key",
+			oauthservice: func() *mocks.OAuthServiceInterface { return nil },
+			c:            withKey(),
+			want:         http.StatusForbidden,
+		},
+		{
+			name:         "invalid payload",
+			oauthservice: func() *mocks.OAuthServiceInterface { return nil },
+			body:         `{"client_id":"first"}`,
+			want:         http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "unknown client",
+			oauthservice: clients(nil),
+			body:         request("unknown", nil),
+			want:         http.StatusBadRequest,
+		},
+		{
+			name:         "redirect uri not registered",
+			oauthservice: clients(nil),
+			body: request("first", func(r map[string]interface{}) {
+				r["redirect_uri"] = "https://evil.example.com/callback"
+			}),
+			want: http.StatusBadRequest,
+		},
+		{
+			name:         "unsupported response type",
+			oauthservice: clients(nil),
+			body: request("first", func(r map[string]interface{}) {
+				r["response_type"] = "token"
+			}),
+			want:         http.StatusOK,
+			wantRedirect: "https://app.example.com/callback?error=unsupported_response_type&state=xyz",
+		},
+		{
+			name:         "missing code challenge",
+			oauthservice: clients(nil),
+			body: request("first", func(r map[string]interface{}) {
+				delete(r, "code_challenge")
+			}),
+			want:         http.StatusOK,
+			wantRedirect: "https://app.example.com/callback?error=invalid_request&error_description=code_challenge+with+S256+is+required&state=xyz",
+		},
+		{
+			name:         "invalid scope",
+			oauthservice: clients(nil),
+			body: request("first", func(r map[string]interface{}) {
+				r["scope"] = "openid admin"
+			}),
+			want:         http.StatusOK,
+			wantRedirect: "https://app.example.com/callback?error=invalid_scope&state=xyz",
+		},
+		{
+			name: "consent required",
+			oauthservice: clients(func(o *mocks.OAuthServiceInterface) {
+				o.On("HasConsent", uint(1), thirdParty, []string{"openid", "profile"}).
+					Return(false, nil)
+			}),
+			body:        request("third", nil),
+			want:        http.StatusOK,
+			wantConsent: true,
+		},
+		{
+			name: "consent granted",
+			oauthservice: clients(func(o *mocks.OAuthServiceInterface) {
+				o.On("HasConsent", uint(1), thirdParty, []string{"openid", "profile"}).
+					Return(false, nil)
+				o.On("GrantConsent", uint(1), thirdParty, []string{"openid", "profile"}).
+					Return(nil)
+				o.On("CreateCode", uint(1), thirdParty, mock.AnythingOfType("oauthservice.AuthorizeRequest")).
+					Return("code", nil)
+			}),
+			body: request("third", func(r map[string]interface{}) {
+				r["consent"] = true
+			}),
+			want:         http.StatusOK,
+			wantRedirect: "https://app.example.com/callback?code=code&state=xyz",
+		},
+		{
+			name: "consent fail",
+			oauthservice: clients(func(o *mocks.OAuthServiceInterface) {
+				o.On("HasConsent", uint(1), thirdParty, []string{"openid", "profile"}).
+					Return(false, errors.New("database error"))
+			}),
+			body: request("third", nil),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "first party code issued",
+			oauthservice: clients(func(o *mocks.OAuthServiceInterface) {
+				o.On("CreateCode", uint(1), firstParty, mock.AnythingOfType("oauthservice.AuthorizeRequest")).
+					Return("code", nil)
+			}),
+			body:         request("first", nil),
+			want:         http.StatusOK,
+			wantRedirect: "https://app.example.com/callback?code=code&state=xyz",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := tt.c, httptest.NewRecorder()
+			if c == nil {
+				c, w = newOAuthContext(user, tt.body)
+			}
+
+			h := handlers.NewOAuthHandler(logrus.WithContext(context.TODO()), config.Options{}, nil, nil, tt.oauthservice())
+			h.Authorize(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Authorize() = %v, want %v", c.Writer.Status(), tt.want)
+				return
+			}
+
+			if tt.wantRedirect == "" && !tt.wantConsent {
+				return
+			}
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Authorize() body %v", w.Body.String())
+			}
+
+			if tt.wantRedirect != "" && got["redirect_uri"] != tt.wantRedirect {
+				t.Errorf("Authorize() redirect_uri = %v, want %v", got["redirect_uri"], tt.wantRedirect)
+			}
+
+			if tt.wantConsent && got["consent_required"] != true {
+				t.Errorf("Authorize() = %v, want consent_required", got)
+			}
+		})
+	}
+}
+
+func TestOAuthHandler_Token(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &userservice.User{Model: model.Model{ID: 1}, Username: "admin", Email: "admin@example.com"}
+	client := &oauthservice.Client{ID: 2, ClientID: "first"}
+	code := &oauthservice.AuthorizationCode{UserID: 1, ClientID: 2, Scope: "openid email", Nonce: "n-0S6"}
+	body := "grant_type=authorization_code&code=code&redirect_uri=https%3A%2F%2Fapp.example.com%2Fcallback&client_id=first&code_verifier=verifier"
+
+	expires := time.Now().Add(time.Minute)
+	reused := &oauthservice.AuthorizationCode{UserID: 1, ClientID: 2, TokenJTI: "leaked", TokenExpiresAt: &expires}
+	var attached string
+
+	revocations := authservice.NewMemoryRevocationStore()
+	auth := authservice.New(
+		nil,
+		revocations,
+		authservice.NewKeyring(authservice.NewSigningKey(jwt.SigningMethodHS256, []byte("signing-key"), nil), time.Minute),
+		authservice.AllowSigningMethod{HMAC: true},
+		"",
+		nil,
+	)
+
+	authenticated := func(extra func(o *mocks.OAuthServiceInterface)) func() *mocks.OAuthServiceInterface {
+		return func() *mocks.OAuthServiceInterface {
+			o := &mocks.OAuthServiceInterface{}
+			o.On("GetClientByClientID", "first").
+				Return(client, nil)
+			o.On("GetClientByClientID", "unknown").
+				Return(nil, errors.New("record not found"))
+			o.On("AuthenticateClient", client, "").
+				Return(nil)
+			o.On("AuthenticateClient", client, "wrong").
+				Return(oauthservice.ErrClientInvalid)
+			if extra != nil {
+				extra(o)
+			}
+
+			return o
+		}
+	}
+
+	tests := []struct {
+		name         string
+		oauthservice func() *mocks.OAuthServiceInterface
+		body         string
+		want         int
+		wantIDToken  bool
+		wantRevoked  func() string
+	}{
+		{
+			name:         "unsupported grant type",
+			oauthservice: func() *mocks.OAuthServiceInterface { return nil },
+			body:         "grant_type=password",
+			want:         http.StatusBadRequest,
+		},
+		{
+			name:         "unknown client",
+			oauthservice: authenticated(nil),
+			body:         strings.Replace(body, "client_id=first", "client_id=unknown", 1),
+			want:         http.StatusUnauthorized,
+		},
+		{
+			name:         "client secret mismatch",
+			oauthservice: authenticated(nil),
+			body:         body + "&client_secret=wrong",
+			want:         http.StatusUnauthorized,
+		},
+		{
+			name: "code invalid",
+			oauthservice: authenticated(func(o *mocks.OAuthServiceInterface) {
+				o.On("ExchangeCode", client, "code", "https://app.example.com/callback", "verifier").
+					Return(nil, oauthservice.ErrCodeInvalid)
+			}),
+			body: body,
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "code reused",
+			oauthservice: authenticated(func(o *mocks.OAuthServiceInterface) {
+				o.On("ExchangeCode", client, "code", "https://app.example.com/callback", "verifier").
+					Return(reused, oauthservice.ErrCodeReused)
+			}),
+			body:        body,
+			want:        http.StatusBadRequest,
+			wantRevoked: func() string { return "leaked" },
+		},
+		{
+			name: "code reused while issuing",
+			oauthservice: authenticated(func(o *mocks.OAuthServiceInterface) {
+				o.On("ExchangeCode", client, "code", "https://app.example.com/callback", "verifier").
+					Return(code, nil)
+				o.On("AttachToken", code, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+					Run(func(args mock.Arguments) {
+						attached = args.String(1)
+					}).
+					Return(oauthservice.ErrCodeReused)
+			}),
+			body:        body,
+			want:        http.StatusBadRequest,
+			wantRevoked: func() string { return attached },
+		},
+		{
+			name: "tokens issued",
+			oauthservice: authenticated(func(o *mocks.OAuthServiceInterface) {
+				o.On("ExchangeCode", client, "code", "https://app.example.com/callback", "verifier").
+					Return(code, nil)
+				o.On("AttachToken", code, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+					Return(nil)
+			}),
+			body:        body,
+			want:        http.StatusOK,
+			wantIDToken: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := newOAuthContext(nil, tt.body)
+			c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			users := &mocks.UserServiceInterface{}
+			users.On("Get", uint(1)).
+				Return(user, nil)
+
+			h := handlers.NewOAuthHandler(logrus.WithContext(context.TODO()), config.Options{
+				JWTExpiredIn:          time.Minute,
+				OAuthIssuerURL:        "https://id.example.com",
+				OAuthIDTokenExpiredIn: time.Minute,
+			}, auth, users, tt.oauthservice())
+			h.Token(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Token() = %v, want %v", c.Writer.Status(), tt.want)
+				return
+			}
+
+			if tt.wantRevoked != nil {
+				if revoked, _ := revocations.IsRevoked(tt.wantRevoked()); !revoked {
+					t.Errorf("Token() did not revoke the token issued from the code")
+				}
+			}
+
+			if !tt.wantIDToken {
+				return
+			}
+
+			var got struct {
+				AccessToken string `json:"access_token"`
+				IDToken     string `json:"id_token"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Token() body %v", w.Body.String())
+			}
+
+			access, err := auth.ParseToken(got.AccessToken)
+			if err != nil || access["client_id"] != "first" || access["scope"] != "openid email" || access["token_use"] != nil {
+				t.Errorf("Token() access_token claims = %v, error %v", access, err)
+			}
+
+			id, err := auth.ParseToken(got.IDToken)
+			if err != nil ||
+				id["aud"] != "first" ||
+				id["iss"] != "https://id.example.com" ||
+				id["nonce"] != "n-0S6" ||
+				id["sub"] != "1" ||
+				id["token_use"] != "id" ||
+				id["email"] != "admin@example.com" {
+				t.Errorf("Token() id_token claims = %v, error %v", id, err)
+			}
+
+			if _, ok := id["preferred_username"]; ok {
+				t.Errorf("Token() id_token released profile claims without the profile scope")
+			}
+		})
+	}
+}
+
+func TestOAuthHandler_UserInfo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &userservice.User{Model: model.Model{ID: 1}, Username: "admin", Email: "admin@example.com"}
+
+	tests := []struct {
+		name      string
+		claims    jwt.MapClaims
+		wantEmail bool
+	}{
+		{
+			name:      "first party token",
+			claims:    jwt.MapClaims{"sub": "1"},
+			wantEmail: true,
+		},
+		{
+			name:   "client token without email scope",
+			claims: jwt.MapClaims{"sub": "1", "client_id": "third", "scope": "openid profile"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := newOAuthContext(user, "")
+			c.Set("claims", tt.claims)
+
+			h := handlers.NewOAuthHandler(logrus.WithContext(context.TODO()), config.Options{}, nil, nil, nil)
+			h.UserInfo(c)
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("UserInfo() body %v", w.Body.String())
+			}
+
+			if _, ok := got["email"]; ok != tt.wantEmail || got["preferred_username"] != "admin" {
+				t.Errorf("UserInfo() = %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maetad/baroness-api/internal/config"
+	"github.com/maetad/baroness-api/internal/services/oidcservice"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/sirupsen/logrus"
+)
+
+// oidcStateCookie binds the login to the browser which started it, so a
+// callback with a state from another browser is refused.
+const oidcStateCookie = "oidc_state"
+
+// OIDCHandler signs users in at the external identity provider. It finishes
+// the login the same way AuthHandler.Login does.
+type OIDCHandler struct {
+	log         *logrus.Entry
+	options     config.Options
+	auth        *AuthHandler
+	userservice userservice.UserServiceInterface
+	roleservice roleservice.RoleServiceInterface
+	oidcservice oidcservice.OIDCServiceInterface
+}
+
+func NewOIDCHandler(
+	log *logrus.Entry,
+	options config.Options,
+	auth *AuthHandler,
+	userservice userservice.UserServiceInterface,
+	roleservice roleservice.RoleServiceInterface,
+	oidcservice oidcservice.OIDCServiceInterface,
+) *OIDCHandler {
+	return &OIDCHandler{log, options, auth, userservice, roleservice, oidcservice}
+}
+
+// Login answers with the URL of the identity provider to send the browser
+// to, and sets the state as a cookie Callback checks.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	u, state, err := h.oidcservice.AuthCodeURL()
+	if err != nil {
+		h.log.WithError(err).Errorf("Login(): h.oidcservice.AuthCodeURL error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	h.setStateCookie(c, state, h.options.OIDCStateExpiredIn)
+
+	c.JSON(http.StatusOK, gin.H{"authorization_url": u})
+}
+
+// Callback exchanges the code the identity provider sent to the redirect
+// page for the tokens of the linked user. A user is linked or created on
+// the first sign in.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	var r oidcservice.CallbackRequest
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(r.State)) != 1 {
+		h.log.Error("Callback(): state does not match the state cookie")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	h.setStateCookie(c, "", -1)
+
+	claims, err := h.oidcservice.Exchange(r.State, r.Code)
+	if err != nil {
+		h.log.WithError(err).Errorf("Callback(): h.oidcservice.Exchange error %v", err)
+		if errors.Is(err, oidcservice.ErrStateInvalid) ||
+			errors.Is(err, oidcservice.ErrCodeRejected) ||
+			errors.Is(err, oidcservice.ErrIDTokenInvalid) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	user := h.user(c, claims)
+	if user == nil {
+		return
+	}
+
+	if user.TOTPEnabled {
+		h.auth.requireMFA(c, "Callback", user)
+		return
+	}
+
+	h.auth.issueTokens(c, "Callback", user)
+}
+
+// user returns the user linked to the identity, linking or creating one
+// when there is none yet. It aborts and returns nil on failure.
+func (h *OIDCHandler) user(c *gin.Context, claims *oidcservice.Claims) *userservice.User {
+	user, err := h.userservice.GetByIdentity(claims.Issuer, claims.Subject)
+	if err == nil {
+		return user.(*userservice.User)
+	}
+
+	if !errors.Is(err, userservice.ErrIdentityNotFound) {
+		h.log.WithError(err).Errorf("Callback(): h.userservice.GetByIdentity error %v", err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return nil
+	}
+
+	if h.options.OIDCLinkByEmail && claims.EmailVerified && claims.Email != "" {
+		if user, err = h.userservice.GetByEmail(claims.Email); err != nil {
+			h.log.WithError(err).Infof("Callback(): h.userservice.GetByEmail error %v", err)
+		}
+	}
+
+	if user == nil {
+		if user = h.provision(c, claims); user == nil {
+			return nil
+		}
+	}
+
+	if err = h.userservice.LinkIdentity(user, claims.Issuer, claims.Subject); err != nil {
+		h.log.WithError(err).Errorf("Callback(): h.userservice.LinkIdentity error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil
+	}
+
+	return user.(*userservice.User)
+}
+
+// provision creates a user without a password for the identity. An
+// existing user with the same username is not taken over, that needs
+// OIDCLinkByEmail.
+func (h *OIDCHandler) provision(c *gin.Context, claims *oidcservice.Claims) userservice.UserInterface {
+	r := userservice.UserExternalCreateRequest{
+		Username:    claims.PreferredUsername,
+		DisplayName: claims.Name,
+		Email:       claims.Email,
+	}
+
+	if r.Username == "" {
+		r.Username = claims.Email
+	}
+	if r.Username == "" {
+		r.Username = claims.Subject
+	}
+	if r.DisplayName == "" {
+		r.DisplayName = r.Username
+	}
+
+	if _, err := h.userservice.GetByUsername(r.Username); err == nil {
+		h.log.Errorf("Callback(): username %v is taken by a user not linked to the identity", r.Username)
+		c.AbortWithStatus(http.StatusConflict)
+		return nil
+	}
+
+	user, err := h.userservice.CreateExternal(r)
+	if err != nil {
+		h.log.WithError(err).Errorf("Callback(): h.userservice.CreateExternal error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil
+	}
+
+	if err = h.roleservice.SetUserRoles(user.(*userservice.User).ID, []string{roleservice.RoleUser}); err != nil {
+		h.log.WithError(err).Errorf("Callback(): h.roleservice.SetUserRoles error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil
+	}
+
+	return user
+}
+
+// setStateCookie sets the state cookie, or removes it when maxAge is
+// negative. It is Lax whatever AuthCookieSameSite is, the login round trips
+// through the identity provider.
+func (h *OIDCHandler) setStateCookie(c *gin.Context, state string, maxAge time.Duration) {
+	age := int(maxAge.Seconds())
+	if maxAge < 0 {
+		age = -1
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, age, "/auth/oidc", h.options.AuthCookieDomain, h.options.AuthCookieSecure, true)
+}
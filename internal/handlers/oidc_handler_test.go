@@ -0,0 +1,437 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maetad/baroness-api/internal/config"
+	"github.com/maetad/baroness-api/internal/handlers"
+	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/oidcservice"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newOIDCContext(body string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	c.Request = &http.Request{
+		URL:    &url.URL{},
+		Header: make(http.Header),
+		Body:   io.NopCloser(strings.NewReader(body)),
+	}
+
+	return c, w
+}
+
+func TestOIDCHandler_Login(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		url  string
+		err  error
+		want int
+	}{
+		{
+			name: "provider unavailable",
+			err:  errors.New("connection refused"),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "authorization url",
+			url:  "https://id.example.com/authorize?state=state",
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &mocks.OIDCServiceInterface{}
+			o.On("AuthCodeURL").
+				Return(tt.url, "state", tt.err)
+
+			c, w := newOIDCContext("")
+			h := handlers.NewOIDCHandler(logrus.WithContext(context.TODO()), config.Options{OIDCStateExpiredIn: time.Minute}, nil, nil, nil, o)
+			h.Login(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Login() = %v, want %v", c.Writer.Status(), tt.want)
+				return
+			}
+
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			cookie := w.Header().Get("Set-Cookie")
+			if !strings.HasPrefix(cookie, "oidc_state=state;") ||
+				!strings.Contains(cookie, "HttpOnly") ||
+				!strings.Contains(cookie, "SameSite=Lax") {
+				t.Errorf("Login() cookie = %v", cookie)
+			}
+		})
+	}
+}
+
+func TestOIDCHandler_Callback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	body := `{"code":"code","state":"state"}`
+	claims := &oidcservice.Claims{
+		Issuer:            "https://id.example.com",
+		Subject:           "248289761001",
+		Email:             "jane@example.com",
+		EmailVerified:     true,
+		PreferredUsername: "jane",
+		Name:              "Jane Doe",
+	}
+	linked := &userservice.User{Model: model.Model{ID: 3}, Username: "jane"}
+	enrolled := &userservice.User{Model: model.Model{ID: 3}, Username: "jane", TOTPEnabled: true}
+	provisioned := &userservice.User{Model: model.Model{ID: 5}, Username: "jane"}
+
+	exchanged := func() *mocks.OIDCServiceInterface {
+		o := &mocks.OIDCServiceInterface{}
+		o.On("Exchange", "state", "code").
+			Return(claims, nil)
+
+		return o
+	}
+
+	notLinked := func(u *mocks.UserServiceInterface) {
+		u.On("GetByIdentity", "https://id.example.com", "248289761001").
+			Return(nil, userservice.ErrIdentityNotFound)
+	}
+
+	users := func(extra func(u *mocks.UserServiceInterface)) func() *mocks.UserServiceInterface {
+		return func() *mocks.UserServiceInterface {
+			u := &mocks.UserServiceInterface{}
+			if extra != nil {
+				extra(u)
+			}
+
+			return u
+		}
+	}
+
+	tests := []struct {
+		name        string
+		options     config.Options
+		oidcservice func() *mocks.OIDCServiceInterface
+		userservice func() *mocks.UserServiceInterface
+		body        string
+		cookie      string
+		want        int
+		wantMFA     bool
+	}{
+		{
+			name:        "invalid payload",
+			oidcservice: func() *mocks.OIDCServiceInterface { return nil },
+			userservice: users(nil),
+			body:        `{"code":"code"}`,
+			want:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "state cookie missing",
+			oidcservice: func() *mocks.OIDCServiceInterface { return nil },
+			userservice: users(nil),
+			body:        body,
+			cookie:      "-",
+			want:        http.StatusUnauthorized,
+		},
+		{
+			name:        "state of another browser",
+			oidcservice: func() *mocks.OIDCServiceInterface { return nil },
+			userservice: users(nil),
+			body:        body,
+			cookie:      "other",
+			want:        http.StatusUnauthorized,
+		},
+		{
+			name: "state invalid",
+			oidcservice: func() *mocks.OIDCServiceInterface {
+				o := &mocks.OIDCServiceInterface{}
+				o.On("Exchange", "state", "code").
+					Return(nil, oidcservice.ErrStateInvalid)
+
+				return o
+			},
+			userservice: users(nil),
+			body:        body,
+			want:        http.StatusUnauthorized,
+		},
+		{
+			name: "provider unavailable",
+			oidcservice: func() *mocks.OIDCServiceInterface {
+				o := &mocks.OIDCServiceInterface{}
+				o.On("Exchange", "state", "code").
+					Return(nil, errors.New("connection refused"))
+
+				return o
+			},
+			userservice: users(nil),
+			body:        body,
+			want:        http.StatusInternalServerError,
+		},
+		{
+			name:        "linked user logged in",
+			oidcservice: exchanged,
+			userservice: users(func(u *mocks.UserServiceInterface) {
+				u.On("GetByIdentity", "https://id.example.com", "248289761001").
+					Return(linked, nil)
+			}),
+			body: body,
+			want: http.StatusOK,
+		},
+		{
+			name:        "linked user with second factor",
+			oidcservice: exchanged,
+			userservice: users(func(u *mocks.UserServiceInterface) {
+				u.On("GetByIdentity", "https://id.example.com", "248289761001").
+					Return(enrolled, nil)
+			}),
+			body:    body,
+			want:    http.StatusOK,
+			wantMFA: true,
+		},
+		{
+			name:        "linked user deleted",
+			oidcservice: exchanged,
+			userservice: users(func(u *mocks.UserServiceInterface) {
+				u.On("GetByIdentity", "https://id.example.com", "248289761001").
+					Return(nil, errors.New("record not found"))
+			}),
+			body: body,
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:        "linked by email",
+			options:     config.Options{OIDCLinkByEmail: true},
+			oidcservice: exchanged,
+			userservice: users(func(u *mocks.UserServiceInterface) {
+				notLinked(u)
+				u.On("GetByEmail", "jane@example.com").
+					Return(linked, nil)
+				u.On("LinkIdentity", linked, "https://id.example.com", "248289761001").
+					Return(nil)
+			}),
+			body: body,
+			want: http.StatusOK,
+		},
+		{
+			name:        "user provisioned",
+			oidcservice: exchanged,
+			userservice: users(func(u *mocks.UserServiceInterface) {
+				notLinked(u)
+				u.On("GetByUsername", "jane").
+					Return(nil, errors.New("record not found"))
+				u.On("CreateExternal", userservice.UserExternalCreateRequest{Username: "jane", DisplayName: "Jane Doe", Email: "jane@example.com"}).
+					Return(provisioned, nil)
+				u.On("LinkIdentity", provisioned, "https://id.example.com", "248289761001").
+					Return(nil)
+			}),
+			body: body,
+			want: http.StatusOK,
+		},
+		{
+			name:        "username taken",
+			oidcservice: exchanged,
+			userservice: users(func(u *mocks.UserServiceInterface) {
+				notLinked(u)
+				u.On("GetByUsername", "jane").
+					Return(linked, nil)
+			}),
+			body: body,
+			want: http.StatusConflict,
+		},
+		{
+			name:        "link fail",
+			oidcservice: exchanged,
+			userservice: users(func(u *mocks.UserServiceInterface) {
+				notLinked(u)
+				u.On("GetByUsername", "jane").
+					Return(nil, errors.New("record not found"))
+				u.On("CreateExternal", mock.AnythingOfType("userservice.UserExternalCreateRequest")).
+					Return(provisioned, nil)
+				u.On("LinkIdentity", provisioned, "https://id.example.com", "248289761001").
+					Return(errors.New("database error"))
+			}),
+			body: body,
+			want: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &mocks.AuthServiceInterface{}
+			a.On("CreateSession", mock.AnythingOfType("uint"), mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+				Return(&authservice.Session{ID: 7}, nil)
+			a.On("GenerateToken", mock.Anything, mock.Anything).
+				Return("token", nil)
+			a.On("GenerateRefreshToken", mock.AnythingOfType("uint"), uint(7), mock.Anything).
+				Return("refresh-token", nil)
+
+			r := &mocks.RoleServiceInterface{}
+			r.On("GetUserAccess", mock.AnythingOfType("uint")).
+				Return(roleservice.Access{Roles: []string{"user"}}, nil)
+			r.On("SetUserRoles", uint(5), []string{roleservice.RoleUser}).
+				Return(nil)
+
+			l := logrus.WithContext(context.TODO())
+			u := tt.userservice()
+			auth := handlers.NewAuthHandler(l, tt.options, a, u, nil, nil, r, nil, nil)
+
+			c, w := newOIDCContext(tt.body)
+			switch tt.cookie {
+			case "":
+				c.Request.Header.Set("Cookie", "oidc_state=state")
+			case "-":
+			default:
+				c.Request.Header.Set("Cookie", "oidc_state="+tt.cookie)
+			}
+
+			h := handlers.NewOIDCHandler(l, tt.options, auth, u, r, tt.oidcservice())
+			h.Callback(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Callback() = %v, want %v", c.Writer.Status(), tt.want)
+				return
+			}
+
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Callback() body %v", w.Body.String())
+			}
+
+			if _, ok := got["mfa_token"]; ok != tt.wantMFA {
+				t.Errorf("Callback() = %v, want mfa %v", got, tt.wantMFA)
+			}
+
+			if _, ok := got["refresh_token"]; ok == tt.wantMFA {
+				t.Errorf("Callback() = %v, want tokens %v", got, !tt.wantMFA)
+			}
+		})
+	}
+}
+
+func TestOIDCHandler_CallbackProvision(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name  string
+		users []userservice.User
+		want  int
+	}{
+		{
+			name:  "user provisioned",
+			users: []userservice.User{{Model: model.Model{ID: 1}, Username: "admin"}},
+			want:  http.StatusOK,
+		},
+		{
+			name:  "username taken",
+			users: []userservice.User{{Model: model.Model{ID: 1}, Username: "admin"}, {Model: model.Model{ID: 3}, Username: "jane"}},
+			want:  http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &mocks.OIDCServiceInterface{}
+			o.On("Exchange", "state", "code").
+				Return(&oidcservice.Claims{
+					Issuer:            "https://id.example.com",
+					Subject:           "248289761001",
+					PreferredUsername: "jane",
+				}, nil)
+
+			a := &mocks.AuthServiceInterface{}
+			a.On("CreateSession", uint(5), mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+				Return(&authservice.Session{ID: 7}, nil)
+			a.On("GenerateToken", mock.Anything, mock.Anything).
+				Return("token", nil)
+			a.On("GenerateRefreshToken", uint(5), uint(7), mock.Anything).
+				Return("refresh-token", nil)
+
+			r := &mocks.RoleServiceInterface{}
+			r.On("GetUserAccess", uint(5)).
+				Return(roleservice.Access{Roles: []string{"user"}}, nil)
+			r.On("SetUserRoles", uint(5), []string{roleservice.RoleUser}).
+				Return(nil)
+
+			l := logrus.WithContext(context.TODO())
+			u := userservice.New(userTable(t, tt.users), userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, userservice.BcryptHasher{})
+			auth := handlers.NewAuthHandler(l, config.Options{}, a, u, nil, nil, r, nil, nil)
+
+			c, _ := newOIDCContext(`{"code":"code","state":"state"}`)
+			c.Request.Header.Set("Cookie", "oidc_state=state")
+			h := handlers.NewOIDCHandler(l, config.Options{}, auth, u, r, o)
+			h.Callback(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Callback() = %v, want %v", c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+// userTable is a database which runs no statement, its users table holding
+// users and its identities table nothing. Created users get the id 5.
+func userTable(t *testing.T, users []userservice.User) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Callback().Query().After("gorm:query").Register("test:answer", func(tx *gorm.DB) {
+		dest, ok := tx.Statement.Dest.(*userservice.User)
+		if !ok {
+			tx.AddError(gorm.ErrRecordNotFound)
+			return
+		}
+
+		// as a database would, a query without conditions finds the first user
+		for _, u := range users {
+			matches := true
+			for _, v := range tx.Statement.Vars {
+				matches = matches && v == u.Username
+			}
+
+			if matches {
+				*dest = u
+				return
+			}
+		}
+
+		tx.AddError(gorm.ErrRecordNotFound)
+	})
+	db.Callback().Create().After("gorm:create").Register("test:id", func(tx *gorm.DB) {
+		if dest, ok := tx.Statement.Dest.(*userservice.User); ok {
+			dest.ID = 5
+		}
+	})
+
+	return db
+}
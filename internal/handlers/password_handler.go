@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maetad/baroness-api/internal/config"
+	"github.com/maetad/baroness-api/internal/mailer"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/resetservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/sirupsen/logrus"
+)
+
+type PasswordHandler struct {
+	log          *logrus.Entry
+	options      config.Options
+	authservice  authservice.AuthServiceInterface
+	userservice  userservice.UserServiceInterface
+	resetservice resetservice.ResetServiceInterface
+	mailer       mailer.Mailer
+	sending      sync.WaitGroup
+}
+
+func NewPasswordHandler(
+	log *logrus.Entry,
+	options config.Options,
+	authservice authservice.AuthServiceInterface,
+	userservice userservice.UserServiceInterface,
+	resetservice resetservice.ResetServiceInterface,
+	mailer mailer.Mailer,
+) *PasswordHandler {
+	return &PasswordHandler{
+		log:          log,
+		options:      options,
+		authservice:  authservice,
+		userservice:  userservice,
+		resetservice: resetservice,
+		mailer:       mailer,
+	}
+}
+
+// Forgot mails a reset link to the user. The lookup and the mail happen
+// after answering, so the response is the same, and takes as long, whether
+// or not the username exists.
+func (h *PasswordHandler) Forgot(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	h.sending.Add(1)
+	go func() {
+		defer h.sending.Done()
+		h.sendReset(req.Username)
+	}()
+
+	c.Status(http.StatusAccepted)
+}
+
+// Wait blocks until the reset mails Forgot started have been sent.
+func (h *PasswordHandler) Wait() {
+	h.sending.Wait()
+}
+
+func (h *PasswordHandler) Reset(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	reset, err := h.resetservice.Get(req.Token)
+	if err != nil {
+		h.log.WithError(err).Errorf("Reset(): h.resetservice.Get error %v", err)
+		if errors.Is(err, resetservice.ErrTokenInvalid) {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.userservice.Get(reset.UserID)
+	if err != nil {
+		h.log.WithError(err).Errorf("Reset(): h.userservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	// a password the policy rejects must not use up the token
+	if err = h.options.PasswordPolicy.Validate(user.(*userservice.User).Username, req.Password); err != nil {
+		h.log.WithError(err).Errorf("Reset(): h.options.PasswordPolicy.Validate error %v", err)
+		abortOnPasswordPolicy(c, err)
+		return
+	}
+
+	// the token is used before the password changes, so that requests
+	// racing with it can not all change the password
+	if err = h.resetservice.Use(reset); err != nil {
+		h.log.WithError(err).Errorf("Reset(): h.resetservice.Use error %v", err)
+		if errors.Is(err, resetservice.ErrTokenInvalid) {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err = h.userservice.ChangePassword(user, req.Password); err != nil {
+		h.log.WithError(err).Errorf("Reset(): h.userservice.ChangePassword error %v", err)
+		if abortOnPasswordPolicy(c, err) {
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err = h.authservice.RevokeUserTokens(reset.UserID); err != nil {
+		h.log.WithError(err).Errorf("Reset(): h.authservice.RevokeUserTokens error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *PasswordHandler) sendReset(username string) {
+	user, err := h.userservice.GetByUsername(username)
+	if err != nil {
+		h.log.WithError(err).Errorf("Forgot(): h.userservice.GetByUsername error %v", err)
+		return
+	}
+
+	u := user.(*userservice.User)
+	if u.Email == "" {
+		h.log.Errorf("Forgot(): user %d has no email", u.ID)
+		return
+	}
+
+	token, err := h.resetservice.Create(u.ID)
+	if err != nil {
+		h.log.WithError(err).Errorf("Forgot(): h.resetservice.Create error %v", err)
+		return
+	}
+
+	if err = h.mailer.Send(u.Email, "Reset your password", h.resetMail(u, token)); err != nil {
+		h.log.WithError(err).Errorf("Forgot(): h.mailer.Send error %v", err)
+	}
+}
+
+func (h *PasswordHandler) resetMail(user *userservice.User, token string) string {
+	link := token
+	if u, err := url.Parse(h.options.PasswordResetURL); err == nil && h.options.PasswordResetURL != "" {
+		q := u.Query()
+		q.Set("token", token)
+		u.RawQuery = q.Encode()
+		link = u.String()
+	}
+
+	return fmt.Sprintf(
+		"Hi %s,\n\nSomeone asked to reset the password of your account %s. Use the link below to choose a new password:\n\n%s\n\nThe link expires in %s and can be used once. If you did not ask for this, you can ignore this email.\n",
+		user.DisplayName,
+		user.Username,
+		link,
+		h.options.PasswordResetExpiredIn,
+	)
+}
@@ -0,0 +1,354 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maetad/baroness-api/internal/config"
+	"github.com/maetad/baroness-api/internal/handlers"
+	"github.com/maetad/baroness-api/internal/mailer"
+	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/resetservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+)
+
+func passwordContext(body string) *gin.Context {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	c.Request = &http.Request{
+		URL:    &url.URL{},
+		Header: make(http.Header),
+		Body:   io.NopCloser(strings.NewReader(body)),
+	}
+
+	return c
+}
+
+func TestPasswordHandler_Forgot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type fields struct {
+		userservice  userservice.UserServiceInterface
+		resetservice resetservice.ResetServiceInterface
+		mailer       mailer.Mailer
+	}
+	type args struct {
+		c *gin.Context
+	}
+
+	users := func(user *userservice.User, err error) *mocks.UserServiceInterface {
+		u := &mocks.UserServiceInterface{}
+		if user == nil {
+			u.On("GetByUsername", "admin").Return(nil, err)
+		} else {
+			u.On("GetByUsername", "admin").Return(user, err)
+		}
+
+		return u
+	}
+
+	admin := &userservice.User{Model: model.Model{ID: 1}, Username: "admin", Email: "admin@example.com"}
+
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		want     int
+		wantMail bool
+	}{
+		{
+			name: "invalid payload",
+			args: args{passwordContext(`{}`)},
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "unknown username",
+			fields: fields{
+				userservice: users(nil, errors.New("user not found")),
+				mailer:      &mocks.Mailer{},
+			},
+			args: args{passwordContext(`{"username":"admin"}`)},
+			want: http.StatusAccepted,
+		},
+		{
+			name: "user without email",
+			fields: fields{
+				userservice: users(&userservice.User{Username: "admin"}, nil),
+				mailer:      &mocks.Mailer{},
+			},
+			args: args{passwordContext(`{"username":"admin"}`)},
+			want: http.StatusAccepted,
+		},
+		{
+			name: "create token fail",
+			fields: func() fields {
+				r := &mocks.ResetServiceInterface{}
+				r.On("Create", uint(1)).Return("", errors.New("create fail"))
+
+				return fields{users(admin, nil), r, &mocks.Mailer{}}
+			}(),
+			args: args{passwordContext(`{"username":"admin"}`)},
+			want: http.StatusAccepted,
+		},
+		{
+			name: "send fail",
+			fields: func() fields {
+				r := &mocks.ResetServiceInterface{}
+				r.On("Create", uint(1)).Return("reset-token", nil)
+
+				m := &mocks.Mailer{}
+				m.On("Send", "admin@example.com", mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+					Return(errors.New("send fail"))
+
+				return fields{users(admin, nil), r, m}
+			}(),
+			args:     args{passwordContext(`{"username":"admin"}`)},
+			want:     http.StatusAccepted,
+			wantMail: true,
+		},
+		{
+			name: "mail sent",
+			fields: func() fields {
+				r := &mocks.ResetServiceInterface{}
+				r.On("Create", uint(1)).Return("reset-token", nil)
+
+				m := &mocks.Mailer{}
+				m.On("Send", "admin@example.com", mock.AnythingOfType("string"), mock.MatchedBy(func(body string) bool {
+					return strings.Contains(body, "https://example.com/reset?token=reset-token")
+				})).Return(nil)
+
+				return fields{users(admin, nil), r, m}
+			}(),
+			args:     args{passwordContext(`{"username":"admin"}`)},
+			want:     http.StatusAccepted,
+			wantMail: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewPasswordHandler(
+				logrus.WithContext(context.TODO()),
+				config.Options{PasswordResetURL: "https://example.com/reset", PasswordResetExpiredIn: time.Hour},
+				nil,
+				tt.fields.userservice,
+				tt.fields.resetservice,
+				tt.fields.mailer,
+			)
+			h.Forgot(tt.args.c)
+			tt.args.c.Writer.WriteHeaderNow()
+			h.Wait()
+
+			if tt.args.c.Writer.Status() != tt.want {
+				t.Errorf("Forgot() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+
+			if m, ok := tt.fields.mailer.(*mocks.Mailer); ok {
+				if sent := len(m.Calls) > 0; sent != tt.wantMail {
+					t.Errorf("Forgot() mail sent = %v, want %v", sent, tt.wantMail)
+				}
+			}
+		})
+	}
+}
+
+func TestPasswordHandler_ForgotAnswersBeforeSending(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	admin := &userservice.User{Model: model.Model{ID: 1}, Username: "admin", Email: "admin@example.com"}
+	release := make(chan struct{})
+
+	u := &mocks.UserServiceInterface{}
+	u.On("GetByUsername", "admin").Return(admin, nil)
+
+	r := &mocks.ResetServiceInterface{}
+	r.On("Create", uint(1)).Return("reset-token", nil)
+
+	m := &mocks.Mailer{}
+	m.On("Send", "admin@example.com", mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+		Run(func(args mock.Arguments) {
+			<-release
+		}).
+		Return(nil)
+
+	h := handlers.NewPasswordHandler(logrus.WithContext(context.TODO()), config.Options{PasswordResetURL: "https://example.com/reset"}, nil, u, r, m)
+
+	c := passwordContext(`{"username":"admin"}`)
+	h.Forgot(c)
+	c.Writer.WriteHeaderNow()
+
+	if c.Writer.Status() != http.StatusAccepted {
+		t.Errorf("Forgot() = %v, want %v", c.Writer.Status(), http.StatusAccepted)
+	}
+
+	close(release)
+	h.Wait()
+
+	m.AssertExpectations(t)
+}
+
+func TestPasswordHandler_Reset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type fields struct {
+		authservice  authservice.AuthServiceInterface
+		userservice  userservice.UserServiceInterface
+		resetservice resetservice.ResetServiceInterface
+	}
+	type args struct {
+		c *gin.Context
+	}
+
+	reset := &resetservice.PasswordReset{ID: 1, UserID: 2}
+	user := &userservice.User{Model: model.Model{ID: 2}}
+
+	resets := func(useErr error) *mocks.ResetServiceInterface {
+		r := &mocks.ResetServiceInterface{}
+		r.On("Get", "reset-token").Return(reset, nil)
+		r.On("Use", reset).Return(useErr)
+
+		return r
+	}
+
+	users := func(changeErr error) *mocks.UserServiceInterface {
+		u := &mocks.UserServiceInterface{}
+		u.On("Get", uint(2)).Return(user, nil)
+		u.On("ChangePassword", user, "n3w-Password").Return(changeErr)
+
+		return u
+	}
+
+	body := `{"token":"reset-token","password":"n3w-Password"}`
+
+	tests := []struct {
+		name    string
+		options config.Options
+		fields  fields
+		args    args
+		want    int
+	}{
+		{
+			name: "invalid payload",
+			args: args{passwordContext(`{"token":"reset-token"}`)},
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "token invalid",
+			fields: func() fields {
+				r := &mocks.ResetServiceInterface{}
+				r.On("Get", "reset-token").Return(nil, resetservice.ErrTokenInvalid)
+
+				return fields{resetservice: r}
+			}(),
+			args: args{passwordContext(body)},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "token lookup fail",
+			fields: func() fields {
+				r := &mocks.ResetServiceInterface{}
+				r.On("Get", "reset-token").Return(nil, errors.New("database error"))
+
+				return fields{resetservice: r}
+			}(),
+			args: args{passwordContext(body)},
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "user not found",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(2)).Return(nil, errors.New("user not found"))
+
+				return fields{userservice: u, resetservice: resets(nil)}
+			}(),
+			args: args{passwordContext(body)},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "password policy",
+			fields: fields{
+				userservice:  users(&userservice.PasswordPolicyError{}),
+				resetservice: resets(nil),
+			},
+			args: args{passwordContext(body)},
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "password policy before the token is used",
+			options: config.Options{PasswordPolicy: userservice.PasswordPolicy{MinLength: 20}},
+			fields: func() fields {
+				r := &mocks.ResetServiceInterface{}
+				r.On("Get", "reset-token").Return(reset, nil)
+
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(2)).Return(user, nil)
+
+				return fields{userservice: u, resetservice: r}
+			}(),
+			args: args{passwordContext(body)},
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "token used meanwhile",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(2)).Return(user, nil)
+
+				return fields{userservice: u, resetservice: resets(resetservice.ErrTokenInvalid)}
+			}(),
+			args: args{passwordContext(body)},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "use token fail",
+			fields: fields{
+				userservice:  users(nil),
+				resetservice: resets(errors.New("save fail")),
+			},
+			args: args{passwordContext(body)},
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "password reset",
+			fields: func() fields {
+				a := &mocks.AuthServiceInterface{}
+				a.On("RevokeUserTokens", uint(2)).Return(nil)
+
+				return fields{a, users(nil), resets(nil)}
+			}(),
+			args: args{passwordContext(body)},
+			want: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewPasswordHandler(
+				logrus.WithContext(context.TODO()),
+				tt.options,
+				tt.fields.authservice,
+				tt.fields.userservice,
+				tt.fields.resetservice,
+				nil,
+			)
+			h.Reset(tt.args.c)
+			tt.args.c.Writer.WriteHeaderNow()
+
+			if tt.args.c.Writer.Status() != tt.want {
+				t.Errorf("Reset() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/sirupsen/logrus"
+)
+
+type RoleHandler struct {
+	log         *logrus.Entry
+	roleservice roleservice.RoleServiceInterface
+}
+
+func NewRoleHandler(log *logrus.Entry, roleservice roleservice.RoleServiceInterface) *RoleHandler {
+	return &RoleHandler{log, roleservice}
+}
+
+func (h *RoleHandler) List(c *gin.Context) {
+	roles, err := h.roleservice.List()
+	if err != nil {
+		h.log.WithError(err).Errorf("List(): h.roleservice.List error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+func (h *RoleHandler) Create(c *gin.Context) {
+	var (
+		user *userservice.User
+		ok   bool
+	)
+
+	if user, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`Create(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	var r roleservice.RoleCreateRequest
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	granted, err := canGrant(h.roleservice, user, r.Permissions)
+	if err != nil {
+		h.log.WithError(err).Errorf("Create(): h.roleservice.GetUserAccess error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if !granted {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	role, err := h.roleservice.Create(r)
+	if err != nil {
+		h.log.WithError(err).Errorf("Create(): h.roleservice.Create error %v", err)
+		abortOnRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+func (h *RoleHandler) Get(c *gin.Context) {
+	var (
+		id  int
+		err error
+	)
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	role, err := h.roleservice.Get(uint(id))
+	if err != nil {
+		h.log.WithError(err).Errorf("Get(): h.roleservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+func (h *RoleHandler) Update(c *gin.Context) {
+	var (
+		user *userservice.User
+		ok   bool
+		id   int
+		err  error
+	)
+
+	if user, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`Update(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	var r roleservice.RoleUpdateRequest
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	role, err := h.roleservice.Get(uint(id))
+	if err != nil {
+		h.log.WithError(err).Errorf("Update(): h.roleservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	// the permissions the role keeps have been granted before
+	var added []string
+	for _, permission := range r.Permissions {
+		if !contains(role.Permissions, permission) {
+			added = append(added, permission)
+		}
+	}
+
+	granted, err := canGrant(h.roleservice, user, added)
+	if err != nil {
+		h.log.WithError(err).Errorf("Update(): h.roleservice.GetUserAccess error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if !granted {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	role, err = h.roleservice.Update(role, r)
+	if err != nil {
+		h.log.WithError(err).Errorf("Update(): h.roleservice.Update error %v", err)
+		abortOnRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+func (h *RoleHandler) Delete(c *gin.Context) {
+	var (
+		id   int
+		err  error
+		role *roleservice.Role
+	)
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if role, err = h.roleservice.Get(uint(id)); err != nil {
+		h.log.WithError(err).Errorf("Delete(): h.roleservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if err = h.roleservice.Delete(role); err != nil {
+		h.log.WithError(err).Errorf("Delete(): h.roleservice.Delete error %v", err)
+		abortOnRoleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *RoleHandler) Permissions(c *gin.Context) {
+	permissions, err := h.roleservice.ListPermissions()
+	if err != nil {
+		h.log.WithError(err).Errorf("Permissions(): h.roleservice.ListPermissions error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
+
+// canGrant tells whether the user holds every one of permissions, nobody can
+// grant more than they have.
+func canGrant(roleservice roleservice.RoleServiceInterface, user *userservice.User, permissions []string) (bool, error) {
+	access, err := roleservice.GetUserAccess(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, permission := range permissions {
+		if !access.Can(permission) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// canActOn aborts with 403 unless the current user holds every permission of
+// the target user, so nobody can take over an account more privileged than
+// their own. It tells whether the handler can go on.
+func canActOn(c *gin.Context, log *logrus.Entry, roleservice roleservice.RoleServiceInterface, targetID uint) bool {
+	user, ok := c.MustGet("user").(*userservice.User)
+	if !ok {
+		log.Error(`canActOn(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return false
+	}
+
+	target, err := roleservice.GetUserAccess(targetID)
+	if err != nil {
+		log.WithError(err).Errorf("canActOn(): roleservice.GetUserAccess error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+
+	granted, err := canGrant(roleservice, user, target.Permissions)
+	if err != nil {
+		log.WithError(err).Errorf("canActOn(): roleservice.GetUserAccess error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+
+	if !granted {
+		c.AbortWithStatus(http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// abortOnRoleError maps the errors of roleservice to a response.
+func abortOnRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, roleservice.ErrRoleExists):
+		c.AbortWithStatus(http.StatusConflict)
+	case errors.Is(err, roleservice.ErrRoleProtected):
+		c.AbortWithStatus(http.StatusForbidden)
+	case errors.Is(err, roleservice.ErrRoleNotFound), errors.Is(err, roleservice.ErrPermissionNotFound):
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+	default:
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
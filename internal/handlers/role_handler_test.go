@@ -0,0 +1,448 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maetad/baroness-api/internal/handlers"
+	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/sirupsen/logrus"
+)
+
+// withAccess is a roleservice answering the permissions of every user in
+// permissions.
+func withAccess(permissions map[uint][]string) *mocks.RoleServiceInterface {
+	r := &mocks.RoleServiceInterface{}
+	for id, p := range permissions {
+		r.On("GetUserAccess", id).
+			Return(roleservice.Access{Permissions: p}, nil)
+	}
+
+	return r
+}
+
+func newRoleContext(id string, body string) *gin.Context {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	c.Request = &http.Request{
+		URL:    &url.URL{},
+		Header: make(http.Header),
+		Body:   io.NopCloser(strings.NewReader(body)),
+	}
+
+	c.Params = gin.Params{
+		{
+			Key:   "id",
+			Value: id,
+		},
+	}
+
+	c.Set("user", &userservice.User{Model: model.Model{ID: 1}})
+
+	return c
+}
+
+func TestRoleHandler_List(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		roleservice func() *mocks.RoleServiceInterface
+		want        int
+	}{
+		{
+			name: "roles found",
+			roleservice: func() *mocks.RoleServiceInterface {
+				r := &mocks.RoleServiceInterface{}
+				r.On("List").
+					Return([]roleservice.Role{{Name: "admin"}}, nil)
+
+				return r
+			},
+			want: http.StatusOK,
+		},
+		{
+			name: "list fail",
+			roleservice: func() *mocks.RoleServiceInterface {
+				r := &mocks.RoleServiceInterface{}
+				r.On("List").
+					Return(nil, errors.New("database error"))
+
+				return r
+			},
+			want: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRoleContext("", "")
+
+			h := handlers.NewRoleHandler(logrus.WithContext(context.TODO()), tt.roleservice())
+			h.List(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("List() = %v, want %v", c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleHandler_Create(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	request := roleservice.RoleCreateRequest{
+		Name:        "support",
+		Permissions: []string{"users.read"},
+	}
+	body := `{"name":"support","permissions":["users.read"]}`
+
+	created := func(role *roleservice.Role, err error) func() *mocks.RoleServiceInterface {
+		return func() *mocks.RoleServiceInterface {
+			r := &mocks.RoleServiceInterface{}
+			r.On("GetUserAccess", uint(1)).
+				Return(roleservice.Access{Permissions: []string{"roles.create", "users.read"}}, nil)
+			r.On("Create", request).
+				Return(role, err)
+
+			return r
+		}
+	}
+
+	tests := []struct {
+		name        string
+		roleservice func() *mocks.RoleServiceInterface
+		body        string
+		want        int
+	}{
+		{
+			name:        "invalid payload",
+			roleservice: func() *mocks.RoleServiceInterface { return nil },
+			body:        `{"permissions":["users.read"]}`,
+			want:        http.StatusUnprocessableEntity,
+		},
+		{
+			name: "permission not held",
+			roleservice: func() *mocks.RoleServiceInterface {
+				r := &mocks.RoleServiceInterface{}
+				r.On("GetUserAccess", uint(1)).
+					Return(roleservice.Access{Permissions: []string{"roles.create"}}, nil)
+
+				return r
+			},
+			body: body,
+			want: http.StatusForbidden,
+		},
+		{
+			name: "access fail",
+			roleservice: func() *mocks.RoleServiceInterface {
+				r := &mocks.RoleServiceInterface{}
+				r.On("GetUserAccess", uint(1)).
+					Return(roleservice.Access{}, errors.New("database error"))
+
+				return r
+			},
+			body: body,
+			want: http.StatusInternalServerError,
+		},
+		{
+			name:        "role exists",
+			roleservice: created(nil, roleservice.ErrRoleExists),
+			body:        body,
+			want:        http.StatusConflict,
+		},
+		{
+			name:        "permission not found",
+			roleservice: created(nil, roleservice.ErrPermissionNotFound),
+			body:        body,
+			want:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "create fail",
+			roleservice: created(nil, errors.New("database error")),
+			body:        body,
+			want:        http.StatusInternalServerError,
+		},
+		{
+			name:        "role created",
+			roleservice: created(&roleservice.Role{ID: 3, Name: "support"}, nil),
+			body:        body,
+			want:        http.StatusCreated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRoleContext("", tt.body)
+
+			h := handlers.NewRoleHandler(logrus.WithContext(context.TODO()), tt.roleservice())
+			h.Create(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Create() = %v, want %v", c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleHandler_Get(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		roleservice func() *mocks.RoleServiceInterface
+		id          string
+		want        int
+	}{
+		{
+			name:        "id is not int",
+			roleservice: func() *mocks.RoleServiceInterface { return nil },
+			id:          "one",
+			want:        http.StatusNotFound,
+		},
+		{
+			name: "role not found",
+			roleservice: func() *mocks.RoleServiceInterface {
+				r := &mocks.RoleServiceInterface{}
+				r.On("Get", uint(3)).
+					Return(nil, errors.New("record not found"))
+
+				return r
+			},
+			id:   "3",
+			want: http.StatusNotFound,
+		},
+		{
+			name: "role found",
+			roleservice: func() *mocks.RoleServiceInterface {
+				r := &mocks.RoleServiceInterface{}
+				r.On("Get", uint(3)).
+					Return(&roleservice.Role{ID: 3}, nil)
+
+				return r
+			},
+			id:   "3",
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRoleContext(tt.id, "")
+
+			h := handlers.NewRoleHandler(logrus.WithContext(context.TODO()), tt.roleservice())
+			h.Get(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Get() = %v, want %v", c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleHandler_Update(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	role := &roleservice.Role{ID: 3, Name: "support", Permissions: []string{"users.read"}}
+	body := `{"name":"support","permissions":["users.read","users.update"]}`
+
+	updated := func(err error) func() *mocks.RoleServiceInterface {
+		return func() *mocks.RoleServiceInterface {
+			r := &mocks.RoleServiceInterface{}
+			r.On("Get", uint(3)).
+				Return(role, nil)
+			r.On("GetUserAccess", uint(1)).
+				Return(roleservice.Access{Permissions: []string{"roles.update", "users.update"}}, nil)
+			r.On("Update", role, roleservice.RoleUpdateRequest{
+				Name:        "support",
+				Permissions: []string{"users.read", "users.update"},
+			}).Return(role, err)
+
+			return r
+		}
+	}
+
+	tests := []struct {
+		name        string
+		roleservice func() *mocks.RoleServiceInterface
+		id          string
+		body        string
+		want        int
+	}{
+		{
+			name:        "id is not int",
+			roleservice: func() *mocks.RoleServiceInterface { return nil },
+			id:          "one",
+			body:        body,
+			want:        http.StatusNotFound,
+		},
+		{
+			name:        "invalid payload",
+			roleservice: func() *mocks.RoleServiceInterface { return nil },
+			id:          "3",
+			body:        `{"description":"support"}`,
+			want:        http.StatusUnprocessableEntity,
+		},
+		{
+			name: "role not found",
+			roleservice: func() *mocks.RoleServiceInterface {
+				r := &mocks.RoleServiceInterface{}
+				r.On("Get", uint(3)).
+					Return(nil, errors.New("record not found"))
+
+				return r
+			},
+			id:   "3",
+			body: body,
+			want: http.StatusNotFound,
+		},
+		{
+			name: "permission not held",
+			roleservice: func() *mocks.RoleServiceInterface {
+				r := &mocks.RoleServiceInterface{}
+				r.On("Get", uint(3)).
+					Return(role, nil)
+				r.On("GetUserAccess", uint(1)).
+					Return(roleservice.Access{Permissions: []string{"roles.update"}}, nil)
+
+				return r
+			},
+			id:   "3",
+			body: body,
+			want: http.StatusForbidden,
+		},
+		{
+			name:        "role protected",
+			roleservice: updated(roleservice.ErrRoleProtected),
+			id:          "3",
+			body:        body,
+			want:        http.StatusForbidden,
+		},
+		{
+			name:        "update fail",
+			roleservice: updated(errors.New("database error")),
+			id:          "3",
+			body:        body,
+			want:        http.StatusInternalServerError,
+		},
+		{
+			name:        "role updated",
+			roleservice: updated(nil),
+			id:          "3",
+			body:        body,
+			want:        http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRoleContext(tt.id, tt.body)
+
+			h := handlers.NewRoleHandler(logrus.WithContext(context.TODO()), tt.roleservice())
+			h.Update(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Update() = %v, want %v", c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleHandler_Delete(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	role := &roleservice.Role{ID: 3, Name: "support"}
+
+	deleted := func(err error) func() *mocks.RoleServiceInterface {
+		return func() *mocks.RoleServiceInterface {
+			r := &mocks.RoleServiceInterface{}
+			r.On("Get", uint(3)).
+				Return(role, nil)
+			r.On("Delete", role).
+				Return(err)
+
+			return r
+		}
+	}
+
+	tests := []struct {
+		name        string
+		roleservice func() *mocks.RoleServiceInterface
+		id          string
+		want        int
+	}{
+		{
+			name:        "id is not int",
+			roleservice: func() *mocks.RoleServiceInterface { return nil },
+			id:          "one",
+			want:        http.StatusNotFound,
+		},
+		{
+			name: "role not found",
+			roleservice: func() *mocks.RoleServiceInterface {
+				r := &mocks.RoleServiceInterface{}
+				r.On("Get", uint(3)).
+					Return(nil, errors.New("record not found"))
+
+				return r
+			},
+			id:   "3",
+			want: http.StatusNotFound,
+		},
+		{
+			name:        "role protected",
+			roleservice: deleted(roleservice.ErrRoleProtected),
+			id:          "3",
+			want:        http.StatusForbidden,
+		},
+		{
+			name:        "delete fail",
+			roleservice: deleted(errors.New("database error")),
+			id:          "3",
+			want:        http.StatusInternalServerError,
+		},
+		{
+			name:        "role deleted",
+			roleservice: deleted(nil),
+			id:          "3",
+			want:        http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRoleContext(tt.id, "")
+
+			h := handlers.NewRoleHandler(logrus.WithContext(context.TODO()), tt.roleservice())
+			h.Delete(c)
+			c.Writer.WriteHeaderNow()
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Delete() = %v, want %v", c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleHandler_Permissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := &mocks.RoleServiceInterface{}
+	r.On("ListPermissions").
+		Return([]roleservice.Permission{{Name: "users.read"}}, nil)
+
+	c := newRoleContext("", "")
+
+	h := handlers.NewRoleHandler(logrus.WithContext(context.TODO()), r)
+	h.Permissions(c)
+
+	if c.Writer.Status() != http.StatusOK {
+		t.Errorf("Permissions() = %v, want %v", c.Writer.Status(), http.StatusOK)
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/maetad/baroness-api/internal/config"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/sirupsen/logrus"
+)
+
+type SessionHandler struct {
+	log         *logrus.Entry
+	options     config.Options
+	authservice authservice.AuthServiceInterface
+}
+
+func NewSessionHandler(
+	log *logrus.Entry,
+	options config.Options,
+	authservice authservice.AuthServiceInterface,
+) *SessionHandler {
+	return &SessionHandler{log, options, authservice}
+}
+
+// List returns the sessions of the user which can still be refreshed, the
+// one of the request marked current.
+func (h *SessionHandler) List(c *gin.Context) {
+	var (
+		user *userservice.User
+		ok   bool
+	)
+
+	if user, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`List(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.authservice.ListSessions(user.ID, h.options.JWTRefreshExpiredIn)
+	if err != nil {
+		h.log.WithError(err).Errorf("List(): h.authservice.ListSessions error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if claims, ok := c.Get("claims"); ok {
+		if current, ok := sessionID(claims.(jwt.MapClaims)); ok {
+			for i := range sessions {
+				sessions[i].Current = sessions[i].ID == current
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// Delete revokes a session of the user, signing the device out.
+func (h *SessionHandler) Delete(c *gin.Context) {
+	var (
+		user    *userservice.User
+		ok      bool
+		id      int
+		err     error
+		session *authservice.Session
+	)
+
+	if user, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`Delete(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	// an API key, an OAuth client or an admin acting as the user can not
+	// sign the user out
+	if isDelegated(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if session, err = h.authservice.GetSession(user.ID, uint(id)); err != nil {
+		h.log.WithError(err).Errorf("Delete(): h.authservice.GetSession error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if err = h.authservice.RevokeSession(session); err != nil {
+		h.log.WithError(err).Errorf("Delete(): h.authservice.RevokeSession error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,213 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/maetad/baroness-api/internal/config"
+	"github.com/maetad/baroness-api/internal/handlers"
+	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/apikeyservice"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/sirupsen/logrus"
+)
+
+func newSessionContext(user interface{}, id string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	c.Request = &http.Request{
+		URL:    &url.URL{},
+		Header: make(http.Header),
+	}
+
+	c.Params = gin.Params{
+		{
+			Key:   "id",
+			Value: id,
+		},
+	}
+
+	c.Set("user", user)
+	c.Set("claims", jwt.MapClaims{"sub": "1", "sid": "3"})
+
+	return c, w
+}
+
+func TestSessionHandler_List(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &userservice.User{Model: model.Model{ID: 1}}
+	options := config.Options{JWTRefreshExpiredIn: 24 * time.Hour}
+
+	tests := []struct {
+		name        string
+		authservice func() *mocks.AuthServiceInterface
+		user        interface{}
+		want        int
+		wantCurrent []bool
+	}{
+		{
+			name:        "current user is incorrect",
+			authservice: func() *mocks.AuthServiceInterface { return nil },
+			user:        "user",
+			want:        http.StatusUnauthorized,
+		},
+		{
+			name: "list fail",
+			authservice: func() *mocks.AuthServiceInterface {
+				a := &mocks.AuthServiceInterface{}
+				a.On("ListSessions", uint(1), 24*time.Hour).
+					Return(nil, errors.New("database error"))
+
+				return a
+			},
+			user: user,
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "sessions found",
+			authservice: func() *mocks.AuthServiceInterface {
+				a := &mocks.AuthServiceInterface{}
+				a.On("ListSessions", uint(1), 24*time.Hour).
+					Return([]authservice.Session{{ID: 2, UserID: 1}, {ID: 3, UserID: 1}}, nil)
+
+				return a
+			},
+			user:        user,
+			want:        http.StatusOK,
+			wantCurrent: []bool{false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := newSessionContext(tt.user, "")
+			h := handlers.NewSessionHandler(logrus.WithContext(context.TODO()), options, tt.authservice())
+			h.List(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("List() = %v, want %v", c.Writer.Status(), tt.want)
+				return
+			}
+
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var got []authservice.Session
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("List() body %v", w.Body.String())
+			}
+
+			for i, s := range got {
+				if s.Current != tt.wantCurrent[i] {
+					t.Errorf("List() session %v current = %v, want %v", s.ID, s.Current, tt.wantCurrent[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSessionHandler_Delete(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &userservice.User{Model: model.Model{ID: 1}}
+	session := &authservice.Session{ID: 2, UserID: 1}
+
+	revoked := func(err error) func() *mocks.AuthServiceInterface {
+		return func() *mocks.AuthServiceInterface {
+			a := &mocks.AuthServiceInterface{}
+			a.On("GetSession", uint(1), uint(2)).
+				Return(session, nil)
+			a.On("RevokeSession", session).
+				Return(err)
+
+			return a
+		}
+	}
+
+	tests := []struct {
+		name        string
+		authservice func() *mocks.AuthServiceInterface
+		user        interface{}
+		id          string
+		apiKey      bool
+		want        int
+	}{
+		{
+			name:        "current user is incorrect",
+			authservice: func() *mocks.AuthServiceInterface { return nil },
+			user:        "user",
+			id:          "2",
+			want:        http.StatusUnauthorized,
+		},
+		{
+			name:        "api key",
+			authservice: func() *mocks.AuthServiceInterface { return nil },
+			user:        user,
+			id:          "2",
+			apiKey:      true,
+			want:        http.StatusForbidden,
+		},
+		{
+			name:        "id is not int",
+			authservice: func() *mocks.AuthServiceInterface { return nil },
+			user:        user,
+			id:          "two",
+			want:        http.StatusNotFound,
+		},
+		{
+			name: "session not found",
+			authservice: func() *mocks.AuthServiceInterface {
+				a := &mocks.AuthServiceInterface{}
+				a.On("GetSession", uint(1), uint(2)).
+					Return(nil, authservice.ErrSessionNotFound)
+
+				return a
+			},
+			user: user,
+			id:   "2",
+			want: http.StatusNotFound,
+		},
+		{
+			name:        "revoke fail",
+			authservice: revoked(errors.New("database error")),
+			user:        user,
+			id:          "2",
+			want:        http.StatusInternalServerError,
+		},
+		{
+			name:        "session revoked",
+			authservice: revoked(nil),
+			user:        user,
+			id:          "2",
+			want:        http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newSessionContext(tt.user, tt.id)
+			if tt.apiKey {
+				c.Set("api_key", &apikeyservice.APIKey{})
+			}
+
+			h := handlers.NewSessionHandler(logrus.WithContext(context.TODO()), config.Options{}, tt.authservice())
+			h.Delete(c)
+			c.Writer.WriteHeaderNow()
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Delete() = %v, want %v", c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
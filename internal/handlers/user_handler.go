@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/maetad/baroness-api/internal/database"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
 	"github.com/maetad/baroness-api/internal/services/userservice"
 	"github.com/sirupsen/logrus"
 )
@@ -12,20 +18,77 @@ import (
 type UserHandler struct {
 	log         *logrus.Entry
 	userservice userservice.UserServiceInterface
+	roleservice roleservice.RoleServiceInterface
 }
 
-func NewUserHandler(log *logrus.Entry, userservice userservice.UserServiceInterface) *UserHandler {
-	return &UserHandler{log, userservice}
+func NewUserHandler(
+	log *logrus.Entry,
+	userservice userservice.UserServiceInterface,
+	roleservice roleservice.RoleServiceInterface,
+) *UserHandler {
+	return &UserHandler{log, userservice, roleservice}
 }
 
+// List answers a page of the users with the total matching the filters, and
+// the link to the next page while there is one.
 func (h *UserHandler) List(c *gin.Context) {
-	list, err := h.userservice.List()
+	var r userservice.UserListRequest
+	if err := c.ShouldBindQuery(&r); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	list, err := h.userservice.List(r)
+	if err != nil {
+		h.log.WithError(err).Errorf("List(): h.userservice.List error %v", err)
+		if errors.Is(err, userservice.ErrCursorInvalid) || errors.Is(err, userservice.ErrSortInvalid) {
+			c.AbortWithStatus(http.StatusUnprocessableEntity)
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	links := gin.H{}
+	if list.NextCursor != "" {
+		q := c.Request.URL.Query()
+		q.Del("offset")
+		q.Set("cursor", list.NextCursor)
+		links["next"] = c.Request.URL.Path + "?" + q.Encode()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        list.Users,
+		"total":       list.Total,
+		"limit":       list.Limit,
+		"offset":      list.Offset,
+		"next_cursor": list.NextCursor,
+		"links":       links,
+	})
+}
+
+// Search answers the users whose username or display name contains q, the
+// best matches first.
+func (h *UserHandler) Search(c *gin.Context) {
+	var r userservice.UserSearchRequest
+	if err := c.ShouldBindQuery(&r); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if r.Limit == 0 {
+		r.Limit = userservice.DefaultListLimit
+	}
+
+	users, err := h.userservice.Search(r.Query, r.Limit)
 	if err != nil {
+		h.log.WithError(err).Errorf("Search(): h.userservice.Search error %v", err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
-	c.JSON(http.StatusOK, list)
+	c.JSON(http.StatusOK, gin.H{"data": users})
 }
 
 func (h *UserHandler) Create(c *gin.Context) {
@@ -35,9 +98,15 @@ func (h *UserHandler) Create(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userservice.Create(r)
+	user, err := h.userservice.Create(r, func(tx database.DatabaseInterface, user *userservice.User) error {
+		return h.roleservice.WithDB(tx).SetUserRoles(user.ID, []string{roleservice.RoleUser})
+	})
 	if err != nil {
 		h.log.WithError(err).Errorf("Create(): h.userservice.Create error %v", err)
+		if abortOnPasswordPolicy(c, err) {
+			return
+		}
+
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
@@ -45,6 +114,141 @@ func (h *UserHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, user)
 }
 
+// Import creates users from a CSV or NDJSON body. Unless mode is best_effort,
+// no user is created when any row is invalid, and the response is 422.
+func (h *UserHandler) Import(c *gin.Context) {
+	var r userservice.UserImportRequest
+	if err := c.ShouldBindQuery(&r); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	format := r.Format
+	if format == "" {
+		if format = importFormat(c.ContentType()); format == "" {
+			c.AbortWithStatus(http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+
+	options := userservice.UserImportOptions{
+		DryRun:     r.DryRun,
+		BestEffort: r.Mode == "best_effort",
+		Created: func(tx database.DatabaseInterface, user *userservice.User) error {
+			return h.roleservice.WithDB(tx).SetUserRoles(user.ID, []string{roleservice.RoleUser})
+		},
+	}
+
+	result, err := h.userservice.Import(c.Request.Body, format, options)
+	if err != nil {
+		h.log.WithError(err).Errorf("Import(): h.userservice.Import error %v", err)
+		if errors.Is(err, userservice.ErrImportInvalid) {
+			c.AbortWithStatus(http.StatusUnprocessableEntity)
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if len(result.Errors) > 0 && !options.BestEffort {
+		status = http.StatusUnprocessableEntity
+	}
+
+	users := result.Users
+	if users == nil {
+		users = []userservice.UserInterface{}
+	}
+
+	errs := result.Errors
+	if errs == nil {
+		errs = []userservice.UserImportError{}
+	}
+
+	c.JSON(status, gin.H{
+		"dry_run":  r.DryRun,
+		"imported": len(users),
+		"users":    users,
+		"errors":   errs,
+	})
+}
+
+// Export streams every user as CSV or NDJSON, CSV by default.
+func (h *UserHandler) Export(c *gin.Context) {
+	var r userservice.UserExportRequest
+	if err := c.ShouldBindQuery(&r); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	var (
+		write func(user *userservice.User) error
+		flush = func() error { return nil }
+	)
+
+	switch r.Format {
+	case userservice.ImportFormatNDJSON:
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", `attachment; filename="users.ndjson"`)
+
+		encoder := json.NewEncoder(c.Writer)
+		write = func(user *userservice.User) error {
+			return encoder.Encode(user)
+		}
+	default:
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", `attachment; filename="users.csv"`)
+
+		writer := csv.NewWriter(c.Writer)
+		header := false
+		write = func(user *userservice.User) error {
+			if !header {
+				header = true
+				if err := writer.Write(exportColumns); err != nil {
+					return err
+				}
+			}
+
+			return writer.Write([]string{
+				strconv.FormatUint(uint64(user.ID), 10),
+				user.Username,
+				user.DisplayName,
+				user.Email,
+				strconv.FormatBool(user.TOTPEnabled),
+				user.CreatedAt.Format(time.RFC3339),
+			})
+		}
+		flush = func() error {
+			if !header {
+				if err := writer.Write(exportColumns); err != nil {
+					return err
+				}
+			}
+
+			writer.Flush()
+			return writer.Error()
+		}
+	}
+
+	err := h.userservice.Export(func(user userservice.UserInterface) error {
+		return write(user.(*userservice.User))
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		h.log.WithError(err).Errorf("Export(): h.userservice.Export error %v", err)
+		// once the body has started, the status can not change any more
+		if !c.Writer.Written() {
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
 func (h *UserHandler) Get(c *gin.Context) {
 	var (
 		id  int
@@ -89,9 +293,17 @@ func (h *UserHandler) Update(c *gin.Context) {
 		return
 	}
 
+	if !canActOn(c, h.log, h.roleservice, uint(id)) {
+		return
+	}
+
 	user, err = h.userservice.Update(user, r)
 	if err != nil {
 		h.log.WithError(err).Errorf("Update(): h.userservice.Update error %v", err)
+		if abortOnPasswordPolicy(c, err) {
+			return
+		}
+
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
@@ -124,13 +336,34 @@ func (h *UserHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if user, err = h.userservice.Get(uint(id)); err != nil {
+	var r userservice.UserDeleteRequest
+	if err = c.ShouldBindQuery(&r); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	// a user can be purged after it has been deleted
+	if r.Purge {
+		user, err = h.userservice.GetUnscoped(uint(id))
+	} else {
+		user, err = h.userservice.Get(uint(id))
+	}
+	if err != nil {
 		h.log.WithError(err).Errorf("Delete(): h.userservice.Get error %v", err)
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
 
-	if err = h.userservice.Delete(user); err != nil {
+	if !canActOn(c, h.log, h.roleservice, uint(id)) {
+		return
+	}
+
+	if r.Purge {
+		err = h.userservice.Purge(user)
+	} else {
+		err = h.userservice.Delete(user)
+	}
+	if err != nil {
 		h.log.WithError(err).Errorf("Delete(): h.userservice.Delete error %v", err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
@@ -138,3 +371,181 @@ func (h *UserHandler) Delete(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// Restore brings back a deleted user, with the roles it had.
+func (h *UserHandler) Restore(c *gin.Context) {
+	var (
+		id   int
+		err  error
+		user userservice.UserInterface
+	)
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if user, err = h.userservice.GetUnscoped(uint(id)); err != nil {
+		h.log.WithError(err).Errorf("Restore(): h.userservice.GetUnscoped error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if !canActOn(c, h.log, h.roleservice, uint(id)) {
+		return
+	}
+
+	if err = h.userservice.Restore(user); err != nil {
+		h.log.WithError(err).Errorf("Restore(): h.userservice.Restore error %v", err)
+		if errors.Is(err, userservice.ErrUserNotDeleted) || errors.Is(err, userservice.ErrUsernameTaken) {
+			c.AbortWithStatus(http.StatusConflict)
+			return
+		}
+
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *UserHandler) GetRoles(c *gin.Context) {
+	var (
+		id  int
+		err error
+	)
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if _, err = h.userservice.Get(uint(id)); err != nil {
+		h.log.WithError(err).Errorf("GetRoles(): h.userservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	roles, err := h.roleservice.GetUserRoles(uint(id))
+	if err != nil {
+		h.log.WithError(err).Errorf("GetRoles(): h.roleservice.GetUserRoles error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// SetRoles replaces the roles of a user. Users can not change their own roles,
+// so an administrator can not lock everyone out by accident.
+func (h *UserHandler) SetRoles(c *gin.Context) {
+	var (
+		currentUser *userservice.User
+		ok          bool
+		id          int
+		err         error
+	)
+
+	if currentUser, ok = c.MustGet("user").(*userservice.User); !ok {
+		h.log.Error(`SetRoles(): c.MustGet("user") is not *userservice.User`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if id, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	var r roleservice.UserRolesRequest
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if currentUser.ID == uint(id) {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if _, err = h.userservice.Get(uint(id)); err != nil {
+		h.log.WithError(err).Errorf("SetRoles(): h.userservice.Get error %v", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	roles, err := h.roleservice.List()
+	if err != nil {
+		h.log.WithError(err).Errorf("SetRoles(): h.roleservice.List error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if !canActOn(c, h.log, h.roleservice, uint(id)) {
+		return
+	}
+
+	// the roles must not grant more than the current user has
+	var permissions []string
+	for _, role := range roles {
+		if contains(r.Roles, role.Name) {
+			permissions = append(permissions, role.Permissions...)
+		}
+	}
+
+	granted, err := canGrant(h.roleservice, currentUser, permissions)
+	if err != nil {
+		h.log.WithError(err).Errorf("SetRoles(): h.roleservice.GetUserAccess error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if !granted {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	if err = h.roleservice.SetUserRoles(uint(id), r.Roles); err != nil {
+		h.log.WithError(err).Errorf("SetRoles(): h.roleservice.SetUserRoles error %v", err)
+		abortOnRoleError(c, err)
+		return
+	}
+
+	userRoles, err := h.roleservice.GetUserRoles(uint(id))
+	if err != nil {
+		h.log.WithError(err).Errorf("SetRoles(): h.roleservice.GetUserRoles error %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, userRoles)
+}
+
+// exportColumns are the columns of a CSV export.
+var exportColumns = []string{"id", "username", "display_name", "email", "totp_enabled", "created_at"}
+
+// importFormat is the import format of a media type, empty when there is
+// none.
+func importFormat(mediaType string) string {
+	switch mediaType {
+	case "text/csv":
+		return userservice.ImportFormatCSV
+	case "application/x-ndjson", "application/ndjson":
+		return userservice.ImportFormatNDJSON
+	}
+
+	return ""
+}
+
+// abortOnPasswordPolicy responds with the broken rules when err is a password
+// policy violation.
+func abortOnPasswordPolicy(c *gin.Context, err error) bool {
+	var policyErr *userservice.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"errors": policyErr.Violations})
+
+	return true
+}
@@ -2,6 +2,7 @@ package handlers_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
@@ -10,13 +11,16 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/maetad/baroness-api/internal/handlers"
 	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
 	"github.com/maetad/baroness-api/internal/services/userservice"
 	"github.com/maetad/baroness-api/mocks"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestNewUserHandler(t *testing.T) {
@@ -25,6 +29,7 @@ func TestNewUserHandler(t *testing.T) {
 	type args struct {
 		log         *logrus.Entry
 		userservice userservice.UserServiceInterface
+		roleservice roleservice.RoleServiceInterface
 	}
 	tests := []struct {
 		name string
@@ -37,7 +42,7 @@ func TestNewUserHandler(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := handlers.NewUserHandler(tt.args.log, tt.args.userservice); reflect.TypeOf(got) != reflect.TypeOf(&handlers.UserHandler{}) {
+			if got := handlers.NewUserHandler(tt.args.log, tt.args.userservice, tt.args.roleservice); reflect.TypeOf(got) != reflect.TypeOf(&handlers.UserHandler{}) {
 				t.Errorf("NewUserHandler() = %v, want %v", got, tt.want)
 			}
 		})
@@ -50,73 +55,179 @@ func TestUserHandler_List(t *testing.T) {
 	type fields struct {
 		log         *logrus.Entry
 		userservice userservice.UserServiceInterface
+		roleservice roleservice.RoleServiceInterface
 	}
 	type args struct {
 		c *gin.Context
+		w *httptest.ResponseRecorder
 	}
+
+	request := func(query string) args {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		c.Request = &http.Request{
+			URL:    &url.URL{Path: "/users/", RawQuery: query},
+			Header: make(http.Header),
+		}
+
+		return args{c, w}
+	}
+
+	page := &userservice.UserList{Users: make([]userservice.UserInterface, 1), Total: 2, Limit: 1, NextCursor: "next"}
+	cursorInvalid := userservice.ErrCursorInvalid
+
 	tests := []struct {
-		name   string
-		fields fields
-		args   args
-		want   int
+		name     string
+		fields   fields
+		args     args
+		want     int
+		wantNext string
 	}{
 		{
 			name: "listed success",
 			fields: func() fields {
-				users := make([]userservice.UserInterface, 1)
 				userservice := &mocks.UserServiceInterface{}
-				userservice.On("List").
-					Return(users, nil)
+				userservice.On("List", mock.AnythingOfType("userservice.UserListRequest")).
+					Return(page, nil)
 				return fields{
 					log:         logrus.WithContext(context.TODO()),
 					userservice: userservice,
 				}
 			}(),
-			args: func() args {
-				w := httptest.NewRecorder()
-				c, _ := gin.CreateTestContext(w)
-
-				c.Request = &http.Request{
-					URL:    &url.URL{},
-					Header: make(http.Header),
+			args:     request("limit=1&offset=0&sort=-username"),
+			want:     http.StatusOK,
+			wantNext: "/users/?cursor=next&limit=1&sort=-username",
+		},
+		{
+			name: "limit too large",
+			fields: fields{
+				log: logrus.WithContext(context.TODO()),
+			},
+			args: request("limit=500"),
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "sort column unknown",
+			fields: fields{
+				log: logrus.WithContext(context.TODO()),
+			},
+			args: request("sort=password"),
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "cursor with offset",
+			fields: fields{
+				log: logrus.WithContext(context.TODO()),
+			},
+			args: request("cursor=next&offset=20"),
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "cursor invalid",
+			fields: func() fields {
+				userservice := &mocks.UserServiceInterface{}
+				userservice.On("List", mock.AnythingOfType("userservice.UserListRequest")).
+					Return(nil, cursorInvalid)
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					userservice: userservice,
 				}
-
-				return args{c}
 			}(),
-			want: http.StatusOK,
+			args: request("cursor=garbage"),
+			want: http.StatusUnprocessableEntity,
 		},
 		{
 			name: "listed fail",
 			fields: func() fields {
 				userservice := &mocks.UserServiceInterface{}
-				userservice.On("List").
+				userservice.On("List", mock.AnythingOfType("userservice.UserListRequest")).
 					Return(nil, errors.New("list fail"))
 				return fields{
 					log:         logrus.WithContext(context.TODO()),
 					userservice: userservice,
 				}
 			}(),
-			args: func() args {
-				w := httptest.NewRecorder()
-				c, _ := gin.CreateTestContext(w)
-
-				c.Request = &http.Request{
-					URL:    &url.URL{},
-					Header: make(http.Header),
-				}
-
-				return args{c}
-			}(),
+			args: request(""),
 			want: http.StatusInternalServerError,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			h := handlers.NewUserHandler(tt.fields.log, tt.fields.userservice)
+			h := handlers.NewUserHandler(tt.fields.log, tt.fields.userservice, tt.fields.roleservice)
 			h.List(tt.args.c)
 
 			if tt.args.c.Writer.Status() != tt.want {
 				t.Errorf("List() = %v, want %v", tt.args.c.Writer.Status(), tt.want)
+				return
+			}
+
+			if tt.wantNext == "" {
+				return
+			}
+
+			var got struct {
+				Total int `json:"total"`
+				Links struct {
+					Next string `json:"next"`
+				} `json:"links"`
+			}
+			if err := json.Unmarshal(tt.args.w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("List() body %v", tt.args.w.Body.String())
+			}
+
+			if got.Total != 2 || got.Links.Next != tt.wantNext {
+				t.Errorf("List() total = %v, next = %v, want %v", got.Total, got.Links.Next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestUserHandler_Search(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name  string
+		query string
+		err   error
+		want  int
+	}{
+		{
+			name:  "query missing",
+			query: "limit=5",
+			want:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:  "search fail",
+			query: "q=ali",
+			err:   errors.New("database error"),
+			want:  http.StatusInternalServerError,
+		},
+		{
+			name:  "users found",
+			query: "q=ali",
+			want:  http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			c.Request = &http.Request{
+				URL:    &url.URL{RawQuery: tt.query},
+				Header: make(http.Header),
+			}
+
+			u := &mocks.UserServiceInterface{}
+			u.On("Search", "ali", 20).
+				Return([]userservice.UserInterface{&userservice.User{Username: "alice"}}, tt.err)
+
+			h := handlers.NewUserHandler(logrus.WithContext(context.TODO()), u, nil)
+			h.Search(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Search() = %v, want %v", c.Writer.Status(), tt.want)
 			}
 		})
 	}
@@ -128,6 +239,7 @@ func TestUserHandler_Create(t *testing.T) {
 	type fields struct {
 		log         *logrus.Entry
 		userservice userservice.UserServiceInterface
+		roleservice roleservice.RoleServiceInterface
 	}
 	type args struct {
 		c *gin.Context
@@ -141,14 +253,26 @@ func TestUserHandler_Create(t *testing.T) {
 		{
 			name: "user created success",
 			fields: func() fields {
+				// the role is assigned with the transaction creating the user
+				tx := &mocks.DatabaseInterface{}
+				user := &userservice.User{Model: model.Model{ID: 1}}
 				u := &mocks.UserServiceInterface{}
 				u.On("Create", userservice.UserCreateRequest{
 					Username:    "username",
 					Password:    "password",
 					DisplayName: "Adminstrator",
-				}).Return(&userservice.User{}, nil)
+				}, mock.AnythingOfType("userservice.CreatedFunc")).
+					Return(user, func(_ userservice.UserCreateRequest, created userservice.CreatedFunc) error {
+						return created(tx, user)
+					})
+				r := &mocks.RoleServiceInterface{}
+				r.On("WithDB", tx).
+					Return(r)
+				r.On("SetUserRoles", uint(1), []string{roleservice.RoleUser}).
+					Return(nil)
 				return fields{
 					userservice: u,
+					roleservice: r,
 					log:         logrus.WithContext(context.TODO()),
 				}
 			}(),
@@ -166,6 +290,46 @@ func TestUserHandler_Create(t *testing.T) {
 			}(),
 			want: http.StatusCreated,
 		},
+		{
+			name: "assign role fail",
+			fields: func() fields {
+				// the role is assigned with the transaction creating the user
+				tx := &mocks.DatabaseInterface{}
+				user := &userservice.User{Model: model.Model{ID: 1}}
+				u := &mocks.UserServiceInterface{}
+				u.On("Create", userservice.UserCreateRequest{
+					Username:    "username",
+					Password:    "password",
+					DisplayName: "Adminstrator",
+				}, mock.AnythingOfType("userservice.CreatedFunc")).
+					Return(user, func(_ userservice.UserCreateRequest, created userservice.CreatedFunc) error {
+						return created(tx, user)
+					})
+				r := &mocks.RoleServiceInterface{}
+				r.On("WithDB", tx).
+					Return(r)
+				r.On("SetUserRoles", uint(1), []string{roleservice.RoleUser}).
+					Return(errors.New("database error"))
+				return fields{
+					userservice: u,
+					roleservice: r,
+					log:         logrus.WithContext(context.TODO()),
+				}
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+					Body:   io.NopCloser(strings.NewReader(`{"username":"username","password":"password","display_name":"Adminstrator"}`)),
+				}
+
+				return args{c}
+			}(),
+			want: http.StatusInternalServerError,
+		},
 		{
 			name: "user created fail invalid payload",
 			fields: func() fields {
@@ -174,7 +338,7 @@ func TestUserHandler_Create(t *testing.T) {
 					Username:    "username",
 					Password:    "password",
 					DisplayName: "Adminstrator",
-				}).Return(&userservice.User{}, nil)
+				}, mock.Anything).Return(&userservice.User{}, nil)
 				return fields{
 					userservice: u,
 					log:         logrus.WithContext(context.TODO()),
@@ -194,6 +358,38 @@ func TestUserHandler_Create(t *testing.T) {
 			}(),
 			want: http.StatusUnprocessableEntity,
 		},
+		{
+			name: "user created fail password policy",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Create", userservice.UserCreateRequest{
+					Username:    "username",
+					Password:    "password",
+					DisplayName: "Adminstrator",
+				}, mock.Anything).Return(nil, &userservice.PasswordPolicyError{
+					Violations: []userservice.PasswordViolation{
+						{Field: "password", Rule: "deny_list", Message: "password is too common"},
+					},
+				})
+				return fields{
+					userservice: u,
+					log:         logrus.WithContext(context.TODO()),
+				}
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+					Body:   io.NopCloser(strings.NewReader(`{"username":"username","password":"password","display_name":"Adminstrator"}`)),
+				}
+
+				return args{c}
+			}(),
+			want: http.StatusUnprocessableEntity,
+		},
 		{
 			name: "user created fail",
 			fields: func() fields {
@@ -202,7 +398,7 @@ func TestUserHandler_Create(t *testing.T) {
 					Username:    "username",
 					Password:    "password",
 					DisplayName: "Adminstrator",
-				}).Return(nil, errors.New("create error"))
+				}, mock.Anything).Return(nil, errors.New("create error"))
 				return fields{
 					userservice: u,
 					log:         logrus.WithContext(context.TODO()),
@@ -225,7 +421,7 @@ func TestUserHandler_Create(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			h := handlers.NewUserHandler(tt.fields.log, tt.fields.userservice)
+			h := handlers.NewUserHandler(tt.fields.log, tt.fields.userservice, tt.fields.roleservice)
 			h.Create(tt.args.c)
 
 			if tt.args.c.Writer.Status() != tt.want {
@@ -235,10 +431,257 @@ func TestUserHandler_Create(t *testing.T) {
 	}
 }
 
+func TestUserHandler_Import(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	imported := &userservice.UserImportResult{
+		Users: []userservice.UserInterface{&userservice.User{Model: model.Model{ID: 1}, Username: "alice"}},
+	}
+	invalid := &userservice.UserImportResult{
+		Errors: []userservice.UserImportError{{Row: 1, Field: "username", Message: "username is required"}},
+	}
+	importInvalid := userservice.ErrImportInvalid
+
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		options     userservice.UserImportOptions
+		format      string
+		result      *userservice.UserImportResult
+		err         error
+		rolesErr    error
+		wantRoles   bool
+		want        int
+	}{
+		{
+			name:  "query invalid",
+			query: "mode=all",
+			want:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "content type unsupported",
+			contentType: "application/json",
+			want:        http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "import invalid",
+			contentType: "text/csv; charset=utf-8",
+			format:      userservice.ImportFormatCSV,
+			err:         importInvalid,
+			want:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "import fail",
+			contentType: "text/csv",
+			format:      userservice.ImportFormatCSV,
+			err:         errors.New("database error"),
+			want:        http.StatusInternalServerError,
+		},
+		{
+			name:        "rows invalid",
+			contentType: "application/x-ndjson",
+			format:      userservice.ImportFormatNDJSON,
+			result:      invalid,
+			want:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "rows invalid best effort",
+			query:   "format=ndjson&mode=best_effort",
+			format:  userservice.ImportFormatNDJSON,
+			options: userservice.UserImportOptions{BestEffort: true},
+			result:  invalid,
+			want:    http.StatusOK,
+		},
+		{
+			name:    "dry run",
+			query:   "format=csv&dry_run=true",
+			format:  userservice.ImportFormatCSV,
+			options: userservice.UserImportOptions{DryRun: true},
+			result:  imported,
+			want:    http.StatusOK,
+		},
+		{
+			name:      "assign role fail fails the row",
+			query:     "format=csv",
+			format:    userservice.ImportFormatCSV,
+			result:    imported,
+			rolesErr:  errors.New("database error"),
+			wantRoles: true,
+			want:      http.StatusOK,
+		},
+		{
+			name:      "users imported",
+			query:     "format=csv",
+			format:    userservice.ImportFormatCSV,
+			result:    imported,
+			wantRoles: true,
+			want:      http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			c.Request = &http.Request{
+				URL:    &url.URL{RawQuery: tt.query},
+				Header: http.Header{"Content-Type": []string{tt.contentType}},
+				Body:   io.NopCloser(strings.NewReader("username\nalice\n")),
+			}
+
+			// the users are created by the import, which assigns their roles
+			// with the transaction creating them
+			tx := &mocks.DatabaseInterface{}
+			var createdErr error
+
+			u := &mocks.UserServiceInterface{}
+			u.On("Import", mock.Anything, tt.format, mock.MatchedBy(func(options userservice.UserImportOptions) bool {
+				return options.DryRun == tt.options.DryRun && options.BestEffort == tt.options.BestEffort
+			})).
+				Run(func(args mock.Arguments) {
+					options := args.Get(2).(userservice.UserImportOptions)
+					if tt.result == nil || options.DryRun {
+						return
+					}
+
+					for _, user := range tt.result.Users {
+						createdErr = options.Created(tx, user.(*userservice.User))
+					}
+				}).
+				Return(tt.result, tt.err)
+			r := &mocks.RoleServiceInterface{}
+			r.On("WithDB", tx).
+				Return(r)
+			r.On("SetUserRoles", uint(1), []string{roleservice.RoleUser}).
+				Return(tt.rolesErr)
+
+			h := handlers.NewUserHandler(logrus.WithContext(context.TODO()), u, r)
+			h.Import(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Import() = %v, want %v", c.Writer.Status(), tt.want)
+			}
+
+			if called := len(r.Calls) > 0; called != tt.wantRoles {
+				t.Errorf("Import() SetUserRoles called = %v, want %v", called, tt.wantRoles)
+			}
+
+			if !errors.Is(createdErr, tt.rolesErr) {
+				t.Errorf("Import() created error = %v, want %v", createdErr, tt.rolesErr)
+			}
+		})
+	}
+}
+
+func TestUserHandler_Export(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	createdAt := time.Date(2022, 8, 1, 10, 0, 0, 0, time.UTC)
+	users := []userservice.UserInterface{
+		&userservice.User{Model: model.Model{ID: 1, CreatedAt: createdAt}, Username: "alice", DisplayName: "Alice", Email: "alice@example.com"},
+		&userservice.User{Model: model.Model{ID: 2, CreatedAt: createdAt}, Username: "bob", DisplayName: "Bob, Jr.", TOTPEnabled: true},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		users    []userservice.UserInterface
+		err      error
+		want     int
+		wantType string
+		wantBody string
+	}{
+		{
+			name:  "format invalid",
+			query: "format=xml",
+			want:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "csv",
+			users:    users,
+			want:     http.StatusOK,
+			wantType: "text/csv",
+			wantBody: "id,username,display_name,email,totp_enabled,created_at\n" +
+				"1,alice,Alice,alice@example.com,false,2022-08-01T10:00:00Z\n" +
+				"2,bob,\"Bob, Jr.\",,true,2022-08-01T10:00:00Z\n",
+		},
+		{
+			name:     "csv without users",
+			want:     http.StatusOK,
+			wantType: "text/csv",
+			wantBody: "id,username,display_name,email,totp_enabled,created_at\n",
+		},
+		{
+			name:     "ndjson",
+			query:    "format=ndjson",
+			users:    users[:1],
+			want:     http.StatusOK,
+			wantType: "application/x-ndjson",
+			wantBody: `{"id":1,"created_at":"2022-08-01T10:00:00Z","updated_at":"0001-01-01T00:00:00Z","username":"alice","display_name":"Alice","email":"alice@example.com","totp_enabled":false}` + "\n",
+		},
+		{
+			name:  "export fail",
+			query: "format=ndjson",
+			err:   errors.New("database error"),
+			want:  http.StatusInternalServerError,
+		},
+		{
+			name:     "export fail after the first user",
+			query:    "format=ndjson",
+			users:    users[:1],
+			err:      errors.New("database error"),
+			want:     http.StatusOK,
+			wantType: "application/x-ndjson",
+			wantBody: `{"id":1,"created_at":"2022-08-01T10:00:00Z","updated_at":"0001-01-01T00:00:00Z","username":"alice","display_name":"Alice","email":"alice@example.com","totp_enabled":false}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			c.Request = &http.Request{
+				URL:    &url.URL{RawQuery: tt.query},
+				Header: make(http.Header),
+			}
+
+			u := &mocks.UserServiceInterface{}
+			u.On("Export", mock.Anything).
+				Return(func(fn func(user userservice.UserInterface) error) error {
+					for _, user := range tt.users {
+						if err := fn(user); err != nil {
+							return err
+						}
+					}
+
+					return tt.err
+				})
+
+			h := handlers.NewUserHandler(logrus.WithContext(context.TODO()), u, nil)
+			h.Export(c)
+			c.Writer.WriteHeaderNow()
+
+			if w.Code != tt.want {
+				t.Errorf("Export() = %v, want %v", w.Code, tt.want)
+			}
+
+			if tt.wantType != "" && w.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("Export() Content-Type = %v, want %v", w.Header().Get("Content-Type"), tt.wantType)
+			}
+
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("Export() body = %v, want %v", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
 func TestUserHandler_Get(t *testing.T) {
 	type fields struct {
 		log         *logrus.Entry
 		userservice userservice.UserServiceInterface
+		roleservice roleservice.RoleServiceInterface
 	}
 	type args struct {
 		c *gin.Context
@@ -345,6 +788,7 @@ func TestUserHandler_Get(t *testing.T) {
 			h := handlers.NewUserHandler(
 				tt.fields.log,
 				tt.fields.userservice,
+				tt.fields.roleservice,
 			)
 			h.Get(tt.args.c)
 
@@ -359,10 +803,14 @@ func TestUserHandler_Update(t *testing.T) {
 	type fields struct {
 		log         *logrus.Entry
 		userservice userservice.UserServiceInterface
+		roleservice roleservice.RoleServiceInterface
 	}
 	type args struct {
 		c *gin.Context
 	}
+
+	admin := withAccess(map[uint][]string{9: {"users.update"}, 1: {}})
+
 	tests := []struct {
 		name   string
 		fields fields
@@ -389,6 +837,7 @@ func TestUserHandler_Update(t *testing.T) {
 				return fields{
 					log:         logrus.WithContext(context.TODO()),
 					userservice: u,
+					roleservice: admin,
 				}
 			}(),
 			args: func() args {
@@ -478,6 +927,39 @@ func TestUserHandler_Update(t *testing.T) {
 			}(),
 			want: http.StatusUnprocessableEntity,
 		},
+		{
+			name: "target more privileged",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(1)).Return(&userservice.User{}, nil)
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					userservice: u,
+					roleservice: withAccess(map[uint][]string{9: {"users.update"}, 1: {"users.update", "roles.update"}}),
+				}
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{},
+					Header: make(http.Header),
+					Body:   io.NopCloser(strings.NewReader(`{"display_name":"display_name","password":"password"}`)),
+				}
+
+				c.Params = gin.Params{
+					{
+						Key:   "id",
+						Value: "1",
+					},
+				}
+
+				return args{c}
+			}(),
+			want: http.StatusForbidden,
+		},
 		{
 			name: "user update fail",
 			fields: func() fields {
@@ -495,6 +977,7 @@ func TestUserHandler_Update(t *testing.T) {
 				return fields{
 					log:         logrus.WithContext(context.TODO()),
 					userservice: u,
+					roleservice: admin,
 				}
 			}(),
 			args: func() args {
@@ -552,7 +1035,9 @@ func TestUserHandler_Update(t *testing.T) {
 			h := handlers.NewUserHandler(
 				tt.fields.log,
 				tt.fields.userservice,
+				tt.fields.roleservice,
 			)
+			tt.args.c.Set("user", &userservice.User{Model: model.Model{ID: 9}})
 			h.Update(tt.args.c)
 
 			if tt.args.c.Writer.Status() != tt.want {
@@ -566,10 +1051,14 @@ func TestUserHandler_Delete(t *testing.T) {
 	type fields struct {
 		log         *logrus.Entry
 		userservice userservice.UserServiceInterface
+		roleservice roleservice.RoleServiceInterface
 	}
 	type args struct {
 		c *gin.Context
 	}
+
+	admin := withAccess(map[uint][]string{0: {"users.delete"}, 1: {}})
+
 	tests := []struct {
 		name   string
 		fields fields
@@ -588,6 +1077,7 @@ func TestUserHandler_Delete(t *testing.T) {
 				return fields{
 					log:         logrus.WithContext(context.TODO()),
 					userservice: u,
+					roleservice: admin,
 				}
 			}(),
 			args: func() args {
@@ -612,6 +1102,104 @@ func TestUserHandler_Delete(t *testing.T) {
 			}(),
 			want: http.StatusNoContent,
 		},
+		{
+			name: "user purge success",
+			fields: func() fields {
+				user := &userservice.User{}
+				u := &mocks.UserServiceInterface{}
+
+				u.On("GetUnscoped", uint(1)).Return(user, nil)
+				u.On("Purge", user).Return(nil)
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					userservice: u,
+					roleservice: admin,
+				}
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{RawQuery: "purge=true"},
+					Header: make(http.Header),
+				}
+
+				c.Params = gin.Params{
+					{
+						Key:   "id",
+						Value: "1",
+					},
+				}
+
+				c.Set("user", &userservice.User{})
+
+				return args{c}
+			}(),
+			want: http.StatusNoContent,
+		},
+		{
+			name: "purge of user more privileged",
+			fields: func() fields {
+				u := &mocks.UserServiceInterface{}
+				u.On("GetUnscoped", uint(1)).Return(&userservice.User{}, nil)
+
+				return fields{
+					log:         logrus.WithContext(context.TODO()),
+					userservice: u,
+					roleservice: withAccess(map[uint][]string{0: {"users.delete"}, 1: {"users.delete", "roles.update"}}),
+				}
+			}(),
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{RawQuery: "purge=true"},
+					Header: make(http.Header),
+				}
+
+				c.Params = gin.Params{
+					{
+						Key:   "id",
+						Value: "1",
+					},
+				}
+
+				c.Set("user", &userservice.User{})
+
+				return args{c}
+			}(),
+			want: http.StatusForbidden,
+		},
+		{
+			name: "purge is not bool",
+			fields: fields{
+				log: logrus.WithContext(context.TODO()),
+			},
+			args: func() args {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+
+				c.Request = &http.Request{
+					URL:    &url.URL{RawQuery: "purge=yes"},
+					Header: make(http.Header),
+				}
+
+				c.Params = gin.Params{
+					{
+						Key:   "id",
+						Value: "1",
+					},
+				}
+
+				c.Set("user", &userservice.User{})
+
+				return args{c}
+			}(),
+			want: http.StatusUnprocessableEntity,
+		},
 		{
 			name: "user not found",
 			fields: func() fields {
@@ -657,6 +1245,7 @@ func TestUserHandler_Delete(t *testing.T) {
 				return fields{
 					log:         logrus.WithContext(context.TODO()),
 					userservice: u,
+					roleservice: admin,
 				}
 			}(),
 			args: func() args {
@@ -781,6 +1370,7 @@ func TestUserHandler_Delete(t *testing.T) {
 			h := handlers.NewUserHandler(
 				tt.fields.log,
 				tt.fields.userservice,
+				tt.fields.roleservice,
 			)
 			h.Delete(tt.args.c)
 
@@ -790,3 +1380,243 @@ func TestUserHandler_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestUserHandler_Restore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &userservice.User{Model: model.Model{ID: 1}}
+	usernameTaken := userservice.ErrUsernameTaken
+
+	restored := func(err error) func() *mocks.UserServiceInterface {
+		return func() *mocks.UserServiceInterface {
+			u := &mocks.UserServiceInterface{}
+			u.On("GetUnscoped", uint(1)).Return(user, nil)
+			u.On("Restore", user).Return(err)
+
+			return u
+		}
+	}
+
+	tests := []struct {
+		name        string
+		userservice func() *mocks.UserServiceInterface
+		id          string
+		target      []string
+		want        int
+	}{
+		{
+			name:        "id is not int",
+			userservice: func() *mocks.UserServiceInterface { return nil },
+			id:          "one",
+			want:        http.StatusNotFound,
+		},
+		{
+			name: "user not found",
+			userservice: func() *mocks.UserServiceInterface {
+				u := &mocks.UserServiceInterface{}
+				u.On("GetUnscoped", uint(1)).Return(nil, errors.New("record not found"))
+
+				return u
+			},
+			id:   "1",
+			want: http.StatusNotFound,
+		},
+		{
+			name: "target more privileged",
+			userservice: func() *mocks.UserServiceInterface {
+				u := &mocks.UserServiceInterface{}
+				u.On("GetUnscoped", uint(1)).Return(user, nil)
+
+				return u
+			},
+			id:     "1",
+			target: []string{"users.delete", "roles.update"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:        "username taken",
+			userservice: restored(usernameTaken),
+			id:          "1",
+			want:        http.StatusConflict,
+		},
+		{
+			name:        "restore fail",
+			userservice: restored(errors.New("database error")),
+			id:          "1",
+			want:        http.StatusInternalServerError,
+		},
+		{
+			name:        "restored",
+			userservice: restored(nil),
+			id:          "1",
+			want:        http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			c.Request = &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			c.Params = gin.Params{{Key: "id", Value: tt.id}}
+			c.Set("user", &userservice.User{Model: model.Model{ID: 9}})
+
+			r := withAccess(map[uint][]string{9: {"users.delete"}, 1: tt.target})
+			h := handlers.NewUserHandler(logrus.WithContext(context.TODO()), tt.userservice(), r)
+			h.Restore(c)
+
+			if c.Writer.Status() != tt.want {
+				t.Errorf("Restore() = %v, want %v", c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
+
+func TestUserHandler_SetRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newContext := func(user interface{}, id string, body string) *gin.Context {
+		c := newRoleContext(id, body)
+		c.Set("user", user)
+
+		return c
+	}
+
+	admin := &userservice.User{Model: model.Model{ID: 1}}
+	body := `{"roles":["support"]}`
+
+	users := func() *mocks.UserServiceInterface {
+		u := &mocks.UserServiceInterface{}
+		u.On("Get", uint(2)).
+			Return(&userservice.User{Model: model.Model{ID: 2}}, nil)
+
+		return u
+	}
+
+	roles := func(target roleservice.Access, access roleservice.Access) *mocks.RoleServiceInterface {
+		r := &mocks.RoleServiceInterface{}
+		r.On("List").
+			Return([]roleservice.Role{
+				{Name: "admin", Permissions: []string{"users.delete"}},
+				{Name: "support", Permissions: []string{"users.read"}},
+			}, nil)
+		r.On("GetUserAccess", uint(2)).
+			Return(target, nil)
+		r.On("GetUserAccess", uint(1)).
+			Return(access, nil)
+
+		return r
+	}
+
+	tests := []struct {
+		name        string
+		userservice userservice.UserServiceInterface
+		roleservice roleservice.RoleServiceInterface
+		c           *gin.Context
+		want        int
+	}{
+		{
+			name: "current user is incorrect",
+			c:    newContext("user", "2", body),
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "id is not int",
+			c:    newContext(admin, "two", body),
+			want: http.StatusNotFound,
+		},
+		{
+			name: "invalid payload",
+			c:    newContext(admin, "2", `{}`),
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "own roles",
+			c:    newContext(admin, "1", body),
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "user not found",
+			userservice: func() *mocks.UserServiceInterface {
+				u := &mocks.UserServiceInterface{}
+				u.On("Get", uint(2)).
+					Return(nil, errors.New("record not found"))
+
+				return u
+			}(),
+			c:    newContext(admin, "2", body),
+			want: http.StatusNotFound,
+		},
+		{
+			name:        "role list fail",
+			userservice: users(),
+			roleservice: func() *mocks.RoleServiceInterface {
+				r := &mocks.RoleServiceInterface{}
+				r.On("List").
+					Return(nil, errors.New("database error"))
+
+				return r
+			}(),
+			c:    newContext(admin, "2", body),
+			want: http.StatusInternalServerError,
+		},
+		{
+			name:        "permission not held",
+			userservice: users(),
+			roleservice: roles(roleservice.Access{}, roleservice.Access{Permissions: []string{"users.read"}}),
+			c:           newContext(admin, "2", `{"roles":["admin"]}`),
+			want:        http.StatusForbidden,
+		},
+		{
+			name:        "target has more permissions",
+			userservice: users(),
+			roleservice: roles(
+				roleservice.Access{Permissions: []string{"users.delete"}},
+				roleservice.Access{Permissions: []string{"users.read"}},
+			),
+			c:    newContext(admin, "2", body),
+			want: http.StatusForbidden,
+		},
+		{
+			name:        "role not found",
+			userservice: users(),
+			roleservice: func() *mocks.RoleServiceInterface {
+				r := roles(roleservice.Access{}, roleservice.Access{Permissions: []string{"users.read"}})
+				r.On("SetUserRoles", uint(2), []string{"support"}).
+					Return(roleservice.ErrRoleNotFound)
+
+				return r
+			}(),
+			c:    newContext(admin, "2", body),
+			want: http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "roles assigned",
+			userservice: users(),
+			roleservice: func() *mocks.RoleServiceInterface {
+				r := roles(roleservice.Access{}, roleservice.Access{Permissions: []string{"users.read"}})
+				r.On("SetUserRoles", uint(2), []string{"support"}).
+					Return(nil)
+				r.On("GetUserRoles", uint(2)).
+					Return([]roleservice.Role{{Name: "support"}}, nil)
+
+				return r
+			}(),
+			c:    newContext(admin, "2", body),
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewUserHandler(logrus.WithContext(context.TODO()), tt.userservice, tt.roleservice)
+			h.SetRoles(tt.c)
+
+			if tt.c.Writer.Status() != tt.want {
+				t.Errorf("SetRoles() = %v, want %v", tt.c.Writer.Status(), tt.want)
+			}
+		})
+	}
+}
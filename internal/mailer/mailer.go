@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer sends mail through the server at host:port. Authentication
+// is skipped when username is empty.
+func NewSMTPMailer(host string, port int, username string, password string, from string) Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{fmt.Sprintf("%s:%d", host, port), auth, from}
+}
+
+func (m *SMTPMailer) Send(to string, subject string, body string) error {
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, message(m.from, to, subject, body))
+}
+
+// FileMailer writes messages to w instead of delivering them, for local
+// development.
+type FileMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewFileMailer(w io.Writer, from string) Mailer {
+	return &FileMailer{w: w, from: from}
+}
+
+func (m *FileMailer) Send(to string, subject string, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.w.Write(append(message(m.from, to, subject, body), "\r\n"...))
+
+	return err
+}
+
+func message(from string, to string, subject string, body string) []byte {
+	// header values must not break out of their line
+	clean := strings.NewReplacer("\r", "", "\n", "").Replace
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", clean(from))
+	fmt.Fprintf(&b, "To: %s\r\n", clean(to))
+	fmt.Fprintf(&b, "Subject: %s\r\n", clean(subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
@@ -0,0 +1,72 @@
+package mailer_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/maetad/baroness-api/internal/mailer"
+)
+
+func TestFileMailer_Send(t *testing.T) {
+	type args struct {
+		to      string
+		subject string
+		body    string
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantHeaders []string
+		wantBody    string
+	}{
+		{
+			name: "message written",
+			args: args{
+				to:      "admin@example.com",
+				subject: "Reset your password",
+				body:    "line 1\nline 2",
+			},
+			wantHeaders: []string{
+				"From: no-reply@example.com\r\n",
+				"To: admin@example.com\r\n",
+				"Subject: Reset your password\r\n",
+			},
+			wantBody: "\r\n\r\nline 1\r\nline 2\r\n",
+		},
+		{
+			name: "header injection",
+			args: args{
+				to:      "admin@example.com\r\nBcc: victim@example.com",
+				subject: "Hello",
+				body:    "body",
+			},
+			wantHeaders: []string{
+				"To: admin@example.comBcc: victim@example.com\r\n",
+			},
+			wantBody: "\r\n\r\nbody\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			m := mailer.NewFileMailer(&buf, "no-reply@example.com")
+			if err := m.Send(tt.args.to, tt.args.subject, tt.args.body); err != nil {
+				t.Errorf("FileMailer.Send() error = %v", err)
+				return
+			}
+
+			got := buf.String()
+			for _, h := range tt.wantHeaders {
+				if !strings.Contains(got, h) {
+					t.Errorf("FileMailer.Send() = %q, want header %q", got, h)
+				}
+			}
+
+			if !strings.Contains(got, tt.wantBody) {
+				t.Errorf("FileMailer.Send() = %q, want body %q", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -6,38 +6,117 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/maetad/baroness-api/internal/config"
 	"github.com/maetad/baroness-api/internal/handlers"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
 	"github.com/sirupsen/logrus"
 )
 
+// registerRouter returns the password handler, Shutdown waits for the reset
+// mails it sends in the background.
 func registerRouter(
 	r *gin.Engine,
 	l *logrus.Entry,
 	o config.Options,
 	services internalService,
-) {
+) *handlers.PasswordHandler {
 	r.GET("/healthz", func(c *gin.Context) {
 		c.String(http.StatusOK, "OK")
 	})
 
-	authHandler := handlers.NewAuthHandler(l, o, services.authservice, services.userservice)
+	authHandler := handlers.NewAuthHandler(l, o, services.authservice, services.userservice, services.lockoutservice, services.mfaservice, services.roleservice, services.apikeyservice, services.loginservice)
 
+	r.GET("/.well-known/jwks.json", authHandler.JWKS)
 	r.POST("/auth/login", authHandler.Login)
+	r.POST("/auth/login/mfa", authHandler.LoginMFA)
+	r.POST("/auth/refresh", authHandler.Refresh)
+
+	oauthHandler := handlers.NewOAuthHandler(l, o, services.authservice, services.userservice, services.oauthservice)
+	r.GET("/.well-known/openid-configuration", oauthHandler.Discovery)
+	r.POST("/oauth/token", oauthHandler.Token)
+
+	if services.oidcservice != nil {
+		oidcHandler := handlers.NewOIDCHandler(l, o, authHandler, services.userservice, services.roleservice, services.oidcservice)
+		r.GET("/auth/oidc/login", oidcHandler.Login)
+		r.POST("/auth/oidc/callback", oidcHandler.Callback)
+	}
+
+	passwordHandler := handlers.NewPasswordHandler(l, o, services.authservice, services.userservice, services.resetservice, services.mailer)
+	r.POST("/auth/password/forgot", passwordHandler.Forgot)
+	r.POST("/auth/password/reset", passwordHandler.Reset)
+
+	// the only endpoint the tokens issued to OAuth clients are accepted by
+	r.GET("/userinfo", authHandler.AuthorizeClient, oauthHandler.UserInfo)
+	r.POST("/userinfo", authHandler.AuthorizeClient, oauthHandler.UserInfo)
 
 	authorized := r.Group("/")
 	authorized.Use(authHandler.Authorize)
 	{
-		meHandler := handlers.NewMeHandler(l, services.userservice)
+		authorized.POST("/auth/logout", authHandler.Logout)
+
+		meHandler := handlers.NewMeHandler(l, o, services.authservice, services.userservice, services.roleservice)
 		authorized.GET("/me", meHandler.Get)
 		authorized.PUT("/me", meHandler.Update)
+		authorized.PUT("/me/password", meHandler.ChangePassword)
+
+		sessionHandler := handlers.NewSessionHandler(l, o, services.authservice)
+		authorized.GET("/me/sessions", sessionHandler.List)
+		authorized.DELETE("/me/sessions/:id", sessionHandler.Delete)
+
+		mfaHandler := handlers.NewMFAHandler(l, services.mfaservice, services.userservice, services.roleservice)
+		authorized.POST("/me/2fa", mfaHandler.Enroll)
+		authorized.POST("/me/2fa/confirm", mfaHandler.Confirm)
+		authorized.DELETE("/me/2fa", mfaHandler.Disable)
+
+		apiKeyHandler := handlers.NewAPIKeyHandler(l, services.apikeyservice, services.roleservice)
+		authorized.GET("/me/api-keys", apiKeyHandler.List)
+		authorized.POST("/me/api-keys", apiKeyHandler.Create)
+		authorized.DELETE("/me/api-keys/:id", apiKeyHandler.Delete)
+
+		can := authHandler.RequirePermission
 
 		userRoute := authorized.Group("/users")
 		{
-			userHandler := handlers.NewUserHandler(l, services.userservice)
-			userRoute.GET("/", userHandler.List)
-			userRoute.POST("/", userHandler.Create)
-			userRoute.GET("/:id", userHandler.Get)
-			userRoute.PUT("/:id", userHandler.Update)
-			userRoute.DELETE("/:id", userHandler.Delete)
+			userHandler := handlers.NewUserHandler(l, services.userservice, services.roleservice)
+			userRoute.GET("/", can(roleservice.PermissionUsersRead), userHandler.List)
+			userRoute.GET("/search", can(roleservice.PermissionUsersRead), userHandler.Search)
+			userRoute.POST("/", can(roleservice.PermissionUsersCreate), userHandler.Create)
+			userRoute.POST("/import", can(roleservice.PermissionUsersCreate), userHandler.Import)
+			userRoute.GET("/export", can(roleservice.PermissionUsersRead), userHandler.Export)
+			userRoute.GET("/:id", can(roleservice.PermissionUsersRead), userHandler.Get)
+			userRoute.PUT("/:id", can(roleservice.PermissionUsersUpdate), userHandler.Update)
+			userRoute.DELETE("/:id", can(roleservice.PermissionUsersDelete), userHandler.Delete)
+			userRoute.POST("/:id/restore", can(roleservice.PermissionUsersDelete), userHandler.Restore)
+			userRoute.DELETE("/:id/sessions", can(roleservice.PermissionUsersSecurity), authHandler.RevokeSessions)
+			userRoute.DELETE("/:id/lockout", can(roleservice.PermissionUsersSecurity), authHandler.Unlock)
+			userRoute.DELETE("/:id/2fa", can(roleservice.PermissionUsersSecurity), mfaHandler.Reset)
+			userRoute.POST("/:id/impersonate", can(roleservice.PermissionUsersImpersonate), authHandler.Impersonate)
+			userRoute.GET("/:id/impersonations", can(roleservice.PermissionUsersSecurity), authHandler.Impersonations)
+			userRoute.GET("/:id/roles", can(roleservice.PermissionUsersRead), userHandler.GetRoles)
+			userRoute.PUT("/:id/roles", can(roleservice.PermissionUsersRoles), userHandler.SetRoles)
+		}
+
+		authorized.POST("/oauth/authorize", oauthHandler.Authorize)
+
+		clientRoute := authorized.Group("/oauth/clients")
+		clientRoute.Use(can(roleservice.PermissionOAuthClients))
+		{
+			clientRoute.GET("/", oauthHandler.ListClients)
+			clientRoute.POST("/", oauthHandler.CreateClient)
+			clientRoute.GET("/:id", oauthHandler.GetClient)
+			clientRoute.DELETE("/:id", oauthHandler.DeleteClient)
+		}
+
+		roleHandler := handlers.NewRoleHandler(l, services.roleservice)
+		authorized.GET("/permissions", can(roleservice.PermissionRolesRead), roleHandler.Permissions)
+
+		roleRoute := authorized.Group("/roles")
+		{
+			roleRoute.GET("/", can(roleservice.PermissionRolesRead), roleHandler.List)
+			roleRoute.POST("/", can(roleservice.PermissionRolesCreate), roleHandler.Create)
+			roleRoute.GET("/:id", can(roleservice.PermissionRolesRead), roleHandler.Get)
+			roleRoute.PUT("/:id", can(roleservice.PermissionRolesUpdate), roleHandler.Update)
+			roleRoute.DELETE("/:id", can(roleservice.PermissionRolesDelete), roleHandler.Delete)
 		}
 	}
+
+	return passwordHandler
 }
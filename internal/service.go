@@ -3,11 +3,23 @@ package internal
 import (
 	"context"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/maetad/baroness-api/internal/config"
 	"github.com/maetad/baroness-api/internal/database"
+	"github.com/maetad/baroness-api/internal/handlers"
+	"github.com/maetad/baroness-api/internal/mailer"
+	"github.com/maetad/baroness-api/internal/services/apikeyservice"
 	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/lockoutservice"
+	"github.com/maetad/baroness-api/internal/services/loginservice"
+	"github.com/maetad/baroness-api/internal/services/mfaservice"
+	"github.com/maetad/baroness-api/internal/services/oauthservice"
+	"github.com/maetad/baroness-api/internal/services/oidcservice"
+	"github.com/maetad/baroness-api/internal/services/resetservice"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
 	"github.com/maetad/baroness-api/internal/services/userservice"
 	"github.com/sirupsen/logrus"
 )
@@ -15,13 +27,24 @@ import (
 var log *logrus.Entry
 
 type Service struct {
-	Http *http.Server
-	log  *logrus.Entry
+	Http            *http.Server
+	log             *logrus.Entry
+	keyring         *authservice.Keyring
+	passwordHandler *handlers.PasswordHandler
 }
 
 type internalService struct {
-	authservice authservice.AuthServiceInterface
-	userservice userservice.UserServiceInterface
+	authservice    authservice.AuthServiceInterface
+	userservice    userservice.UserServiceInterface
+	lockoutservice lockoutservice.LockoutServiceInterface
+	mfaservice     mfaservice.MFAServiceInterface
+	resetservice   resetservice.ResetServiceInterface
+	roleservice    roleservice.RoleServiceInterface
+	apikeyservice  apikeyservice.APIKeyServiceInterface
+	oauthservice   oauthservice.OAuthServiceInterface
+	oidcservice    oidcservice.OIDCServiceInterface
+	loginservice   loginservice.LoginServiceInterface
+	mailer         mailer.Mailer
 }
 
 func New(
@@ -32,8 +55,11 @@ func New(
 	log = l
 
 	r := gin.Default()
+	if err := r.SetTrustedProxies(options.TrustedProxies); err != nil {
+		log.WithError(err).Fatal("r.SetTrustedProxies()")
+	}
 
-	db, err := database.Connect(options)
+	db, err := database.Connect(options.DatabaseDSN())
 	if err != nil {
 		log.WithError(err).Fatal("database.Connect()")
 	}
@@ -53,18 +79,121 @@ func New(
 			Handler: r.Handler(),
 		},
 		log: l,
+		keyring: authservice.NewKeyring(
+			authservice.NewSigningKey(options.JWTSigningMethod, options.JWTSigningKey, options.JWTVerifyKey),
+			options.TokenLifetime(),
+		),
 	}
 
 	services := internalService{
-		authservice: authservice.New(options.JWTSigningMethod, options.JWTSigningKey, options.JWTAllowMethod),
-		userservice: userservice.New(db),
+		authservice: authservice.New(
+			db,
+			authservice.NewDatabaseRevocationStore(db),
+			svc.keyring,
+			options.JWTAllowMethod,
+			options.AppName,
+			options.JWTAudience,
+		),
+		userservice: userservice.New(db, userservice.NewDatabaseUserSearcher(db), options.PasswordPolicy, options.PasswordHasher),
+		lockoutservice: lockoutservice.New(
+			db,
+			lockoutservice.Policy{
+				MaxAttempts:     options.LoginMaxAttempts,
+				Backoff:         options.LoginBackoff,
+				LockoutDuration: options.LoginLockoutDuration,
+			},
+			lockoutservice.Policy{
+				MaxAttempts:     options.LoginIPMaxAttempts,
+				LockoutDuration: options.LoginLockoutDuration,
+			},
+		),
+		mfaservice:    mfaservice.New(db, options.AppName),
+		resetservice:  resetservice.New(db, options.PasswordResetExpiredIn),
+		roleservice:   roleservice.New(db),
+		apikeyservice: apikeyservice.New(db),
+		oauthservice:  oauthservice.New(db, options.OAuthCodeExpiredIn),
+		oidcservice:   newOIDCService(db, options),
+		mailer:        newMailer(options),
 	}
+	services.loginservice = newLoginService(options, services.userservice, services.roleservice)
 
-	registerRouter(r, l, options, services)
+	svc.passwordHandler = registerRouter(r, l, options, services)
 
 	return &svc, nil
 }
 
+// newOIDCService returns nil when no identity provider is configured.
+func newOIDCService(db database.DatabaseInterface, options config.Options) oidcservice.OIDCServiceInterface {
+	if options.OIDCIssuerURL == "" {
+		return nil
+	}
+
+	return oidcservice.New(db, &http.Client{Timeout: 10 * time.Second}, oidcservice.Config{
+		IssuerURL:      options.OIDCIssuerURL,
+		ClientID:       options.OIDCClientID,
+		ClientSecret:   options.OIDCClientSecret,
+		RedirectURL:    options.OIDCRedirectURL,
+		Scopes:         options.OIDCScopes,
+		StateExpiredIn: options.OIDCStateExpiredIn,
+	})
+}
+
+func newLoginService(
+	options config.Options,
+	userservice userservice.UserServiceInterface,
+	roleservice roleservice.RoleServiceInterface,
+) loginservice.LoginServiceInterface {
+	var authenticators []loginservice.Authenticator
+
+	for _, name := range options.LoginAuthenticators {
+		switch name {
+		case "local":
+			authenticators = append(authenticators, loginservice.NewLocalAuthenticator(userservice))
+		case "ldap":
+			authenticators = append(authenticators, loginservice.NewLDAPAuthenticator(loginservice.LDAPConfig{
+				URL:                  options.LDAPURL,
+				StartTLS:             options.LDAPStartTLS,
+				BindDN:               options.LDAPBindDN,
+				BindPassword:         options.LDAPBindPassword,
+				BaseDN:               options.LDAPBaseDN,
+				UserFilter:           options.LDAPUserFilter,
+				UsernameAttribute:    options.LDAPUsernameAttribute,
+				DisplayNameAttribute: options.LDAPDisplayNameAttribute,
+				EmailAttribute:       options.LDAPEmailAttribute,
+				Timeout:              10 * time.Second,
+			}, userservice, roleservice))
+		default:
+			log.Fatalf("unknown login authenticator %v", name)
+		}
+	}
+
+	return loginservice.New(authenticators...)
+}
+
+func newMailer(options config.Options) mailer.Mailer {
+	if options.MailDriver == "smtp" {
+		return mailer.NewSMTPMailer(options.SMTPHost, options.SMTPPort, options.SMTPUsername, options.SMTPPassword, options.MailFrom)
+	}
+
+	if options.MailFile == "" {
+		return mailer.NewFileMailer(os.Stdout, options.MailFrom)
+	}
+
+	f, err := os.OpenFile(options.MailFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.WithError(err).Fatal("os.OpenFile()")
+	}
+
+	return mailer.NewFileMailer(f, options.MailFrom)
+}
+
+// RotateSigningKey signs new tokens with key while tokens signed by the
+// previous key stay valid until they expire.
+func (s *Service) RotateSigningKey(key authservice.SigningKey) {
+	s.keyring.Rotate(key)
+	s.log.WithField("kid", key.ID).Info("Signing key rotated")
+}
+
 func (s *Service) Close() {
 	s.Http.Close()
 }
@@ -72,5 +201,18 @@ func (s *Service) Close() {
 func (s *Service) Shutdown(ctx context.Context) bool {
 	err := s.Http.Shutdown(ctx)
 
+	// reset mails are still being sent after their requests were answered
+	sent := make(chan struct{})
+	go func() {
+		s.passwordHandler.Wait()
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+	case <-ctx.Done():
+		return false
+	}
+
 	return err == nil
 }
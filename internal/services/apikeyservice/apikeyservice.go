@@ -0,0 +1,147 @@
+package apikeyservice
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/database"
+	"gorm.io/gorm"
+)
+
+// keys look like bk_<8 hex chars>_<secret>, the first 11 characters being
+// the prefix.
+const (
+	keyPrefix    = "bk_"
+	prefixLength = len(keyPrefix) + 8
+)
+
+// lastUsedInterval limits how often using a key is written to the database.
+const lastUsedInterval = time.Minute
+
+var (
+	ErrKeyInvalid       = errors.New("api key is invalid")
+	ErrExpiresAtInvalid = errors.New("api key expiry is in the past")
+)
+
+type APIKeyService struct {
+	db database.DatabaseInterface
+}
+
+type APIKeyServiceInterface interface {
+	List(userID uint) ([]APIKey, error)
+	Create(userID uint, r APIKeyCreateRequest) (*APIKey, string, error)
+	Get(userID uint, id uint) (*APIKey, error)
+	Delete(key *APIKey) error
+	Authenticate(key string) (*APIKey, error)
+}
+
+func New(db database.DatabaseInterface) APIKeyServiceInterface {
+	return APIKeyService{db}
+}
+
+func (s APIKeyService) List(userID uint) ([]APIKey, error) {
+	var keys []APIKey
+	if result := s.db.Find(&keys, "user_id = ?", userID); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return keys, nil
+}
+
+// Create issues a key for the user. The key is only returned here, just its
+// hash is stored.
+func (s APIKeyService) Create(userID uint, r APIKeyCreateRequest) (*APIKey, string, error) {
+	if r.ExpiresAt != nil && r.ExpiresAt.Before(time.Now()) {
+		return nil, "", ErrExpiresAtInvalid
+	}
+
+	prefix := make([]byte, 4)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+
+	key := keyPrefix + hex.EncodeToString(prefix) + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	scopes := r.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	apiKey := &APIKey{
+		UserID:    userID,
+		Name:      r.Name,
+		Prefix:    key[:prefixLength],
+		KeyHash:   hashKey(key),
+		Scopes:    scopes,
+		ExpiresAt: r.ExpiresAt,
+	}
+
+	if result := s.db.Create(apiKey); result.Error != nil {
+		return nil, "", result.Error
+	}
+
+	return apiKey, key, nil
+}
+
+func (s APIKeyService) Get(userID uint, id uint) (*APIKey, error) {
+	apiKey := &APIKey{}
+	if result := s.db.First(apiKey, "id = ? AND user_id = ?", id, userID); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return apiKey, nil
+}
+
+func (s APIKeyService) Delete(key *APIKey) error {
+	result := s.db.Delete(key)
+
+	return result.Error
+}
+
+// Authenticate returns the key matching key, as long as it has not expired,
+// and records that it has been used.
+func (s APIKeyService) Authenticate(key string) (*APIKey, error) {
+	if !strings.HasPrefix(key, keyPrefix) || len(key) <= prefixLength || key[prefixLength] != '_' {
+		return nil, ErrKeyInvalid
+	}
+
+	apiKey := &APIKey{}
+	if result := s.db.First(apiKey, "prefix = ?", key[:prefixLength]); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrKeyInvalid
+		}
+
+		return nil, result.Error
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(hashKey(key))) != 1 || apiKey.IsExpired() {
+		return nil, ErrKeyInvalid
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > lastUsedInterval {
+		apiKey.LastUsedAt = &now
+		if result := s.db.Save(apiKey); result.Error != nil {
+			return nil, result.Error
+		}
+	}
+
+	return apiKey, nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
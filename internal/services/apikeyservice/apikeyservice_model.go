@@ -0,0 +1,35 @@
+package apikeyservice
+
+import (
+	"time"
+)
+
+type APIKey struct {
+	ID     uint   `json:"id" gorm:"primarykey"`
+	UserID uint   `json:"user_id"`
+	Name   string `json:"name"`
+	// Prefix is the start of the key, kept in plain text so that the owner
+	// can tell their keys apart.
+	Prefix  string `json:"prefix"`
+	KeyHash string `json:"-"`
+	// Scopes are the permissions the key is limited to, on top of the
+	// permissions of its owner.
+	Scopes     []string   `json:"scopes" gorm:"serializer:json"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k APIKey) IsExpired() bool {
+	return k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt)
+}
+
+func (k APIKey) Allows(permission string) bool {
+	for _, s := range k.Scopes {
+		if s == permission {
+			return true
+		}
+	}
+
+	return false
+}
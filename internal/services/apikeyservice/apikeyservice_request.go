@@ -0,0 +1,11 @@
+package apikeyservice
+
+import (
+	"time"
+)
+
+type APIKeyCreateRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
@@ -0,0 +1,185 @@
+package apikeyservice_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/services/apikeyservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestAPIKeyService_Create(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		request   apikeyservice.APIKeyCreateRequest
+		createErr error
+		wantErr   error
+	}{
+		{
+			name:    "key created",
+			request: apikeyservice.APIKeyCreateRequest{Name: "batch", Scopes: []string{"users.read"}},
+		},
+		{
+			name:    "expiry in the past",
+			request: apikeyservice.APIKeyCreateRequest{Name: "batch", ExpiresAt: &past},
+			wantErr: apikeyservice.ErrExpiresAtInvalid,
+		},
+		{
+			name:      "create fail",
+			request:   apikeyservice.APIKeyCreateRequest{Name: "batch"},
+			createErr: errors.New("database error"),
+			wantErr:   errors.New("database error"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("Create", mock.AnythingOfType("*apikeyservice.APIKey")).
+				Return(&gorm.DB{Error: tt.createErr})
+
+			s := apikeyservice.New(db)
+			got, key, err := s.Create(1, tt.request)
+			if (err == nil) != (tt.wantErr == nil) || (err != nil && err.Error() != tt.wantErr.Error()) {
+				t.Errorf("APIKeyService.Create() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if !strings.HasPrefix(key, got.Prefix+"_") || len(got.Prefix) != 11 {
+				t.Errorf("APIKeyService.Create() key %v does not start with prefix %v", key, got.Prefix)
+			}
+
+			if got.KeyHash == "" || strings.Contains(got.KeyHash, key) {
+				t.Errorf("APIKeyService.Create() stored hash %v", got.KeyHash)
+			}
+
+			if got.UserID != 1 || got.Name != "batch" {
+				t.Errorf("APIKeyService.Create() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestAPIKeyService_Authenticate(t *testing.T) {
+	// issue a real key to authenticate against
+	var stored apikeyservice.APIKey
+	db := &mocks.DatabaseInterface{}
+	db.On("Create", mock.AnythingOfType("*apikeyservice.APIKey")).
+		Run(func(args mock.Arguments) {
+			stored = *args.Get(0).(*apikeyservice.APIKey)
+		}).
+		Return(&gorm.DB{})
+
+	_, key, err := apikeyservice.New(db).Create(1, apikeyservice.APIKeyCreateRequest{Name: "batch"})
+	if err != nil {
+		t.Fatalf("APIKeyService.Create() error = %v", err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	recent := time.Now().Add(-time.Second)
+
+	tests := []struct {
+		name     string
+		key      string
+		stored   func() apikeyservice.APIKey
+		firstErr error
+		wantSave bool
+		wantErr  error
+	}{
+		{
+			name:     "key authenticated",
+			key:      key,
+			stored:   func() apikeyservice.APIKey { return stored },
+			wantSave: true,
+		},
+		{
+			name: "recently used",
+			key:  key,
+			stored: func() apikeyservice.APIKey {
+				k := stored
+				k.LastUsedAt = &recent
+				return k
+			},
+		},
+		{
+			name:    "malformed",
+			key:     "not-a-key",
+			stored:  func() apikeyservice.APIKey { return stored },
+			wantErr: apikeyservice.ErrKeyInvalid,
+		},
+		{
+			name:    "secret mismatch",
+			key:     stored.Prefix + "_wrong",
+			stored:  func() apikeyservice.APIKey { return stored },
+			wantErr: apikeyservice.ErrKeyInvalid,
+		},
+		{
+			name:     "prefix not found",
+			key:      key,
+			stored:   func() apikeyservice.APIKey { return stored },
+			firstErr: gorm.ErrRecordNotFound,
+			wantErr:  apikeyservice.ErrKeyInvalid,
+		},
+		{
+			name: "expired",
+			key:  key,
+			stored: func() apikeyservice.APIKey {
+				k := stored
+				k.ExpiresAt = &past
+				return k
+			},
+			wantErr: apikeyservice.ErrKeyInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := false
+
+			db := &mocks.DatabaseInterface{}
+			db.On("First", mock.AnythingOfType("*apikeyservice.APIKey"), "prefix = ?", stored.Prefix).
+				Run(func(args mock.Arguments) {
+					*args.Get(0).(*apikeyservice.APIKey) = tt.stored()
+				}).
+				Return(&gorm.DB{Error: tt.firstErr})
+			db.On("Save", mock.AnythingOfType("*apikeyservice.APIKey")).
+				Run(func(args mock.Arguments) {
+					saved = true
+				}).
+				Return(&gorm.DB{})
+
+			s := apikeyservice.New(db)
+			got, err := s.Authenticate(tt.key)
+			if err != tt.wantErr {
+				t.Errorf("APIKeyService.Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.ID != stored.ID || saved != tt.wantSave {
+				t.Errorf("APIKeyService.Authenticate() = %+v, saved %v, want %v", got, saved, tt.wantSave)
+			}
+		})
+	}
+}
+
+func TestAPIKey_Allows(t *testing.T) {
+	k := apikeyservice.APIKey{Scopes: []string{"users.read"}}
+
+	if !k.Allows("users.read") {
+		t.Errorf("APIKey.Allows(users.read) = false, want true")
+	}
+
+	if k.Allows("users.delete") {
+		t.Errorf("APIKey.Allows(users.delete) = true, want false")
+	}
+}
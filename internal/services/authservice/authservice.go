@@ -1,22 +1,56 @@
 package authservice
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"reflect"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/maetad/baroness-api/internal/database"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+	ErrTokenInvalid        = errors.New("token is invalid")
+	ErrTokenIssuer         = errors.New("token issuer is invalid")
+	ErrTokenAudience       = errors.New("token audience is invalid")
+	ErrSessionNotFound     = errors.New("session not found")
 )
 
 type AuthService struct {
-	signingMethod      jwt.SigningMethod
-	signingKey         interface{}
+	db                 database.DatabaseInterface
+	revocationStore    RevocationStoreInterface
+	keyring            *Keyring
 	allowSigningMethod AllowSigningMethod
+	issuer             string
+	audience           []string
 }
 
 type AuthServiceInterface interface {
 	GenerateToken(c Claimer, expiredIn time.Duration) (string, error)
 	ParseToken(tokenString string) (jwt.MapClaims, error)
+	GenerateRefreshToken(userID uint, sessionID uint, expiredIn time.Duration) (string, error)
+	RotateRefreshToken(refreshToken string, expiredIn time.Duration) (*RefreshToken, string, error)
+	RevokeRefreshToken(refreshToken string) error
+	RevokeToken(claims jwt.MapClaims) error
+	ConsumeToken(claims jwt.MapClaims) error
+	RevokeUserTokens(userID uint) error
+	IsTokenRevoked(claims jwt.MapClaims, userID uint) (bool, error)
+	JWKS() JSONWebKeySet
+	CreateSession(userID uint, ip string, userAgent string) (*Session, error)
+	ListSessions(userID uint, idleTimeout time.Duration) ([]Session, error)
+	GetSession(userID uint, id uint) (*Session, error)
+	TouchSession(id uint, interval time.Duration) error
+	RevokeSession(session *Session) error
+	RecordImpersonation(actorID uint, userID uint, ip string, userAgent string, expiresAt time.Time) (*Impersonation, error)
+	ListImpersonations(userID uint) ([]Impersonation, error)
 }
 
 type AllowSigningMethod struct {
@@ -46,8 +80,22 @@ type Claimer interface {
 	GetClaims() map[string]interface{}
 }
 
-func New(method jwt.SigningMethod, key interface{}, allowSigningMethod AllowSigningMethod) AuthServiceInterface {
-	return &AuthService{method, key, allowSigningMethod}
+// Claims is a Claimer for tokens which are not issued for a model.
+type Claims map[string]interface{}
+
+func (c Claims) GetClaims() map[string]interface{} {
+	return c
+}
+
+func New(
+	db database.DatabaseInterface,
+	revocationStore RevocationStoreInterface,
+	keyring *Keyring,
+	allowSigningMethod AllowSigningMethod,
+	issuer string,
+	audience []string,
+) AuthServiceInterface {
+	return &AuthService{db, revocationStore, keyring, allowSigningMethod, issuer, audience}
 }
 
 func (s AuthService) GenerateToken(c Claimer, expiredIn time.Duration) (string, error) {
@@ -57,13 +105,33 @@ func (s AuthService) GenerateToken(c Claimer, expiredIn time.Duration) (string,
 		claims[k] = v
 	}
 
-	claims["iat"] = time.Now().Unix()
-	claims["nbf"] = time.Now().Unix()
-	claims["exp"] = time.Now().Add(expiredIn).Unix()
+	jti, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	// an issuer or audience given by c wins, as for ID tokens issued to an
+	// OAuth client
+	claims["jti"] = jti
+	if _, ok := claims["iss"]; !ok && s.issuer != "" {
+		claims["iss"] = s.issuer
+	}
+	if _, ok := claims["aud"]; !ok && len(s.audience) > 0 {
+		claims["aud"] = s.audience
+	}
+	// iat_us orders the token against a revocation of the user's tokens
+	// within the same second, at the precision the revocation is stored
+	now := time.Now()
+	claims["iat"] = now.Unix()
+	claims["iat_us"] = now.UnixMicro()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(expiredIn).Unix()
 
-	token := jwt.NewWithClaims(s.signingMethod, claims)
+	key := s.keyring.Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
 
-	return token.SignedString(s.signingKey)
+	return token.SignedString(key.SigningKey)
 }
 
 func (s AuthService) ParseToken(tokenString string) (jwt.MapClaims, error) {
@@ -72,6 +140,8 @@ func (s AuthService) ParseToken(tokenString string) (jwt.MapClaims, error) {
 		switch token.Method.(type) {
 		case *jwt.SigningMethodECDSA:
 			ok = s.allowSigningMethod.ECDSA
+		case *jwt.SigningMethodEd25519:
+			ok = s.allowSigningMethod.Ed25519
 		case *jwt.SigningMethodHMAC:
 			ok = s.allowSigningMethod.HMAC
 		case *jwt.SigningMethodRSA:
@@ -84,12 +154,276 @@ func (s AuthService) ParseToken(tokenString string) (jwt.MapClaims, error) {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
-		return s.signingKey, nil
+		// tokens without kid were signed before key rotation was introduced
+		key := s.keyring.Active()
+		if kid, exists := token.Header["kid"]; exists {
+			id, _ := kid.(string)
+			if key, ok = s.keyring.Get(id); !ok {
+				return nil, fmt.Errorf("unknown signing key: %v", kid)
+			}
+		}
+
+		if key.Method.Alg() != token.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method for key %v: %v", key.ID, token.Header["alg"])
+		}
+
+		return key.VerifyKey, nil
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return token.Claims.(jwt.MapClaims), nil
+	claims := token.Claims.(jwt.MapClaims)
+
+	if s.issuer != "" && !claims.VerifyIssuer(s.issuer, true) {
+		return nil, ErrTokenIssuer
+	}
+
+	if len(s.audience) > 0 && !s.verifyAudience(claims) {
+		return nil, ErrTokenAudience
+	}
+
+	return claims, nil
+}
+
+// verifyAudience accepts tokens intended for any of the configured audiences.
+func (s AuthService) verifyAudience(claims jwt.MapClaims) bool {
+	for _, aud := range s.audience {
+		if claims.VerifyAudience(aud, true) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// JWKS publishes every verification key in the keyring so other services can
+// validate tokens. Symmetric keys are never published.
+func (s AuthService) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+
+	for _, key := range s.keyring.Keys() {
+		if jwk, err := NewJSONWebKey(key.Method, key.VerifyKey); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	return set
+}
+
+// GenerateRefreshToken issues an opaque refresh token for the session which
+// starts a new rotation family.
+func (s AuthService) GenerateRefreshToken(userID uint, sessionID uint, expiredIn time.Duration) (string, error) {
+	family, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	return s.createRefreshToken(userID, &sessionID, family, expiredIn)
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same
+// family and session and returns the token exchanged. Presenting a token
+// which has already been rotated revokes the whole family.
+func (s AuthService) RotateRefreshToken(refreshToken string, expiredIn time.Duration) (*RefreshToken, string, error) {
+	token := &RefreshToken{}
+
+	if result := s.db.First(token, "token_hash = ?", hashRefreshToken(refreshToken)); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, "", ErrRefreshTokenInvalid
+		}
+
+		return nil, "", result.Error
+	}
+
+	if token.IsRevoked() || token.IsExpired() {
+		return nil, "", ErrRefreshTokenInvalid
+	}
+
+	if token.IsUsed() {
+		if err := s.revokeRefreshTokens("family = ? AND revoked_at IS NULL", token.Family); err != nil {
+			return nil, "", err
+		}
+
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	// the token is marked used only if no concurrent request has used or
+	// revoked it since it was read, otherwise it counts as reuse
+	now := time.Now()
+	result := s.db.Scopes(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&RefreshToken{}).Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", token.ID)
+	}).Update("used_at", now)
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		if err := s.revokeRefreshTokens("family = ? AND revoked_at IS NULL", token.Family); err != nil {
+			return nil, "", err
+		}
+
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	token.UsedAt = &now
+
+	newToken, err := s.createRefreshToken(token.UserID, token.SessionID, token.Family, expiredIn)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return token, newToken, nil
+}
+
+func (s AuthService) createRefreshToken(userID uint, sessionID *uint, family string, expiredIn time.Duration) (string, error) {
+	refreshToken, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	token := &RefreshToken{
+		UserID:    userID,
+		SessionID: sessionID,
+		Family:    family,
+		TokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt: time.Now().Add(expiredIn),
+	}
+
+	if result := s.db.Create(token); result.Error != nil {
+		return "", result.Error
+	}
+
+	return refreshToken, nil
+}
+
+// RevokeRefreshToken revokes the family the refresh token belongs to.
+func (s AuthService) RevokeRefreshToken(refreshToken string) error {
+	token := &RefreshToken{}
+
+	if result := s.db.First(token, "token_hash = ?", hashRefreshToken(refreshToken)); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrRefreshTokenInvalid
+		}
+
+		return result.Error
+	}
+
+	return s.revokeRefreshTokens("family = ? AND revoked_at IS NULL", token.Family)
+}
+
+// RevokeToken blocks the access token identified by the claims until it
+// expires.
+func (s AuthService) RevokeToken(claims jwt.MapClaims) error {
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		return ErrTokenInvalid
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return ErrTokenInvalid
+	}
+
+	return s.revocationStore.Revoke(jti, time.Unix(int64(exp), 0))
+}
+
+// ConsumeToken revokes a single use token, failing with ErrTokenInvalid when
+// it has been used already.
+func (s AuthService) ConsumeToken(claims jwt.MapClaims) error {
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		return ErrTokenInvalid
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return ErrTokenInvalid
+	}
+
+	consumed, err := s.revocationStore.Consume(jti, time.Unix(int64(exp), 0))
+	if err != nil {
+		return err
+	}
+
+	if !consumed {
+		return ErrTokenInvalid
+	}
+
+	return nil
+}
+
+// RevokeUserTokens invalidates every access and refresh token issued to the
+// user so far, and ends their sessions.
+func (s AuthService) RevokeUserTokens(userID uint) error {
+	if err := s.revocationStore.RevokeUser(userID, time.Now()); err != nil {
+		return err
+	}
+
+	if err := s.revokeRefreshTokens("user_id = ? AND revoked_at IS NULL", userID); err != nil {
+		return err
+	}
+
+	result := s.db.Delete(&Session{}, "user_id = ?", userID)
+
+	return result.Error
+}
+
+func (s AuthService) IsTokenRevoked(claims jwt.MapClaims, userID uint) (bool, error) {
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		return true, nil
+	}
+
+	revoked, err := s.revocationStore.IsRevoked(jti)
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	revokedAt, err := s.revocationStore.UserRevokedAt(userID)
+	if err != nil {
+		return false, err
+	}
+
+	// tokens issued before iat_us was introduced only have whole seconds
+	if iat, ok := claims["iat_us"].(float64); ok {
+		return int64(iat) < revokedAt.UnixMicro(), nil
+	}
+
+	iat, _ := claims["iat"].(float64)
+
+	return int64(iat) < revokedAt.Unix(), nil
+}
+
+func (s AuthService) revokeRefreshTokens(query string, args ...interface{}) error {
+	var tokens []RefreshToken
+	if result := s.db.Find(&tokens, append([]interface{}{query}, args...)...); result.Error != nil {
+		return result.Error
+	}
+
+	now := time.Now()
+	for i := 0; i < len(tokens); i++ {
+		tokens[i].RevokedAt = &now
+		if result := s.db.Save(&tokens[i]); result.Error != nil {
+			return result.Error
+		}
+	}
+
+	return nil
+}
+
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
@@ -0,0 +1,31 @@
+package authservice
+
+import "time"
+
+// RecordImpersonation keeps the audit record of actor signing in as the user
+// until expiresAt.
+func (s AuthService) RecordImpersonation(actorID uint, userID uint, ip string, userAgent string, expiresAt time.Time) (*Impersonation, error) {
+	impersonation := &Impersonation{
+		ActorID:   &actorID,
+		UserID:    &userID,
+		IP:        ip,
+		UserAgent: userAgent,
+		ExpiresAt: expiresAt,
+	}
+
+	if result := s.db.Create(impersonation); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return impersonation, nil
+}
+
+// ListImpersonations returns the records of actors signing in as the user.
+func (s AuthService) ListImpersonations(userID uint) ([]Impersonation, error) {
+	var impersonations []Impersonation
+	if result := s.db.Find(&impersonations, "user_id = ?", userID); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return impersonations, nil
+}
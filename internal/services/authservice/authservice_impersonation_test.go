@@ -0,0 +1,71 @@
+package authservice_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestAuthService_RecordImpersonation(t *testing.T) {
+	expiresAt := time.Now().Add(15 * time.Minute)
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{
+			name: "recorded",
+		},
+		{
+			name:    "create fail",
+			err:     errors.New("database error"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("Create", mock.MatchedBy(func(impersonation *authservice.Impersonation) bool {
+				return *impersonation.ActorID == 1 && *impersonation.UserID == 2 && impersonation.IP == "127.0.0.1" &&
+					impersonation.UserAgent == "curl/7.84.0" && impersonation.ExpiresAt.Equal(expiresAt)
+			})).Return(&gorm.DB{Error: tt.err})
+
+			got, err := newSessionService(db).RecordImpersonation(1, 2, "127.0.0.1", "curl/7.84.0", expiresAt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AuthService.RecordImpersonation() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && *got.UserID != 2 {
+				t.Errorf("AuthService.RecordImpersonation() = %v", got)
+			}
+		})
+	}
+}
+
+func TestAuthService_ListImpersonations(t *testing.T) {
+	actorID, userID := uint(1), uint(2)
+
+	db := &mocks.DatabaseInterface{}
+	db.On("Find", mock.AnythingOfType("*[]authservice.Impersonation"), "user_id = ?", uint(2)).
+		Run(func(args mock.Arguments) {
+			*args.Get(0).(*[]authservice.Impersonation) = []authservice.Impersonation{{ID: 1, ActorID: &actorID, UserID: &userID}}
+		}).
+		Return(&gorm.DB{})
+
+	got, err := newSessionService(db).ListImpersonations(2)
+	if err != nil {
+		t.Errorf("AuthService.ListImpersonations() error = %v", err)
+		return
+	}
+
+	if len(got) != 1 || *got[0].ActorID != 1 {
+		t.Errorf("AuthService.ListImpersonations() = %v", got)
+	}
+}
@@ -0,0 +1,300 @@
+package authservice_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+)
+
+var RSAPrivateKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+var ECDSAPrivateKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+var Ed25519PublicKey, Ed25519PrivateKey, _ = ed25519.GenerateKey(rand.Reader)
+
+func encodePEM(t string, b []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: t, Bytes: b})
+}
+
+func TestParseSigningKey(t *testing.T) {
+	ecdsaKey, _ := x509.MarshalECPrivateKey(ECDSAPrivateKey)
+	ed25519Key, _ := x509.MarshalPKCS8PrivateKey(Ed25519PrivateKey)
+
+	type args struct {
+		method jwt.SigningMethod
+		data   []byte
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "hmac",
+			args: args{jwt.SigningMethodHS256, []byte("signing-key")},
+			want: []byte("signing-key"),
+		},
+		{
+			name: "rsa",
+			args: args{jwt.SigningMethodRS256, encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(RSAPrivateKey))},
+			want: RSAPrivateKey,
+		},
+		{
+			name: "rsa pss",
+			args: args{jwt.SigningMethodPS256, encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(RSAPrivateKey))},
+			want: RSAPrivateKey,
+		},
+		{
+			name: "ecdsa",
+			args: args{jwt.SigningMethodES256, encodePEM("EC PRIVATE KEY", ecdsaKey)},
+			want: ECDSAPrivateKey,
+		},
+		{
+			name: "ed25519",
+			args: args{jwt.SigningMethodEdDSA, encodePEM("PRIVATE KEY", ed25519Key)},
+			want: Ed25519PrivateKey,
+		},
+		{
+			name:    "ed25519 invalid pem",
+			args:    args{jwt.SigningMethodEdDSA, encodePEM("EC PRIVATE KEY", ecdsaKey)},
+			wantErr: true,
+		},
+		{
+			name:    "rsa invalid pem",
+			args:    args{jwt.SigningMethodRS256, []byte("signing-key")},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported method",
+			args:    args{jwt.SigningMethodNone, []byte("signing-key")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := authservice.ParseSigningKey(tt.args.method, tt.args.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSigningKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSigningKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVerifyKey(t *testing.T) {
+	rsaKey, _ := x509.MarshalPKIXPublicKey(&RSAPrivateKey.PublicKey)
+	ecdsaKey, _ := x509.MarshalPKIXPublicKey(&ECDSAPrivateKey.PublicKey)
+	ed25519Key, _ := x509.MarshalPKIXPublicKey(Ed25519PublicKey)
+
+	type args struct {
+		method jwt.SigningMethod
+		data   []byte
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "hmac",
+			args: args{jwt.SigningMethodHS256, []byte("signing-key")},
+			want: []byte("signing-key"),
+		},
+		{
+			name: "rsa",
+			args: args{jwt.SigningMethodRS256, encodePEM("PUBLIC KEY", rsaKey)},
+			want: &RSAPrivateKey.PublicKey,
+		},
+		{
+			name: "ecdsa",
+			args: args{jwt.SigningMethodES256, encodePEM("PUBLIC KEY", ecdsaKey)},
+			want: &ECDSAPrivateKey.PublicKey,
+		},
+		{
+			name: "ed25519",
+			args: args{jwt.SigningMethodEdDSA, encodePEM("PUBLIC KEY", ed25519Key)},
+			want: Ed25519PublicKey,
+		},
+		{
+			name:    "ecdsa invalid pem",
+			args:    args{jwt.SigningMethodES256, encodePEM("PUBLIC KEY", rsaKey)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := authservice.ParseVerifyKey(tt.args.method, tt.args.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseVerifyKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseVerifyKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewJSONWebKey(t *testing.T) {
+	// example key from RFC 7638 section 3.1
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	rfcKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+	// example key from RFC 8037 appendix A.2
+	x, _ := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	rfcEd25519Key := ed25519.PublicKey(x)
+
+	type args struct {
+		method jwt.SigningMethod
+		key    interface{}
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantKty string
+		wantKid string
+		wantErr bool
+	}{
+		{
+			name:    "rfc 7638 thumbprint",
+			args:    args{jwt.SigningMethodRS256, rfcKey},
+			wantKty: "RSA",
+			wantKid: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			name:    "rfc 8037 thumbprint",
+			args:    args{jwt.SigningMethodEdDSA, rfcEd25519Key},
+			wantKty: "OKP",
+			wantKid: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+		{
+			name:    "ed25519 private key",
+			args:    args{jwt.SigningMethodEdDSA, Ed25519PrivateKey},
+			wantKty: "OKP",
+		},
+		{
+			name:    "rsa private key",
+			args:    args{jwt.SigningMethodRS256, RSAPrivateKey},
+			wantKty: "RSA",
+		},
+		{
+			name:    "ecdsa private key",
+			args:    args{jwt.SigningMethodES256, ECDSAPrivateKey},
+			wantKty: "EC",
+		},
+		{
+			name:    "hmac key",
+			args:    args{jwt.SigningMethodHS256, []byte("signing-key")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := authservice.NewJSONWebKey(tt.args.method, tt.args.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewJSONWebKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got.Kty != tt.wantKty {
+				t.Errorf("NewJSONWebKey() kty = %v, want %v", got.Kty, tt.wantKty)
+			}
+			if tt.wantKid != "" && got.Kid != tt.wantKid {
+				t.Errorf("NewJSONWebKey() kid = %v, want %v", got.Kid, tt.wantKid)
+			}
+			if !tt.wantErr && got.Alg != tt.args.method.Alg() {
+				t.Errorf("NewJSONWebKey() alg = %v, want %v", got.Alg, tt.args.method.Alg())
+			}
+		})
+	}
+}
+
+func TestJSONWebKey_PublicKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    interface{}
+		want   interface{}
+	}{
+		{
+			name:   "rsa",
+			method: jwt.SigningMethodRS256,
+			key:    RSAPrivateKey,
+			want:   &RSAPrivateKey.PublicKey,
+		},
+		{
+			name:   "ecdsa",
+			method: jwt.SigningMethodES256,
+			key:    ECDSAPrivateKey,
+			want:   &ECDSAPrivateKey.PublicKey,
+		},
+		{
+			name:   "ed25519",
+			method: jwt.SigningMethodEdDSA,
+			key:    Ed25519PrivateKey,
+			want:   Ed25519PublicKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwk, err := authservice.NewJSONWebKey(tt.method, tt.key)
+			if err != nil {
+				t.Fatalf("NewJSONWebKey() error = %v", err)
+			}
+
+			got, err := jwk.PublicKey()
+			if err != nil {
+				t.Fatalf("JSONWebKey.PublicKey() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("JSONWebKey.PublicKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := (authservice.JSONWebKey{Kty: "oct"}).PublicKey(); err == nil {
+		t.Errorf("JSONWebKey.PublicKey() of oct key error = nil, want %v", authservice.ErrKeyUnsupported)
+	}
+}
+
+func TestAuthService_JWKS(t *testing.T) {
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    interface{}
+		want   int
+	}{
+		{
+			name:   "hmac key is not published",
+			method: jwt.SigningMethodHS256,
+			key:    []byte("signing-key"),
+			want:   0,
+		},
+		{
+			name:   "rsa public key published",
+			method: jwt.SigningMethodRS256,
+			key:    RSAPrivateKey,
+			want:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := authservice.New(db, authservice.NewMemoryRevocationStore(), newKeyring(tt.method, tt.key), authservice.AllowSigningMethod{}, "", nil)
+			if got := s.JWKS(); len(got.Keys) != tt.want {
+				t.Errorf("AuthService.JWKS() = %v, want %v keys", got, tt.want)
+			}
+		})
+	}
+}
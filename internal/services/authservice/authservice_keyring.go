@@ -0,0 +1,122 @@
+package authservice
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	SigningKey interface{}
+	VerifyKey  interface{}
+	ExpiresAt  time.Time
+}
+
+// NewSigningKey derives the verify key and the key id from the signing key
+// when they are not given.
+func NewSigningKey(method jwt.SigningMethod, signingKey interface{}, verifyKey interface{}) SigningKey {
+	if verifyKey == nil {
+		verifyKey = PublicKey(signingKey)
+	}
+
+	key := SigningKey{
+		Method:     method,
+		SigningKey: signingKey,
+		VerifyKey:  verifyKey,
+	}
+
+	if jwk, err := NewJSONWebKey(method, verifyKey); err == nil {
+		key.ID = jwk.Kid
+	} else if secret, ok := verifyKey.([]byte); ok {
+		sum := sha256.Sum256(append([]byte(method.Alg()+":"), secret...))
+		key.ID = base64.RawURLEncoding.EncodeToString(sum[:12])
+	}
+
+	return key
+}
+
+func (k SigningKey) IsExpired() bool {
+	return !k.ExpiresAt.IsZero() && time.Now().After(k.ExpiresAt)
+}
+
+// Keyring signs with a single active key and keeps retired keys around for
+// verification until every token they signed has expired.
+type Keyring struct {
+	mu        sync.RWMutex
+	active    SigningKey
+	retired   []SigningKey
+	retention time.Duration
+}
+
+func NewKeyring(active SigningKey, retention time.Duration) *Keyring {
+	return &Keyring{active: active, retention: retention}
+}
+
+func (k *Keyring) Active() SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.active
+}
+
+func (k *Keyring) Get(kid string) (SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.active.ID == kid {
+		return k.active, true
+	}
+
+	for _, key := range k.retired {
+		if key.ID == kid && !key.IsExpired() {
+			return key, true
+		}
+	}
+
+	return SigningKey{}, false
+}
+
+// Keys returns the active key followed by the retired keys still accepted.
+func (k *Keyring) Keys() []SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := []SigningKey{k.active}
+	for _, key := range k.retired {
+		if !key.IsExpired() {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Rotate makes key the active signing key and retires the previous one.
+// Rotating to the key which is already active is a no-op.
+func (k *Keyring) Rotate(key SigningKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key.ID == k.active.ID {
+		return
+	}
+
+	retired := []SigningKey{}
+	for _, r := range k.retired {
+		if !r.IsExpired() && r.ID != key.ID {
+			retired = append(retired, r)
+		}
+	}
+
+	previous := k.active
+	previous.ExpiresAt = time.Now().Add(k.retention)
+
+	key.ExpiresAt = time.Time{}
+	k.active = key
+	k.retired = append(retired, previous)
+}
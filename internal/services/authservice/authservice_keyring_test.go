@@ -0,0 +1,137 @@
+package authservice_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/mocks"
+)
+
+func newKeyring(method jwt.SigningMethod, key interface{}) *authservice.Keyring {
+	return authservice.NewKeyring(authservice.NewSigningKey(method, key, nil), time.Minute)
+}
+
+func TestNewSigningKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        jwt.SigningMethod
+		key           interface{}
+		wantVerifyKey interface{}
+	}{
+		{
+			name:          "hmac",
+			method:        jwt.SigningMethodHS256,
+			key:           []byte("signing-key"),
+			wantVerifyKey: []byte("signing-key"),
+		},
+		{
+			name:          "rsa",
+			method:        jwt.SigningMethodRS256,
+			key:           RSAPrivateKey,
+			wantVerifyKey: &RSAPrivateKey.PublicKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := authservice.NewSigningKey(tt.method, tt.key, nil)
+			if got.ID == "" {
+				t.Errorf("NewSigningKey() id is empty")
+			}
+			if !reflect.DeepEqual(got.VerifyKey, tt.wantVerifyKey) {
+				t.Errorf("NewSigningKey() verify key = %v, want %v", got.VerifyKey, tt.wantVerifyKey)
+			}
+		})
+	}
+
+	if a, b := authservice.NewSigningKey(jwt.SigningMethodHS256, []byte("a"), nil), authservice.NewSigningKey(jwt.SigningMethodHS256, []byte("b"), nil); a.ID == b.ID {
+		t.Errorf("NewSigningKey() different secrets share id %v", a.ID)
+	}
+}
+
+func TestKeyring_Rotate(t *testing.T) {
+	first := authservice.NewSigningKey(jwt.SigningMethodHS256, []byte("first"), nil)
+	second := authservice.NewSigningKey(jwt.SigningMethodHS256, []byte("second"), nil)
+
+	k := authservice.NewKeyring(first, time.Minute)
+	k.Rotate(first)
+
+	if got := k.Keys(); len(got) != 1 {
+		t.Errorf("Keyring.Rotate() same key keys = %v, want 1", len(got))
+	}
+
+	k.Rotate(second)
+
+	if got := k.Active(); got.ID != second.ID {
+		t.Errorf("Keyring.Active() = %v, want %v", got.ID, second.ID)
+	}
+
+	if got, ok := k.Get(first.ID); !ok || got.ExpiresAt.IsZero() {
+		t.Errorf("Keyring.Get() retired = %v, %v, want retired key", got, ok)
+	}
+
+	if got := k.Keys(); len(got) != 2 {
+		t.Errorf("Keyring.Keys() = %v, want 2", len(got))
+	}
+
+	if _, ok := k.Get("unknown"); ok {
+		t.Errorf("Keyring.Get() unknown = %v, want false", ok)
+	}
+
+	expired := authservice.NewKeyring(first, -time.Minute)
+	expired.Rotate(second)
+
+	if _, ok := expired.Get(first.ID); ok {
+		t.Errorf("Keyring.Get() expired = %v, want false", ok)
+	}
+
+	if got := expired.Keys(); len(got) != 1 {
+		t.Errorf("Keyring.Keys() expired = %v, want 1", len(got))
+	}
+}
+
+func TestAuthService_ParseToken_rotatedKey(t *testing.T) {
+	claimer := &mocks.Claimer{}
+	claimer.On("GetClaims").Return(map[string]interface{}{"username": "admin"})
+
+	allow := authservice.AllowSigningMethod{HMAC: true, RSA: true}
+	k := newKeyring(jwt.SigningMethodHS256, []byte("first"))
+	s := authservice.New(db, authservice.NewMemoryRevocationStore(), k, allow, "", nil)
+
+	old, err := s.GenerateToken(claimer, time.Minute)
+	if err != nil {
+		t.Fatalf("AuthService.GenerateToken() error = %v", err)
+	}
+
+	k.Rotate(authservice.NewSigningKey(jwt.SigningMethodRS256, RSAPrivateKey, nil))
+
+	current, err := s.GenerateToken(claimer, time.Minute)
+	if err != nil {
+		t.Fatalf("AuthService.GenerateToken() error = %v", err)
+	}
+
+	for name, token := range map[string]string{"retired key": old, "active key": current} {
+		if _, err := s.ParseToken(token); err != nil {
+			t.Errorf("AuthService.ParseToken() %s error = %v", name, err)
+		}
+	}
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": "admin"})
+	unknown.Header["kid"] = "unknown"
+	tokenString, _ := unknown.SignedString([]byte("first"))
+
+	if _, err := s.ParseToken(tokenString); err == nil {
+		t.Errorf("AuthService.ParseToken() unknown kid error = %v, want error", err)
+	}
+
+	// the retired HMAC secret must not verify a token claiming the RSA key id
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": "admin"})
+	confused.Header["kid"] = k.Active().ID
+	tokenString, _ = confused.SignedString([]byte("first"))
+
+	if _, err := s.ParseToken(tokenString); err == nil {
+		t.Errorf("AuthService.ParseToken() algorithm mismatch error = %v, want error", err)
+	}
+}
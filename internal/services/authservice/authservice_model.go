@@ -0,0 +1,66 @@
+package authservice
+
+import (
+	"time"
+
+	"github.com/maetad/baroness-api/internal/model"
+)
+
+type RefreshToken struct {
+	model.Model
+	UserID    uint       `json:"user_id"`
+	SessionID *uint      `json:"session_id"`
+	Family    string     `json:"-"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+func (t *RefreshToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+func (t *RefreshToken) IsUsed() bool {
+	return t.UsedAt != nil
+}
+
+func (t *RefreshToken) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
+
+type RevokedToken struct {
+	JTI       string `gorm:"column:jti;primarykey"`
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type UserRevocation struct {
+	UserID    uint `gorm:"primarykey;autoIncrement:false"`
+	RevokedAt time.Time
+}
+
+// Session is a login from one device. Access and refresh tokens issued for
+// it carry its id, they stop working once it is revoked.
+type Session struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	UserID     uint      `json:"-"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Current marks the session of the request listing the sessions.
+	Current bool `json:"current" gorm:"-"`
+}
+
+// Impersonation is the audit record of an actor signing in as the user. It
+// is kept when either of them is purged, without the id of the purged one.
+type Impersonation struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	ActorID   *uint     `json:"actor_id"`
+	UserID    *uint     `json:"user_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
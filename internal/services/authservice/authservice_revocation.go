@@ -0,0 +1,146 @@
+package authservice
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RevocationStoreInterface interface {
+	Revoke(jti string, expiresAt time.Time) error
+	Consume(jti string, expiresAt time.Time) (bool, error)
+	IsRevoked(jti string) (bool, error)
+	RevokeUser(userID uint, revokedAt time.Time) error
+	UserRevokedAt(userID uint) (time.Time, error)
+}
+
+type DatabaseRevocationStore struct {
+	db database.DatabaseInterface
+}
+
+func NewDatabaseRevocationStore(db database.DatabaseInterface) RevocationStoreInterface {
+	return DatabaseRevocationStore{db}
+}
+
+func (s DatabaseRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	// expired entries can never match a valid token again
+	if result := s.db.Delete(&RevokedToken{}, "expires_at < ?", time.Now()); result.Error != nil {
+		return result.Error
+	}
+
+	result := s.db.Save(&RevokedToken{JTI: jti, ExpiresAt: expiresAt})
+	return result.Error
+}
+
+// Consume revokes the token unless it already is, and tells whether this call
+// revoked it.
+func (s DatabaseRevocationStore) Consume(jti string, expiresAt time.Time) (bool, error) {
+	if result := s.db.Delete(&RevokedToken{}, "expires_at < ?", time.Now()); result.Error != nil {
+		return false, result.Error
+	}
+
+	result := s.db.Scopes(func(tx *gorm.DB) *gorm.DB {
+		return tx.Clauses(clause.OnConflict{DoNothing: true})
+	}).Create(&RevokedToken{JTI: jti, ExpiresAt: expiresAt})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (s DatabaseRevocationStore) IsRevoked(jti string) (bool, error) {
+	result := s.db.First(&RevokedToken{}, "jti = ?", jti)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+
+	return result.Error == nil, result.Error
+}
+
+func (s DatabaseRevocationStore) RevokeUser(userID uint, revokedAt time.Time) error {
+	result := s.db.Save(&UserRevocation{UserID: userID, RevokedAt: revokedAt})
+	return result.Error
+}
+
+func (s DatabaseRevocationStore) UserRevokedAt(userID uint) (time.Time, error) {
+	revocation := &UserRevocation{}
+
+	result := s.db.First(revocation, "user_id = ?", userID)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+
+	return revocation.RevokedAt, result.Error
+}
+
+type MemoryRevocationStore struct {
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+	users  map[uint]time.Time
+}
+
+func NewMemoryRevocationStore() RevocationStoreInterface {
+	return &MemoryRevocationStore{
+		tokens: map[string]time.Time{},
+		users:  map[uint]time.Time{},
+	}
+}
+
+func (s *MemoryRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, exp := range s.tokens {
+		if exp.Before(now) {
+			delete(s.tokens, k)
+		}
+	}
+
+	s.tokens[jti] = expiresAt
+
+	return nil
+}
+
+func (s *MemoryRevocationStore) Consume(jti string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[jti]; ok {
+		return false, nil
+	}
+
+	s.tokens[jti] = expiresAt
+
+	return true, nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.tokens[jti]
+
+	return ok, nil
+}
+
+func (s *MemoryRevocationStore) RevokeUser(userID uint, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[userID] = revokedAt
+
+	return nil
+}
+
+func (s *MemoryRevocationStore) UserRevokedAt(userID uint) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.users[userID], nil
+}
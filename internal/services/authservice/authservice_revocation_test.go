@@ -0,0 +1,238 @@
+package authservice_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMemoryRevocationStore(t *testing.T) {
+	s := authservice.NewMemoryRevocationStore()
+
+	if revoked, _ := s.IsRevoked("jti"); revoked {
+		t.Errorf("MemoryRevocationStore.IsRevoked() = %v, want %v", revoked, false)
+	}
+
+	if err := s.Revoke("expired", time.Now().Add(-time.Minute)); err != nil {
+		t.Errorf("MemoryRevocationStore.Revoke() error = %v", err)
+	}
+
+	if err := s.Revoke("jti", time.Now().Add(time.Minute)); err != nil {
+		t.Errorf("MemoryRevocationStore.Revoke() error = %v", err)
+	}
+
+	if revoked, _ := s.IsRevoked("jti"); !revoked {
+		t.Errorf("MemoryRevocationStore.IsRevoked() = %v, want %v", revoked, true)
+	}
+
+	if revoked, _ := s.IsRevoked("expired"); revoked {
+		t.Errorf("MemoryRevocationStore.IsRevoked() expired = %v, want %v", revoked, false)
+	}
+
+	if consumed, _ := s.Consume("jti", time.Now().Add(time.Minute)); consumed {
+		t.Errorf("MemoryRevocationStore.Consume() revoked = %v, want %v", consumed, false)
+	}
+
+	if consumed, _ := s.Consume("single-use", time.Now().Add(time.Minute)); !consumed {
+		t.Errorf("MemoryRevocationStore.Consume() = %v, want %v", consumed, true)
+	}
+
+	if at, _ := s.UserRevokedAt(1); !at.IsZero() {
+		t.Errorf("MemoryRevocationStore.UserRevokedAt() = %v, want zero", at)
+	}
+
+	now := time.Now()
+	if err := s.RevokeUser(1, now); err != nil {
+		t.Errorf("MemoryRevocationStore.RevokeUser() error = %v", err)
+	}
+
+	if at, _ := s.UserRevokedAt(1); !at.Equal(now) {
+		t.Errorf("MemoryRevocationStore.UserRevokedAt() = %v, want %v", at, now)
+	}
+}
+
+func TestDatabaseRevocationStore_Revoke(t *testing.T) {
+	tests := []struct {
+		name    string
+		db      *mocks.DatabaseInterface
+		wantErr bool
+	}{
+		{
+			name: "revoked",
+			db: func() *mocks.DatabaseInterface {
+				db := &mocks.DatabaseInterface{}
+				db.On("Delete", mock.AnythingOfType("*authservice.RevokedToken"), "expires_at < ?", mock.AnythingOfType("time.Time")).
+					Return(&gorm.DB{})
+				db.On("Save", mock.MatchedBy(func(token *authservice.RevokedToken) bool {
+					return token.JTI == "jti"
+				})).Return(&gorm.DB{})
+
+				return db
+			}(),
+		},
+		{
+			name: "prune fail",
+			db: func() *mocks.DatabaseInterface {
+				db := &mocks.DatabaseInterface{}
+				db.On("Delete", mock.AnythingOfType("*authservice.RevokedToken"), "expires_at < ?", mock.AnythingOfType("time.Time")).
+					Return(&gorm.DB{Error: errors.New("delete fail")})
+
+				return db
+			}(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := authservice.NewDatabaseRevocationStore(tt.db)
+			if err := s.Revoke("jti", time.Now()); (err != nil) != tt.wantErr {
+				t.Errorf("DatabaseRevocationStore.Revoke() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDatabaseRevocationStore_Consume(t *testing.T) {
+	tests := []struct {
+		name         string
+		rowsAffected int64
+		want         bool
+	}{
+		{
+			name:         "consumed",
+			rowsAffected: 1,
+			want:         true,
+		},
+		{
+			name: "consumed already",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dry, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+				DryRun:                 true,
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+				Logger:                 logger.Default.LogMode(logger.Silent),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var query string
+			dry.Callback().Create().After("gorm:create").Register("test:create", func(tx *gorm.DB) {
+				query = tx.Statement.SQL.String()
+				tx.RowsAffected = tt.rowsAffected
+			})
+
+			db := &mocks.DatabaseInterface{}
+			db.On("Delete", mock.AnythingOfType("*authservice.RevokedToken"), "expires_at < ?", mock.AnythingOfType("time.Time")).
+				Return(&gorm.DB{})
+			db.On("Scopes", mock.Anything).Return(dry.Scopes)
+
+			got, err := authservice.NewDatabaseRevocationStore(db).Consume("jti", time.Now())
+			if err != nil || got != tt.want {
+				t.Errorf("DatabaseRevocationStore.Consume() = %v, error %v, want %v", got, err, tt.want)
+			}
+
+			want := `INSERT INTO "revoked_tokens" ("jti","expires_at","created_at") VALUES ($1,$2,$3) ON CONFLICT DO NOTHING`
+			if query != want {
+				t.Errorf("DatabaseRevocationStore.Consume() query = %v, want %v", query, want)
+			}
+		})
+	}
+}
+
+func TestDatabaseRevocationStore_IsRevoked(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		want    bool
+		wantErr bool
+	}{
+		{
+			name: "revoked",
+			want: true,
+		},
+		{
+			name: "not revoked",
+			err:  gorm.ErrRecordNotFound,
+		},
+		{
+			name:    "query fail",
+			err:     errors.New("query fail"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("First", mock.AnythingOfType("*authservice.RevokedToken"), "jti = ?", "jti").
+				Return(&gorm.DB{Error: tt.err})
+
+			s := authservice.NewDatabaseRevocationStore(db)
+			got, err := s.IsRevoked("jti")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DatabaseRevocationStore.IsRevoked() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("DatabaseRevocationStore.IsRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDatabaseRevocationStore_UserRevokedAt(t *testing.T) {
+	revokedAt := time.Now()
+
+	tests := []struct {
+		name    string
+		err     error
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name: "revoked",
+			want: revokedAt,
+		},
+		{
+			name: "never revoked",
+			err:  gorm.ErrRecordNotFound,
+		},
+		{
+			name:    "query fail",
+			err:     errors.New("query fail"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("First", mock.AnythingOfType("*authservice.UserRevocation"), "user_id = ?", uint(1)).
+				Run(func(args mock.Arguments) {
+					if tt.err == nil {
+						args.Get(0).(*authservice.UserRevocation).RevokedAt = revokedAt
+					}
+				}).
+				Return(&gorm.DB{Error: tt.err})
+
+			s := authservice.NewDatabaseRevocationStore(db)
+			got, err := s.UserRevokedAt(1)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DatabaseRevocationStore.UserRevokedAt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("DatabaseRevocationStore.UserRevokedAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package authservice
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateSession starts a session for a login of the user from the device.
+func (s AuthService) CreateSession(userID uint, ip string, userAgent string) (*Session, error) {
+	session := &Session{
+		UserID:     userID,
+		IP:         ip,
+		UserAgent:  userAgent,
+		LastSeenAt: time.Now(),
+	}
+
+	if result := s.db.Create(session); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return session, nil
+}
+
+// ListSessions returns the sessions of the user seen within idleTimeout,
+// older ones can not be refreshed anymore.
+func (s AuthService) ListSessions(userID uint, idleTimeout time.Duration) ([]Session, error) {
+	var sessions []Session
+	if result := s.db.Find(&sessions, "user_id = ? AND last_seen_at > ?", userID, time.Now().Add(-idleTimeout)); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return sessions, nil
+}
+
+func (s AuthService) GetSession(userID uint, id uint) (*Session, error) {
+	session := &Session{}
+	if result := s.db.First(session, "id = ? AND user_id = ?", id, userID); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+
+		return nil, result.Error
+	}
+
+	return session, nil
+}
+
+// TouchSession returns ErrSessionNotFound once the session is revoked. The
+// last seen time is only written when it is older than interval, so most
+// requests only read the session.
+func (s AuthService) TouchSession(id uint, interval time.Duration) error {
+	session := &Session{}
+	if result := s.db.First(session, "id = ?", id); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+
+		return result.Error
+	}
+
+	if time.Since(session.LastSeenAt) < interval {
+		return nil
+	}
+
+	session.LastSeenAt = time.Now()
+	result := s.db.Save(session)
+
+	return result.Error
+}
+
+// RevokeSession ends the session and revokes its refresh tokens. Its access
+// tokens are rejected by TouchSession.
+func (s AuthService) RevokeSession(session *Session) error {
+	if err := s.revokeRefreshTokens("session_id = ? AND revoked_at IS NULL", session.ID); err != nil {
+		return err
+	}
+
+	result := s.db.Delete(session)
+
+	return result.Error
+}
@@ -0,0 +1,132 @@
+package authservice_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func newSessionService(db *mocks.DatabaseInterface) authservice.AuthServiceInterface {
+	return authservice.New(db, authservice.NewMemoryRevocationStore(), newKeyring(jwt.SigningMethodHS256, []byte("signing-key")), authservice.AllowSigningMethod{}, "", nil)
+}
+
+func TestAuthService_CreateSession(t *testing.T) {
+	db := &mocks.DatabaseInterface{}
+	db.On("Create", mock.MatchedBy(func(session *authservice.Session) bool {
+		return session.UserID == 1 && session.IP == "127.0.0.1" && session.UserAgent == "curl/7.84.0" && !session.LastSeenAt.IsZero()
+	})).Return(&gorm.DB{})
+
+	got, err := newSessionService(db).CreateSession(1, "127.0.0.1", "curl/7.84.0")
+	if err != nil {
+		t.Errorf("AuthService.CreateSession() error = %v", err)
+		return
+	}
+
+	if got.UserID != 1 {
+		t.Errorf("AuthService.CreateSession() = %v", got)
+	}
+}
+
+func TestAuthService_GetSession(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{
+			name: "found",
+		},
+		{
+			name:    "not found",
+			err:     gorm.ErrRecordNotFound,
+			wantErr: authservice.ErrSessionNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("First", mock.AnythingOfType("*authservice.Session"), "id = ? AND user_id = ?", uint(2), uint(1)).
+				Return(&gorm.DB{Error: tt.err})
+
+			if _, err := newSessionService(db).GetSession(1, 2); !errors.Is(err, tt.wantErr) {
+				t.Errorf("AuthService.GetSession() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthService_TouchSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		lastSeenAt time.Time
+		err        error
+		wantErr    error
+		wantSave   bool
+	}{
+		{
+			name:       "seen recently",
+			lastSeenAt: time.Now().Add(-time.Second),
+		},
+		{
+			name:       "seen before the interval",
+			lastSeenAt: time.Now().Add(-time.Hour),
+			wantSave:   true,
+		},
+		{
+			name:    "revoked",
+			err:     gorm.ErrRecordNotFound,
+			wantErr: authservice.ErrSessionNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("First", mock.AnythingOfType("*authservice.Session"), "id = ?", uint(2)).
+				Run(func(args mock.Arguments) {
+					*args.Get(0).(*authservice.Session) = authservice.Session{ID: 2, LastSeenAt: tt.lastSeenAt}
+				}).
+				Return(&gorm.DB{Error: tt.err})
+			db.On("Save", mock.MatchedBy(func(session *authservice.Session) bool {
+				return time.Since(session.LastSeenAt) < time.Second
+			})).Return(&gorm.DB{})
+
+			if err := newSessionService(db).TouchSession(2, time.Minute); !errors.Is(err, tt.wantErr) {
+				t.Errorf("AuthService.TouchSession() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if saved := len(db.Calls) > 1; saved != tt.wantSave {
+				t.Errorf("AuthService.TouchSession() saved = %v, want %v", saved, tt.wantSave)
+			}
+		})
+	}
+}
+
+func TestAuthService_RevokeSession(t *testing.T) {
+	session := &authservice.Session{ID: 2, UserID: 1}
+
+	db := &mocks.DatabaseInterface{}
+	db.On("Find", mock.AnythingOfType("*[]authservice.RefreshToken"), "session_id = ? AND revoked_at IS NULL", uint(2)).
+		Run(func(args mock.Arguments) {
+			*args.Get(0).(*[]authservice.RefreshToken) = []authservice.RefreshToken{{UserID: 1}}
+		}).
+		Return(&gorm.DB{})
+	db.On("Save", mock.MatchedBy(func(token *authservice.RefreshToken) bool {
+		return token.IsRevoked()
+	})).Return(&gorm.DB{})
+	db.On("Delete", session).
+		Return(&gorm.DB{})
+
+	if err := newSessionService(db).RevokeSession(session); err != nil {
+		t.Errorf("AuthService.RevokeSession() error = %v", err)
+		return
+	}
+
+	db.AssertExpectations(t)
+}
@@ -1,14 +1,23 @@
 package authservice_test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"reflect"
 	"regexp"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/maetad/baroness-api/internal/database"
+	"github.com/maetad/baroness-api/internal/model"
 	"github.com/maetad/baroness-api/internal/services/authservice"
 	"github.com/maetad/baroness-api/mocks"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 var PEM = `-----BEGIN PUBLIC KEY-----
@@ -22,6 +31,7 @@ ODIRe1AuTyHceAbewn8b462yEWKARdpd9AjQW5SIVPfdsz5B6GlYQ5LdYKtznTuy
 -----END PUBLIC KEY-----
 `
 
+var db = &mocks.DatabaseInterface{}
 var claimer = &mocks.Claimer{}
 var jwtPattern = `^([a-zA-Z0-9_=]+)\.([a-zA-Z0-9_=]+)\.([a-zA-Z0-9_\-\+\/=]*)`
 var jwtRegex = regexp.MustCompile(jwtPattern)
@@ -54,15 +64,49 @@ func TestAuthService_GenerateToken(t *testing.T) {
 			},
 			args: args{claimer},
 		},
+		{
+			name: "token signed with rsa private key",
+			fields: fields{
+				signingMethod: jwt.SigningMethodRS256,
+				signingKey:    RSAPrivateKey,
+				allowSigningMethod: authservice.AllowSigningMethod{
+					RSA: true,
+				},
+			},
+			args: args{claimer},
+		},
+		{
+			name: "token signed with ed25519 private key",
+			fields: fields{
+				signingMethod: jwt.SigningMethodEdDSA,
+				signingKey:    Ed25519PrivateKey,
+				allowSigningMethod: authservice.AllowSigningMethod{
+					Ed25519: true,
+				},
+			},
+			args: args{claimer},
+		},
+		{
+			name: "token signed with ecdsa private key",
+			fields: fields{
+				signingMethod: jwt.SigningMethodES256,
+				signingKey:    ECDSAPrivateKey,
+				allowSigningMethod: authservice.AllowSigningMethod{
+					ECDSA: true,
+				},
+			},
+			args: args{claimer},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			claimer.Mock.ExpectedCalls = nil
+			claimer.Mock.Calls = nil
 			claimer.On("GetClaims").Return(map[string]interface{}{
 				"username": "admin",
 			})
 
-			s := authservice.New(tt.fields.signingMethod, tt.fields.signingKey, tt.fields.allowSigningMethod)
+			s := authservice.New(db, authservice.NewMemoryRevocationStore(), newKeyring(tt.fields.signingMethod, tt.fields.signingKey), tt.fields.allowSigningMethod, "", nil)
 			got, err := s.GenerateToken(tt.args.c, time.Minute)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("AuthService.GenerateToken() error = %v, wantErr %v", err, tt.wantErr)
@@ -73,6 +117,16 @@ func TestAuthService_GenerateToken(t *testing.T) {
 				t.Errorf("AuthService.GenerateToken() = %v, want %v", got, jwtPattern)
 			}
 
+			claims, err := s.ParseToken(got)
+			if err != nil {
+				t.Errorf("AuthService.ParseToken() error = %v", err)
+				return
+			}
+
+			if jti, ok := claims["jti"].(string); !ok || jti == "" {
+				t.Errorf("AuthService.GenerateToken() jti = %v, want not empty", claims["jti"])
+			}
+
 			claimer.AssertNumberOfCalls(t, "GetClaims", 1)
 		})
 	}
@@ -180,10 +234,46 @@ func TestAuthService_ParseToken(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "EdDSA alg is not allow",
+			fields: fields{
+				signingMethod: jwt.SigningMethodEdDSA,
+				signingKey:    Ed25519PrivateKey,
+				allowSigningMethod: authservice.AllowSigningMethod{
+					HMAC: true,
+				},
+			},
+			args: args{
+				tokenString: func() string {
+					token, _ := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"username": "admin"}).SignedString(Ed25519PrivateKey)
+					return token
+				}(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "EdDSA parsed complete",
+			fields: fields{
+				signingMethod: jwt.SigningMethodEdDSA,
+				signingKey:    Ed25519PrivateKey,
+				allowSigningMethod: authservice.AllowSigningMethod{
+					Ed25519: true,
+				},
+			},
+			args: args{
+				tokenString: func() string {
+					token, _ := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"username": "admin"}).SignedString(Ed25519PrivateKey)
+					return token
+				}(),
+			},
+			want: jwt.MapClaims{
+				"username": "admin",
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := authservice.New(tt.fields.signingMethod, tt.fields.signingKey, tt.fields.allowSigningMethod)
+			s := authservice.New(db, authservice.NewMemoryRevocationStore(), newKeyring(tt.fields.signingMethod, tt.fields.signingKey), tt.fields.allowSigningMethod, "", nil)
 			got, err := s.ParseToken(tt.args.tokenString)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("AuthService.ParseToken() error = %v, wantErr %v", err, tt.wantErr)
@@ -256,3 +346,541 @@ func TestAllowSigningMethod_Allowed(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthService_GenerateRefreshToken(t *testing.T) {
+	type fields struct {
+		db database.DatabaseInterface
+	}
+	type args struct {
+		userID uint
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "refresh token generated",
+			fields: func() fields {
+				db := &mocks.DatabaseInterface{}
+				db.On("Create", mock.MatchedBy(func(token *authservice.RefreshToken) bool {
+					return token.UserID == 1 && *token.SessionID == 2 && token.Family != "" && token.TokenHash != ""
+				})).Return(&gorm.DB{})
+
+				return fields{db}
+			}(),
+			args: args{1},
+		},
+		{
+			name: "create fail",
+			fields: func() fields {
+				db := &mocks.DatabaseInterface{}
+				db.On("Create", mock.AnythingOfType("*authservice.RefreshToken")).
+					Return(&gorm.DB{Error: errors.New("create fail")})
+
+				return fields{db}
+			}(),
+			args:    args{1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := authservice.New(tt.fields.db, authservice.NewMemoryRevocationStore(), newKeyring(jwt.SigningMethodHS256, []byte("signing-key")), authservice.AllowSigningMethod{}, "", nil)
+			got, err := s.GenerateRefreshToken(tt.args.userID, 2, time.Hour)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AuthService.GenerateRefreshToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && got == "" {
+				t.Errorf("AuthService.GenerateRefreshToken() = %v, want not empty", got)
+			}
+		})
+	}
+}
+
+func TestAuthService_RotateRefreshToken(t *testing.T) {
+	hash := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	found := func(token authservice.RefreshToken) func(args mock.Arguments) {
+		return func(args mock.Arguments) {
+			*args.Get(0).(*authservice.RefreshToken) = token
+		}
+	}
+	past := time.Now().Add(-time.Minute)
+	session := uint(2)
+
+	var query string
+	used := func(db *mocks.DatabaseInterface, rowsAffected int64) {
+		dry, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+			DryRun:                 true,
+			DisableAutomaticPing:   true,
+			SkipDefaultTransaction: true,
+			Logger:                 logger.Default.LogMode(logger.Silent),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dry.Callback().Update().After("gorm:update").Register("test:update", func(tx *gorm.DB) {
+			query = tx.Statement.SQL.String()
+			tx.RowsAffected = rowsAffected
+		})
+
+		db.On("Scopes", mock.Anything).Return(dry.Scopes)
+	}
+
+	type fields struct {
+		db *mocks.DatabaseInterface
+	}
+	type args struct {
+		refreshToken string
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		want       uint
+		wantErr    error
+		wantRevoke bool
+		wantQuery  string
+	}{
+		{
+			name: "rotated",
+			fields: func() fields {
+				db := &mocks.DatabaseInterface{}
+				db.On("First", mock.AnythingOfType("*authservice.RefreshToken"), "token_hash = ?", hash("refresh")).
+					Run(found(authservice.RefreshToken{Model: model.Model{ID: 3}, UserID: 1, SessionID: &session, Family: "family", ExpiresAt: time.Now().Add(time.Hour)})).
+					Return(&gorm.DB{})
+				used(db, 1)
+				db.On("Create", mock.MatchedBy(func(token *authservice.RefreshToken) bool {
+					return token.UserID == 1 && token.SessionID == &session && token.Family == "family"
+				})).Return(&gorm.DB{})
+
+				return fields{db}
+			}(),
+			args:      args{"refresh"},
+			want:      1,
+			wantQuery: `UPDATE "refresh_tokens" SET "used_at"=$1,"updated_at"=$2 WHERE (id = $3 AND used_at IS NULL AND revoked_at IS NULL) AND "refresh_tokens"."deleted_at" IS NULL`,
+		},
+		{
+			name: "token used meanwhile revokes family",
+			fields: func() fields {
+				db := &mocks.DatabaseInterface{}
+				db.On("First", mock.AnythingOfType("*authservice.RefreshToken"), "token_hash = ?", hash("refresh")).
+					Run(found(authservice.RefreshToken{Model: model.Model{ID: 3}, UserID: 1, Family: "family", ExpiresAt: time.Now().Add(time.Hour)})).
+					Return(&gorm.DB{})
+				used(db, 0)
+				db.On("Find", mock.AnythingOfType("*[]authservice.RefreshToken"), "family = ? AND revoked_at IS NULL", "family").
+					Run(func(args mock.Arguments) {
+						*args.Get(0).(*[]authservice.RefreshToken) = []authservice.RefreshToken{{Family: "family"}}
+					}).
+					Return(&gorm.DB{})
+				db.On("Save", mock.MatchedBy(func(token *authservice.RefreshToken) bool {
+					return token.IsRevoked()
+				})).Return(&gorm.DB{})
+
+				return fields{db}
+			}(),
+			args:       args{"refresh"},
+			wantErr:    authservice.ErrRefreshTokenReused,
+			wantRevoke: true,
+		},
+		{
+			name: "token not found",
+			fields: func() fields {
+				db := &mocks.DatabaseInterface{}
+				db.On("First", mock.AnythingOfType("*authservice.RefreshToken"), "token_hash = ?", hash("refresh")).
+					Return(&gorm.DB{Error: gorm.ErrRecordNotFound})
+
+				return fields{db}
+			}(),
+			args:    args{"refresh"},
+			wantErr: authservice.ErrRefreshTokenInvalid,
+		},
+		{
+			name: "token expired",
+			fields: func() fields {
+				db := &mocks.DatabaseInterface{}
+				db.On("First", mock.AnythingOfType("*authservice.RefreshToken"), "token_hash = ?", hash("refresh")).
+					Run(found(authservice.RefreshToken{UserID: 1, Family: "family", ExpiresAt: past})).
+					Return(&gorm.DB{})
+
+				return fields{db}
+			}(),
+			args:    args{"refresh"},
+			wantErr: authservice.ErrRefreshTokenInvalid,
+		},
+		{
+			name: "token revoked",
+			fields: func() fields {
+				db := &mocks.DatabaseInterface{}
+				db.On("First", mock.AnythingOfType("*authservice.RefreshToken"), "token_hash = ?", hash("refresh")).
+					Run(found(authservice.RefreshToken{UserID: 1, Family: "family", ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &past})).
+					Return(&gorm.DB{})
+
+				return fields{db}
+			}(),
+			args:    args{"refresh"},
+			wantErr: authservice.ErrRefreshTokenInvalid,
+		},
+		{
+			name: "token reused revokes family",
+			fields: func() fields {
+				db := &mocks.DatabaseInterface{}
+				db.On("First", mock.AnythingOfType("*authservice.RefreshToken"), "token_hash = ?", hash("refresh")).
+					Run(found(authservice.RefreshToken{UserID: 1, Family: "family", ExpiresAt: time.Now().Add(time.Hour), UsedAt: &past})).
+					Return(&gorm.DB{})
+				db.On("Find", mock.AnythingOfType("*[]authservice.RefreshToken"), "family = ? AND revoked_at IS NULL", "family").
+					Run(func(args mock.Arguments) {
+						*args.Get(0).(*[]authservice.RefreshToken) = []authservice.RefreshToken{{Family: "family"}}
+					}).
+					Return(&gorm.DB{})
+				db.On("Save", mock.MatchedBy(func(token *authservice.RefreshToken) bool {
+					return token.IsRevoked()
+				})).Return(&gorm.DB{})
+
+				return fields{db}
+			}(),
+			args:       args{"refresh"},
+			wantErr:    authservice.ErrRefreshTokenReused,
+			wantRevoke: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := authservice.New(tt.fields.db, authservice.NewMemoryRevocationStore(), newKeyring(jwt.SigningMethodHS256, []byte("signing-key")), authservice.AllowSigningMethod{}, "", nil)
+			got, refreshToken, err := s.RotateRefreshToken(tt.args.refreshToken, time.Hour)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("AuthService.RotateRefreshToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr == nil && (got.UserID != tt.want || !got.IsUsed()) {
+				t.Errorf("AuthService.RotateRefreshToken() = %v, want %v", got.UserID, tt.want)
+			}
+
+			if tt.wantQuery != "" && query != tt.wantQuery {
+				t.Errorf("AuthService.RotateRefreshToken() query = %v, want %v", query, tt.wantQuery)
+			}
+
+			if tt.wantErr == nil && (refreshToken == "" || refreshToken == tt.args.refreshToken) {
+				t.Errorf("AuthService.RotateRefreshToken() refresh token = %v, want new token", refreshToken)
+			}
+
+			if tt.wantRevoke {
+				tt.fields.db.AssertCalled(t, "Save", mock.AnythingOfType("*authservice.RefreshToken"))
+			}
+		})
+	}
+}
+
+func TestAuthService_RevokeToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		wantErr bool
+	}{
+		{
+			name:   "revoked",
+			claims: jwt.MapClaims{"jti": "jti", "exp": float64(time.Now().Add(time.Minute).Unix())},
+		},
+		{
+			name:    "jti missing",
+			claims:  jwt.MapClaims{"exp": float64(time.Now().Add(time.Minute).Unix())},
+			wantErr: true,
+		},
+		{
+			name:    "exp missing",
+			claims:  jwt.MapClaims{"jti": "jti"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := authservice.NewMemoryRevocationStore()
+			s := authservice.New(db, store, newKeyring(jwt.SigningMethodHS256, []byte("signing-key")), authservice.AllowSigningMethod{}, "", nil)
+			if err := s.RevokeToken(tt.claims); (err != nil) != tt.wantErr {
+				t.Errorf("AuthService.RevokeToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if revoked, _ := store.IsRevoked("jti"); revoked == tt.wantErr {
+				t.Errorf("AuthService.RevokeToken() revoked = %v, want %v", revoked, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthService_ConsumeToken(t *testing.T) {
+	claims := jwt.MapClaims{"jti": "jti", "exp": float64(time.Now().Add(time.Minute).Unix())}
+
+	tests := []struct {
+		name    string
+		store   func() authservice.RevocationStoreInterface
+		claims  jwt.MapClaims
+		wantErr error
+	}{
+		{
+			name:   "consumed",
+			store:  authservice.NewMemoryRevocationStore,
+			claims: claims,
+		},
+		{
+			name: "consumed already",
+			store: func() authservice.RevocationStoreInterface {
+				s := authservice.NewMemoryRevocationStore()
+				s.Revoke("jti", time.Now().Add(time.Minute))
+				return s
+			},
+			claims:  claims,
+			wantErr: authservice.ErrTokenInvalid,
+		},
+		{
+			name:    "jti missing",
+			store:   authservice.NewMemoryRevocationStore,
+			claims:  jwt.MapClaims{"exp": float64(time.Now().Add(time.Minute).Unix())},
+			wantErr: authservice.ErrTokenInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.store()
+			s := authservice.New(db, store, newKeyring(jwt.SigningMethodHS256, []byte("signing-key")), authservice.AllowSigningMethod{}, "", nil)
+			if err := s.ConsumeToken(tt.claims); !errors.Is(err, tt.wantErr) {
+				t.Errorf("AuthService.ConsumeToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthService_IsTokenRevoked(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		store  func() authservice.RevocationStoreInterface
+		claims jwt.MapClaims
+		want   bool
+	}{
+		{
+			name:   "not revoked",
+			store:  authservice.NewMemoryRevocationStore,
+			claims: jwt.MapClaims{"jti": "jti", "iat": float64(now.Unix())},
+		},
+		{
+			name:   "jti missing",
+			store:  authservice.NewMemoryRevocationStore,
+			claims: jwt.MapClaims{"iat": float64(now.Unix())},
+			want:   true,
+		},
+		{
+			name: "token revoked",
+			store: func() authservice.RevocationStoreInterface {
+				s := authservice.NewMemoryRevocationStore()
+				_ = s.Revoke("jti", now.Add(time.Minute))
+
+				return s
+			},
+			claims: jwt.MapClaims{"jti": "jti", "iat": float64(now.Unix())},
+			want:   true,
+		},
+		{
+			name: "issued before user revocation",
+			store: func() authservice.RevocationStoreInterface {
+				s := authservice.NewMemoryRevocationStore()
+				_ = s.RevokeUser(1, now)
+
+				return s
+			},
+			claims: jwt.MapClaims{"jti": "jti", "iat": float64(now.Add(-time.Minute).Unix())},
+			want:   true,
+		},
+		{
+			name: "issued just before user revocation",
+			store: func() authservice.RevocationStoreInterface {
+				s := authservice.NewMemoryRevocationStore()
+				_ = s.RevokeUser(1, now)
+
+				return s
+			},
+			claims: jwt.MapClaims{"jti": "jti", "iat": float64(now.Unix()), "iat_us": float64(now.Add(-time.Millisecond).UnixMicro())},
+			want:   true,
+		},
+		{
+			name: "issued just after user revocation",
+			store: func() authservice.RevocationStoreInterface {
+				s := authservice.NewMemoryRevocationStore()
+				_ = s.RevokeUser(1, now)
+
+				return s
+			},
+			claims: jwt.MapClaims{"jti": "jti", "iat": float64(now.Unix()), "iat_us": float64(now.Add(time.Millisecond).UnixMicro())},
+		},
+		{
+			name: "issued after user revocation",
+			store: func() authservice.RevocationStoreInterface {
+				s := authservice.NewMemoryRevocationStore()
+				_ = s.RevokeUser(1, now.Add(-time.Minute))
+
+				return s
+			},
+			claims: jwt.MapClaims{"jti": "jti", "iat": float64(now.Unix())},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := authservice.New(db, tt.store(), newKeyring(jwt.SigningMethodHS256, []byte("signing-key")), authservice.AllowSigningMethod{}, "", nil)
+			got, err := s.IsTokenRevoked(tt.claims, 1)
+			if err != nil {
+				t.Errorf("AuthService.IsTokenRevoked() error = %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("AuthService.IsTokenRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthService_RevokeUserTokens(t *testing.T) {
+	db := &mocks.DatabaseInterface{}
+	db.On("Find", mock.AnythingOfType("*[]authservice.RefreshToken"), "user_id = ? AND revoked_at IS NULL", uint(1)).
+		Run(func(args mock.Arguments) {
+			*args.Get(0).(*[]authservice.RefreshToken) = []authservice.RefreshToken{{UserID: 1}, {UserID: 1}}
+		}).
+		Return(&gorm.DB{})
+	db.On("Save", mock.MatchedBy(func(token *authservice.RefreshToken) bool {
+		return token.IsRevoked()
+	})).Return(&gorm.DB{})
+	db.On("Delete", mock.AnythingOfType("*authservice.Session"), "user_id = ?", uint(1)).
+		Return(&gorm.DB{})
+
+	store := authservice.NewMemoryRevocationStore()
+	s := authservice.New(db, store, newKeyring(jwt.SigningMethodHS256, []byte("signing-key")), authservice.AllowSigningMethod{}, "", nil)
+	if err := s.RevokeUserTokens(1); err != nil {
+		t.Errorf("AuthService.RevokeUserTokens() error = %v", err)
+		return
+	}
+
+	if at, _ := store.UserRevokedAt(1); at.IsZero() {
+		t.Errorf("AuthService.RevokeUserTokens() user revoked at = %v, want not zero", at)
+	}
+
+	db.AssertNumberOfCalls(t, "Save", 2)
+	db.AssertCalled(t, "Delete", mock.AnythingOfType("*authservice.Session"), "user_id = ?", uint(1))
+}
+
+func TestAuthService_ParseToken_registeredClaims(t *testing.T) {
+	sign := func(claims jwt.MapClaims) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("signing-key"))
+		return token
+	}
+
+	tests := []struct {
+		name        string
+		tokenString string
+		wantErr     error
+	}{
+		{
+			name:        "issuer and audience match",
+			tokenString: sign(jwt.MapClaims{"sub": "1", "iss": "baroness", "aud": []string{"other", "baroness"}}),
+		},
+		{
+			name:        "audience as string",
+			tokenString: sign(jwt.MapClaims{"sub": "1", "iss": "baroness", "aud": "baroness"}),
+		},
+		{
+			name:        "issuer missing",
+			tokenString: sign(jwt.MapClaims{"sub": "1", "aud": "baroness"}),
+			wantErr:     authservice.ErrTokenIssuer,
+		},
+		{
+			name:        "issuer mismatch",
+			tokenString: sign(jwt.MapClaims{"sub": "1", "iss": "other", "aud": "baroness"}),
+			wantErr:     authservice.ErrTokenIssuer,
+		},
+		{
+			name:        "audience mismatch",
+			tokenString: sign(jwt.MapClaims{"sub": "1", "iss": "baroness", "aud": "other"}),
+			wantErr:     authservice.ErrTokenAudience,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := authservice.New(
+				db,
+				authservice.NewMemoryRevocationStore(),
+				newKeyring(jwt.SigningMethodHS256, []byte("signing-key")),
+				authservice.AllowSigningMethod{HMAC: true},
+				"baroness",
+				[]string{"baroness"},
+			)
+			if _, err := s.ParseToken(tt.tokenString); !errors.Is(err, tt.wantErr) {
+				t.Errorf("AuthService.ParseToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthService_GenerateToken_registeredClaims(t *testing.T) {
+	claimer := &mocks.Claimer{}
+	claimer.On("GetClaims").Return(map[string]interface{}{"sub": "1"})
+
+	s := authservice.New(
+		db,
+		authservice.NewMemoryRevocationStore(),
+		newKeyring(jwt.SigningMethodHS256, []byte("signing-key")),
+		authservice.AllowSigningMethod{HMAC: true},
+		"baroness",
+		[]string{"baroness", "other"},
+	)
+
+	token, err := s.GenerateToken(claimer, time.Minute)
+	if err != nil {
+		t.Fatalf("AuthService.GenerateToken() error = %v", err)
+	}
+
+	claims, err := s.ParseToken(token)
+	if err != nil {
+		t.Fatalf("AuthService.ParseToken() error = %v", err)
+	}
+
+	if claims["sub"] != "1" || claims["iss"] != "baroness" || !reflect.DeepEqual(claims["aud"], []interface{}{"baroness", "other"}) {
+		t.Errorf("AuthService.GenerateToken() claims = %v", claims)
+	}
+}
+
+func TestAuthService_GenerateToken_overrideRegisteredClaims(t *testing.T) {
+	s := authservice.New(
+		db,
+		authservice.NewMemoryRevocationStore(),
+		newKeyring(jwt.SigningMethodHS256, []byte("signing-key")),
+		authservice.AllowSigningMethod{HMAC: true},
+		"baroness",
+		[]string{"baroness"},
+	)
+
+	token, err := s.GenerateToken(authservice.Claims{"sub": "1", "iss": "https://id.example.com", "aud": "client"}, time.Minute)
+	if err != nil {
+		t.Fatalf("AuthService.GenerateToken() error = %v", err)
+	}
+
+	// tokens for another audience are not accepted by this service
+	if _, err = s.ParseToken(token); err == nil {
+		t.Errorf("AuthService.ParseToken() error = nil, want an issuer error")
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err = new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		t.Fatalf("jwt.Parser.ParseUnverified() error = %v", err)
+	}
+
+	if claims["iss"] != "https://id.example.com" || claims["aud"] != "client" {
+		t.Errorf("AuthService.GenerateToken() claims = %v", claims)
+	}
+}
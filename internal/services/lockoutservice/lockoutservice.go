@@ -0,0 +1,221 @@
+package lockoutservice
+
+import (
+	"errors"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Policy struct {
+	// MaxAttempts is the number of failures which locks the key.
+	MaxAttempts int
+	// Backoff is the delay after the first failure, doubled for every
+	// following one. Zero disables backoff.
+	Backoff time.Duration
+	// LockoutDuration is how long a key stays locked, and how long failures
+	// are remembered.
+	LockoutDuration time.Duration
+}
+
+type LockoutService struct {
+	db            database.DatabaseInterface
+	accountPolicy Policy
+	ipPolicy      Policy
+}
+
+type LockoutServiceInterface interface {
+	Attempt(username string, ip string) (time.Duration, error)
+	Release(username string, ip string) error
+	RecordFailure(username string, ip string) error
+	RecordSuccess(username string, ip string) error
+	Unlock(username string) error
+}
+
+func New(db database.DatabaseInterface, accountPolicy Policy, ipPolicy Policy) LockoutServiceInterface {
+	return LockoutService{db, accountPolicy, ipPolicy}
+}
+
+// Attempt counts a login attempt to the account from the address before the
+// credentials are verified, so concurrent guesses can not all pass a check
+// made before any of them failed. It returns how long the caller has to wait
+// before trying again, zero means the credentials may be verified. Every
+// allowed attempt has to be followed by RecordFailure, RecordSuccess or
+// Release.
+func (s LockoutService) Attempt(username string, ip string) (time.Duration, error) {
+	var retryAfter time.Duration
+
+	for _, k := range []struct {
+		key    string
+		policy Policy
+	}{{accountKey(username), s.accountPolicy}, {ipKey(ip), s.ipPolicy}} {
+		d, err := s.count(k.key, k.policy)
+		if err != nil {
+			return 0, err
+		}
+
+		if d > retryAfter {
+			retryAfter = d
+		}
+	}
+
+	return retryAfter, nil
+}
+
+// Release takes back an attempt which turned out not to be a failure, like
+// a correct password still waiting for the second factor.
+func (s LockoutService) Release(username string, ip string) error {
+	if err := s.release(accountKey(username)); err != nil {
+		return err
+	}
+
+	return s.release(ipKey(ip))
+}
+
+// RecordFailure locks the account and the address for the failures Attempt
+// counted.
+func (s LockoutService) RecordFailure(username string, ip string) error {
+	if err := s.lock(accountKey(username), s.accountPolicy); err != nil {
+		return err
+	}
+
+	return s.lock(ipKey(ip), s.ipPolicy)
+}
+
+// RecordSuccess clears the failures of the account. Failures of the address
+// are kept so logging in to one account does not reset guesses on others,
+// only the attempt is taken back.
+func (s LockoutService) RecordSuccess(username string, ip string) error {
+	if err := s.Unlock(username); err != nil {
+		return err
+	}
+
+	return s.release(ipKey(ip))
+}
+
+func (s LockoutService) Unlock(username string) error {
+	result := s.db.Delete(&LoginAttempt{}, "key = ?", accountKey(username))
+	return result.Error
+}
+
+func (s LockoutService) get(key string) (*LoginAttempt, error) {
+	attempt := &LoginAttempt{}
+
+	if result := s.db.First(attempt, "key = ?", key); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return &LoginAttempt{Key: key}, nil
+		}
+
+		return nil, result.Error
+	}
+
+	return attempt, nil
+}
+
+// count counts the attempt in the database unless the key is locked, and
+// returns how long the attempt has to wait. An attempt counted beyond the
+// maximum is refused, it raced with the failure which locks the key.
+func (s LockoutService) count(key string, policy Policy) (time.Duration, error) {
+	now := time.Now()
+	attempt := &LoginAttempt{Key: key, Failures: 1, LastFailedAt: now}
+
+	result := s.db.Scopes(func(tx *gorm.DB) *gorm.DB {
+		return tx.Clauses(
+			clause.OnConflict{
+				Columns: []clause.Column{{Name: "key"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"failures":       gorm.Expr("CASE WHEN login_attempts.last_failed_at < ? THEN 1 ELSE login_attempts.failures + 1 END", now.Add(-policy.LockoutDuration)),
+					"last_failed_at": now,
+				}),
+				Where: clause.Where{Exprs: []clause.Expression{
+					gorm.Expr("login_attempts.locked_until IS NULL OR login_attempts.locked_until <= ?", now),
+				}},
+			},
+			clause.Returning{Columns: []clause.Column{{Name: "failures"}}},
+		)
+	}).Create(attempt)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		locked, err := s.get(key)
+		if err != nil {
+			return 0, err
+		}
+
+		if d := locked.RetryAfter(); d > 0 {
+			return d, nil
+		}
+
+		// the lock expired meanwhile, but the attempt has not been counted
+		return time.Second, nil
+	}
+
+	if policy.MaxAttempts > 0 && attempt.Failures > policy.MaxAttempts {
+		return policy.LockoutDuration, nil
+	}
+
+	return 0, nil
+}
+
+// lock locks the key for the failures counted. A concurrent attempt counted
+// meanwhile sets its own lock when it fails.
+func (s LockoutService) lock(key string, policy Policy) error {
+	attempt, err := s.get(key)
+	if err != nil {
+		return err
+	}
+
+	if attempt.Failures == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	var lockedUntil *time.Time
+	if policy.MaxAttempts > 0 && attempt.Failures >= policy.MaxAttempts {
+		t := now.Add(policy.LockoutDuration)
+		lockedUntil = &t
+	} else if policy.Backoff > 0 {
+		t := now.Add(backoff(policy, attempt.Failures))
+		lockedUntil = &t
+	}
+
+	result := s.db.Scopes(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&LoginAttempt{}).Where("key = ? AND failures = ?", key, attempt.Failures)
+	}).Update("locked_until", lockedUntil)
+
+	return result.Error
+}
+
+func (s LockoutService) release(key string) error {
+	result := s.db.Scopes(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&LoginAttempt{}).Where("key = ? AND failures > 0", key)
+	}).Update("failures", gorm.Expr("failures - 1"))
+
+	return result.Error
+}
+
+func backoff(policy Policy, failures int) time.Duration {
+	d := policy.Backoff
+	for i := 1; i < failures && d < policy.LockoutDuration; i++ {
+		d *= 2
+	}
+
+	if d > policy.LockoutDuration {
+		return policy.LockoutDuration
+	}
+
+	return d
+}
+
+func accountKey(username string) string {
+	return "username:" + username
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,22 @@
+package lockoutservice
+
+import "time"
+
+type LoginAttempt struct {
+	Key          string `gorm:"primarykey"`
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
+
+func (a *LoginAttempt) RetryAfter() time.Duration {
+	if a.LockedUntil == nil {
+		return 0
+	}
+
+	if d := time.Until(*a.LockedUntil); d > 0 {
+		return d
+	}
+
+	return 0
+}
@@ -0,0 +1,282 @@
+package lockoutservice_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/services/lockoutservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var policy = lockoutservice.Policy{
+	MaxAttempts:     3,
+	Backoff:         time.Second,
+	LockoutDuration: time.Minute,
+}
+
+func found(attempt lockoutservice.LoginAttempt) func(args mock.Arguments) {
+	return func(args mock.Arguments) {
+		a := args.Get(0).(*lockoutservice.LoginAttempt)
+		attempt.Key = args.String(2)
+		*a = attempt
+	}
+}
+
+func dryRun(t *testing.T) *gorm.DB {
+	dry, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dry
+}
+
+func TestLockoutService_Attempt(t *testing.T) {
+	future := time.Now().Add(30 * time.Second)
+	past := time.Now().Add(-time.Second)
+
+	tests := []struct {
+		name     string
+		failures map[string]int
+		locked   map[string]*time.Time
+		err      error
+		wantMin  time.Duration
+		wantMax  time.Duration
+		wantErr  bool
+	}{
+		{
+			name:     "first attempt",
+			failures: map[string]int{"username:admin": 1, "ip:127.0.0.1": 1},
+		},
+		{
+			name:     "last attempt allowed",
+			failures: map[string]int{"username:admin": 3, "ip:127.0.0.1": 3},
+		},
+		{
+			name:     "account locked",
+			failures: map[string]int{"ip:127.0.0.1": 1},
+			locked:   map[string]*time.Time{"username:admin": &future},
+			wantMin:  29 * time.Second,
+			wantMax:  30 * time.Second,
+		},
+		{
+			name:     "address locked",
+			failures: map[string]int{"username:admin": 1},
+			locked:   map[string]*time.Time{"ip:127.0.0.1": &future},
+			wantMin:  29 * time.Second,
+			wantMax:  30 * time.Second,
+		},
+		{
+			name:     "lock expired meanwhile",
+			failures: map[string]int{"ip:127.0.0.1": 1},
+			locked:   map[string]*time.Time{"username:admin": &past},
+			wantMin:  time.Second,
+			wantMax:  time.Second,
+		},
+		{
+			name:     "counted beyond max attempts",
+			failures: map[string]int{"username:admin": 4, "ip:127.0.0.1": 4},
+			wantMin:  time.Minute,
+			wantMax:  time.Minute,
+		},
+		{
+			name:    "count fail",
+			err:     errors.New("count fail"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dry := dryRun(t)
+
+			var query string
+			// the database counts the attempt unless the key is locked
+			dry.Callback().Create().After("gorm:create").Register("test:create", func(tx *gorm.DB) {
+				query = tx.Statement.SQL.String()
+				if tt.err != nil {
+					tx.AddError(tt.err)
+					return
+				}
+
+				attempt := tx.Statement.Dest.(*lockoutservice.LoginAttempt)
+				if failures, ok := tt.failures[attempt.Key]; ok {
+					attempt.Failures = failures
+					tx.RowsAffected = 1
+				}
+			})
+
+			db := &mocks.DatabaseInterface{}
+			db.On("Scopes", mock.Anything).Return(dry.Scopes)
+			for key, locked := range tt.locked {
+				db.On("First", mock.AnythingOfType("*lockoutservice.LoginAttempt"), "key = ?", key).
+					Run(found(lockoutservice.LoginAttempt{Failures: 3, LockedUntil: locked})).
+					Return(&gorm.DB{})
+			}
+
+			s := lockoutservice.New(db, policy, policy)
+			got, err := s.Attempt("admin", "127.0.0.1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LockoutService.Attempt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("LockoutService.Attempt() = %v, want between %v and %v", got, tt.wantMin, tt.wantMax)
+			}
+
+			want := `INSERT INTO "login_attempts" ("key","failures","last_failed_at","locked_until") VALUES ($1,$2,$3,$4) ON CONFLICT ("key") DO UPDATE SET "failures"=CASE WHEN login_attempts.last_failed_at < $5 THEN 1 ELSE login_attempts.failures + 1 END,"last_failed_at"=$6 WHERE login_attempts.locked_until IS NULL OR login_attempts.locked_until <= $7  RETURNING "failures"`
+			if query != want {
+				t.Errorf("LockoutService.Attempt() query = %v, want %v", query, want)
+			}
+		})
+	}
+}
+
+func TestLockoutService_RecordFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		err        error
+		wantLocked time.Duration
+		wantErr    bool
+	}{
+		{
+			name:       "first failure backs off",
+			failures:   1,
+			wantLocked: time.Second,
+		},
+		{
+			name:       "backoff doubles",
+			failures:   2,
+			wantLocked: 2 * time.Second,
+		},
+		{
+			name:       "locked after max attempts",
+			failures:   3,
+			wantLocked: time.Minute,
+		},
+		{
+			name:    "query fail",
+			err:     errors.New("query fail"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dry := dryRun(t)
+
+			var (
+				queries []string
+				locked  *time.Time
+			)
+			dry.Callback().Update().After("gorm:update").Register("test:update", func(tx *gorm.DB) {
+				queries = append(queries, tx.Statement.SQL.String())
+				if key := tx.Statement.Vars[1]; key == "username:admin" {
+					locked, _ = tx.Statement.Vars[0].(*time.Time)
+				}
+			})
+
+			// the failures Attempt counted for the key
+			db := &mocks.DatabaseInterface{}
+			db.On("First", mock.AnythingOfType("*lockoutservice.LoginAttempt"), "key = ?", mock.AnythingOfType("string")).
+				Run(found(lockoutservice.LoginAttempt{Failures: tt.failures})).
+				Return(&gorm.DB{Error: tt.err})
+			db.On("Scopes", mock.Anything).Return(dry.Scopes)
+
+			s := lockoutservice.New(db, policy, lockoutservice.Policy{MaxAttempts: 10, LockoutDuration: time.Minute})
+			if err := s.RecordFailure("admin", "127.0.0.1"); (err != nil) != tt.wantErr {
+				t.Errorf("LockoutService.RecordFailure() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			attempt := lockoutservice.LoginAttempt{LockedUntil: locked}
+			if got := attempt.RetryAfter(); got > tt.wantLocked || got < tt.wantLocked-time.Second {
+				t.Errorf("LockoutService.RecordFailure() retry after = %v, want %v", got, tt.wantLocked)
+			}
+
+			want := `UPDATE "login_attempts" SET "locked_until"=$1 WHERE key = $2 AND failures = $3`
+			if len(queries) != 2 || queries[0] != want {
+				t.Errorf("LockoutService.RecordFailure() queries = %v, want %v", queries, want)
+			}
+		})
+	}
+}
+
+func TestLockoutService_Release(t *testing.T) {
+	dry := dryRun(t)
+
+	var queries []string
+	dry.Callback().Update().After("gorm:update").Register("test:update", func(tx *gorm.DB) {
+		queries = append(queries, tx.Statement.SQL.String())
+	})
+
+	db := &mocks.DatabaseInterface{}
+	db.On("Scopes", mock.Anything).Return(dry.Scopes)
+
+	s := lockoutservice.New(db, policy, policy)
+	if err := s.Release("admin", "127.0.0.1"); err != nil {
+		t.Errorf("LockoutService.Release() error = %v", err)
+	}
+
+	want := `UPDATE "login_attempts" SET "failures"=failures - 1 WHERE key = $1 AND failures > 0`
+	if len(queries) != 2 || queries[0] != want || queries[1] != want {
+		t.Errorf("LockoutService.Release() queries = %v, want %v", queries, want)
+	}
+}
+
+func TestLockoutService_Unlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{
+			name: "unlocked",
+		},
+		{
+			name:    "delete fail",
+			err:     errors.New("delete fail"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query string
+			dry := dryRun(t)
+			dry.Callback().Update().After("gorm:update").Register("test:update", func(tx *gorm.DB) {
+				query = tx.Statement.SQL.String()
+			})
+
+			db := &mocks.DatabaseInterface{}
+			db.On("Delete", mock.AnythingOfType("*lockoutservice.LoginAttempt"), "key = ?", "username:admin").
+				Return(&gorm.DB{Error: tt.err})
+			db.On("Scopes", mock.Anything).Return(dry.Scopes)
+
+			s := lockoutservice.New(db, policy, policy)
+			if err := s.Unlock("admin"); (err != nil) != tt.wantErr {
+				t.Errorf("LockoutService.Unlock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := s.RecordSuccess("admin", "127.0.0.1"); (err != nil) != tt.wantErr {
+				t.Errorf("LockoutService.RecordSuccess() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// the address keeps its failures, only the attempt is taken back
+			if want := `UPDATE "login_attempts" SET "failures"=failures - 1 WHERE key = $1 AND failures > 0`; !tt.wantErr && query != want {
+				t.Errorf("LockoutService.RecordSuccess() query = %v, want %v", query, want)
+			}
+		})
+	}
+}
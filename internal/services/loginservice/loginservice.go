@@ -0,0 +1,54 @@
+package loginservice
+
+import (
+	"errors"
+
+	"github.com/maetad/baroness-api/internal/services/userservice"
+)
+
+var ErrCredentialsInvalid = errors.New("credentials are invalid")
+
+// Authenticator verifies the credentials of a user against one backend.
+// It returns an error wrapping ErrCredentialsInvalid when the backend
+// rejects them, any other error means the backend could not be asked.
+type Authenticator interface {
+	Authenticate(username string, password string) (userservice.UserInterface, error)
+}
+
+// LoginService asks its authenticators in order and signs in with the
+// first one which accepts the credentials.
+type LoginService struct {
+	authenticators []Authenticator
+}
+
+type LoginServiceInterface interface {
+	Authenticate(username string, password string) (userservice.UserInterface, error)
+}
+
+func New(authenticators ...Authenticator) LoginServiceInterface {
+	return LoginService{authenticators}
+}
+
+// Authenticate returns ErrCredentialsInvalid when every authenticator
+// rejects the credentials. When one of them failed otherwise its error is
+// returned instead, as the credentials might have been accepted.
+func (s LoginService) Authenticate(username string, password string) (userservice.UserInterface, error) {
+	var failed error
+
+	for _, a := range s.authenticators {
+		user, err := a.Authenticate(username, password)
+		if err == nil {
+			return user, nil
+		}
+
+		if failed == nil && !errors.Is(err, ErrCredentialsInvalid) {
+			failed = err
+		}
+	}
+
+	if failed != nil {
+		return nil, failed
+	}
+
+	return nil, ErrCredentialsInvalid
+}
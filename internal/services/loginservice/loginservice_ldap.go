@@ -0,0 +1,177 @@
+package loginservice
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+)
+
+// LDAPConfig describes the directory and how its entries map to users.
+type LDAPConfig struct {
+	// URL is the directory server, ldap:// or ldaps://.
+	URL      string
+	StartTLS bool
+	// BindDN and BindPassword are the service account searching for the
+	// user. The search is anonymous when BindDN is empty.
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds the entry of the user, %s is the escaped username.
+	UserFilter           string
+	UsernameAttribute    string
+	DisplayNameAttribute string
+	EmailAttribute       string
+	Timeout              time.Duration
+}
+
+// LDAPAuthenticator verifies the password by binding as the user's entry.
+// A user is created and linked to the entry on the first login.
+type LDAPAuthenticator struct {
+	config      LDAPConfig
+	userservice userservice.UserServiceInterface
+	roleservice roleservice.RoleServiceInterface
+}
+
+func NewLDAPAuthenticator(
+	config LDAPConfig,
+	userservice userservice.UserServiceInterface,
+	roleservice roleservice.RoleServiceInterface,
+) Authenticator {
+	return LDAPAuthenticator{config, userservice, roleservice}
+}
+
+func (a LDAPAuthenticator) Authenticate(username string, password string) (userservice.UserInterface, error) {
+	// an empty password is an unauthenticated bind, which most servers
+	// accept for any DN
+	if password == "" {
+		return nil, fmt.Errorf("%w: password is empty", ErrCredentialsInvalid)
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.config.BindDN != "" {
+		if err = conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.config.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		int(a.config.Timeout.Seconds()),
+		false,
+		fmt.Sprintf(a.config.UserFilter, ldap.EscapeFilter(username)),
+		[]string{a.config.UsernameAttribute, a.config.DisplayNameAttribute, a.config.EmailAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Entries) != 1 {
+		return nil, fmt.Errorf("%w: %d entries match %v", ErrCredentialsInvalid, len(result.Entries), username)
+	}
+
+	entry := result.Entries[0]
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, fmt.Errorf("%w: %v", ErrCredentialsInvalid, err)
+		}
+
+		return nil, err
+	}
+
+	return a.user(entry, username)
+}
+
+func (a LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	u, err := url.Parse(a.config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{ServerName: u.Hostname()}
+
+	conn, err := ldap.DialURL(
+		a.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: a.config.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetTimeout(a.config.Timeout)
+
+	if a.config.StartTLS {
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// user returns the user linked to the entry, creating it on the first
+// login. Display name and email follow the directory.
+func (a LDAPAuthenticator) user(entry *ldap.Entry, username string) (userservice.UserInterface, error) {
+	r := userservice.UserExternalCreateRequest{
+		Username:    entry.GetAttributeValue(a.config.UsernameAttribute),
+		DisplayName: entry.GetAttributeValue(a.config.DisplayNameAttribute),
+		Email:       entry.GetAttributeValue(a.config.EmailAttribute),
+	}
+
+	if r.Username == "" {
+		r.Username = username
+	}
+	if r.DisplayName == "" {
+		r.DisplayName = r.Username
+	}
+
+	user, err := a.userservice.GetByIdentity(a.config.URL, entry.DN)
+	if err == nil {
+		u := user.(*userservice.User)
+		if u.DisplayName == r.DisplayName && u.Email == r.Email {
+			return user, nil
+		}
+
+		return a.userservice.Update(user, userservice.UserUpdateRequest{DisplayName: r.DisplayName, Email: r.Email})
+	}
+
+	if !errors.Is(err, userservice.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	// a local user with the same username is not taken over by the entry
+	if _, err = a.userservice.GetByUsername(r.Username); err == nil {
+		return nil, fmt.Errorf("%w: username %v is taken by a user not linked to %v", ErrCredentialsInvalid, r.Username, entry.DN)
+	}
+
+	if user, err = a.userservice.CreateExternal(r); err != nil {
+		return nil, err
+	}
+
+	if err = a.roleservice.SetUserRoles(user.(*userservice.User).ID, []string{roleservice.RoleUser}); err != nil {
+		return nil, err
+	}
+
+	if err = a.userservice.LinkIdentity(user, a.config.URL, entry.DN); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,304 @@
+package loginservice_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/loginservice"
+	"github.com/maetad/baroness-api/internal/services/roleservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/maetad/baroness-api/mocks"
+)
+
+const janeDN = "uid=jane,ou=people,dc=example,dc=com"
+
+type entry struct {
+	password   string
+	attributes map[string]string
+}
+
+// directory is an in-process LDAP server answering simple binds and
+// equality searches on uid. Searching needs the service account.
+var directory = map[string]entry{
+	"cn=admin,dc=example,dc=com": {password: "secret"},
+	janeDN: {
+		password: "password",
+		attributes: map[string]string{
+			"uid":  "jane",
+			"cn":   "Jane Doe",
+			"mail": "jane@example.com",
+		},
+	},
+}
+
+func newDirectory(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go serve(conn)
+		}
+	}()
+
+	return "ldap://" + l.Addr().String()
+}
+
+func serve(conn net.Conn) {
+	defer conn.Close()
+
+	var bound string
+	for {
+		p, err := ber.ReadPacket(conn)
+		if err != nil || len(p.Children) < 2 {
+			return
+		}
+
+		id := p.Children[0].Value.(int64)
+		op := p.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			e, ok := directory[dn]
+			if !ok || e.password != op.Children[2].Data.String() {
+				bound = ""
+				conn.Write(response(id, ldap.ApplicationBindResponse, result(ldap.LDAPResultInvalidCredentials)...).Bytes())
+				continue
+			}
+
+			bound = dn
+			conn.Write(response(id, ldap.ApplicationBindResponse, result(ldap.LDAPResultSuccess)...).Bytes())
+		case ldap.ApplicationSearchRequest:
+			if bound != "cn=admin,dc=example,dc=com" {
+				conn.Write(response(id, ldap.ApplicationSearchResultDone, result(ldap.LDAPResultInsufficientAccessRights)...).Bytes())
+				continue
+			}
+
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			for dn, e := range directory {
+				if uid, ok := e.attributes["uid"]; ok && filter == fmt.Sprintf("(uid=%s)", uid) {
+					conn.Write(response(id, ldap.ApplicationSearchResultEntry, searchEntry(dn, e)...).Bytes())
+				}
+			}
+
+			conn.Write(response(id, ldap.ApplicationSearchResultDone, result(ldap.LDAPResultSuccess)...).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func response(id int64, tag ber.Tag, children ...*ber.Packet) *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	for _, c := range children {
+		op.AppendChild(c)
+	}
+	p.AppendChild(op)
+
+	return p
+}
+
+func result(code int) []*ber.Packet {
+	return []*ber.Packet{
+		ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"),
+		ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"),
+		ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"),
+	}
+}
+
+func searchEntry(dn string, e entry) []*ber.Packet {
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, value := range e.attributes {
+		a := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		a.AppendChild(values)
+
+		attributes.AppendChild(a)
+	}
+
+	return []*ber.Packet{
+		ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "DN"),
+		attributes,
+	}
+}
+
+func TestLDAPAuthenticator_Authenticate(t *testing.T) {
+	url := newDirectory(t)
+
+	config := loginservice.LDAPConfig{
+		URL:                  url,
+		BindDN:               "cn=admin,dc=example,dc=com",
+		BindPassword:         "secret",
+		BaseDN:               "dc=example,dc=com",
+		UserFilter:           "(uid=%s)",
+		UsernameAttribute:    "uid",
+		DisplayNameAttribute: "cn",
+		EmailAttribute:       "mail",
+	}
+
+	linked := &userservice.User{Model: model.Model{ID: 3}, Username: "jane", DisplayName: "Jane Doe", Email: "jane@example.com"}
+	renamed := &userservice.User{Model: model.Model{ID: 3}, Username: "jane", DisplayName: "Jane", Email: "jane@example.com"}
+	provisioned := &userservice.User{Model: model.Model{ID: 5}, Username: "jane", DisplayName: "Jane Doe", Email: "jane@example.com"}
+
+	notLinked := func(u *mocks.UserServiceInterface) {
+		u.On("GetByIdentity", url, janeDN).
+			Return(nil, userservice.ErrIdentityNotFound)
+	}
+
+	tests := []struct {
+		name        string
+		config      func(c loginservice.LDAPConfig) loginservice.LDAPConfig
+		username    string
+		password    string
+		userservice func(u *mocks.UserServiceInterface)
+		want        *userservice.User
+		wantInvalid bool
+		wantErr     bool
+	}{
+		{
+			name:     "user provisioned",
+			username: "jane",
+			password: "password",
+			userservice: func(u *mocks.UserServiceInterface) {
+				notLinked(u)
+				u.On("GetByUsername", "jane").
+					Return(nil, errors.New("record not found"))
+				u.On("CreateExternal", userservice.UserExternalCreateRequest{Username: "jane", DisplayName: "Jane Doe", Email: "jane@example.com"}).
+					Return(provisioned, nil)
+				u.On("LinkIdentity", provisioned, url, janeDN).
+					Return(nil)
+			},
+			want: provisioned,
+		},
+		{
+			name:     "linked user",
+			username: "jane",
+			password: "password",
+			userservice: func(u *mocks.UserServiceInterface) {
+				u.On("GetByIdentity", url, janeDN).
+					Return(linked, nil)
+			},
+			want: linked,
+		},
+		{
+			name:     "linked user renamed in the directory",
+			username: "jane",
+			password: "password",
+			userservice: func(u *mocks.UserServiceInterface) {
+				u.On("GetByIdentity", url, janeDN).
+					Return(renamed, nil)
+				u.On("Update", renamed, userservice.UserUpdateRequest{DisplayName: "Jane Doe", Email: "jane@example.com"}).
+					Return(linked, nil)
+			},
+			want: linked,
+		},
+		{
+			name:     "username taken by a local user",
+			username: "jane",
+			password: "password",
+			userservice: func(u *mocks.UserServiceInterface) {
+				notLinked(u)
+				u.On("GetByUsername", "jane").
+					Return(linked, nil)
+			},
+			wantInvalid: true,
+		},
+		{
+			name:        "password incorrect",
+			username:    "jane",
+			password:    "wrong",
+			wantInvalid: true,
+		},
+		{
+			name:        "password empty",
+			username:    "jane",
+			wantInvalid: true,
+		},
+		{
+			name:        "user not in directory",
+			username:    "john",
+			password:    "password",
+			wantInvalid: true,
+		},
+		{
+			name:        "filter escaped",
+			username:    "*",
+			password:    "password",
+			wantInvalid: true,
+		},
+		{
+			name: "service account rejected",
+			config: func(c loginservice.LDAPConfig) loginservice.LDAPConfig {
+				c.BindPassword = "wrong"
+				return c
+			},
+			username: "jane",
+			password: "password",
+			wantErr:  true,
+		},
+		{
+			name: "directory unavailable",
+			config: func(c loginservice.LDAPConfig) loginservice.LDAPConfig {
+				c.URL = "ldap://127.0.0.1:1"
+				return c
+			},
+			username: "jane",
+			password: "password",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &mocks.UserServiceInterface{}
+			if tt.userservice != nil {
+				tt.userservice(u)
+			}
+
+			r := &mocks.RoleServiceInterface{}
+			r.On("SetUserRoles", uint(5), []string{roleservice.RoleUser}).
+				Return(nil)
+
+			c := config
+			if tt.config != nil {
+				c = tt.config(c)
+			}
+
+			got, err := loginservice.NewLDAPAuthenticator(c, u, r).Authenticate(tt.username, tt.password)
+			if (err != nil) != (tt.wantInvalid || tt.wantErr) {
+				t.Errorf("LDAPAuthenticator.Authenticate() error = %v", err)
+				return
+			}
+
+			if errors.Is(err, loginservice.ErrCredentialsInvalid) != tt.wantInvalid {
+				t.Errorf("LDAPAuthenticator.Authenticate() error = %v, wantInvalid %v", err, tt.wantInvalid)
+				return
+			}
+
+			if tt.want != nil && got != tt.want {
+				t.Errorf("LDAPAuthenticator.Authenticate() = %v, want %v", got, tt.want)
+			}
+
+			u.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package loginservice
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"gorm.io/gorm"
+)
+
+// LocalAuthenticator verifies the password stored with the user.
+type LocalAuthenticator struct {
+	userservice userservice.UserServiceInterface
+}
+
+func NewLocalAuthenticator(userservice userservice.UserServiceInterface) Authenticator {
+	return LocalAuthenticator{userservice}
+}
+
+func (a LocalAuthenticator) Authenticate(username string, password string) (userservice.UserInterface, error) {
+	user, err := a.userservice.GetByUsername(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %v", ErrCredentialsInvalid, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = user.ValidatePassword(password); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCredentialsInvalid, err)
+	}
+
+	// the password is verified, failing to upgrade its hash only means it
+	// is tried again on the next login
+	_ = a.userservice.RehashPassword(user, password)
+
+	return user, nil
+}
@@ -0,0 +1,180 @@
+package loginservice_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/maetad/baroness-api/internal/services/loginservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/maetad/baroness-api/mocks"
+	"gorm.io/gorm"
+)
+
+func TestLoginService_Authenticate(t *testing.T) {
+	user := &userservice.User{Username: "jane"}
+	rejected := fmt.Errorf("%w: password incorrect", loginservice.ErrCredentialsInvalid)
+	unavailable := errors.New("connection refused")
+
+	authenticator := func(u userservice.UserInterface, err error) loginservice.Authenticator {
+		a := &mocks.Authenticator{}
+		a.On("Authenticate", "jane", "password").
+			Return(u, err)
+
+		return a
+	}
+
+	tests := []struct {
+		name           string
+		authenticators []loginservice.Authenticator
+		want           userservice.UserInterface
+		wantErr        error
+	}{
+		{
+			name:    "no authenticators",
+			wantErr: loginservice.ErrCredentialsInvalid,
+		},
+		{
+			name: "first accepts",
+			authenticators: []loginservice.Authenticator{
+				authenticator(user, nil),
+				&mocks.Authenticator{},
+			},
+			want: user,
+		},
+		{
+			name: "second accepts",
+			authenticators: []loginservice.Authenticator{
+				authenticator(nil, rejected),
+				authenticator(user, nil),
+			},
+			want: user,
+		},
+		{
+			name: "accepted after an unavailable backend",
+			authenticators: []loginservice.Authenticator{
+				authenticator(nil, unavailable),
+				authenticator(user, nil),
+			},
+			want: user,
+		},
+		{
+			name: "all reject",
+			authenticators: []loginservice.Authenticator{
+				authenticator(nil, rejected),
+				authenticator(nil, rejected),
+			},
+			wantErr: loginservice.ErrCredentialsInvalid,
+		},
+		{
+			name: "rejected and unavailable",
+			authenticators: []loginservice.Authenticator{
+				authenticator(nil, rejected),
+				authenticator(nil, unavailable),
+			},
+			wantErr: unavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loginservice.New(tt.authenticators...).Authenticate("jane", "password")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("LoginService.Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("LoginService.Authenticate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalAuthenticator_Authenticate(t *testing.T) {
+	user := &userservice.User{Username: "jane"}
+	user.SetPassword("password")
+	unavailable := errors.New("database error")
+
+	tests := []struct {
+		name        string
+		userservice func() *mocks.UserServiceInterface
+		password    string
+		wantErr     error
+	}{
+		{
+			name: "user not found",
+			userservice: func() *mocks.UserServiceInterface {
+				u := &mocks.UserServiceInterface{}
+				u.On("GetByUsername", "jane").
+					Return(nil, gorm.ErrRecordNotFound)
+
+				return u
+			},
+			password: "password",
+			wantErr:  loginservice.ErrCredentialsInvalid,
+		},
+		{
+			name: "user lookup fail",
+			userservice: func() *mocks.UserServiceInterface {
+				u := &mocks.UserServiceInterface{}
+				u.On("GetByUsername", "jane").
+					Return(nil, unavailable)
+
+				return u
+			},
+			password: "password",
+			wantErr:  unavailable,
+		},
+		{
+			name: "password incorrect",
+			userservice: func() *mocks.UserServiceInterface {
+				u := &mocks.UserServiceInterface{}
+				u.On("GetByUsername", "jane").
+					Return(user, nil)
+
+				return u
+			},
+			password: "wrong",
+			wantErr:  loginservice.ErrCredentialsInvalid,
+		},
+		{
+			name: "rehash fail",
+			userservice: func() *mocks.UserServiceInterface {
+				u := &mocks.UserServiceInterface{}
+				u.On("GetByUsername", "jane").
+					Return(user, nil)
+				u.On("RehashPassword", user, "password").
+					Return(errors.New("database error"))
+
+				return u
+			},
+			password: "password",
+		},
+		{
+			name: "password correct",
+			userservice: func() *mocks.UserServiceInterface {
+				u := &mocks.UserServiceInterface{}
+				u.On("GetByUsername", "jane").
+					Return(user, nil)
+				u.On("RehashPassword", user, "password").
+					Return(nil)
+
+				return u
+			},
+			password: "password",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loginservice.NewLocalAuthenticator(tt.userservice()).Authenticate("jane", tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("LocalAuthenticator.Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr == nil && got != user {
+				t.Errorf("LocalAuthenticator.Authenticate() = %v, want %v", got, user)
+			}
+		})
+	}
+}
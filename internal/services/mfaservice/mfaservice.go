@@ -0,0 +1,198 @@
+package mfaservice
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/database"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrNotEnrolled    = errors.New("two-factor authentication is not enrolled")
+	ErrCodeInvalid    = errors.New("two-factor code is invalid")
+)
+
+type MFAService struct {
+	db     database.DatabaseInterface
+	issuer string
+}
+
+type MFAServiceInterface interface {
+	Enroll(user userservice.UserInterface) (Enrollment, error)
+	Confirm(user userservice.UserInterface, code string) ([]string, error)
+	Verify(user userservice.UserInterface, code string) error
+	Disable(user userservice.UserInterface) error
+}
+
+func New(db database.DatabaseInterface, issuer string) MFAServiceInterface {
+	return MFAService{db, issuer}
+}
+
+// Enroll generates a new secret for the user. Two-factor authentication is
+// not enforced until the secret is confirmed with a code.
+func (s MFAService) Enroll(user userservice.UserInterface) (Enrollment, error) {
+	u := user.(*userservice.User)
+	if u.TOTPEnabled {
+		return Enrollment{}, ErrAlreadyEnabled
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		return Enrollment{}, err
+	}
+
+	u.TOTPSecret = secret
+	u.TOTPLastStep = 0
+	if result := s.db.Save(u); result.Error != nil {
+		return Enrollment{}, result.Error
+	}
+
+	return Enrollment{
+		Secret: secret,
+		URI:    keyURI(s.issuer, u.Username, secret),
+	}, nil
+}
+
+// Confirm enables two-factor authentication once the user proves the
+// authenticator works, and returns a fresh set of recovery codes.
+func (s MFAService) Confirm(user userservice.UserInterface, code string) ([]string, error) {
+	u := user.(*userservice.User)
+	if u.TOTPEnabled {
+		return nil, ErrAlreadyEnabled
+	}
+
+	if u.TOTPSecret == "" {
+		return nil, ErrNotEnrolled
+	}
+
+	step, ok := validateCode(u.TOTPSecret, code, u.TOTPLastStep)
+	if !ok {
+		return nil, ErrCodeInvalid
+	}
+
+	u.TOTPEnabled = true
+	u.TOTPLastStep = step
+	if result := s.db.Save(u); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return s.generateRecoveryCodes(u.ID)
+}
+
+// Verify accepts either a code from the authenticator or an unused recovery
+// code. Both are consumed with a conditional update, so concurrent requests
+// can not redeem the same code twice.
+func (s MFAService) Verify(user userservice.UserInterface, code string) error {
+	u := user.(*userservice.User)
+	if !u.TOTPEnabled {
+		return ErrNotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		step, ok := validateCode(u.TOTPSecret, code, u.TOTPLastStep)
+		if !ok {
+			return ErrCodeInvalid
+		}
+
+		result := s.db.Scopes(func(tx *gorm.DB) *gorm.DB {
+			return tx.Model(&userservice.User{}).Where("id = ? AND totp_last_step < ?", u.ID, step)
+		}).Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrCodeInvalid
+		}
+
+		u.TOTPLastStep = step
+
+		return nil
+	}
+
+	recoveryCode := &RecoveryCode{}
+	if result := s.db.First(recoveryCode, "user_id = ? AND code_hash = ? AND used_at IS NULL", u.ID, hashRecoveryCode(code)); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrCodeInvalid
+		}
+
+		return result.Error
+	}
+
+	now := time.Now()
+	result := s.db.Scopes(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&RecoveryCode{}).Where("id = ? AND used_at IS NULL", recoveryCode.ID)
+	}).Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrCodeInvalid
+	}
+
+	recoveryCode.UsedAt = &now
+
+	return nil
+}
+
+// Disable turns two-factor authentication off and drops the recovery codes.
+func (s MFAService) Disable(user userservice.UserInterface) error {
+	u := user.(*userservice.User)
+
+	u.TOTPSecret = ""
+	u.TOTPEnabled = false
+	u.TOTPLastStep = 0
+	if result := s.db.Save(u); result.Error != nil {
+		return result.Error
+	}
+
+	result := s.db.Delete(&RecoveryCode{}, "user_id = ?", u.ID)
+
+	return result.Error
+}
+
+func (s MFAService) generateRecoveryCodes(userID uint) ([]string, error) {
+	if result := s.db.Delete(&RecoveryCode{}, "user_id = ?", userID); result.Error != nil {
+		return nil, result.Error
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		records[i] = RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(codes[i])}
+	}
+
+	if result := s.db.Create(&records); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return codes, nil
+}
+
+// hashRecoveryCode ignores case and separators so codes can be typed the way
+// they are read.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,18 @@
+package mfaservice
+
+import (
+	"time"
+)
+
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCode struct {
+	ID        uint `gorm:"primarykey"`
+	UserID    uint
+	CodeHash  string
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
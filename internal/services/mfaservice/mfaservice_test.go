@@ -0,0 +1,347 @@
+package mfaservice_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/mfaservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// RFC 6238 test secret
+const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func currentCode(t *testing.T) string {
+	code, err := mfaservice.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+func TestGenerateCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		time    time.Time
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "rfc 6238 at 59",
+			secret: secret,
+			time:   time.Unix(59, 0),
+			want:   "287082",
+		},
+		{
+			name:   "rfc 6238 at 1111111109",
+			secret: secret,
+			time:   time.Unix(1111111109, 0),
+			want:   "081804",
+		},
+		{
+			name:    "invalid secret",
+			secret:  "1",
+			time:    time.Unix(59, 0),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mfaservice.GenerateCode(tt.secret, tt.time)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GenerateCode() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GenerateCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMFAService_Enroll(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    *userservice.User
+		saveErr error
+		wantErr error
+	}{
+		{
+			name:    "already enabled",
+			user:    &userservice.User{Username: "admin", TOTPEnabled: true},
+			wantErr: mfaservice.ErrAlreadyEnabled,
+		},
+		{
+			name:    "save fail",
+			user:    &userservice.User{Username: "admin"},
+			saveErr: errors.New("save fail"),
+			wantErr: errors.New("save fail"),
+		},
+		{
+			name: "enrolled",
+			user: &userservice.User{Username: "admin"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("Save", tt.user).
+				Return(&gorm.DB{Error: tt.saveErr})
+
+			s := mfaservice.New(db, "baroness")
+			got, err := s.Enroll(tt.user)
+			if (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("MFAService.Enroll() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			if got.Secret == "" || got.Secret != tt.user.TOTPSecret {
+				t.Errorf("MFAService.Enroll() secret = %v, user secret %v", got.Secret, tt.user.TOTPSecret)
+			}
+
+			u, err := url.Parse(got.URI)
+			if err != nil {
+				t.Errorf("MFAService.Enroll() uri = %v, error %v", got.URI, err)
+				return
+			}
+			if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/baroness:admin" || u.Query().Get("secret") != got.Secret {
+				t.Errorf("MFAService.Enroll() uri = %v", got.URI)
+			}
+		})
+	}
+}
+
+func TestMFAService_Confirm(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      *userservice.User
+		code      func(t *testing.T) string
+		wantErr   error
+		wantCodes int
+	}{
+		{
+			name:    "already enabled",
+			user:    &userservice.User{TOTPSecret: secret, TOTPEnabled: true},
+			code:    currentCode,
+			wantErr: mfaservice.ErrAlreadyEnabled,
+		},
+		{
+			name:    "not enrolled",
+			user:    &userservice.User{},
+			code:    currentCode,
+			wantErr: mfaservice.ErrNotEnrolled,
+		},
+		{
+			name:    "code invalid",
+			user:    &userservice.User{TOTPSecret: secret},
+			code:    func(t *testing.T) string { return "000000x" },
+			wantErr: mfaservice.ErrCodeInvalid,
+		},
+		{
+			name:      "confirmed",
+			user:      &userservice.User{Model: model.Model{ID: 1}, TOTPSecret: secret},
+			code:      currentCode,
+			wantCodes: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("Save", tt.user).
+				Return(&gorm.DB{})
+			db.On("Delete", &mfaservice.RecoveryCode{}, "user_id = ?", uint(1)).
+				Return(&gorm.DB{})
+			db.On("Create", mock.AnythingOfType("*[]mfaservice.RecoveryCode")).
+				Return(&gorm.DB{})
+
+			s := mfaservice.New(db, "baroness")
+			got, err := s.Confirm(tt.user, tt.code(t))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("MFAService.Confirm() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if len(got) != tt.wantCodes {
+				t.Errorf("MFAService.Confirm() codes = %v, want %v", len(got), tt.wantCodes)
+			}
+
+			if err == nil && !tt.user.TOTPEnabled {
+				t.Error("MFAService.Confirm() did not enable two-factor authentication")
+			}
+		})
+	}
+}
+
+func TestMFAService_Verify(t *testing.T) {
+	now := time.Now().Unix() / 30
+
+	tests := []struct {
+		name         string
+		user         *userservice.User
+		code         func(t *testing.T) string
+		db           func() *mocks.DatabaseInterface
+		rowsAffected int64
+		wantQuery    string
+		wantErr      error
+	}{
+		{
+			name:    "not enrolled",
+			user:    &userservice.User{TOTPSecret: secret},
+			code:    currentCode,
+			db:      func() *mocks.DatabaseInterface { return &mocks.DatabaseInterface{} },
+			wantErr: mfaservice.ErrNotEnrolled,
+		},
+		{
+			name:         "totp code",
+			user:         &userservice.User{Model: model.Model{ID: 1}, TOTPSecret: secret, TOTPEnabled: true},
+			code:         currentCode,
+			db:           func() *mocks.DatabaseInterface { return &mocks.DatabaseInterface{} },
+			rowsAffected: 1,
+			wantQuery:    `UPDATE "users" SET "totp_last_step"=$1,"updated_at"=$2 WHERE (id = $3 AND totp_last_step < $4) AND "users"."deleted_at" IS NULL`,
+		},
+		{
+			name:    "totp code replayed",
+			user:    &userservice.User{TOTPSecret: secret, TOTPEnabled: true, TOTPLastStep: now + 1},
+			code:    currentCode,
+			db:      func() *mocks.DatabaseInterface { return &mocks.DatabaseInterface{} },
+			wantErr: mfaservice.ErrCodeInvalid,
+		},
+		{
+			name:      "totp code replayed concurrently",
+			user:      &userservice.User{Model: model.Model{ID: 1}, TOTPSecret: secret, TOTPEnabled: true},
+			code:      currentCode,
+			db:        func() *mocks.DatabaseInterface { return &mocks.DatabaseInterface{} },
+			wantQuery: `UPDATE "users" SET "totp_last_step"=$1,"updated_at"=$2 WHERE (id = $3 AND totp_last_step < $4) AND "users"."deleted_at" IS NULL`,
+			wantErr:   mfaservice.ErrCodeInvalid,
+		},
+		{
+			name: "recovery code",
+			user: &userservice.User{Model: model.Model{ID: 1}, TOTPSecret: secret, TOTPEnabled: true},
+			code: func(t *testing.T) string { return "ABCD-EFGH" },
+			db: func() *mocks.DatabaseInterface {
+				db := &mocks.DatabaseInterface{}
+				db.On("First", mock.AnythingOfType("*mfaservice.RecoveryCode"), "user_id = ? AND code_hash = ? AND used_at IS NULL", uint(1), mock.AnythingOfType("string")).
+					Return(&gorm.DB{})
+
+				return db
+			},
+			rowsAffected: 1,
+			wantQuery:    `UPDATE "recovery_codes" SET "used_at"=$1 WHERE id = $2 AND used_at IS NULL`,
+		},
+		{
+			name: "recovery code used concurrently",
+			user: &userservice.User{Model: model.Model{ID: 1}, TOTPSecret: secret, TOTPEnabled: true},
+			code: func(t *testing.T) string { return "ABCD-EFGH" },
+			db: func() *mocks.DatabaseInterface {
+				db := &mocks.DatabaseInterface{}
+				db.On("First", mock.AnythingOfType("*mfaservice.RecoveryCode"), "user_id = ? AND code_hash = ? AND used_at IS NULL", uint(1), mock.AnythingOfType("string")).
+					Return(&gorm.DB{})
+
+				return db
+			},
+			wantQuery: `UPDATE "recovery_codes" SET "used_at"=$1 WHERE id = $2 AND used_at IS NULL`,
+			wantErr:   mfaservice.ErrCodeInvalid,
+		},
+		{
+			name: "recovery code unknown",
+			user: &userservice.User{Model: model.Model{ID: 1}, TOTPSecret: secret, TOTPEnabled: true},
+			code: func(t *testing.T) string { return "abcd-efgh" },
+			db: func() *mocks.DatabaseInterface {
+				db := &mocks.DatabaseInterface{}
+				db.On("First", mock.AnythingOfType("*mfaservice.RecoveryCode"), "user_id = ? AND code_hash = ? AND used_at IS NULL", uint(1), mock.AnythingOfType("string")).
+					Return(&gorm.DB{Error: gorm.ErrRecordNotFound})
+
+				return db
+			},
+			wantErr: mfaservice.ErrCodeInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dry, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+				DryRun:                 true,
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+				Logger:                 logger.Default.LogMode(logger.Silent),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var query string
+			dry.Callback().Update().After("gorm:update").Register("test:update", func(tx *gorm.DB) {
+				query = tx.Statement.SQL.String()
+				tx.RowsAffected = tt.rowsAffected
+			})
+
+			db := tt.db()
+			db.On("Scopes", mock.Anything).Return(dry.Scopes)
+
+			s := mfaservice.New(db, "baroness")
+			if err := s.Verify(tt.user, tt.code(t)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("MFAService.Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if query != tt.wantQuery {
+				t.Errorf("MFAService.Verify() query = %v, want %v", query, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestMFAService_Disable(t *testing.T) {
+	tests := []struct {
+		name      string
+		saveErr   error
+		deleteErr error
+		wantErr   bool
+	}{
+		{
+			name:    "save fail",
+			saveErr: errors.New("save fail"),
+			wantErr: true,
+		},
+		{
+			name:      "delete fail",
+			deleteErr: errors.New("delete fail"),
+			wantErr:   true,
+		},
+		{
+			name: "disabled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &userservice.User{Model: model.Model{ID: 1}, TOTPSecret: secret, TOTPEnabled: true}
+
+			db := &mocks.DatabaseInterface{}
+			db.On("Save", user).
+				Return(&gorm.DB{Error: tt.saveErr})
+			db.On("Delete", &mfaservice.RecoveryCode{}, "user_id = ?", uint(1)).
+				Return(&gorm.DB{Error: tt.deleteErr})
+
+			s := mfaservice.New(db, "baroness")
+			if err := s.Disable(user); (err != nil) != tt.wantErr {
+				t.Errorf("MFAService.Disable() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if user.TOTPEnabled || user.TOTPSecret != "" {
+				t.Error("MFAService.Disable() left two-factor authentication enabled")
+			}
+		})
+	}
+}
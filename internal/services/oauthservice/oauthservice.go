@@ -0,0 +1,327 @@
+package oauthservice
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/database"
+	"gorm.io/gorm"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// SupportedScopes are the scopes clients can ask for.
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+var (
+	ErrClientInvalid = errors.New("oauth client authentication failed")
+	ErrScopeInvalid  = errors.New("scope is not supported")
+	ErrCodeInvalid   = errors.New("authorization code is invalid")
+	ErrCodeReused    = errors.New("authorization code has already been redeemed")
+)
+
+type OAuthService struct {
+	db            database.DatabaseInterface
+	codeExpiredIn time.Duration
+}
+
+type OAuthServiceInterface interface {
+	ListClients() ([]Client, error)
+	CreateClient(r ClientCreateRequest) (*Client, string, error)
+	GetClient(id uint) (*Client, error)
+	GetClientByClientID(clientID string) (*Client, error)
+	DeleteClient(client *Client) error
+	AuthenticateClient(client *Client, secret string) error
+	HasConsent(userID uint, client *Client, scope []string) (bool, error)
+	GrantConsent(userID uint, client *Client, scope []string) error
+	CreateCode(userID uint, client *Client, r AuthorizeRequest) (string, error)
+	ExchangeCode(client *Client, code string, redirectURI string, verifier string) (*AuthorizationCode, error)
+	AttachToken(code *AuthorizationCode, jti string, expiresAt time.Time) error
+}
+
+func New(db database.DatabaseInterface, codeExpiredIn time.Duration) OAuthServiceInterface {
+	return OAuthService{db, codeExpiredIn}
+}
+
+func (s OAuthService) ListClients() ([]Client, error) {
+	var clients []Client
+	if result := s.db.Find(&clients); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return clients, nil
+}
+
+// CreateClient registers a client. The secret of a confidential client is
+// only returned here, public clients get an empty one.
+func (s OAuthService) CreateClient(r ClientCreateRequest) (*Client, string, error) {
+	clientID, err := randomString(16)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := &Client{
+		ClientID:     clientID,
+		Name:         r.Name,
+		RedirectURIs: r.RedirectURIs,
+		FirstParty:   r.FirstParty,
+	}
+
+	var secret string
+	if r.Confidential {
+		if secret, err = randomString(32); err != nil {
+			return nil, "", err
+		}
+
+		client.SecretHash = hash(secret)
+	}
+
+	if result := s.db.Create(client); result.Error != nil {
+		return nil, "", result.Error
+	}
+
+	return client, secret, nil
+}
+
+func (s OAuthService) GetClient(id uint) (*Client, error) {
+	client := &Client{}
+	if result := s.db.First(client, id); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return client, nil
+}
+
+func (s OAuthService) GetClientByClientID(clientID string) (*Client, error) {
+	client := &Client{}
+	if result := s.db.First(client, "client_id = ?", clientID); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return client, nil
+}
+
+func (s OAuthService) DeleteClient(client *Client) error {
+	result := s.db.Delete(client)
+
+	return result.Error
+}
+
+// AuthenticateClient checks the secret of a confidential client. Public
+// clients must not send one.
+func (s OAuthService) AuthenticateClient(client *Client, secret string) error {
+	if client.IsPublic() {
+		if secret != "" {
+			return ErrClientInvalid
+		}
+
+		return nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hash(secret))) != 1 {
+		return ErrClientInvalid
+	}
+
+	return nil
+}
+
+func (s OAuthService) HasConsent(userID uint, client *Client, scope []string) (bool, error) {
+	consent := &Consent{}
+	if result := s.db.First(consent, "user_id = ? AND client_id = ?", userID, client.ID); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+
+		return false, result.Error
+	}
+
+	granted := strings.Fields(consent.Scope)
+	for _, sc := range scope {
+		if !contains(granted, sc) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// GrantConsent adds scope to what the user has allowed the client.
+func (s OAuthService) GrantConsent(userID uint, client *Client, scope []string) error {
+	consent := &Consent{UserID: userID, ClientID: client.ID}
+	result := s.db.First(consent, "user_id = ? AND client_id = ?", userID, client.ID)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return result.Error
+	}
+
+	granted := strings.Fields(consent.Scope)
+	for _, sc := range scope {
+		if !contains(granted, sc) {
+			granted = append(granted, sc)
+		}
+	}
+	consent.Scope = strings.Join(granted, " ")
+
+	result = s.db.Save(consent)
+
+	return result.Error
+}
+
+// CreateCode issues a short lived, single use authorization code for a
+// request whose client and redirect URI have already been checked.
+func (s OAuthService) CreateCode(userID uint, client *Client, r AuthorizeRequest) (string, error) {
+	code, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	authorizationCode := &AuthorizationCode{
+		CodeHash:      hash(code),
+		ClientID:      client.ID,
+		UserID:        userID,
+		RedirectURI:   r.RedirectURI,
+		Scope:         r.Scope,
+		Nonce:         r.Nonce,
+		CodeChallenge: r.CodeChallenge,
+		ExpiresAt:     time.Now().Add(s.codeExpiredIn),
+	}
+
+	if result := s.db.Create(authorizationCode); result.Error != nil {
+		return "", result.Error
+	}
+
+	return code, nil
+}
+
+// ExchangeCode redeems code for the client, verifying the redirect URI and
+// the PKCE verifier. A code can only be redeemed once, redeeming it again
+// revokes it and returns it with ErrCodeReused so the token issued from it
+// can be revoked as well.
+func (s OAuthService) ExchangeCode(client *Client, code string, redirectURI string, verifier string) (*AuthorizationCode, error) {
+	authorizationCode := &AuthorizationCode{}
+	if result := s.db.First(authorizationCode, "code_hash = ?", hash(code)); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrCodeInvalid
+		}
+
+		return nil, result.Error
+	}
+
+	if authorizationCode.IsExpired() ||
+		authorizationCode.ClientID != client.ID ||
+		authorizationCode.RedirectURI != redirectURI ||
+		!verifyCodeChallenge(authorizationCode.CodeChallenge, verifier) {
+		return nil, ErrCodeInvalid
+	}
+
+	now := time.Now()
+	result := s.db.Scopes(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&AuthorizationCode{}).Where("id = ? AND used_at IS NULL", authorizationCode.ID)
+	}).Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return s.revokeCode(authorizationCode.ID)
+	}
+
+	authorizationCode.UsedAt = &now
+
+	return authorizationCode, nil
+}
+
+// AttachToken records the access token issued from code. It fails with
+// ErrCodeReused when the code has been revoked meanwhile, the caller has to
+// revoke the token then.
+func (s OAuthService) AttachToken(code *AuthorizationCode, jti string, expiresAt time.Time) error {
+	result := s.db.Scopes(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&AuthorizationCode{}).Where("id = ? AND revoked_at IS NULL", code.ID)
+	}).Updates(map[string]interface{}{"token_jti": jti, "token_expires_at": expiresAt})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrCodeReused
+	}
+
+	code.TokenJTI, code.TokenExpiresAt = jti, &expiresAt
+
+	return nil
+}
+
+// revokeCode marks the code revoked before reading it back, so a token is
+// either attached in time to be returned here or refused by AttachToken.
+func (s OAuthService) revokeCode(id uint) (*AuthorizationCode, error) {
+	result := s.db.Scopes(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&AuthorizationCode{}).Where("id = ?", id)
+	}).Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	authorizationCode := &AuthorizationCode{}
+	if result := s.db.First(authorizationCode, "id = ?", id); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return authorizationCode, ErrCodeReused
+}
+
+// ParseScope splits a space separated scope, rejecting unsupported scopes.
+func ParseScope(scope string) ([]string, error) {
+	scopes := strings.Fields(scope)
+	for _, sc := range scopes {
+		if !contains(SupportedScopes, sc) {
+			return nil, ErrScopeInvalid
+		}
+	}
+
+	return scopes, nil
+}
+
+// verifyCodeChallenge checks an S256 PKCE verifier, RFC 7636 section 4.6.
+func verifyCodeChallenge(challenge string, verifier string) bool {
+	if challenge == "" || verifier == "" {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(base64.RawURLEncoding.EncodeToString(sum[:]))) == 1
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,69 @@
+package oauthservice
+
+import (
+	"time"
+)
+
+type Client struct {
+	ID uint `json:"id" gorm:"primarykey"`
+	// ClientID is the public identifier clients send, ID stays internal.
+	ClientID     string    `json:"client_id"`
+	SecretHash   string    `json:"-"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris" gorm:"serializer:json"`
+	FirstParty   bool      `json:"first_party"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// IsPublic tells whether the client can not keep a secret, like a single
+// page or mobile app. Public clients rely on PKCE alone.
+func (c Client) IsPublic() bool {
+	return c.SecretHash == ""
+}
+
+func (c Client) HasRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+
+	return false
+}
+
+type AuthorizationCode struct {
+	ID            uint `gorm:"primarykey"`
+	CodeHash      string
+	ClientID      uint
+	UserID        uint
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+	// TokenJTI identifies the access token issued from the code, so it can
+	// be revoked when the code is redeemed again.
+	TokenJTI       string
+	TokenExpiresAt *time.Time
+	RevokedAt      *time.Time
+	CreatedAt      time.Time
+}
+
+func (c AuthorizationCode) IsExpired() bool {
+	return time.Now().After(c.ExpiresAt)
+}
+
+func (c AuthorizationCode) IsUsed() bool {
+	return c.UsedAt != nil
+}
+
+// Consent records the scopes a user has allowed a client to request.
+type Consent struct {
+	UserID    uint `gorm:"primaryKey;autoIncrement:false"`
+	ClientID  uint `gorm:"primaryKey;autoIncrement:false"`
+	Scope     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
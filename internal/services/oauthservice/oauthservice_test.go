@@ -0,0 +1,362 @@
+package oauthservice_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/services/oauthservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestOAuthService_CreateClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		request    oauthservice.ClientCreateRequest
+		wantSecret bool
+	}{
+		{
+			name:    "public client",
+			request: oauthservice.ClientCreateRequest{Name: "spa", RedirectURIs: []string{"https://app.example.com/callback"}},
+		},
+		{
+			name:       "confidential client",
+			request:    oauthservice.ClientCreateRequest{Name: "backend", RedirectURIs: []string{"https://app.example.com/callback"}, Confidential: true},
+			wantSecret: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("Create", mock.AnythingOfType("*oauthservice.Client")).
+				Return(&gorm.DB{})
+
+			s := oauthservice.New(db, time.Minute)
+			client, secret, err := s.CreateClient(tt.request)
+			if err != nil {
+				t.Fatalf("OAuthService.CreateClient() error = %v", err)
+			}
+
+			if client.ClientID == "" || (secret != "") != tt.wantSecret || client.IsPublic() == tt.wantSecret {
+				t.Errorf("OAuthService.CreateClient() = %+v, secret %v", client, secret)
+			}
+
+			if tt.wantSecret {
+				if err = s.AuthenticateClient(client, secret); err != nil {
+					t.Errorf("OAuthService.AuthenticateClient() error = %v", err)
+				}
+
+				if err = s.AuthenticateClient(client, "wrong"); err != oauthservice.ErrClientInvalid {
+					t.Errorf("OAuthService.AuthenticateClient() error = %v, want %v", err, oauthservice.ErrClientInvalid)
+				}
+			}
+		})
+	}
+}
+
+func TestOAuthService_HasConsent(t *testing.T) {
+	client := &oauthservice.Client{ID: 2}
+
+	tests := []struct {
+		name     string
+		consent  oauthservice.Consent
+		firstErr error
+		scope    []string
+		want     bool
+		wantErr  bool
+	}{
+		{
+			name:    "scope consented",
+			consent: oauthservice.Consent{Scope: "openid profile"},
+			scope:   []string{"openid"},
+			want:    true,
+		},
+		{
+			name:    "scope not consented",
+			consent: oauthservice.Consent{Scope: "openid"},
+			scope:   []string{"openid", "email"},
+		},
+		{
+			name:     "no consent",
+			firstErr: gorm.ErrRecordNotFound,
+			scope:    []string{"openid"},
+		},
+		{
+			name:     "find fail",
+			firstErr: errors.New("database error"),
+			scope:    []string{"openid"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("First", mock.AnythingOfType("*oauthservice.Consent"), "user_id = ? AND client_id = ?", uint(1), uint(2)).
+				Run(func(args mock.Arguments) {
+					*args.Get(0).(*oauthservice.Consent) = tt.consent
+				}).
+				Return(&gorm.DB{Error: tt.firstErr})
+
+			s := oauthservice.New(db, time.Minute)
+			got, err := s.HasConsent(1, client, tt.scope)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OAuthService.HasConsent() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("OAuthService.HasConsent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOAuthService_ExchangeCode(t *testing.T) {
+	client := &oauthservice.Client{ID: 2}
+	verifier := "a-verifier-which-is-long-enough-to-be-unguessable-0123456789"
+
+	code := func() oauthservice.AuthorizationCode {
+		return oauthservice.AuthorizationCode{
+			ID:            1,
+			ClientID:      2,
+			UserID:        1,
+			RedirectURI:   "https://app.example.com/callback",
+			Scope:         "openid",
+			CodeChallenge: challenge(verifier),
+			ExpiresAt:     time.Now().Add(time.Minute),
+		}
+	}
+
+	tests := []struct {
+		name         string
+		stored       func() oauthservice.AuthorizationCode
+		firstErr     error
+		rowsAffected int64
+		redirectURI  string
+		verifier     string
+		wantErr      error
+		wantQueries  []string
+	}{
+		{
+			name:         "code exchanged",
+			stored:       code,
+			rowsAffected: 1,
+			redirectURI:  "https://app.example.com/callback",
+			verifier:     verifier,
+			wantQueries: []string{
+				`UPDATE "authorization_codes" SET "used_at"=$1 WHERE id = $2 AND used_at IS NULL`,
+			},
+		},
+		{
+			name:        "code not found",
+			stored:      code,
+			firstErr:    gorm.ErrRecordNotFound,
+			redirectURI: "https://app.example.com/callback",
+			verifier:    verifier,
+			wantErr:     oauthservice.ErrCodeInvalid,
+		},
+		{
+			name:        "code reused",
+			stored:      code,
+			redirectURI: "https://app.example.com/callback",
+			verifier:    verifier,
+			wantErr:     oauthservice.ErrCodeReused,
+			wantQueries: []string{
+				`UPDATE "authorization_codes" SET "used_at"=$1 WHERE id = $2 AND used_at IS NULL`,
+				`UPDATE "authorization_codes" SET "revoked_at"=$1 WHERE id = $2`,
+			},
+		},
+		{
+			name: "code expired",
+			stored: func() oauthservice.AuthorizationCode {
+				c := code()
+				c.ExpiresAt = time.Now().Add(-time.Second)
+				return c
+			},
+			redirectURI: "https://app.example.com/callback",
+			verifier:    verifier,
+			wantErr:     oauthservice.ErrCodeInvalid,
+		},
+		{
+			name: "other client",
+			stored: func() oauthservice.AuthorizationCode {
+				c := code()
+				c.ClientID = 3
+				return c
+			},
+			redirectURI: "https://app.example.com/callback",
+			verifier:    verifier,
+			wantErr:     oauthservice.ErrCodeInvalid,
+		},
+		{
+			name:        "redirect uri mismatch",
+			stored:      code,
+			redirectURI: "https://evil.example.com/callback",
+			verifier:    verifier,
+			wantErr:     oauthservice.ErrCodeInvalid,
+		},
+		{
+			name:        "verifier mismatch",
+			stored:      code,
+			redirectURI: "https://app.example.com/callback",
+			verifier:    "wrong",
+			wantErr:     oauthservice.ErrCodeInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dry, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+				DryRun:                 true,
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+				Logger:                 logger.Default.LogMode(logger.Silent),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var queries []string
+			dry.Callback().Update().After("gorm:update").Register("test:update", func(tx *gorm.DB) {
+				queries = append(queries, tx.Statement.SQL.String())
+				if len(queries) == 1 {
+					tx.RowsAffected = tt.rowsAffected
+				}
+			})
+
+			db := &mocks.DatabaseInterface{}
+			db.On("First", mock.AnythingOfType("*oauthservice.AuthorizationCode"), "code_hash = ?", mock.AnythingOfType("string")).
+				Run(func(args mock.Arguments) {
+					*args.Get(0).(*oauthservice.AuthorizationCode) = tt.stored()
+				}).
+				Return(&gorm.DB{Error: tt.firstErr})
+			db.On("First", mock.AnythingOfType("*oauthservice.AuthorizationCode"), "id = ?", uint(1)).
+				Run(func(args mock.Arguments) {
+					c := tt.stored()
+					c.TokenJTI = "issued"
+					*args.Get(0).(*oauthservice.AuthorizationCode) = c
+				}).
+				Return(&gorm.DB{})
+			db.On("Scopes", mock.Anything).Return(dry.Scopes)
+
+			s := oauthservice.New(db, time.Minute)
+			got, err := s.ExchangeCode(client, "code", tt.redirectURI, tt.verifier)
+			if err != tt.wantErr {
+				t.Errorf("OAuthService.ExchangeCode() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(queries, tt.wantQueries) {
+				t.Errorf("OAuthService.ExchangeCode() queries = %v, want %v", queries, tt.wantQueries)
+			}
+
+			switch tt.wantErr {
+			case nil:
+				if got.UserID != 1 || !got.IsUsed() {
+					t.Errorf("OAuthService.ExchangeCode() = %+v", got)
+				}
+			case oauthservice.ErrCodeReused:
+				if got == nil || got.TokenJTI != "issued" {
+					t.Errorf("OAuthService.ExchangeCode() = %+v, want the issued token", got)
+				}
+			}
+		})
+	}
+}
+
+func TestOAuthService_AttachToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		rowsAffected int64
+		wantErr      error
+	}{
+		{
+			name:         "attached",
+			rowsAffected: 1,
+		},
+		{
+			name:    "code revoked meanwhile",
+			wantErr: oauthservice.ErrCodeReused,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dry, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+				DryRun:                 true,
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+				Logger:                 logger.Default.LogMode(logger.Silent),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var query string
+			dry.Callback().Update().After("gorm:update").Register("test:update", func(tx *gorm.DB) {
+				query = tx.Statement.SQL.String()
+				tx.RowsAffected = tt.rowsAffected
+			})
+
+			db := &mocks.DatabaseInterface{}
+			db.On("Scopes", mock.Anything).Return(dry.Scopes)
+
+			code := &oauthservice.AuthorizationCode{ID: 1}
+			err = oauthservice.New(db, time.Minute).AttachToken(code, "jti", time.Now().Add(time.Minute))
+			if err != tt.wantErr {
+				t.Errorf("OAuthService.AttachToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if (code.TokenJTI == "jti") != (tt.wantErr == nil) {
+				t.Errorf("OAuthService.AttachToken() token = %v", code.TokenJTI)
+			}
+
+			want := `UPDATE "authorization_codes" SET "token_expires_at"=$1,"token_jti"=$2 WHERE id = $3 AND revoked_at IS NULL`
+			if query != want {
+				t.Errorf("OAuthService.AttachToken() query = %v, want %v", query, want)
+			}
+		})
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "supported",
+			scope: "openid  profile email",
+			want:  []string{"openid", "profile", "email"},
+		},
+		{
+			name:    "unsupported",
+			scope:   "openid admin",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := oauthservice.ParseScope(tt.scope)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseScope() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseScope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package oidcservice
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/database"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrStateInvalid   = errors.New("login state is invalid")
+	ErrCodeRejected   = errors.New("authorization code is rejected by the identity provider")
+	ErrIDTokenInvalid = errors.New("id token is invalid")
+)
+
+// OIDCService signs users in at an external OpenID Connect provider with
+// the authorization code flow.
+type OIDCService struct {
+	db     database.DatabaseInterface
+	client *http.Client
+	config Config
+
+	mu            sync.Mutex
+	metadata      *providerMetadata
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+type OIDCServiceInterface interface {
+	AuthCodeURL() (string, string, error)
+	Exchange(state string, code string) (*Claims, error)
+}
+
+func New(db database.DatabaseInterface, client *http.Client, config Config) OIDCServiceInterface {
+	return &OIDCService{db: db, client: client, config: config}
+}
+
+// AuthCodeURL starts a login and returns the URL of the provider to send
+// the browser to, and the state the browser has to be bound to.
+func (s *OIDCService) AuthCodeURL() (string, string, error) {
+	metadata, err := s.provider()
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := randomString(16)
+	if err != nil {
+		return "", "", err
+	}
+
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	login := &LoginState{
+		StateHash:    hashState(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(s.config.StateExpiredIn),
+	}
+
+	if result := s.db.Create(login); result.Error != nil {
+		return "", "", result.Error
+	}
+
+	u, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", s.config.ClientID)
+	q.Set("redirect_uri", s.config.RedirectURL)
+	q.Set("scope", strings.Join(s.config.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), state, nil
+}
+
+// Exchange redeems the code the provider answered state with and returns
+// the claims of the validated ID token. A state can only be used once.
+func (s *OIDCService) Exchange(state string, code string) (*Claims, error) {
+	login := &LoginState{}
+	if result := s.db.First(login, "state_hash = ?", hashState(state)); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrStateInvalid
+		}
+
+		return nil, result.Error
+	}
+
+	// a concurrent exchange of the same state deletes it first
+	result := s.db.Delete(login)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrStateInvalid
+	}
+
+	if login.IsExpired() {
+		return nil, ErrStateInvalid
+	}
+
+	metadata, err := s.provider()
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := s.exchangeCode(metadata, code, login.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.verifyIDToken(metadata, idToken, login.Nonce)
+}
+
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
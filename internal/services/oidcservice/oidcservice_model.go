@@ -0,0 +1,46 @@
+package oidcservice
+
+import "time"
+
+// LoginState is an authorization request sent to the identity provider and
+// not answered yet. Only the hash of the state is stored.
+type LoginState struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	StateHash    string    `json:"-"`
+	Nonce        string    `json:"-"`
+	CodeVerifier string    `json:"-"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (s *LoginState) IsExpired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
+
+// Claims are the claims of a validated ID token.
+type Claims struct {
+	Issuer            string `json:"iss"`
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+// Config describes the client registered at the identity provider.
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// StateExpiredIn is how long the user has to sign in at the provider.
+	StateExpiredIn time.Duration
+}
+
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
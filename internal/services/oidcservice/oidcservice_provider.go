@@ -0,0 +1,219 @@
+package oidcservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+)
+
+// keysRefreshInterval limits how often an unknown key id makes the keys be
+// fetched again.
+const keysRefreshInterval = time.Minute
+
+// signingMethods are the algorithms an ID token may be signed with. HMAC is
+// left out, the client secret is not a key the provider should sign with.
+var signingMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// provider returns the discovery document of the issuer, fetched once.
+func (s *OIDCService) provider() (*providerMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.metadata != nil {
+		return s.metadata, nil
+	}
+
+	metadata := &providerMetadata{}
+	if err := s.getJSON(strings.TrimSuffix(s.config.IssuerURL, "/")+"/.well-known/openid-configuration", metadata); err != nil {
+		return nil, err
+	}
+
+	if metadata.Issuer != s.config.IssuerURL {
+		return nil, fmt.Errorf("discovery issuer %v does not match %v", metadata.Issuer, s.config.IssuerURL)
+	}
+
+	s.metadata = metadata
+
+	return metadata, nil
+}
+
+// key returns the verify key with the id kid. The keys are fetched again
+// when kid is unknown, as the provider may have rotated its keys.
+func (s *OIDCService) key(metadata *providerMetadata, kid string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(s.keysFetchedAt) < keysRefreshInterval {
+		return nil, fmt.Errorf("key %v not found", kid)
+	}
+
+	set := authservice.JSONWebKeySet{}
+	if err := s.getJSON(metadata.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	// a provider with a single key does not have to name it
+	if len(keys) == 1 {
+		for _, key := range keys {
+			keys[""] = key
+		}
+	}
+
+	s.keys = keys
+	s.keysFetchedAt = time.Now()
+
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("key %v not found", kid)
+}
+
+func (s *OIDCService) exchangeCode(metadata *providerMetadata, code string, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.config.RedirectURL},
+		"code_verifier": {verifier},
+	}
+
+	if s.config.ClientSecret == "" {
+		form.Set("client_id", s.config.ClientID)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.config.ClientSecret != "" {
+		// RFC 6749 section 2.3.1 form encodes the credentials first
+		req.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+
+	err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body)
+
+	if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusUnauthorized {
+		return "", fmt.Errorf("%w: %v", ErrCodeRejected, body.Error)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint responded %v", res.StatusCode)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if body.IDToken == "" {
+		return "", fmt.Errorf("%w: token response has no id_token", ErrIDTokenInvalid)
+	}
+
+	return body.IDToken, nil
+}
+
+// verifyIDToken validates the ID token as OpenID Connect Core section
+// 3.1.3.7 asks of a client.
+func (s *OIDCService) verifyIDToken(metadata *providerMetadata, idToken string, nonce string) (*Claims, error) {
+	parser := jwt.Parser{ValidMethods: signingMethods}
+	claims := jwt.MapClaims{}
+
+	_, err := parser.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		return s.key(metadata, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIDTokenInvalid, err)
+	}
+
+	if !claims.VerifyIssuer(s.config.IssuerURL, true) {
+		return nil, fmt.Errorf("%w: iss %v", ErrIDTokenInvalid, claims["iss"])
+	}
+
+	if !claims.VerifyAudience(s.config.ClientID, true) {
+		return nil, fmt.Errorf("%w: aud %v", ErrIDTokenInvalid, claims["aud"])
+	}
+
+	if azp, ok := claims["azp"]; ok && azp != s.config.ClientID {
+		return nil, fmt.Errorf("%w: azp %v", ErrIDTokenInvalid, azp)
+	}
+
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, fmt.Errorf("%w: token is expired", ErrIDTokenInvalid)
+	}
+
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrIDTokenInvalid)
+	}
+
+	c := &Claims{Issuer: s.config.IssuerURL}
+	c.Subject, _ = claims["sub"].(string)
+	c.Email, _ = claims["email"].(string)
+	c.EmailVerified, _ = claims["email_verified"].(bool)
+	c.PreferredUsername, _ = claims["preferred_username"].(string)
+	c.Name, _ = claims["name"].(string)
+
+	if c.Subject == "" {
+		return nil, fmt.Errorf("%w: sub is missing", ErrIDTokenInvalid)
+	}
+
+	return c, nil
+}
+
+func (s *OIDCService) getJSON(u string, v interface{}) error {
+	res, err := s.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v responded %v", u, res.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,6 @@
+package oidcservice
+
+type CallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
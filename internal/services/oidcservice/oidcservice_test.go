@@ -0,0 +1,318 @@
+package oidcservice_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/oidcservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+var providerKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+
+// provider is an in-process identity provider. It answers the token request
+// with the ID token idToken returns.
+type provider struct {
+	*httptest.Server
+	kid          string
+	wantVerifier string
+	idToken      func(issuer string) string
+}
+
+func newProvider(t *testing.T) *provider {
+	p := &provider{}
+
+	jwk, err := authservice.NewJSONWebKey(jwt.SigningMethodRS256, providerKey)
+	if err != nil {
+		t.Fatalf("NewJSONWebKey() error = %v", err)
+	}
+	p.kid = jwk.Kid
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(authservice.JSONWebKeySet{Keys: []authservice.JSONWebKey{jwk}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if r.FormValue("code") != "code" || r.FormValue("code_verifier") != p.wantVerifier || id != "baroness" || secret != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     p.idToken(p.URL),
+		})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func (p *provider) config() oidcservice.Config {
+	return oidcservice.Config{
+		IssuerURL:      p.URL,
+		ClientID:       "baroness",
+		ClientSecret:   "secret",
+		RedirectURL:    "https://app.example.com/oidc/callback",
+		Scopes:         []string{"openid", "email"},
+		StateExpiredIn: time.Minute,
+	}
+}
+
+func (p *provider) sign(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.kid
+
+	s, _ := token.SignedString(providerKey)
+
+	return s
+}
+
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func TestOIDCService_AuthCodeURL(t *testing.T) {
+	p := newProvider(t)
+
+	var login *oidcservice.LoginState
+	db := &mocks.DatabaseInterface{}
+	db.On("Create", mock.AnythingOfType("*oidcservice.LoginState")).
+		Run(func(args mock.Arguments) {
+			login = args.Get(0).(*oidcservice.LoginState)
+		}).
+		Return(&gorm.DB{})
+
+	s := oidcservice.New(db, p.Client(), p.config())
+	got, state, err := s.AuthCodeURL()
+	if err != nil {
+		t.Fatalf("OIDCService.AuthCodeURL() error = %v", err)
+	}
+
+	u, _ := url.Parse(got)
+	q := u.Query()
+	challenge := sha256.Sum256([]byte(login.CodeVerifier))
+
+	if u.Path != "/authorize" ||
+		q.Get("client_id") != "baroness" ||
+		q.Get("redirect_uri") != "https://app.example.com/oidc/callback" ||
+		q.Get("scope") != "openid email" ||
+		q.Get("nonce") != login.Nonce ||
+		q.Get("state") != state ||
+		hashState(state) != login.StateHash ||
+		q.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(challenge[:]) ||
+		q.Get("code_challenge_method") != "S256" {
+		t.Errorf("OIDCService.AuthCodeURL() = %v, login %+v", got, login)
+	}
+}
+
+func TestOIDCService_Exchange(t *testing.T) {
+	p := newProvider(t)
+	p.wantVerifier = "verifier"
+
+	login := func() oidcservice.LoginState {
+		return oidcservice.LoginState{
+			ID:           1,
+			StateHash:    hashState("state"),
+			Nonce:        "nonce",
+			CodeVerifier: "verifier",
+			ExpiresAt:    time.Now().Add(time.Minute),
+		}
+	}
+
+	claims := func(change func(c jwt.MapClaims)) func(issuer string) string {
+		return func(issuer string) string {
+			c := jwt.MapClaims{
+				"iss":            issuer,
+				"sub":            "248289761001",
+				"aud":            "baroness",
+				"exp":            time.Now().Add(time.Minute).Unix(),
+				"iat":            time.Now().Unix(),
+				"nonce":          "nonce",
+				"email":          "jane@example.com",
+				"email_verified": true,
+			}
+			if change != nil {
+				change(c)
+			}
+
+			return p.sign(c)
+		}
+	}
+
+	tests := []struct {
+		name               string
+		login              func() oidcservice.LoginState
+		firstErr           error
+		exchangedMeanwhile bool
+		code               string
+		idToken            func(issuer string) string
+		wantErr            error
+	}{
+		{
+			name:    "identity verified",
+			login:   login,
+			code:    "code",
+			idToken: claims(nil),
+		},
+		{
+			name:     "state not found",
+			login:    login,
+			firstErr: gorm.ErrRecordNotFound,
+			code:     "code",
+			idToken:  claims(nil),
+			wantErr:  oidcservice.ErrStateInvalid,
+		},
+		{
+			name:               "state exchanged meanwhile",
+			login:              login,
+			exchangedMeanwhile: true,
+			code:               "code",
+			idToken:            claims(nil),
+			wantErr:            oidcservice.ErrStateInvalid,
+		},
+		{
+			name: "state expired",
+			login: func() oidcservice.LoginState {
+				l := login()
+				l.ExpiresAt = time.Now().Add(-time.Second)
+				return l
+			},
+			code:    "code",
+			idToken: claims(nil),
+			wantErr: oidcservice.ErrStateInvalid,
+		},
+		{
+			name:    "code rejected",
+			login:   login,
+			code:    "other",
+			idToken: claims(nil),
+			wantErr: oidcservice.ErrCodeRejected,
+		},
+		{
+			name:  "nonce mismatch",
+			login: login,
+			code:  "code",
+			idToken: claims(func(c jwt.MapClaims) {
+				c["nonce"] = "replayed"
+			}),
+			wantErr: oidcservice.ErrIDTokenInvalid,
+		},
+		{
+			name:  "other audience",
+			login: login,
+			code:  "code",
+			idToken: claims(func(c jwt.MapClaims) {
+				c["aud"] = "other"
+			}),
+			wantErr: oidcservice.ErrIDTokenInvalid,
+		},
+		{
+			name:  "other issuer",
+			login: login,
+			code:  "code",
+			idToken: claims(func(c jwt.MapClaims) {
+				c["iss"] = "https://evil.example.com"
+			}),
+			wantErr: oidcservice.ErrIDTokenInvalid,
+		},
+		{
+			name:  "expired",
+			login: login,
+			code:  "code",
+			idToken: claims(func(c jwt.MapClaims) {
+				c["exp"] = time.Now().Add(-time.Minute).Unix()
+			}),
+			wantErr: oidcservice.ErrIDTokenInvalid,
+		},
+		{
+			name:  "signed with the client secret",
+			login: login,
+			code:  "code",
+			idToken: func(issuer string) string {
+				s, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+					"iss":   issuer,
+					"sub":   "248289761001",
+					"aud":   "baroness",
+					"exp":   time.Now().Add(time.Minute).Unix(),
+					"nonce": "nonce",
+				}).SignedString([]byte("secret"))
+
+				return s
+			},
+			wantErr: oidcservice.ErrIDTokenInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.idToken = tt.idToken
+
+			deleted := false
+			db := &mocks.DatabaseInterface{}
+			db.On("First", mock.AnythingOfType("*oidcservice.LoginState"), "state_hash = ?", hashState("state")).
+				Run(func(args mock.Arguments) {
+					*args.Get(0).(*oidcservice.LoginState) = tt.login()
+				}).
+				Return(&gorm.DB{Error: tt.firstErr})
+			db.On("Delete", mock.AnythingOfType("*oidcservice.LoginState")).
+				Run(func(args mock.Arguments) {
+					deleted = true
+				}).
+				Return(func(value interface{}, conds ...interface{}) *gorm.DB {
+					if tt.exchangedMeanwhile {
+						return &gorm.DB{}
+					}
+
+					return &gorm.DB{RowsAffected: 1}
+				})
+
+			s := oidcservice.New(db, p.Client(), p.config())
+			got, err := s.Exchange("state", tt.code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("OIDCService.Exchange() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.firstErr == nil && !deleted {
+				t.Errorf("OIDCService.Exchange() did not delete the login state")
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.Issuer != p.URL || got.Subject != "248289761001" || got.Email != "jane@example.com" || !got.EmailVerified {
+				t.Errorf("OIDCService.Exchange() = %+v", got)
+			}
+		})
+	}
+}
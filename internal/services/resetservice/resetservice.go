@@ -0,0 +1,102 @@
+package resetservice
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/database"
+	"gorm.io/gorm"
+)
+
+var ErrTokenInvalid = errors.New("password reset token is invalid")
+
+type ResetService struct {
+	db        database.DatabaseInterface
+	expiredIn time.Duration
+}
+
+type ResetServiceInterface interface {
+	Create(userID uint) (string, error)
+	Get(token string) (*PasswordReset, error)
+	Use(reset *PasswordReset) error
+}
+
+func New(db database.DatabaseInterface, expiredIn time.Duration) ResetServiceInterface {
+	return ResetService{db, expiredIn}
+}
+
+// Create issues a reset token for the user. Only the hash is stored, and
+// tokens issued earlier stop working.
+func (s ResetService) Create(userID uint) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	if result := s.db.Delete(&PasswordReset{}, "user_id = ? AND used_at IS NULL", userID); result.Error != nil {
+		return "", result.Error
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	reset := &PasswordReset{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.expiredIn),
+	}
+
+	if result := s.db.Create(reset); result.Error != nil {
+		return "", result.Error
+	}
+
+	return token, nil
+}
+
+// Get returns the reset the token belongs to, as long as it is neither used
+// nor expired.
+func (s ResetService) Get(token string) (*PasswordReset, error) {
+	reset := &PasswordReset{}
+	if result := s.db.First(reset, "token_hash = ?", hashToken(token)); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrTokenInvalid
+		}
+
+		return nil, result.Error
+	}
+
+	if reset.IsUsed() || reset.IsExpired() {
+		return nil, ErrTokenInvalid
+	}
+
+	return reset, nil
+}
+
+// Use marks the reset used unless it already is or has expired, in which case
+// it returns ErrTokenInvalid. Only one of the requests racing with a token
+// can use it.
+func (s ResetService) Use(reset *PasswordReset) error {
+	now := time.Now()
+	result := s.db.Scopes(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&PasswordReset{}).Where("id = ? AND used_at IS NULL AND expires_at > ?", reset.ID, now)
+	}).Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrTokenInvalid
+	}
+
+	reset.UsedAt = &now
+
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
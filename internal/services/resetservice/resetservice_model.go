@@ -0,0 +1,22 @@
+package resetservice
+
+import (
+	"time"
+)
+
+type PasswordReset struct {
+	ID        uint `gorm:"primarykey"`
+	UserID    uint
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (r PasswordReset) IsExpired() bool {
+	return time.Now().After(r.ExpiresAt)
+}
+
+func (r PasswordReset) IsUsed() bool {
+	return r.UsedAt != nil
+}
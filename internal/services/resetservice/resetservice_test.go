@@ -0,0 +1,195 @@
+package resetservice_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/services/resetservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestResetService_Create(t *testing.T) {
+	tests := []struct {
+		name      string
+		deleteErr error
+		createErr error
+		wantErr   bool
+	}{
+		{
+			name: "token created",
+		},
+		{
+			name:      "delete previous fail",
+			deleteErr: errors.New("delete fail"),
+			wantErr:   true,
+		},
+		{
+			name:      "create fail",
+			createErr: errors.New("create fail"),
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created *resetservice.PasswordReset
+
+			db := &mocks.DatabaseInterface{}
+			db.On("Delete", &resetservice.PasswordReset{}, "user_id = ? AND used_at IS NULL", uint(1)).
+				Return(&gorm.DB{Error: tt.deleteErr})
+			db.On("Create", mock.AnythingOfType("*resetservice.PasswordReset")).
+				Run(func(args mock.Arguments) {
+					created = args.Get(0).(*resetservice.PasswordReset)
+				}).
+				Return(&gorm.DB{Error: tt.createErr})
+
+			s := resetservice.New(db, time.Hour)
+			got, err := s.Create(1)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResetService.Create() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got == "" || created.TokenHash == "" || created.TokenHash == got {
+				t.Errorf("ResetService.Create() = %v, stored hash %v", got, created.TokenHash)
+			}
+
+			if created.UserID != 1 || created.ExpiresAt.Before(time.Now().Add(59*time.Minute)) {
+				t.Errorf("ResetService.Create() stored %+v", created)
+			}
+		})
+	}
+}
+
+func TestResetService_Get(t *testing.T) {
+	used := time.Now().Add(-time.Minute)
+
+	found := func(reset resetservice.PasswordReset) func() *mocks.DatabaseInterface {
+		return func() *mocks.DatabaseInterface {
+			db := &mocks.DatabaseInterface{}
+			db.On("First", mock.AnythingOfType("*resetservice.PasswordReset"), "token_hash = ?", mock.AnythingOfType("string")).
+				Run(func(args mock.Arguments) {
+					*args.Get(0).(*resetservice.PasswordReset) = reset
+				}).
+				Return(&gorm.DB{})
+
+			return db
+		}
+	}
+
+	tests := []struct {
+		name    string
+		db      func() *mocks.DatabaseInterface
+		wantErr error
+	}{
+		{
+			name: "valid",
+			db:   found(resetservice.PasswordReset{UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}),
+		},
+		{
+			name: "not found",
+			db: func() *mocks.DatabaseInterface {
+				db := &mocks.DatabaseInterface{}
+				db.On("First", mock.AnythingOfType("*resetservice.PasswordReset"), "token_hash = ?", mock.AnythingOfType("string")).
+					Return(&gorm.DB{Error: gorm.ErrRecordNotFound})
+
+				return db
+			},
+			wantErr: resetservice.ErrTokenInvalid,
+		},
+		{
+			name:    "expired",
+			db:      found(resetservice.PasswordReset{UserID: 1, ExpiresAt: time.Now().Add(-time.Second)}),
+			wantErr: resetservice.ErrTokenInvalid,
+		},
+		{
+			name:    "used",
+			db:      found(resetservice.PasswordReset{UserID: 1, ExpiresAt: time.Now().Add(time.Hour), UsedAt: &used}),
+			wantErr: resetservice.ErrTokenInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := resetservice.New(tt.db(), time.Hour)
+			got, err := s.Get("token")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ResetService.Get() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if err == nil && got.UserID != 1 {
+				t.Errorf("ResetService.Get() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestResetService_Use(t *testing.T) {
+	tests := []struct {
+		name         string
+		rowsAffected int64
+		err          error
+		wantErr      error
+	}{
+		{
+			name:         "used",
+			rowsAffected: 1,
+		},
+		{
+			name:    "used meanwhile",
+			wantErr: resetservice.ErrTokenInvalid,
+		},
+		{
+			name:    "database error",
+			err:     gorm.ErrInvalidDB,
+			wantErr: gorm.ErrInvalidDB,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dry, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+				DryRun:                 true,
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+				Logger:                 logger.Default.LogMode(logger.Silent),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var query string
+			dry.Callback().Update().After("gorm:update").Register("test:update", func(tx *gorm.DB) {
+				query = tx.Statement.SQL.String()
+				tx.RowsAffected = tt.rowsAffected
+				if tt.err != nil {
+					tx.AddError(tt.err)
+				}
+			})
+
+			db := &mocks.DatabaseInterface{}
+			db.On("Scopes", mock.Anything).Return(dry.Scopes)
+
+			reset := &resetservice.PasswordReset{ID: 1}
+			err = resetservice.New(db, time.Hour).Use(reset)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ResetService.Use() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if reset.IsUsed() != (tt.wantErr == nil) {
+				t.Errorf("ResetService.Use() used = %v", reset.IsUsed())
+			}
+
+			want := `UPDATE "password_resets" SET "used_at"=$1 WHERE id = $2 AND used_at IS NULL AND expires_at > $3`
+			if query != want {
+				t.Errorf("ResetService.Use() query = %v, want %v", query, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package roleservice
+
+import (
+	"errors"
+
+	"github.com/maetad/baroness-api/internal/database"
+	"gorm.io/gorm"
+)
+
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+const (
+	PermissionUsersRead        = "users.read"
+	PermissionUsersCreate      = "users.create"
+	PermissionUsersUpdate      = "users.update"
+	PermissionUsersDelete      = "users.delete"
+	PermissionUsersSecurity    = "users.security"
+	PermissionUsersRoles       = "users.roles"
+	PermissionUsersImpersonate = "users.impersonate"
+	PermissionRolesRead        = "roles.read"
+	PermissionRolesCreate      = "roles.create"
+	PermissionRolesUpdate      = "roles.update"
+	PermissionRolesDelete      = "roles.delete"
+	PermissionOAuthClients     = "oauth.clients"
+)
+
+var (
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrRoleExists         = errors.New("role already exists")
+	ErrRoleProtected      = errors.New("role is built in")
+	ErrPermissionNotFound = errors.New("permission not found")
+)
+
+type RoleService struct {
+	db database.DatabaseInterface
+}
+
+type RoleServiceInterface interface {
+	List() ([]Role, error)
+	Create(r RoleCreateRequest) (*Role, error)
+	Get(id uint) (*Role, error)
+	Update(role *Role, r RoleUpdateRequest) (*Role, error)
+	Delete(role *Role) error
+	ListPermissions() ([]Permission, error)
+	GetUserRoles(userID uint) ([]Role, error)
+	GetUserAccess(userID uint) (Access, error)
+	SetUserRoles(userID uint, roles []string) error
+	WithDB(db database.DatabaseInterface) RoleServiceInterface
+}
+
+func New(db database.DatabaseInterface) RoleServiceInterface {
+	return RoleService{db}
+}
+
+// WithDB returns the service running on db, as the transaction of another
+// service.
+func (s RoleService) WithDB(db database.DatabaseInterface) RoleServiceInterface {
+	return RoleService{db}
+}
+
+func (s RoleService) List() ([]Role, error) {
+	var roles []Role
+	if result := s.db.Find(&roles); result.Error != nil {
+		return nil, result.Error
+	}
+
+	for i := range roles {
+		if err := s.loadPermissions(&roles[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return roles, nil
+}
+
+func (s RoleService) Create(r RoleCreateRequest) (*Role, error) {
+	if err := s.checkName(r.Name, 0); err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.findPermissions(r.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role := &Role{
+		Name:        r.Name,
+		Description: r.Description,
+	}
+
+	if result := s.db.Create(role); result.Error != nil {
+		return nil, result.Error
+	}
+
+	if err := s.setPermissions(role, permissions); err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (s RoleService) Get(id uint) (*Role, error) {
+	role := &Role{}
+	if result := s.db.First(role, id); result.Error != nil {
+		return nil, result.Error
+	}
+
+	if err := s.loadPermissions(role); err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// Update replaces the name, description and permissions of the role. The
+// built-in roles keep their name, and admin can not be changed at all so that
+// there is always a role which can manage the others.
+func (s RoleService) Update(role *Role, r RoleUpdateRequest) (*Role, error) {
+	if role.Name == RoleAdmin || (role.Name == RoleUser && r.Name != role.Name) {
+		return nil, ErrRoleProtected
+	}
+
+	if err := s.checkName(r.Name, role.ID); err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.findPermissions(r.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role.Name = r.Name
+	role.Description = r.Description
+	if result := s.db.Save(role); result.Error != nil {
+		return nil, result.Error
+	}
+
+	if err := s.setPermissions(role, permissions); err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// Delete removes the role from every user holding it.
+func (s RoleService) Delete(role *Role) error {
+	if role.Name == RoleAdmin || role.Name == RoleUser {
+		return ErrRoleProtected
+	}
+
+	result := s.db.Delete(role)
+
+	return result.Error
+}
+
+func (s RoleService) ListPermissions() ([]Permission, error) {
+	var permissions []Permission
+	if result := s.db.Find(&permissions); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return permissions, nil
+}
+
+func (s RoleService) GetUserRoles(userID uint) ([]Role, error) {
+	var roles []Role
+	if result := s.db.Find(&roles, "id IN (SELECT role_id FROM user_roles WHERE user_id = ?)", userID); result.Error != nil {
+		return nil, result.Error
+	}
+
+	for i := range roles {
+		if err := s.loadPermissions(&roles[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return roles, nil
+}
+
+func (s RoleService) GetUserAccess(userID uint) (Access, error) {
+	var (
+		roles       []Role
+		permissions []Permission
+	)
+
+	if result := s.db.Find(&roles, "id IN (SELECT role_id FROM user_roles WHERE user_id = ?)", userID); result.Error != nil {
+		return Access{}, result.Error
+	}
+
+	if result := s.db.Find(
+		&permissions,
+		"id IN (SELECT role_permissions.permission_id FROM role_permissions JOIN user_roles ON user_roles.role_id = role_permissions.role_id WHERE user_roles.user_id = ?)",
+		userID,
+	); result.Error != nil {
+		return Access{}, result.Error
+	}
+
+	access := Access{
+		Roles:       make([]string, len(roles)),
+		Permissions: make([]string, len(permissions)),
+	}
+	for i, r := range roles {
+		access.Roles[i] = r.Name
+	}
+	for i, p := range permissions {
+		access.Permissions[i] = p.Name
+	}
+
+	return access, nil
+}
+
+// SetUserRoles replaces the roles of the user with the named roles.
+func (s RoleService) SetUserRoles(userID uint, names []string) error {
+	var roles []Role
+	if len(names) > 0 {
+		if result := s.db.Find(&roles, "name IN ?", names); result.Error != nil {
+			return result.Error
+		}
+	}
+
+	if len(roles) != len(unique(names)) {
+		return ErrRoleNotFound
+	}
+
+	if result := s.db.Delete(&UserRole{}, "user_id = ?", userID); result.Error != nil {
+		return result.Error
+	}
+
+	if len(roles) == 0 {
+		return nil
+	}
+
+	userRoles := make([]UserRole, len(roles))
+	for i, r := range roles {
+		userRoles[i] = UserRole{UserID: userID, RoleID: r.ID}
+	}
+
+	result := s.db.Create(&userRoles)
+
+	return result.Error
+}
+
+// checkName makes sure no role other than id is called name.
+func (s RoleService) checkName(name string, id uint) error {
+	role := &Role{}
+	result := s.db.First(role, "name = ?", name)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil
+	}
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if role.ID != id {
+		return ErrRoleExists
+	}
+
+	return nil
+}
+
+func (s RoleService) findPermissions(names []string) ([]Permission, error) {
+	var permissions []Permission
+	if len(names) > 0 {
+		if result := s.db.Find(&permissions, "name IN ?", names); result.Error != nil {
+			return nil, result.Error
+		}
+	}
+
+	if len(permissions) != len(unique(names)) {
+		return nil, ErrPermissionNotFound
+	}
+
+	return permissions, nil
+}
+
+func (s RoleService) loadPermissions(role *Role) error {
+	var permissions []Permission
+	if result := s.db.Find(&permissions, "id IN (SELECT permission_id FROM role_permissions WHERE role_id = ?)", role.ID); result.Error != nil {
+		return result.Error
+	}
+
+	role.Permissions = make([]string, len(permissions))
+	for i, p := range permissions {
+		role.Permissions[i] = p.Name
+	}
+
+	return nil
+}
+
+func (s RoleService) setPermissions(role *Role, permissions []Permission) error {
+	if result := s.db.Delete(&RolePermission{}, "role_id = ?", role.ID); result.Error != nil {
+		return result.Error
+	}
+
+	role.Permissions = make([]string, len(permissions))
+	for i, p := range permissions {
+		role.Permissions[i] = p.Name
+	}
+
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	rolePermissions := make([]RolePermission, len(permissions))
+	for i, p := range permissions {
+		rolePermissions[i] = RolePermission{RoleID: role.ID, PermissionID: p.ID}
+	}
+
+	result := s.db.Create(&rolePermissions)
+
+	return result.Error
+}
+
+func unique(names []string) []string {
+	seen := map[string]bool{}
+	u := []string{}
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			u = append(u, n)
+		}
+	}
+
+	return u
+}
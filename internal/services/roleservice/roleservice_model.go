@@ -0,0 +1,46 @@
+package roleservice
+
+import (
+	"time"
+)
+
+type Role struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions" gorm:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type Permission struct {
+	ID          uint   `json:"id" gorm:"primarykey"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type RolePermission struct {
+	RoleID       uint `gorm:"primaryKey;autoIncrement:false"`
+	PermissionID uint `gorm:"primaryKey;autoIncrement:false"`
+}
+
+type UserRole struct {
+	UserID uint `gorm:"primaryKey;autoIncrement:false"`
+	RoleID uint `gorm:"primaryKey;autoIncrement:false"`
+}
+
+// Access is what a user is allowed to do through the roles they hold.
+type Access struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+func (a Access) Can(permission string) bool {
+	for _, p := range a.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,17 @@
+package roleservice
+
+type RoleCreateRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type RoleUpdateRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type UserRolesRequest struct {
+	Roles []string `json:"roles" binding:"required"`
+}
@@ -0,0 +1,327 @@
+package roleservice_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/maetad/baroness-api/internal/services/roleservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestAccess_Can(t *testing.T) {
+	access := roleservice.Access{Permissions: []string{roleservice.PermissionUsersRead}}
+
+	if !access.Can(roleservice.PermissionUsersRead) {
+		t.Errorf("Access.Can(%v) = false, want true", roleservice.PermissionUsersRead)
+	}
+
+	if access.Can(roleservice.PermissionUsersDelete) {
+		t.Errorf("Access.Can(%v) = true, want false", roleservice.PermissionUsersDelete)
+	}
+}
+
+func TestRoleService_GetUserAccess(t *testing.T) {
+	tests := []struct {
+		name          string
+		rolesErr      error
+		permissionErr error
+		want          roleservice.Access
+		wantErr       bool
+	}{
+		{
+			name: "access found",
+			want: roleservice.Access{
+				Roles:       []string{"admin"},
+				Permissions: []string{"users.read", "users.delete"},
+			},
+		},
+		{
+			name:     "find roles fail",
+			rolesErr: errors.New("database error"),
+			wantErr:  true,
+		},
+		{
+			name:          "find permissions fail",
+			permissionErr: errors.New("database error"),
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("Find", mock.AnythingOfType("*[]roleservice.Role"), mock.AnythingOfType("string"), uint(1)).
+				Run(func(args mock.Arguments) {
+					*args.Get(0).(*[]roleservice.Role) = []roleservice.Role{{Name: "admin"}}
+				}).
+				Return(&gorm.DB{Error: tt.rolesErr})
+			db.On("Find", mock.AnythingOfType("*[]roleservice.Permission"), mock.AnythingOfType("string"), uint(1)).
+				Run(func(args mock.Arguments) {
+					*args.Get(0).(*[]roleservice.Permission) = []roleservice.Permission{{Name: "users.read"}, {Name: "users.delete"}}
+				}).
+				Return(&gorm.DB{Error: tt.permissionErr})
+
+			s := roleservice.New(db)
+			got, err := s.GetUserAccess(1)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RoleService.GetUserAccess() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RoleService.GetUserAccess() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleService_SetUserRoles(t *testing.T) {
+	tests := []struct {
+		name      string
+		roles     []string
+		found     []roleservice.Role
+		deleteErr error
+		createErr error
+		wantErr   error
+	}{
+		{
+			name:  "roles assigned",
+			roles: []string{"user"},
+			found: []roleservice.Role{{ID: 2, Name: "user"}},
+		},
+		{
+			name:    "role not found",
+			roles:   []string{"user", "unknown"},
+			found:   []roleservice.Role{{ID: 2, Name: "user"}},
+			wantErr: roleservice.ErrRoleNotFound,
+		},
+		{
+			name:      "delete fail",
+			roles:     []string{"user"},
+			found:     []roleservice.Role{{ID: 2, Name: "user"}},
+			deleteErr: errors.New("database error"),
+			wantErr:   errors.New("database error"),
+		},
+		{
+			name:      "create fail",
+			roles:     []string{"user"},
+			found:     []roleservice.Role{{ID: 2, Name: "user"}},
+			createErr: errors.New("database error"),
+			wantErr:   errors.New("database error"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created *[]roleservice.UserRole
+
+			db := &mocks.DatabaseInterface{}
+			db.On("Find", mock.AnythingOfType("*[]roleservice.Role"), "name IN ?", tt.roles).
+				Run(func(args mock.Arguments) {
+					*args.Get(0).(*[]roleservice.Role) = tt.found
+				}).
+				Return(&gorm.DB{})
+			db.On("Delete", &roleservice.UserRole{}, "user_id = ?", uint(1)).
+				Return(&gorm.DB{Error: tt.deleteErr})
+			db.On("Create", mock.AnythingOfType("*[]roleservice.UserRole")).
+				Run(func(args mock.Arguments) {
+					created = args.Get(0).(*[]roleservice.UserRole)
+				}).
+				Return(&gorm.DB{Error: tt.createErr})
+
+			s := roleservice.New(db)
+			err := s.SetUserRoles(1, tt.roles)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("RoleService.SetUserRoles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if want := []roleservice.UserRole{{UserID: 1, RoleID: 2}}; !reflect.DeepEqual(*created, want) {
+				t.Errorf("RoleService.SetUserRoles() created %v, want %v", *created, want)
+			}
+		})
+	}
+}
+
+func TestRoleService_Create(t *testing.T) {
+	request := roleservice.RoleCreateRequest{
+		Name:        "support",
+		Permissions: []string{"users.read"},
+	}
+
+	tests := []struct {
+		name        string
+		existing    error
+		permissions []roleservice.Permission
+		createErr   error
+		wantErr     error
+	}{
+		{
+			name:        "role created",
+			existing:    gorm.ErrRecordNotFound,
+			permissions: []roleservice.Permission{{ID: 1, Name: "users.read"}},
+		},
+		{
+			name:     "role exists",
+			existing: nil,
+			wantErr:  roleservice.ErrRoleExists,
+		},
+		{
+			name:     "permission not found",
+			existing: gorm.ErrRecordNotFound,
+			wantErr:  roleservice.ErrPermissionNotFound,
+		},
+		{
+			name:        "create fail",
+			existing:    gorm.ErrRecordNotFound,
+			permissions: []roleservice.Permission{{ID: 1, Name: "users.read"}},
+			createErr:   errors.New("database error"),
+			wantErr:     errors.New("database error"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created *[]roleservice.RolePermission
+
+			db := &mocks.DatabaseInterface{}
+			db.On("First", mock.AnythingOfType("*roleservice.Role"), "name = ?", "support").
+				Run(func(args mock.Arguments) {
+					args.Get(0).(*roleservice.Role).ID = 2
+				}).
+				Return(&gorm.DB{Error: tt.existing})
+			db.On("Find", mock.AnythingOfType("*[]roleservice.Permission"), "name IN ?", []string{"users.read"}).
+				Run(func(args mock.Arguments) {
+					*args.Get(0).(*[]roleservice.Permission) = tt.permissions
+				}).
+				Return(&gorm.DB{})
+			db.On("Create", mock.AnythingOfType("*roleservice.Role")).
+				Run(func(args mock.Arguments) {
+					args.Get(0).(*roleservice.Role).ID = 3
+				}).
+				Return(&gorm.DB{Error: tt.createErr})
+			db.On("Delete", &roleservice.RolePermission{}, "role_id = ?", uint(3)).
+				Return(&gorm.DB{})
+			db.On("Create", mock.AnythingOfType("*[]roleservice.RolePermission")).
+				Run(func(args mock.Arguments) {
+					created = args.Get(0).(*[]roleservice.RolePermission)
+				}).
+				Return(&gorm.DB{})
+
+			s := roleservice.New(db)
+			got, err := s.Create(request)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("RoleService.Create() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.Name != "support" || !reflect.DeepEqual(got.Permissions, []string{"users.read"}) {
+				t.Errorf("RoleService.Create() = %+v", got)
+			}
+
+			if want := []roleservice.RolePermission{{RoleID: 3, PermissionID: 1}}; !reflect.DeepEqual(*created, want) {
+				t.Errorf("RoleService.Create() created %v, want %v", *created, want)
+			}
+		})
+	}
+}
+
+func TestRoleService_Update(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    *roleservice.Role
+		request roleservice.RoleUpdateRequest
+		wantErr error
+	}{
+		{
+			name:    "role updated",
+			role:    &roleservice.Role{ID: 3, Name: "support"},
+			request: roleservice.RoleUpdateRequest{Name: "helpdesk"},
+		},
+		{
+			name:    "user permissions updated",
+			role:    &roleservice.Role{ID: 2, Name: roleservice.RoleUser},
+			request: roleservice.RoleUpdateRequest{Name: roleservice.RoleUser},
+		},
+		{
+			name:    "admin protected",
+			role:    &roleservice.Role{ID: 1, Name: roleservice.RoleAdmin},
+			request: roleservice.RoleUpdateRequest{Name: roleservice.RoleAdmin},
+			wantErr: roleservice.ErrRoleProtected,
+		},
+		{
+			name:    "user rename protected",
+			role:    &roleservice.Role{ID: 2, Name: roleservice.RoleUser},
+			request: roleservice.RoleUpdateRequest{Name: "member"},
+			wantErr: roleservice.ErrRoleProtected,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("First", mock.AnythingOfType("*roleservice.Role"), "name = ?", tt.request.Name).
+				Run(func(args mock.Arguments) {
+					args.Get(0).(*roleservice.Role).ID = tt.role.ID
+				}).
+				Return(&gorm.DB{})
+			db.On("Save", tt.role).
+				Return(&gorm.DB{})
+			db.On("Delete", &roleservice.RolePermission{}, "role_id = ?", tt.role.ID).
+				Return(&gorm.DB{})
+
+			s := roleservice.New(db)
+			got, err := s.Update(tt.role, tt.request)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("RoleService.Update() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.Name != tt.request.Name || len(got.Permissions) != 0 {
+				t.Errorf("RoleService.Update() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestRoleService_Delete(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    *roleservice.Role
+		wantErr error
+	}{
+		{
+			name: "role deleted",
+			role: &roleservice.Role{ID: 3, Name: "support"},
+		},
+		{
+			name:    "admin protected",
+			role:    &roleservice.Role{ID: 1, Name: roleservice.RoleAdmin},
+			wantErr: roleservice.ErrRoleProtected,
+		},
+		{
+			name:    "user protected",
+			role:    &roleservice.Role{ID: 2, Name: roleservice.RoleUser},
+			wantErr: roleservice.ErrRoleProtected,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("Delete", tt.role).
+				Return(&gorm.DB{})
+
+			s := roleservice.New(db)
+			if err := s.Delete(tt.role); err != tt.wantErr {
+				t.Errorf("RoleService.Delete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
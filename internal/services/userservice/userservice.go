@@ -1,49 +1,83 @@
 package userservice
 
 import (
+	"errors"
+	"io"
+
 	"github.com/maetad/baroness-api/internal/database"
+	"gorm.io/gorm"
 )
 
 type UserService struct {
-	db database.DatabaseInterface
+	db             database.DatabaseInterface
+	searcher       UserSearcherInterface
+	passwordPolicy PasswordPolicy
+	passwordHasher PasswordHasher
 }
 
 type UserServiceInterface interface {
-	List() ([]UserInterface, error)
-	Create(r UserCreateRequest) (UserInterface, error)
+	List(r UserListRequest) (*UserList, error)
+	Search(query string, limit int) ([]UserInterface, error)
+	Create(r UserCreateRequest, created CreatedFunc) (UserInterface, error)
+	CreateExternal(r UserExternalCreateRequest) (UserInterface, error)
 	Get(id uint) (UserInterface, error)
+	GetUnscoped(id uint) (UserInterface, error)
 	GetByUsername(username string) (UserInterface, error)
+	GetByEmail(email string) (UserInterface, error)
+	GetByIdentity(issuer string, subject string) (UserInterface, error)
+	LinkIdentity(user UserInterface, issuer string, subject string) error
 	Update(user UserInterface, r UserUpdateRequest) (UserInterface, error)
+	ChangePassword(user UserInterface, password string) error
+	RehashPassword(user UserInterface, password string) error
 	Delete(user UserInterface) error
+	Restore(user UserInterface) error
+	Purge(user UserInterface) error
+	Import(r io.Reader, format string, options UserImportOptions) (*UserImportResult, error)
+	Export(fn func(user UserInterface) error) error
 }
 
-func New(db database.DatabaseInterface) UserServiceInterface {
-	return UserService{db}
+// CreatedFunc is called with the transaction creating user, to create what
+// belongs to the user along with it. An error rolls the user back.
+type CreatedFunc func(tx database.DatabaseInterface, user *User) error
+
+func New(db database.DatabaseInterface, searcher UserSearcherInterface, passwordPolicy PasswordPolicy, passwordHasher PasswordHasher) UserServiceInterface {
+	return UserService{db, searcher, passwordPolicy, passwordHasher}
 }
 
-func (s UserService) List() ([]UserInterface, error) {
-	var users []User
-	if result := s.db.Find(&users); result.Error != nil {
-		return nil, result.Error
+// Create creates the user and calls created, when not nil, in the same
+// transaction.
+func (s UserService) Create(r UserCreateRequest, created CreatedFunc) (UserInterface, error) {
+	user := &User{
+		Username:    r.Username,
+		DisplayName: r.DisplayName,
+		Email:       r.Email,
 	}
 
-	var u = make([]UserInterface, len(users))
+	if err := s.passwordPolicy.Validate(r.Username, r.Password); err != nil {
+		return nil, err
+	}
 
-	for i := 0; i < len(users); i++ {
-		u[i] = &users[i]
+	if err := user.setPassword(s.passwordHasher, r.Password); err != nil {
+		return nil, err
 	}
 
-	return u, nil
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return createUser(tx, user, created)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
 }
 
-func (s UserService) Create(r UserCreateRequest) (UserInterface, error) {
+func (s UserService) CreateExternal(r UserExternalCreateRequest) (UserInterface, error) {
 	user := &User{
 		Username:    r.Username,
 		DisplayName: r.DisplayName,
+		Email:       r.Email,
 	}
 
-	user.SetPassword(r.Password)
-
 	if result := s.db.Create(user); result.Error != nil {
 		return nil, result.Error
 	}
@@ -61,25 +95,76 @@ func (s UserService) Get(id uint) (UserInterface, error) {
 	return user, nil
 }
 
+// GetUnscoped is Get which finds deleted users as well.
+func (s UserService) GetUnscoped(id uint) (UserInterface, error) {
+	user := &User{}
+
+	if result := s.db.Scopes(unscoped).First(user, id); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return user, nil
+}
+
 func (s UserService) GetByUsername(username string) (UserInterface, error) {
-	user := &User{
-		Username: username,
+	user := &User{}
+
+	if result := s.db.First(user, "username = ?", username); result.Error != nil {
+		return nil, result.Error
 	}
 
-	if result := s.db.First(user); result.Error != nil {
+	return user, nil
+}
+
+func (s UserService) GetByEmail(email string) (UserInterface, error) {
+	user := &User{}
+
+	if result := s.db.First(user, "email = ?", email); result.Error != nil {
 		return nil, result.Error
 	}
 
 	return user, nil
 }
 
+func (s UserService) GetByIdentity(issuer string, subject string) (UserInterface, error) {
+	identity := &Identity{}
+	if result := s.db.First(identity, "issuer = ? AND subject = ?", issuer, subject); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrIdentityNotFound
+		}
+
+		return nil, result.Error
+	}
+
+	return s.Get(identity.UserID)
+}
+
+func (s UserService) LinkIdentity(user UserInterface, issuer string, subject string) error {
+	identity := &Identity{
+		UserID:  user.(*User).ID,
+		Issuer:  issuer,
+		Subject: subject,
+	}
+
+	result := s.db.Create(identity)
+
+	return result.Error
+}
+
 func (s UserService) Update(user UserInterface, r UserUpdateRequest) (UserInterface, error) {
 	u := user.(*User)
-	u.DisplayName = r.DisplayName
 	if r.Password != "" {
-		u.SetPassword(r.Password)
+		if err := s.passwordPolicy.Validate(u.Username, r.Password); err != nil {
+			return nil, err
+		}
+
+		if err := u.setPassword(s.passwordHasher, r.Password); err != nil {
+			return nil, err
+		}
 	}
 
+	u.DisplayName = r.DisplayName
+	u.Email = r.Email
 	if result := s.db.Save(u); result.Error != nil {
 		return nil, result.Error
 	}
@@ -87,7 +172,73 @@ func (s UserService) Update(user UserInterface, r UserUpdateRequest) (UserInterf
 	return u, nil
 }
 
+func (s UserService) ChangePassword(user UserInterface, password string) error {
+	u := user.(*User)
+	if err := s.passwordPolicy.Validate(u.Username, password); err != nil {
+		return err
+	}
+
+	if err := u.setPassword(s.passwordHasher, password); err != nil {
+		return err
+	}
+
+	result := s.db.Save(u)
+
+	return result.Error
+}
+
+// RehashPassword upgrades the stored hash to the configured hasher. It must
+// only be called with a password which has just been validated.
+func (s UserService) RehashPassword(user UserInterface, password string) error {
+	u := user.(*User)
+	if !s.passwordHasher.NeedsRehash(u.Password) {
+		return nil
+	}
+
+	if err := u.setPassword(s.passwordHasher, password); err != nil {
+		return err
+	}
+
+	result := s.db.Save(u)
+
+	return result.Error
+}
+
 func (s UserService) Delete(user UserInterface) error {
 	result := s.db.Delete(user)
 	return result.Error
 }
+
+// Restore undoes Delete, unless the username has been taken meanwhile.
+func (s UserService) Restore(user UserInterface) error {
+	u := user.(*User)
+	if !u.DeletedAt.Valid {
+		return ErrUserNotDeleted
+	}
+
+	result := s.db.First(&User{}, "username = ?", u.Username)
+	if result.Error == nil {
+		return ErrUsernameTaken
+	}
+
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return result.Error
+	}
+
+	u.DeletedAt = gorm.DeletedAt{}
+	result = s.db.Scopes(unscoped).Save(u)
+
+	return result.Error
+}
+
+// Purge deletes the user for good, deleted or not, along with everything
+// referring to it but the impersonation records, which only lose the user.
+func (s UserService) Purge(user UserInterface) error {
+	result := s.db.Scopes(unscoped).Delete(user)
+	return result.Error
+}
+
+// unscoped includes the deleted users in a query.
+func unscoped(tx *gorm.DB) *gorm.DB {
+	return tx.Unscoped()
+}
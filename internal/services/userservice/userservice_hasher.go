@@ -0,0 +1,166 @@
+package userservice
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch = errors.New("password does not match")
+	ErrHashUnsupported  = errors.New("password hash format is not supported")
+)
+
+// PasswordHasher hashes new passwords. Verification does not depend on the
+// hasher, so stored hashes keep working after the algorithm or its
+// parameters change, and NeedsRehash tells when to upgrade them.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	NeedsRehash(hash string) bool
+}
+
+// DefaultPasswordHasher is used by User.SetPassword.
+var DefaultPasswordHasher PasswordHasher = BcryptHasher{Cost: bcrypt.DefaultCost}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	// bcrypt would silently ignore the rest of the password
+	if len(password) > maxPasswordBytes {
+		return "", ErrPasswordTooLong
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hashed), nil
+}
+
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+
+	return cost != h.Cost
+}
+
+// Argon2idHasher encodes hashes in the PHC string format, e.g.
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+type Argon2idHasher struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type argon2idHash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.Memory,
+		h.Iterations,
+		h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	decoded, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return decoded.memory != h.Memory ||
+		decoded.iterations != h.Iterations ||
+		decoded.parallelism != h.Parallelism ||
+		uint32(len(decoded.salt)) != h.SaltLength ||
+		uint32(len(decoded.key)) != h.KeyLength
+}
+
+func decodeArgon2id(hash string) (argon2idHash, error) {
+	var (
+		decoded argon2idHash
+		version int
+		err     error
+	)
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return decoded, ErrHashUnsupported
+	}
+
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return decoded, ErrHashUnsupported
+	}
+
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &decoded.memory, &decoded.iterations, &decoded.parallelism); err != nil {
+		return decoded, ErrHashUnsupported
+	}
+
+	if decoded.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return decoded, ErrHashUnsupported
+	}
+
+	if decoded.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return decoded, ErrHashUnsupported
+	}
+
+	return decoded, nil
+}
+
+// verifyPassword checks password against a hash made by any supported
+// hasher.
+func verifyPassword(hash string, password string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		decoded, err := decodeArgon2id(hash)
+		if err != nil {
+			return err
+		}
+
+		key := argon2.IDKey([]byte(password), decoded.salt, decoded.iterations, decoded.memory, decoded.parallelism, uint32(len(decoded.key)))
+		if subtle.ConstantTimeCompare(key, decoded.key) != 1 {
+			return ErrPasswordMismatch
+		}
+
+		return nil
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+
+		return err
+	}
+
+	return nil
+}
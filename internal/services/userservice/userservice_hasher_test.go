@@ -0,0 +1,187 @@
+package userservice_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var argon2id = userservice.Argon2idHasher{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestPasswordHasher_Hash(t *testing.T) {
+	tests := []struct {
+		name       string
+		hasher     userservice.PasswordHasher
+		password   string
+		wantPrefix string
+		wantErr    bool
+	}{
+		{
+			name:       "bcrypt",
+			hasher:     userservice.BcryptHasher{Cost: bcrypt.MinCost},
+			password:   "password",
+			wantPrefix: "$2a$04$",
+		},
+		{
+			name:     "bcrypt password too long",
+			hasher:   userservice.BcryptHasher{Cost: bcrypt.MinCost},
+			password: strings.Repeat("a", 73),
+			wantErr:  true,
+		},
+		{
+			name:       "argon2id",
+			hasher:     argon2id,
+			password:   "password",
+			wantPrefix: "$argon2id$v=19$m=1024,t=1,p=1$",
+		},
+		{
+			name:       "argon2id long password",
+			hasher:     argon2id,
+			password:   strings.Repeat("a", 73),
+			wantPrefix: "$argon2id$",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.hasher.Hash(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PasswordHasher.Hash() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Errorf("PasswordHasher.Hash() = %v, want prefix %v", got, tt.wantPrefix)
+			}
+
+			u := &userservice.User{Password: got}
+			if err := u.ValidatePassword(tt.password); err != nil {
+				t.Errorf("User.ValidatePassword() error = %v", err)
+			}
+
+			if err := u.ValidatePassword(tt.password + "x"); err == nil {
+				t.Error("User.ValidatePassword() accepted a wrong password")
+			}
+
+			if tt.hasher.NeedsRehash(got) {
+				t.Errorf("PasswordHasher.NeedsRehash() = true for a fresh hash")
+			}
+		})
+	}
+}
+
+func TestPasswordHasher_NeedsRehash(t *testing.T) {
+	bcryptHash, _ := userservice.BcryptHasher{Cost: bcrypt.MinCost}.Hash("password")
+	argon2idHash, _ := argon2id.Hash("password")
+
+	stronger := argon2id
+	stronger.Iterations = 2
+
+	tests := []struct {
+		name   string
+		hasher userservice.PasswordHasher
+		hash   string
+		want   bool
+	}{
+		{
+			name:   "bcrypt same cost",
+			hasher: userservice.BcryptHasher{Cost: bcrypt.MinCost},
+			hash:   bcryptHash,
+			want:   false,
+		},
+		{
+			name:   "bcrypt cost raised",
+			hasher: userservice.BcryptHasher{Cost: bcrypt.MinCost + 1},
+			hash:   bcryptHash,
+			want:   true,
+		},
+		{
+			name:   "bcrypt to argon2id",
+			hasher: argon2id,
+			hash:   bcryptHash,
+			want:   true,
+		},
+		{
+			name:   "argon2id parameters raised",
+			hasher: stronger,
+			hash:   argon2idHash,
+			want:   true,
+		},
+		{
+			name:   "argon2id to bcrypt",
+			hasher: userservice.BcryptHasher{Cost: bcrypt.MinCost},
+			hash:   argon2idHash,
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("PasswordHasher.NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserService_RehashPassword(t *testing.T) {
+	bcryptHash, _ := userservice.BcryptHasher{Cost: bcrypt.MinCost}.Hash("password")
+
+	tests := []struct {
+		name       string
+		hasher     userservice.PasswordHasher
+		wantSave   bool
+		wantPrefix string
+	}{
+		{
+			name:       "up to date",
+			hasher:     userservice.BcryptHasher{Cost: bcrypt.MinCost},
+			wantPrefix: "$2a$04$",
+		},
+		{
+			name:       "upgraded to argon2id",
+			hasher:     argon2id,
+			wantSave:   true,
+			wantPrefix: "$argon2id$",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("Save", mock.AnythingOfType("*userservice.User")).
+				Return(&gorm.DB{})
+
+			user := &userservice.User{Password: bcryptHash}
+
+			s := userservice.New(db, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, tt.hasher)
+			if err := s.RehashPassword(user, "password"); err != nil {
+				t.Errorf("UserService.RehashPassword() error = %v", err)
+				return
+			}
+
+			if saved := len(db.Calls) > 0; saved != tt.wantSave {
+				t.Errorf("UserService.RehashPassword() saved = %v, want %v", saved, tt.wantSave)
+			}
+
+			if !strings.HasPrefix(user.Password, tt.wantPrefix) {
+				t.Errorf("UserService.RehashPassword() hash = %v, want prefix %v", user.Password, tt.wantPrefix)
+			}
+
+			if err := user.ValidatePassword("password"); err != nil {
+				t.Errorf("User.ValidatePassword() error = %v", err)
+			}
+		})
+	}
+}
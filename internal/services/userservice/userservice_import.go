@@ -0,0 +1,369 @@
+package userservice
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+	// MaxImportRows bounds an import, the passwords of every row are hashed
+	// within the request.
+	MaxImportRows = 1000
+	// exportBatchSize is how many users Export reads at once.
+	exportBatchSize = 500
+)
+
+var ErrImportInvalid = errors.New("import is invalid")
+
+// importColumns are the columns an imported CSV file can have.
+var importColumns = []string{"username", "password", "display_name", "email"}
+
+type UserImportOptions struct {
+	// DryRun validates the rows without creating any user.
+	DryRun bool
+	// BestEffort creates the valid rows when others are invalid, rather
+	// than none.
+	BestEffort bool
+	// Created is called for every user created, with the transaction
+	// creating it. An error fails the row like one creating the user.
+	Created CreatedFunc
+}
+
+// UserImportError is a problem with a row of an import, rows counting from 1
+// after the CSV header.
+type UserImportError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type UserImportResult struct {
+	// Users are the users created, or those which would be on a dry run.
+	Users  []UserInterface
+	Errors []UserImportError
+}
+
+type importRow struct {
+	row     int
+	request UserCreateRequest
+}
+
+// Import creates the users in r, a CSV file with a header row or one JSON
+// object per line. Every row is validated first, and unless
+// options.BestEffort, no user is created when any row is invalid.
+func (s UserService) Import(r io.Reader, format string, options UserImportOptions) (*UserImportResult, error) {
+	var (
+		rows   []importRow
+		result = &UserImportResult{}
+		err    error
+	)
+
+	switch format {
+	case ImportFormatCSV:
+		rows, result.Errors, err = decodeCSV(r)
+	case ImportFormatNDJSON:
+		rows, result.Errors, err = decodeNDJSON(r)
+	default:
+		err = fmt.Errorf("%w: format %q is not supported", ErrImportInvalid, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	users, errs, err := s.validateImport(rows)
+	if err != nil {
+		return nil, err
+	}
+	result.Errors = append(result.Errors, errs...)
+
+	if len(result.Errors) > 0 && !options.BestEffort {
+		return result, nil
+	}
+
+	if options.DryRun {
+		for _, u := range users {
+			result.Users = append(result.Users, u.user)
+		}
+
+		return result, nil
+	}
+
+	if options.BestEffort {
+		for _, u := range users {
+			err := s.db.Transaction(func(tx *gorm.DB) error {
+				return createUser(tx, u.user, options.Created)
+			})
+			if err != nil {
+				result.Errors = append(result.Errors, UserImportError{Row: u.row, Message: err.Error()})
+				continue
+			}
+
+			result.Users = append(result.Users, u.user)
+		}
+
+		return result, nil
+	}
+
+	// the row failing to be created rolls back the others, and is answered
+	// like an invalid one
+	var rowErr *UserImportError
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, u := range users {
+			if err := createUser(tx, u.user, options.Created); err != nil {
+				rowErr = &UserImportError{Row: u.row, Message: err.Error()}
+				return err
+			}
+		}
+
+		return nil
+	})
+	if rowErr != nil {
+		result.Errors = append(result.Errors, *rowErr)
+		return result, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		result.Users = append(result.Users, u.user)
+	}
+
+	return result, nil
+}
+
+func createUser(tx *gorm.DB, user *User, created CreatedFunc) error {
+	if result := tx.Create(user); result.Error != nil {
+		return result.Error
+	}
+
+	if created == nil {
+		return nil
+	}
+
+	return created(tx, user)
+}
+
+type importUser struct {
+	row  int
+	user *User
+}
+
+// validateImport returns the users of the valid rows, with their passwords
+// hashed, and the errors of the others.
+func (s UserService) validateImport(rows []importRow) ([]importUser, []UserImportError, error) {
+	var (
+		users     []importUser
+		errs      []UserImportError
+		usernames = make([]string, 0, len(rows))
+		seen      = map[string]int{}
+	)
+
+	for _, r := range rows {
+		usernames = append(usernames, r.request.Username)
+	}
+
+	var existing []User
+	if len(usernames) > 0 {
+		if result := s.db.Find(&existing, "username IN ?", usernames); result.Error != nil {
+			return nil, nil, result.Error
+		}
+	}
+
+	taken := map[string]bool{}
+	for _, u := range existing {
+		taken[u.Username] = true
+	}
+
+	for _, r := range rows {
+		var rowErrs []UserImportError
+		invalid := func(field string, format string, a ...interface{}) {
+			rowErrs = append(rowErrs, UserImportError{Row: r.row, Field: field, Message: fmt.Sprintf(format, a...)})
+		}
+
+		req := r.request
+		switch {
+		case req.Username == "":
+			invalid("username", "username is required")
+		case taken[req.Username]:
+			invalid("username", "username is taken")
+		case seen[req.Username] > 0:
+			invalid("username", "username is repeated from row %d", seen[req.Username])
+		default:
+			seen[req.Username] = r.row
+		}
+
+		if req.DisplayName == "" {
+			invalid("display_name", "display name is required")
+		}
+
+		if req.Email != "" {
+			if _, err := mail.ParseAddress(req.Email); err != nil {
+				invalid("email", "email is invalid")
+			}
+		}
+
+		if req.Password == "" {
+			invalid("password", "password is required")
+		} else if err := s.passwordPolicy.Validate(req.Username, req.Password); err != nil {
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) {
+				return nil, nil, err
+			}
+
+			for _, v := range policyErr.Violations {
+				invalid(v.Field, "%s", v.Message)
+			}
+		}
+
+		if len(rowErrs) > 0 {
+			errs = append(errs, rowErrs...)
+			continue
+		}
+
+		user := &User{
+			Username:    req.Username,
+			DisplayName: req.DisplayName,
+			Email:       req.Email,
+		}
+		if err := user.setPassword(s.passwordHasher, req.Password); err != nil {
+			return nil, nil, err
+		}
+
+		users = append(users, importUser{r.row, user})
+	}
+
+	return users, errs, nil
+}
+
+func decodeCSV(r io.Reader) ([]importRow, []UserImportError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: header %v", ErrImportInvalid, err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if !contains(importColumns, name) {
+			return nil, nil, fmt.Errorf("%w: unknown column %q", ErrImportInvalid, name)
+		}
+
+		columns[name] = i
+	}
+
+	var (
+		rows []importRow
+		errs []UserImportError
+	)
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if row > MaxImportRows {
+			return nil, nil, fmt.Errorf("%w: more than %d rows", ErrImportInvalid, MaxImportRows)
+		}
+
+		if err != nil {
+			errs = append(errs, UserImportError{Row: row, Message: err.Error()})
+			continue
+		}
+
+		value := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(record) {
+				return ""
+			}
+
+			return record[i]
+		}
+
+		// spaces can be part of a password
+		rows = append(rows, importRow{row, UserCreateRequest{
+			Username:    strings.TrimSpace(value("username")),
+			Password:    value("password"),
+			DisplayName: strings.TrimSpace(value("display_name")),
+			Email:       strings.TrimSpace(value("email")),
+		}})
+	}
+
+	return rows, errs, nil
+}
+
+func decodeNDJSON(r io.Reader) ([]importRow, []UserImportError, error) {
+	var (
+		rows    []importRow
+		errs    []UserImportError
+		scanner = bufio.NewScanner(r)
+		row     int
+	)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if row++; row > MaxImportRows {
+			return nil, nil, fmt.Errorf("%w: more than %d rows", ErrImportInvalid, MaxImportRows)
+		}
+
+		var req UserCreateRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			errs = append(errs, UserImportError{Row: row, Message: err.Error()})
+			continue
+		}
+
+		rows = append(rows, importRow{row, req})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrImportInvalid, err)
+	}
+
+	return rows, errs, nil
+}
+
+// Export calls fn with every user, reading them in batches so the table is
+// never loaded whole. It stops at the first error fn returns.
+func (s UserService) Export(fn func(user UserInterface) error) error {
+	var users []User
+	result := s.db.FindInBatches(&users, exportBatchSize, func(tx *gorm.DB, batch int) error {
+		for i := range users {
+			if err := fn(&users[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return result.Error
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,303 @@
+package userservice_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/maetad/baroness-api/internal/database"
+	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestUserService_Import(t *testing.T) {
+	dbErr := errors.New("error")
+	taken := []userservice.User{{Username: "carol"}}
+	passwords := map[string]string{"alice": "correct horse", "bob": "battery staple"}
+
+	type args struct {
+		input   string
+		format  string
+		options userservice.UserImportOptions
+	}
+	tests := []struct {
+		name          string
+		args          args
+		existing      []userservice.User
+		createErr     error
+		createdErr    error
+		wantUsernames []string
+		wantCreated   []string
+		wantErrors    []userservice.UserImportError
+		wantQueries   int
+		wantErr       error
+	}{
+		{
+			name: "csv",
+			args: args{
+				input:  "username,password,display_name,email\nalice,correct horse,Alice,alice@example.com\n bob ,battery staple,Bob,\n",
+				format: userservice.ImportFormatCSV,
+			},
+			wantUsernames: []string{"alice", "bob"},
+			wantCreated:   []string{"alice", "bob"},
+			wantQueries:   2,
+		},
+		{
+			name: "ndjson",
+			args: args{
+				input:  `{"username":"alice","password":"correct horse","display_name":"Alice"}` + "\n\n" + `{"username":"bob","password":"battery staple","display_name":"Bob"}`,
+				format: userservice.ImportFormatNDJSON,
+			},
+			wantUsernames: []string{"alice", "bob"},
+			wantCreated:   []string{"alice", "bob"},
+			wantQueries:   2,
+		},
+		{
+			name: "unknown format",
+			args: args{
+				input:  "alice",
+				format: "xml",
+			},
+			wantErr: userservice.ErrImportInvalid,
+		},
+		{
+			name: "unknown column",
+			args: args{
+				input:  "username,role\nalice,admin\n",
+				format: userservice.ImportFormatCSV,
+			},
+			wantErr: userservice.ErrImportInvalid,
+		},
+		{
+			name: "too many rows",
+			args: args{
+				input:  "username\n" + strings.Repeat("alice\n", userservice.MaxImportRows+1),
+				format: userservice.ImportFormatCSV,
+			},
+			wantErr: userservice.ErrImportInvalid,
+		},
+		{
+			name: "invalid rows create nobody",
+			args: args{
+				input:  "username,password,display_name,email\nalice,correct horse,Alice,alice@\nbob,battery staple,Bob,\ncarol,long enough,Carol,\nbob,staple battery,,\n",
+				format: userservice.ImportFormatCSV,
+			},
+			existing: taken,
+			wantErrors: []userservice.UserImportError{
+				{Row: 1, Field: "email", Message: "email is invalid"},
+				{Row: 3, Field: "username", Message: "username is taken"},
+				{Row: 4, Field: "username", Message: "username is repeated from row 2"},
+				{Row: 4, Field: "display_name", Message: "display name is required"},
+			},
+		},
+		{
+			name: "invalid json",
+			args: args{
+				input:  `{"username":"alice"`,
+				format: userservice.ImportFormatNDJSON,
+			},
+			wantErrors: []userservice.UserImportError{
+				{Row: 1, Message: "unexpected end of JSON input"},
+			},
+		},
+		{
+			name: "dry run",
+			args: args{
+				input:   "username,password,display_name\nalice,correct horse,Alice\n",
+				format:  userservice.ImportFormatCSV,
+				options: userservice.UserImportOptions{DryRun: true},
+			},
+			wantUsernames: []string{"alice"},
+		},
+		{
+			name: "best effort",
+			args: args{
+				input:   "username,password,display_name\nalice,correct horse,Alice\ncarol,long enough,Carol\n",
+				format:  userservice.ImportFormatCSV,
+				options: userservice.UserImportOptions{BestEffort: true},
+			},
+			existing:      taken,
+			wantUsernames: []string{"alice"},
+			wantCreated:   []string{"alice"},
+			wantErrors: []userservice.UserImportError{
+				{Row: 2, Field: "username", Message: "username is taken"},
+			},
+			wantQueries: 1,
+		},
+		{
+			name: "best effort create error",
+			args: args{
+				input:   "username,password,display_name\nalice,correct horse,Alice\n",
+				format:  userservice.ImportFormatCSV,
+				options: userservice.UserImportOptions{BestEffort: true},
+			},
+			createErr: dbErr,
+			wantErrors: []userservice.UserImportError{
+				{Row: 1, Message: "error"},
+			},
+			wantQueries: 1,
+		},
+		{
+			name: "best effort created error",
+			args: args{
+				input:   "username,password,display_name\nalice,correct horse,Alice\nbob,battery staple,Bob\n",
+				format:  userservice.ImportFormatCSV,
+				options: userservice.UserImportOptions{BestEffort: true},
+			},
+			createdErr:  dbErr,
+			wantCreated: []string{"alice", "bob"},
+			wantErrors: []userservice.UserImportError{
+				{Row: 1, Message: "error"},
+				{Row: 2, Message: "error"},
+			},
+			wantQueries: 2,
+		},
+		{
+			name: "create error fails the row",
+			args: args{
+				input:  "username,password,display_name\nalice,correct horse,Alice\n",
+				format: userservice.ImportFormatCSV,
+			},
+			createErr: dbErr,
+			wantErrors: []userservice.UserImportError{
+				{Row: 1, Message: "error"},
+			},
+			wantQueries: 1,
+		},
+		{
+			name: "created error fails the row",
+			args: args{
+				input:  "username,password,display_name\nalice,correct horse,Alice\nbob,battery staple,Bob\n",
+				format: userservice.ImportFormatCSV,
+			},
+			createdErr:  dbErr,
+			wantCreated: []string{"alice"},
+			wantErrors: []userservice.UserImportError{
+				{Row: 1, Message: "error"},
+			},
+			wantQueries: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, queries := dryRun(t, nil, 0, tt.createErr)
+			db.On("Find", mock.AnythingOfType("*[]userservice.User"), "username IN ?", mock.Anything).
+				Run(func(args mock.Arguments) {
+					*args.Get(0).(*[]userservice.User) = tt.existing
+				}).
+				Return(&gorm.DB{})
+
+			var created []string
+			options := tt.args.options
+			options.Created = func(tx database.DatabaseInterface, user *userservice.User) error {
+				if _, ok := tx.(*gorm.DB); !ok {
+					t.Errorf("UserService.Import() created with %T, want the transaction", tx)
+				}
+				created = append(created, user.Username)
+
+				return tt.createdErr
+			}
+
+			s := userservice.New(db, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{MinLength: 8}, hasher)
+			got, err := s.Import(strings.NewReader(tt.args.input), tt.args.format, options)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UserService.Import() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(*queries) != tt.wantQueries {
+				t.Errorf("UserService.Import() queries = %v, want %d", *queries, tt.wantQueries)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			var usernames []string
+			for _, u := range got.Users {
+				user := u.(*userservice.User)
+				if err := user.ValidatePassword(passwords[user.Username]); err != nil {
+					t.Errorf("UserService.Import() password of %s is not set", user.Username)
+				}
+				usernames = append(usernames, user.Username)
+			}
+
+			if !reflect.DeepEqual(usernames, tt.wantUsernames) {
+				t.Errorf("UserService.Import() users = %v, want %v", usernames, tt.wantUsernames)
+			}
+
+			if !reflect.DeepEqual(got.Errors, tt.wantErrors) {
+				t.Errorf("UserService.Import() errors = %v, want %v", got.Errors, tt.wantErrors)
+			}
+
+			if !reflect.DeepEqual(created, tt.wantCreated) {
+				t.Errorf("UserService.Import() created = %v, want %v", created, tt.wantCreated)
+			}
+		})
+	}
+}
+
+func TestUserService_Export(t *testing.T) {
+	users := []userservice.User{
+		{Model: model.Model{ID: 1}, Username: "alice"},
+		{Model: model.Model{ID: 2}, Username: "bob"},
+	}
+	fnErr := errors.New("error")
+
+	tests := []struct {
+		name    string
+		users   []userservice.User
+		dbErr   error
+		fnErr   error
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "export",
+			users: users,
+			want:  []string{"alice", "bob"},
+		},
+		{
+			name: "no users",
+		},
+		{
+			name:    "stops on fn error",
+			users:   users,
+			fnErr:   fnErr,
+			want:    []string{"alice"},
+			wantErr: fnErr,
+		},
+		{
+			name:    "database error",
+			users:   users,
+			dbErr:   fnErr,
+			wantErr: fnErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, queries := dryRun(t, tt.users, 0, tt.dbErr)
+
+			var got []string
+			s := userservice.New(db, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, hasher)
+			err := s.Export(func(user userservice.UserInterface) error {
+				got = append(got, user.(*userservice.User).Username)
+				return tt.fnErr
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UserService.Export() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserService.Export() users = %v, want %v", got, tt.want)
+			}
+
+			want := `SELECT * FROM "users" WHERE "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT 500`
+			if len(*queries) == 0 || (*queries)[0] != want {
+				t.Errorf("UserService.Export() queries = %v, want %s", *queries, want)
+			}
+		})
+	}
+}
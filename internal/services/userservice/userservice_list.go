@@ -0,0 +1,191 @@
+package userservice
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultListLimit = 20
+	defaultListSort  = "created_at"
+)
+
+// listSortColumns are the columns users can be sorted by.
+var listSortColumns = map[string]bool{
+	"created_at":   true,
+	"username":     true,
+	"display_name": true,
+}
+
+// UserList is a page of users. NextCursor is empty on the last page.
+type UserList struct {
+	Users      []UserInterface
+	Total      int64
+	Limit      int
+	Offset     int
+	NextCursor string
+}
+
+// listCursor is the position after the last user of a page, the value of
+// the sort column and the id breaking ties.
+type listCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+func (c listCursor) encode() (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeListCursor(s string) (*listCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCursorInvalid, err)
+	}
+
+	var c listCursor
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCursorInvalid, err)
+	}
+
+	return &c, nil
+}
+
+// List returns a page of the users matching the filters of r, along with how
+// many match in total. Pages after a cursor are stable while users are
+// created, unlike those at an offset.
+func (s UserService) List(r UserListRequest) (*UserList, error) {
+	limit := r.Limit
+	if limit == 0 {
+		limit = DefaultListLimit
+	}
+
+	sort := r.Sort
+	if sort == "" {
+		sort = defaultListSort
+	}
+
+	if !listSortColumns[strings.TrimPrefix(sort, "-")] {
+		return nil, ErrSortInvalid
+	}
+
+	var after *listCursor
+	if r.Cursor != "" {
+		var err error
+		if after, err = decodeListCursor(r.Cursor); err != nil {
+			return nil, err
+		}
+
+		// the position is only meaningful in the order it was taken in
+		if after.Sort != sort {
+			return nil, ErrCursorInvalid
+		}
+	}
+
+	var total int64
+	if result := s.db.Scopes(r.filter).Model(&User{}).Count(&total); result.Error != nil {
+		return nil, result.Error
+	}
+
+	var users []User
+	if result := s.db.Scopes(r.filter, page(sort, after, limit, r.Offset)).Find(&users); result.Error != nil {
+		return nil, result.Error
+	}
+
+	list := &UserList{
+		Users:  make([]UserInterface, 0, limit),
+		Total:  total,
+		Limit:  limit,
+		Offset: r.Offset,
+	}
+
+	// one more user than the limit is fetched to know whether a next page
+	// exists
+	if len(users) > limit {
+		users = users[:limit]
+
+		next, err := cursorAfter(sort, users[limit-1]).encode()
+		if err != nil {
+			return nil, err
+		}
+		list.NextCursor = next
+	}
+
+	for i := range users {
+		list.Users = append(list.Users, &users[i])
+	}
+
+	return list, nil
+}
+
+func (r UserListRequest) filter(tx *gorm.DB) *gorm.DB {
+	if r.Deleted {
+		tx = tx.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+
+	if r.Username != "" {
+		tx = tx.Where("username LIKE ?", escapeLike(r.Username)+"%")
+	}
+
+	if r.CreatedAfter != nil {
+		tx = tx.Where("created_at >= ?", *r.CreatedAfter)
+	}
+
+	if r.CreatedBefore != nil {
+		tx = tx.Where("created_at < ?", *r.CreatedBefore)
+	}
+
+	return tx
+}
+
+// page orders by the sort column, then by id so the order is total, and
+// seeks past the cursor when there is one.
+func page(sort string, after *listCursor, limit int, offset int) func(*gorm.DB) *gorm.DB {
+	column := strings.TrimPrefix(sort, "-")
+	direction, operator := "ASC", ">"
+	if strings.HasPrefix(sort, "-") {
+		direction, operator = "DESC", "<"
+	}
+
+	return func(tx *gorm.DB) *gorm.DB {
+		if after != nil {
+			tx = tx.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, operator), after.Value, after.ID)
+		}
+
+		return tx.
+			Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).
+			Limit(limit + 1).
+			Offset(offset)
+	}
+}
+
+func cursorAfter(sort string, user User) listCursor {
+	c := listCursor{Sort: sort, ID: user.ID}
+
+	switch strings.TrimPrefix(sort, "-") {
+	case "username":
+		c.Value = user.Username
+	case "display_name":
+		c.Value = user.DisplayName
+	default:
+		c.Value = user.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	return c
+}
+
+// escapeLike quotes the wildcards of LIKE in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
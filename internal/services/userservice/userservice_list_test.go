@@ -0,0 +1,205 @@
+package userservice_test
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"github.com/maetad/baroness-api/mocks"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// dryDB is a database which does not run statements but records them,
+// answering queries with users and total, or err.
+func dryDB(t *testing.T, users []userservice.User, total int64, err error) (*gorm.DB, *[]string) {
+	dry, openErr := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+
+	var queries []string
+	record := func(tx *gorm.DB) {
+		queries = append(queries, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+		if err != nil {
+			tx.AddError(err)
+		}
+	}
+	answer := func(tx *gorm.DB) {
+		if record(tx); err != nil {
+			return
+		}
+
+		switch dest := tx.Statement.Dest.(type) {
+		case *int64:
+			*dest = total
+			tx.RowsAffected = 1
+		case *[]userservice.User:
+			*dest = users
+			tx.RowsAffected = int64(len(users))
+		case *userservice.User:
+			if len(users) == 0 {
+				tx.AddError(gorm.ErrRecordNotFound)
+				return
+			}
+			*dest = users[0]
+		}
+	}
+	dry.Callback().Query().After("gorm:query").Register("test:answer", answer)
+	dry.Callback().Create().After("gorm:create").Register("test:record", record)
+	dry.Callback().Update().After("gorm:update").Register("test:record", record)
+	dry.Callback().Delete().After("gorm:delete").Register("test:record", record)
+
+	return dry, &queries
+}
+
+// dryRun is a mocked database whose scopes, transactions and batches run on
+// dryDB.
+func dryRun(t *testing.T, users []userservice.User, total int64, err error) (*mocks.DatabaseInterface, *[]string) {
+	dry, queries := dryDB(t, users, total, err)
+
+	scopes := func(funcs ...func(*gorm.DB) *gorm.DB) *gorm.DB {
+		return dry.Scopes(funcs...)
+	}
+
+	db := &mocks.DatabaseInterface{}
+	db.On("Scopes", mock.Anything).Return(scopes)
+	db.On("Scopes", mock.Anything, mock.Anything).Return(scopes)
+	db.On("Transaction", mock.Anything).Return(func(fc func(*gorm.DB) error, opts ...*sql.TxOptions) error {
+		return fc(dry)
+	})
+	db.On("FindInBatches", mock.Anything, mock.Anything, mock.Anything).Return(dry.FindInBatches)
+
+	return db, queries
+}
+
+func cursor(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func TestUserService_List(t *testing.T) {
+	createdAt := time.Date(2022, 8, 1, 10, 0, 0, 0, time.UTC)
+	users := []userservice.User{
+		{Model: model.Model{ID: 1, CreatedAt: createdAt}, Username: "alice"},
+		{Model: model.Model{ID: 2, CreatedAt: createdAt}, Username: "bob"},
+		{Model: model.Model{ID: 3, CreatedAt: createdAt}, Username: "carol"},
+	}
+	dbErr := errors.New("database error")
+
+	tests := []struct {
+		name        string
+		r           userservice.UserListRequest
+		users       []userservice.User
+		err         error
+		wantErr     error
+		wantUsers   int
+		wantNext    string
+		wantQueries []string
+	}{
+		{
+			name:      "first page",
+			r:         userservice.UserListRequest{Limit: 2},
+			users:     users,
+			wantUsers: 2,
+			wantNext:  cursor(`{"s":"created_at","v":"2022-08-01T10:00:00Z","id":2}`),
+			wantQueries: []string{
+				`SELECT count(*) FROM "users" WHERE "users"."deleted_at" IS NULL`,
+				`SELECT * FROM "users" WHERE "users"."deleted_at" IS NULL ORDER BY created_at ASC, id ASC LIMIT 3`,
+			},
+		},
+		{
+			name:      "last page at an offset",
+			r:         userservice.UserListRequest{Offset: 20},
+			users:     users,
+			wantUsers: 3,
+			wantQueries: []string{
+				`SELECT count(*) FROM "users" WHERE "users"."deleted_at" IS NULL`,
+				`SELECT * FROM "users" WHERE "users"."deleted_at" IS NULL ORDER BY created_at ASC, id ASC LIMIT 21 OFFSET 20`,
+			},
+		},
+		{
+			name: "filtered after a cursor",
+			r: userservice.UserListRequest{
+				Limit:        2,
+				Sort:         "-username",
+				Cursor:       cursor(`{"s":"-username","v":"bob","id":2}`),
+				Username:     "a_b",
+				CreatedAfter: &createdAt,
+			},
+			users:     users[:1],
+			wantUsers: 1,
+			wantQueries: []string{
+				`SELECT count(*) FROM "users" WHERE username LIKE 'a\_b%' AND created_at >= '2022-08-01 10:00:00' AND "users"."deleted_at" IS NULL`,
+				`SELECT * FROM "users" WHERE username LIKE 'a\_b%' AND created_at >= '2022-08-01 10:00:00' AND (username, id) < ('bob', 2) AND "users"."deleted_at" IS NULL ORDER BY username DESC, id DESC LIMIT 3`,
+			},
+		},
+		{
+			name:      "deleted",
+			r:         userservice.UserListRequest{Deleted: true},
+			users:     users[:1],
+			wantUsers: 1,
+			wantQueries: []string{
+				`SELECT count(*) FROM "users" WHERE deleted_at IS NOT NULL`,
+				`SELECT * FROM "users" WHERE deleted_at IS NOT NULL ORDER BY created_at ASC, id ASC LIMIT 21`,
+			},
+		},
+		{
+			name:    "cursor is not base64",
+			r:       userservice.UserListRequest{Cursor: "!"},
+			wantErr: userservice.ErrCursorInvalid,
+		},
+		{
+			name:    "cursor of another sort",
+			r:       userservice.UserListRequest{Sort: "username", Cursor: cursor(`{"s":"created_at","v":"2022-08-01T10:00:00Z","id":2}`)},
+			wantErr: userservice.ErrCursorInvalid,
+		},
+		{
+			name:    "sort column unknown",
+			r:       userservice.UserListRequest{Sort: "password"},
+			wantErr: userservice.ErrSortInvalid,
+		},
+		{
+			name:    "count fail",
+			err:     dbErr,
+			wantErr: dbErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, queries := dryRun(t, tt.users, 5, tt.err)
+
+			got, err := userservice.New(db, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, hasher).List(tt.r)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("UserService.List() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("UserService.List() error = %v", err)
+				return
+			}
+
+			if len(got.Users) != tt.wantUsers || got.Total != 5 || got.NextCursor != tt.wantNext {
+				t.Errorf("UserService.List() = %d users, total %v, next %v, want %d users, next %v", len(got.Users), got.Total, got.NextCursor, tt.wantUsers, tt.wantNext)
+			}
+
+			if strings.Join(*queries, "\n") != strings.Join(tt.wantQueries, "\n") {
+				t.Errorf("UserService.List() queries\n%v\nwant\n%v", strings.Join(*queries, "\n"), strings.Join(tt.wantQueries, "\n"))
+			}
+		})
+	}
+}
@@ -1,35 +1,84 @@
 package userservice
 
 import (
+	"errors"
+	"strconv"
+	"time"
+
 	"github.com/maetad/baroness-api/internal/model"
-	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordTooLong = errors.New("password is longer than 72 bytes")
+	ErrPasswordNotSet  = errors.New("user has no password")
+	// ErrIdentityNotFound is returned when no user is linked to an
+	// identity of an external identity provider.
+	ErrIdentityNotFound = errors.New("identity is not linked to a user")
+	ErrCursorInvalid    = errors.New("cursor is invalid")
+	ErrSortInvalid      = errors.New("sort column is invalid")
+	ErrUserNotDeleted   = errors.New("user is not deleted")
+	// ErrUsernameTaken is returned when restoring a user whose username has
+	// been given to another user since it was deleted.
+	ErrUsernameTaken = errors.New("username is taken")
 )
 
 type UserInterface interface {
-	SetPassword(password string)
+	SetPassword(password string) error
 	ValidatePassword(password string) error
 }
 
 type User struct {
 	model.Model
-	Username    string `json:"username"`
-	Password    string `json:"-"`
+	Username string `json:"username"`
+	// Password is NULL for users who sign in through an external identity
+	// provider only.
+	Password    string `json:"-" gorm:"default:null"`
 	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	// TOTPLastStep is the time step of the last accepted code, so that a
+	// code can not be used twice.
+	TOTPLastStep int64 `json:"-"`
 }
 
-func (u *User) SetPassword(password string) {
-	hashed, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func (u *User) SetPassword(password string) error {
+	return u.setPassword(DefaultPasswordHasher, password)
+}
+
+func (u *User) setPassword(hasher PasswordHasher, password string) error {
+	hashed, err := hasher.Hash(password)
+	if err != nil {
+		return err
+	}
 
-	u.Password = string(hashed)
+	u.Password = hashed
+
+	return nil
 }
 
 func (u *User) ValidatePassword(password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
+	if u.Password == "" {
+		return ErrPasswordNotSet
+	}
+
+	return verifyPassword(u.Password, password)
 }
 
 func (u *User) GetClaims() map[string]interface{} {
 	return map[string]interface{}{
+		"sub":          strconv.FormatUint(uint64(u.ID), 10),
 		"username":     u.Username,
 		"display_name": u.DisplayName,
 	}
 }
+
+// Identity links a user to the subject of an external identity provider,
+// such as an OpenID Connect issuer or an LDAP directory.
+type Identity struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
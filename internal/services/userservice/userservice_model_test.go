@@ -2,6 +2,7 @@ package userservice_test
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/maetad/baroness-api/internal/model"
@@ -17,9 +18,10 @@ func TestUser_SetPassword(t *testing.T) {
 		password string
 	}
 	tests := []struct {
-		name   string
-		fields fields
-		args   args
+		name    string
+		fields  fields
+		args    args
+		wantErr bool
 	}{
 		{
 			name:   "set password",
@@ -28,6 +30,14 @@ func TestUser_SetPassword(t *testing.T) {
 				password: "password",
 			},
 		},
+		{
+			name:   "password too long",
+			fields: fields{},
+			args: args{
+				password: strings.Repeat("a", 73),
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -35,7 +45,9 @@ func TestUser_SetPassword(t *testing.T) {
 				Username:    tt.fields.Username,
 				DisplayName: tt.fields.DisplayName,
 			}
-			u.SetPassword(tt.args.password)
+			if err := u.SetPassword(tt.args.password); (err != nil) != tt.wantErr {
+				t.Errorf("User.SetPassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
 		})
 	}
 }
@@ -75,6 +87,14 @@ func TestUser_ValidatePassword(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name:   "password not set",
+			fields: fields{},
+			args: args{
+				password: "",
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -105,10 +125,12 @@ func TestUser_GetClaims(t *testing.T) {
 		{
 			name: "user claims",
 			fields: fields{
+				Model:       model.Model{ID: 1},
 				Username:    "admin",
 				DisplayName: "Administrator",
 			},
 			want: map[string]interface{}{
+				"sub":          "1",
 				"username":     "admin",
 				"display_name": "Administrator",
 			},
@@ -0,0 +1,114 @@
+package userservice
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcrypt only uses the first 72 bytes of a password
+const maxPasswordBytes = 72
+
+// DefaultDenyList holds the most common leaked passwords.
+var DefaultDenyList = []string{
+	"123456", "123456789", "12345678", "1234567890", "1234567", "12345",
+	"password", "password1", "password123", "qwerty", "qwerty123", "qwertyuiop",
+	"111111", "000000", "123123", "654321", "abc123", "iloveyou", "admin",
+	"admin123", "welcome", "welcome1", "letmein", "monkey", "dragon",
+	"football", "baseball", "sunshine", "princess", "superman", "1q2w3e4r",
+	"passw0rd", "p@ssw0rd", "trustno1", "master", "login", "changeme",
+}
+
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength is in bytes and never above the 72 bytes bcrypt accepts.
+	MaxLength int
+	// MinCharClasses is how many of lower case, upper case, digits and
+	// symbols the password must mix.
+	MinCharClasses int
+	DenyList       []string
+}
+
+type PasswordViolation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+
+	return strings.Join(messages, ", ")
+}
+
+// Validate returns a *PasswordPolicyError listing every rule the password
+// breaks, or nil.
+func (p PasswordPolicy) Validate(username string, password string) error {
+	var violations []PasswordViolation
+	violate := func(rule string, format string, a ...interface{}) {
+		violations = append(violations, PasswordViolation{
+			Field:   "password",
+			Rule:    rule,
+			Message: fmt.Sprintf(format, a...),
+		})
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violate("min_length", "password must be at least %d characters", p.MinLength)
+	}
+
+	maxLength := p.MaxLength
+	if maxLength <= 0 || maxLength > maxPasswordBytes {
+		maxLength = maxPasswordBytes
+	}
+	if len(password) > maxLength {
+		violate("max_length", "password must be at most %d bytes", maxLength)
+	}
+
+	if classes := charClasses(password); classes < p.MinCharClasses {
+		violate("char_classes", "password must mix at least %d of lower case, upper case, digits and symbols", p.MinCharClasses)
+	}
+
+	for _, denied := range p.DenyList {
+		if strings.EqualFold(password, denied) {
+			violate("deny_list", "password is too common")
+			break
+		}
+	}
+
+	if username != "" && strings.EqualFold(password, username) {
+		violate("username", "password must not be the username")
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{violations}
+	}
+
+	return nil
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	return lower + upper + digit + symbol
+}
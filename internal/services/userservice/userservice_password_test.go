@@ -0,0 +1,104 @@
+package userservice_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/maetad/baroness-api/internal/services/userservice"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy := userservice.PasswordPolicy{
+		MinLength:      8,
+		MaxLength:      72,
+		MinCharClasses: 3,
+		DenyList:       userservice.DefaultDenyList,
+	}
+
+	type args struct {
+		username string
+		password string
+	}
+	tests := []struct {
+		name      string
+		policy    userservice.PasswordPolicy
+		args      args
+		wantRules []string
+	}{
+		{
+			name:   "valid",
+			policy: policy,
+			args:   args{"admin", "c0rrect-Horse"},
+		},
+		{
+			name:      "too short",
+			policy:    policy,
+			args:      args{"admin", "aB1-"},
+			wantRules: []string{"min_length"},
+		},
+		{
+			name:      "too long",
+			policy:    policy,
+			args:      args{"admin", "aB1-" + strings.Repeat("a", 69)},
+			wantRules: []string{"max_length"},
+		},
+		{
+			name:      "max length is capped by bcrypt",
+			policy:    userservice.PasswordPolicy{MaxLength: 100},
+			args:      args{"admin", strings.Repeat("a", 73)},
+			wantRules: []string{"max_length"},
+		},
+		{
+			name:      "not enough character classes",
+			policy:    policy,
+			args:      args{"admin", "correcthorse"},
+			wantRules: []string{"char_classes"},
+		},
+		{
+			name:      "common password",
+			policy:    policy,
+			args:      args{"admin", "P@ssw0rd"},
+			wantRules: []string{"deny_list"},
+		},
+		{
+			name:      "username",
+			policy:    policy,
+			args:      args{"Adm1n-User", "adm1n-user"},
+			wantRules: []string{"username"},
+		},
+		{
+			name:      "every rule reported",
+			policy:    policy,
+			args:      args{"admin", "admin"},
+			wantRules: []string{"min_length", "char_classes", "deny_list", "username"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.args.username, tt.args.password)
+			if tt.wantRules == nil {
+				if err != nil {
+					t.Errorf("PasswordPolicy.Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var policyErr *userservice.PasswordPolicyError
+			if !errors.As(err, &policyErr) {
+				t.Errorf("PasswordPolicy.Validate() error = %v, want *PasswordPolicyError", err)
+				return
+			}
+
+			rules := make([]string, len(policyErr.Violations))
+			for i, v := range policyErr.Violations {
+				rules[i] = v.Rule
+			}
+
+			if !reflect.DeepEqual(rules, tt.wantRules) {
+				t.Errorf("PasswordPolicy.Validate() rules = %v, want %v", rules, tt.wantRules)
+			}
+		})
+	}
+}
@@ -1,12 +1,66 @@
 package userservice
 
+import "time"
+
 type UserCreateRequest struct {
 	Username    string `json:"username" binding:"required"`
 	Password    string `json:"password" binding:"required"`
 	DisplayName string `json:"display_name" binding:"required"`
+	Email       string `json:"email" binding:"omitempty,email"`
+}
+
+// UserExternalCreateRequest provisions a user who is authenticated by an
+// external identity provider, without a password.
+type UserExternalCreateRequest struct {
+	Username    string
+	DisplayName string
+	Email       string
 }
 
 type UserUpdateRequest struct {
 	Password    string `json:"password"`
 	DisplayName string `json:"display_name" binding:"required"`
+	Email       string `json:"email" binding:"omitempty,email"`
+}
+
+type UserChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+}
+
+// UserListRequest pages through the users, either by offset or by the cursor
+// of the previous page. Sort is a column, descending when prefixed with -.
+type UserListRequest struct {
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Offset int    `form:"offset" binding:"min=0"`
+	Cursor string `form:"cursor" binding:"excluded_with=Offset"`
+	Sort   string `form:"sort" binding:"omitempty,oneof=created_at -created_at username -username display_name -display_name"`
+	// Username matches the users whose username starts with it.
+	Username      string     `form:"username"`
+	CreatedAfter  *time.Time `form:"created_after"`
+	CreatedBefore *time.Time `form:"created_before"`
+	// Deleted lists the deleted users instead.
+	Deleted bool `form:"deleted"`
+}
+
+type UserSearchRequest struct {
+	Query string `form:"q" binding:"required"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type UserDeleteRequest struct {
+	// Purge deletes the user for good rather than so it can be restored.
+	Purge bool `form:"purge"`
+}
+
+// UserImportRequest tells how to import the request body. Format defaults to
+// the Content-Type of the body, and Mode to transaction.
+type UserImportRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=csv ndjson"`
+	DryRun bool   `form:"dry_run"`
+	Mode   string `form:"mode" binding:"omitempty,oneof=transaction best_effort"`
+}
+
+type UserExportRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=csv ndjson"`
 }
@@ -0,0 +1,136 @@
+package userservice
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/maetad/baroness-api/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Search returns at most limit users whose username or display name contains
+// query, the best matches first.
+func (s UserService) Search(query string, limit int) ([]UserInterface, error) {
+	users, err := s.searcher.Search(query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	u := make([]UserInterface, len(users))
+	for i := range users {
+		u[i] = &users[i]
+	}
+
+	return u, nil
+}
+
+// UserSearcherInterface finds the users whose username or display name
+// contains query, the best matches first.
+type UserSearcherInterface interface {
+	Search(query string, limit int) ([]User, error)
+}
+
+type DatabaseUserSearcher struct {
+	db database.DatabaseInterface
+}
+
+func NewDatabaseUserSearcher(db database.DatabaseInterface) UserSearcherInterface {
+	return DatabaseUserSearcher{db}
+}
+
+// Search ranks by trigram similarity, so close spellings match as well. The
+// trigram indexes of the users table serve both the ILIKE and % operators.
+func (s DatabaseUserSearcher) Search(query string, limit int) ([]User, error) {
+	pattern := "%" + escapeLike(query) + "%"
+
+	var users []User
+	result := s.db.Scopes(func(tx *gorm.DB) *gorm.DB {
+		return tx.
+			Where("username ILIKE ? OR display_name ILIKE ? OR username % ? OR display_name % ?", pattern, pattern, query, query).
+			Clauses(clause.OrderBy{Expression: clause.Expr{
+				SQL:  "GREATEST(similarity(username, ?), similarity(display_name, ?)) DESC, id",
+				Vars: []interface{}{query, query},
+			}}).
+			Limit(limit)
+	}).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return users, nil
+}
+
+// MemoryUserSearcher searches the users it is given, for tests which have no
+// database.
+type MemoryUserSearcher struct {
+	mu    sync.RWMutex
+	users []User
+}
+
+func NewMemoryUserSearcher(users ...User) UserSearcherInterface {
+	return &MemoryUserSearcher{users: users}
+}
+
+// Search ranks an exact match above a prefix, and a prefix above any other
+// part of the username or display name.
+func (s *MemoryUserSearcher) Search(query string, limit int) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query = strings.ToLower(query)
+
+	type match struct {
+		user User
+		rank int
+	}
+
+	var matches []match
+	for _, u := range s.users {
+		if u.DeletedAt.Valid {
+			continue
+		}
+
+		rank := memoryRank(strings.ToLower(u.Username), query)
+		if r := memoryRank(strings.ToLower(u.DisplayName), query); r > rank {
+			rank = r
+		}
+
+		if rank > 0 {
+			matches = append(matches, match{u, rank})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank > matches[j].rank
+		}
+
+		return matches[i].user.ID < matches[j].user.ID
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	users := make([]User, len(matches))
+	for i, m := range matches {
+		users[i] = m.user
+	}
+
+	return users, nil
+}
+
+func memoryRank(s string, query string) int {
+	switch {
+	case s == query:
+		return 3
+	case strings.HasPrefix(s, query):
+		return 2
+	case strings.Contains(s, query):
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,117 @@
+package userservice_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/maetad/baroness-api/internal/model"
+	"github.com/maetad/baroness-api/internal/services/userservice"
+	"gorm.io/gorm"
+)
+
+func TestUserService_Search(t *testing.T) {
+	searcher := userservice.NewMemoryUserSearcher(
+		userservice.User{Model: model.Model{ID: 1}, Username: "alice", DisplayName: "Alice Liddell"},
+		userservice.User{Model: model.Model{ID: 2}, Username: "malice", DisplayName: "Mal"},
+		userservice.User{Model: model.Model{ID: 3}, Username: "lid", DisplayName: "Alice"},
+		userservice.User{Model: model.Model{ID: 4}, Username: "bob", DisplayName: "Bob"},
+		userservice.User{Model: model.Model{ID: 5, DeletedAt: gorm.DeletedAt{Valid: true}}, Username: "alice2", DisplayName: "Alice"},
+	)
+
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		want  []uint
+	}{
+		{
+			name:  "exact match first",
+			query: "ALICE",
+			limit: 10,
+			want:  []uint{1, 3, 2},
+		},
+		{
+			name:  "display name",
+			query: "lidd",
+			limit: 10,
+			want:  []uint{1},
+		},
+		{
+			name:  "limited",
+			query: "alice",
+			limit: 2,
+			want:  []uint{1, 3},
+		},
+		{
+			name:  "nothing found",
+			query: "carol",
+			limit: 10,
+			want:  []uint{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := userservice.New(db, searcher, userservice.PasswordPolicy{}, hasher).Search(tt.query, tt.limit)
+			if err != nil {
+				t.Errorf("UserService.Search() error = %v", err)
+				return
+			}
+
+			ids := make([]uint, len(got))
+			for i, u := range got {
+				ids[i] = u.(*userservice.User).ID
+			}
+
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("UserService.Search() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestDatabaseUserSearcher_Search(t *testing.T) {
+	dbErr := errors.New("database error")
+
+	tests := []struct {
+		name        string
+		err         error
+		wantErr     error
+		wantQueries []string
+	}{
+		{
+			name: "ranked by similarity",
+			wantQueries: []string{
+				`SELECT * FROM "users" WHERE (username ILIKE '%a\_b%' OR display_name ILIKE '%a\_b%' OR username % 'a_b' OR display_name % 'a_b') AND "users"."deleted_at" IS NULL ORDER BY GREATEST(similarity(username, 'a_b'), similarity(display_name, 'a_b')) DESC, id LIMIT 5`,
+			},
+		},
+		{
+			name:    "find fail",
+			err:     dbErr,
+			wantErr: dbErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, queries := dryRun(t, []userservice.User{{Username: "a_b"}}, 0, tt.err)
+
+			got, err := userservice.NewDatabaseUserSearcher(db).Search("a_b", 5)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DatabaseUserSearcher.Search() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if len(got) != 1 {
+				t.Errorf("DatabaseUserSearcher.Search() = %v", got)
+			}
+
+			if !reflect.DeepEqual(*queries, tt.wantQueries) {
+				t.Errorf("DatabaseUserSearcher.Search() queries = %v, want %v", *queries, tt.wantQueries)
+			}
+		})
+	}
+}
@@ -3,17 +3,23 @@ package userservice_test
 import (
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/maetad/baroness-api/internal/database"
+	"github.com/maetad/baroness-api/internal/model"
 	"github.com/maetad/baroness-api/internal/services/userservice"
 	"github.com/maetad/baroness-api/mocks"
 	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 var db = &mocks.DatabaseInterface{}
 
+var hasher = userservice.BcryptHasher{Cost: bcrypt.MinCost}
+
 func TestNew(t *testing.T) {
 	tests := []struct {
 		name string
@@ -24,7 +30,7 @@ func TestNew(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := userservice.New(db); reflect.ValueOf(got).Kind() != reflect.ValueOf(userservice.UserService{}).Kind() {
+			if got := userservice.New(db, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, hasher); reflect.ValueOf(got).Kind() != reflect.ValueOf(userservice.UserService{}).Kind() {
 				t.Errorf("New() = %v, want %v", reflect.ValueOf(got).Kind(), reflect.ValueOf(userservice.UserService{}).Kind())
 			}
 		})
@@ -33,23 +39,23 @@ func TestNew(t *testing.T) {
 
 func TestUserService_Create(t *testing.T) {
 	type fields struct {
-		db database.DatabaseInterface
+		dbErr          error
+		passwordPolicy userservice.PasswordPolicy
 	}
 	type args struct {
-		r userservice.UserCreateRequest
+		r          userservice.UserCreateRequest
+		createdErr error
 	}
 	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		want    *userservice.User
-		wantErr bool
+		name        string
+		fields      fields
+		args        args
+		want        *userservice.User
+		wantCreated bool
+		wantErr     bool
 	}{
 		{
 			name: "user created",
-			fields: fields{
-				db: db,
-			},
 			args: args{
 				r: userservice.UserCreateRequest{
 					Username:    "admin",
@@ -62,11 +68,26 @@ func TestUserService_Create(t *testing.T) {
 				Password:    "$2a$10$EIbuP5hbywq0xp183mHeBe0cN6TO00FNK7sAZJGKXWr9V6A2pVLkS",
 				DisplayName: "Administrator",
 			},
+			wantCreated: true,
+		},
+		{
+			name: "password violates policy",
+			fields: fields{
+				passwordPolicy: userservice.PasswordPolicy{MinLength: 12, DenyList: userservice.DefaultDenyList},
+			},
+			args: args{
+				r: userservice.UserCreateRequest{
+					Username:    "admin",
+					Password:    "password",
+					DisplayName: "Administrator",
+				},
+			},
+			wantErr: true,
 		},
 		{
 			name: "user create fail",
 			fields: fields{
-				db: db,
+				dbErr: errors.New("error"),
 			},
 			args: args{
 				r: userservice.UserCreateRequest{
@@ -77,28 +98,39 @@ func TestUserService_Create(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "created fail",
+			args: args{
+				r: userservice.UserCreateRequest{
+					Username:    "admin",
+					Password:    "password",
+					DisplayName: "Administrator",
+				},
+				createdErr: errors.New("error"),
+			},
+			wantCreated: true,
+			wantErr:     true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db.Mock.ExpectedCalls = nil
-			db.On("Create", mock.AnythingOfType("*userservice.User")).
-				Return(&gorm.DB{
-					Error: func() error {
-						if tt.wantErr {
-							return errors.New("error")
-						}
-
-						return nil
-					}(),
-				})
+			db, _ := dryRun(t, nil, 0, tt.fields.dbErr)
 
-			u := userservice.New(tt.fields.db)
-			got, err := u.Create(tt.args.r)
+			var created bool
+			u := userservice.New(db, userservice.NewMemoryUserSearcher(), tt.fields.passwordPolicy, hasher)
+			got, err := u.Create(tt.args.r, func(tx database.DatabaseInterface, user *userservice.User) error {
+				created = true
+				return tt.args.createdErr
+			})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("UserService.Create() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
+			if created != tt.wantCreated {
+				t.Errorf("UserService.Create() created called = %v, want %v", created, tt.wantCreated)
+			}
+
 			if tt.want != nil {
 				user := got.(*userservice.User)
 
@@ -106,8 +138,9 @@ func TestUserService_Create(t *testing.T) {
 					t.Errorf("UserService.Create() password hashed invalid %v", err)
 				}
 
-				// ignore password difference
+				// ignore password and timestamps difference
 				user.Password = ""
+				user.CreatedAt, user.UpdatedAt = time.Time{}, time.Time{}
 				clone := tt.want
 				clone.Password = ""
 
@@ -143,9 +176,7 @@ func TestUserService_GetByUsername(t *testing.T) {
 			args: args{
 				username: "admin",
 			},
-			want: &userservice.User{
-				Username: "admin",
-			},
+			want: &userservice.User{},
 		},
 		{
 			name: "not found",
@@ -161,7 +192,7 @@ func TestUserService_GetByUsername(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			db.Mock.ExpectedCalls = nil
-			db.On("First", mock.AnythingOfType("*userservice.User")).
+			db.On("First", mock.AnythingOfType("*userservice.User"), "username = ?", "admin").
 				Return(&gorm.DB{
 					Error: func() error {
 						if tt.wantErr {
@@ -172,7 +203,7 @@ func TestUserService_GetByUsername(t *testing.T) {
 					}(),
 				})
 
-			u := userservice.New(tt.fields.db)
+			u := userservice.New(tt.fields.db, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, hasher)
 			got, err := u.GetByUsername(tt.args.username)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("UserService.GetByUsername() error = %v, wantErr %v", err, tt.wantErr)
@@ -190,55 +221,21 @@ func TestUserService_GetByUsername(t *testing.T) {
 	}
 }
 
-func TestUserService_List(t *testing.T) {
-	type fields struct {
-		db database.DatabaseInterface
-	}
-	tests := []struct {
-		name    string
-		fields  fields
-		want    []userservice.UserInterface
-		wantErr bool
-	}{
-		{
-			name: "listed success",
-			fields: func() fields {
-				db := &mocks.DatabaseInterface{}
-				db.On("Find", mock.Anything).
-					Return(&gorm.DB{
-						Error: nil,
-					})
+func TestUserService_GetByUsernameQuery(t *testing.T) {
+	dry, queries := dryDB(t, []userservice.User{{Model: model.Model{ID: 2}, Username: "bob"}}, 0, nil)
 
-				return fields{db}
-			}(),
-			want: []userservice.UserInterface{},
-		},
-		{
-			name: "listed fail",
-			fields: func() fields {
-				db := &mocks.DatabaseInterface{}
-				db.On("Find", mock.Anything).
-					Return(&gorm.DB{
-						Error: errors.New("find error"),
-					})
+	got, err := userservice.New(dry, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, hasher).GetByUsername("bob")
+	if err != nil {
+		t.Fatalf("UserService.GetByUsername() error = %v", err)
+	}
 
-				return fields{db}
-			}(),
-			wantErr: true,
-		},
+	if got.(*userservice.User).Username != "bob" {
+		t.Errorf("UserService.GetByUsername() = %v", got)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := userservice.New(tt.fields.db)
-			got, err := s.List()
-			if (err != nil) != tt.wantErr {
-				t.Errorf("UserService.List() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("UserService.List() = %v, want %v", got, tt.want)
-			}
-		})
+
+	want := []string{`SELECT * FROM "users" WHERE username = 'bob' AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT 1`}
+	if !reflect.DeepEqual(*queries, want) {
+		t.Errorf("UserService.GetByUsername() queries = %v, want %v", *queries, want)
 	}
 }
 
@@ -291,7 +288,7 @@ func TestUserService_Get(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := userservice.New(tt.fields.db)
+			s := userservice.New(tt.fields.db, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, hasher)
 			got, err := s.Get(tt.args.id)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("UserService.Get() error = %v, wantErr %v", err, tt.wantErr)
@@ -304,6 +301,47 @@ func TestUserService_Get(t *testing.T) {
 	}
 }
 
+func TestUserService_GetByIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		firstErr error
+		want     userservice.UserInterface
+		wantErr  error
+	}{
+		{
+			name: "identity linked",
+			want: &userservice.User{},
+		},
+		{
+			name:     "identity not linked",
+			firstErr: gorm.ErrRecordNotFound,
+			wantErr:  userservice.ErrIdentityNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mocks.DatabaseInterface{}
+			db.On("First", mock.AnythingOfType("*userservice.Identity"), "issuer = ? AND subject = ?", "https://id.example.com", "248289761001").
+				Run(func(args mock.Arguments) {
+					args.Get(0).(*userservice.Identity).UserID = 3
+				}).
+				Return(&gorm.DB{Error: tt.firstErr})
+			db.On("First", mock.AnythingOfType("*userservice.User"), uint(3)).
+				Return(&gorm.DB{})
+
+			s := userservice.New(db, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, hasher)
+			got, err := s.GetByIdentity("https://id.example.com", "248289761001")
+			if err != tt.wantErr {
+				t.Errorf("UserService.GetByIdentity() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserService.GetByIdentity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestUserService_Update(t *testing.T) {
 	type fields struct {
 		db database.DatabaseInterface
@@ -387,7 +425,7 @@ func TestUserService_Update(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := userservice.New(tt.fields.db)
+			s := userservice.New(tt.fields.db, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, hasher)
 			got, err := s.Update(tt.args.user, tt.args.r)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("UserService.Update() error = %v, wantErr %v", err, tt.wantErr)
@@ -463,10 +501,170 @@ func TestUserService_Delete(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := userservice.New(tt.fields.db)
+			s := userservice.New(tt.fields.db, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, hasher)
 			if err := s.Delete(tt.args.user); (err != nil) != tt.wantErr {
 				t.Errorf("UserService.Delete() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestUserService_ChangePassword(t *testing.T) {
+	type fields struct {
+		db             database.DatabaseInterface
+		passwordPolicy userservice.PasswordPolicy
+	}
+	type args struct {
+		user     userservice.UserInterface
+		password string
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "password changed",
+			fields: func() fields {
+				db := &mocks.DatabaseInterface{}
+				db.On("Save", mock.AnythingOfType("*userservice.User")).
+					Return(&gorm.DB{})
+				return fields{db: db}
+			}(),
+			args: args{
+				user:     &userservice.User{Username: "admin"},
+				password: "n3w-Password",
+			},
+		},
+		{
+			name: "password violates policy",
+			fields: fields{
+				db:             &mocks.DatabaseInterface{},
+				passwordPolicy: userservice.PasswordPolicy{MinLength: 8},
+			},
+			args: args{
+				user:     &userservice.User{Username: "admin"},
+				password: "short",
+			},
+			wantErr: true,
+		},
+		{
+			name: "save fail",
+			fields: func() fields {
+				db := &mocks.DatabaseInterface{}
+				db.On("Save", mock.AnythingOfType("*userservice.User")).
+					Return(&gorm.DB{Error: errors.New("save fail")})
+				return fields{db: db}
+			}(),
+			args: args{
+				user:     &userservice.User{Username: "admin"},
+				password: "n3w-Password",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := userservice.New(tt.fields.db, userservice.NewMemoryUserSearcher(), tt.fields.passwordPolicy, hasher)
+			if err := s.ChangePassword(tt.args.user, tt.args.password); (err != nil) != tt.wantErr {
+				t.Errorf("UserService.ChangePassword() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr {
+				if err := tt.args.user.ValidatePassword(tt.args.password); err != nil {
+					t.Errorf("UserService.ChangePassword() password hashed invalid %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestUserService_GetUnscoped(t *testing.T) {
+	deleted := userservice.User{Model: model.Model{ID: 1, DeletedAt: gorm.DeletedAt{Valid: true}}}
+
+	db, queries := dryRun(t, []userservice.User{deleted}, 0, nil)
+
+	got, err := userservice.New(db, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, hasher).GetUnscoped(1)
+	if err != nil {
+		t.Errorf("UserService.GetUnscoped() error = %v", err)
+		return
+	}
+
+	if got.(*userservice.User).ID != 1 {
+		t.Errorf("UserService.GetUnscoped() = %v", got)
+	}
+
+	want := []string{`SELECT * FROM "users" WHERE "users"."id" = 1 ORDER BY "users"."id" LIMIT 1`}
+	if !reflect.DeepEqual(*queries, want) {
+		t.Errorf("UserService.GetUnscoped() queries = %v, want %v", *queries, want)
+	}
+}
+
+func TestUserService_Restore(t *testing.T) {
+	deletedAt := gorm.DeletedAt{Time: time.Date(2022, 8, 1, 10, 0, 0, 0, time.UTC), Valid: true}
+
+	tests := []struct {
+		name        string
+		user        *userservice.User
+		taken       error
+		wantErr     error
+		wantQueries int
+	}{
+		{
+			name:    "not deleted",
+			user:    &userservice.User{Model: model.Model{ID: 1}, Username: "alice"},
+			wantErr: userservice.ErrUserNotDeleted,
+		},
+		{
+			name:    "username taken",
+			user:    &userservice.User{Model: model.Model{ID: 1, DeletedAt: deletedAt}, Username: "alice"},
+			wantErr: userservice.ErrUsernameTaken,
+		},
+		{
+			name:        "restored",
+			user:        &userservice.User{Model: model.Model{ID: 1, DeletedAt: deletedAt}, Username: "alice"},
+			taken:       gorm.ErrRecordNotFound,
+			wantQueries: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, queries := dryRun(t, nil, 0, nil)
+			db.On("First", mock.AnythingOfType("*userservice.User"), "username = ?", "alice").
+				Return(&gorm.DB{Error: tt.taken})
+
+			err := userservice.New(db, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, hasher).Restore(tt.user)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UserService.Restore() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if len(*queries) != tt.wantQueries {
+				t.Errorf("UserService.Restore() queries = %v", *queries)
+				return
+			}
+
+			// the update must not be limited to users which are not deleted
+			if tt.wantQueries > 0 && (tt.user.DeletedAt.Valid || !strings.Contains((*queries)[0], `"deleted_at"=NULL`) ||
+				!strings.HasSuffix((*queries)[0], `WHERE "id" = 1`)) {
+				t.Errorf("UserService.Restore() queries = %v", *queries)
+			}
+		})
+	}
+}
+
+func TestUserService_Purge(t *testing.T) {
+	db, queries := dryRun(t, nil, 0, nil)
+
+	if err := userservice.New(db, userservice.NewMemoryUserSearcher(), userservice.PasswordPolicy{}, hasher).Purge(&userservice.User{Model: model.Model{ID: 1}}); err != nil {
+		t.Errorf("UserService.Purge() error = %v", err)
+		return
+	}
+
+	want := []string{`DELETE FROM "users" WHERE "users"."id" = 1`}
+	if !reflect.DeepEqual(*queries, want) {
+		t.Errorf("UserService.Purge() queries = %v, want %v", *queries, want)
+	}
+}
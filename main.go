@@ -15,6 +15,7 @@ import (
 	"github.com/maetad/baroness-api/internal"
 	"github.com/maetad/baroness-api/internal/config"
 	"github.com/maetad/baroness-api/internal/services/authservice"
+	"github.com/maetad/baroness-api/internal/services/userservice"
 	"github.com/sirupsen/logrus"
 )
 
@@ -37,12 +38,48 @@ func main() {
 		}
 	}()
 
+	go reloadOnSignal(svc)
+
 	shutdownOnSignal(svc)
 
 	svc.Close()
 }
 
 func init() {
+	signingMethod := func() jwt.SigningMethod {
+		method := os.Getenv("JWT_SIGNING_METHOD")
+		switch method {
+		case "HS256":
+			return jwt.SigningMethodHS256
+		case "HS384":
+			return jwt.SigningMethodHS384
+		case "HS512":
+			return jwt.SigningMethodHS512
+		case "RS256":
+			return jwt.SigningMethodRS256
+		case "RS384":
+			return jwt.SigningMethodRS384
+		case "RS512":
+			return jwt.SigningMethodRS512
+		case "ES256":
+			return jwt.SigningMethodES256
+		case "ES384":
+			return jwt.SigningMethodES384
+		case "ES512":
+			return jwt.SigningMethodES512
+		case "PS256":
+			return jwt.SigningMethodPS256
+		case "PS384":
+			return jwt.SigningMethodPS384
+		case "PS512":
+			return jwt.SigningMethodPS512
+		case "EdDSA":
+			return jwt.SigningMethodEdDSA
+		default:
+			panic(fmt.Sprintf("JWT signing method %s is not allow", method))
+		}
+	}()
+
 	options = config.Options{
 		AppName:           os.Getenv("APP_NAME"),
 		ListenAddressHTTP: os.Getenv("LISTEN_ADDRESS_HTTP"),
@@ -65,38 +102,23 @@ func init() {
 			return "disable"
 		}(),
 		DatabaseTimezone: os.Getenv("DATABASE_TIMEZONE"),
-		JWTSigningMethod: func() jwt.SigningMethod {
-			method := os.Getenv("JWT_SIGNING_METHOD")
-			switch method {
-			case "HS256":
-				return jwt.SigningMethodHS256
-			case "HS384":
-				return jwt.SigningMethodHS384
-			case "HS512":
-				return jwt.SigningMethodHS512
-			case "RS256":
-				return jwt.SigningMethodRS256
-			case "RS384":
-				return jwt.SigningMethodRS384
-			case "RS512":
-				return jwt.SigningMethodRS512
-			case "ES256":
-				return jwt.SigningMethodES256
-			case "ES384":
-				return jwt.SigningMethodES384
-			case "ES512":
-				return jwt.SigningMethodES512
-			case "PS256":
-				return jwt.SigningMethodPS256
-			case "PS384":
-				return jwt.SigningMethodPS384
-			case "PS512":
-				return jwt.SigningMethodPS512
-			default:
-				panic(fmt.Sprintf("JWT signing method %s is not allow", method))
+		JWTSigningMethod: signingMethod,
+		JWTSigningKey: func() interface{} {
+			key, err := loadSigningKey(signingMethod)
+			if err != nil {
+				panic(fmt.Sprintf("JWT signing key is invalid: %v", err))
+			}
+
+			return key
+		}(),
+		JWTVerifyKey: func() interface{} {
+			key, err := loadVerifyKey(signingMethod)
+			if err != nil {
+				panic(fmt.Sprintf("JWT verify key is invalid: %v", err))
 			}
+
+			return key
 		}(),
-		JWTSigningKey: []byte(os.Getenv("JWT_SIGNING_KEY")),
 		JWTAllowMethod: func() authservice.AllowSigningMethod {
 			allow := authservice.AllowSigningMethod{}
 			for _, a := range strings.Split(os.Getenv("JWT_ALLOW_METHOD"), ",") {
@@ -105,6 +127,20 @@ func init() {
 			}
 			return allow
 		}(),
+		JWTAudience: func() []string {
+			audience := []string{}
+			for _, a := range strings.Split(os.Getenv("JWT_AUDIENCE"), ",") {
+				if a = strings.TrimSpace(a); a != "" {
+					audience = append(audience, a)
+				}
+			}
+
+			if len(audience) == 0 && os.Getenv("APP_NAME") != "" {
+				audience = append(audience, os.Getenv("APP_NAME"))
+			}
+
+			return audience
+		}(),
 		JWTExpiredIn: func() time.Duration {
 			var (
 				t   int
@@ -117,11 +153,405 @@ func init() {
 
 			return time.Duration(t * int(time.Second))
 		}(),
+		JWTRefreshExpiredIn: func() time.Duration {
+			var (
+				t   int
+				err error
+			)
+
+			if t, err = strconv.Atoi(os.Getenv("JWT_REFRESH_EXPIRED_IN")); err != nil {
+				t = 604800
+			}
+
+			return time.Duration(t * int(time.Second))
+		}(),
+		LoginMaxAttempts: func() int {
+			i, err := strconv.Atoi(os.Getenv("LOGIN_MAX_ATTEMPTS"))
+			if err != nil {
+				return 5
+			}
+
+			return i
+		}(),
+		LoginIPMaxAttempts: func() int {
+			i, err := strconv.Atoi(os.Getenv("LOGIN_IP_MAX_ATTEMPTS"))
+			if err != nil {
+				return 50
+			}
+
+			return i
+		}(),
+		LoginBackoff: func() time.Duration {
+			var (
+				t   int
+				err error
+			)
+
+			if t, err = strconv.Atoi(os.Getenv("LOGIN_BACKOFF")); err != nil {
+				t = 1
+			}
+
+			return time.Duration(t * int(time.Second))
+		}(),
+		LoginLockoutDuration: func() time.Duration {
+			var (
+				t   int
+				err error
+			)
+
+			if t, err = strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_DURATION")); err != nil {
+				t = 900
+			}
+
+			return time.Duration(t * int(time.Second))
+		}(),
+		TrustedProxies: func() []string {
+			var proxies []string
+			for _, a := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+				if a = strings.TrimSpace(a); a != "" {
+					proxies = append(proxies, a)
+				}
+			}
+
+			return proxies
+		}(),
+		MFAPendingExpiredIn: func() time.Duration {
+			var (
+				t   int
+				err error
+			)
+
+			if t, err = strconv.Atoi(os.Getenv("MFA_PENDING_EXPIRED_IN")); err != nil {
+				t = 300
+			}
+
+			return time.Duration(t * int(time.Second))
+		}(),
+		AuthCookie: func() bool {
+			b, err := strconv.ParseBool(os.Getenv("AUTH_COOKIE"))
+			if err != nil {
+				return false
+			}
+
+			return b
+		}(),
+		AuthCookieDomain: os.Getenv("AUTH_COOKIE_DOMAIN"),
+		AuthCookieSecure: func() bool {
+			b, err := strconv.ParseBool(os.Getenv("AUTH_COOKIE_SECURE"))
+			if err != nil {
+				return true
+			}
+
+			return b
+		}(),
+		AuthCookieSameSite: func() http.SameSite {
+			switch strings.ToLower(os.Getenv("AUTH_COOKIE_SAME_SITE")) {
+			case "lax":
+				return http.SameSiteLaxMode
+			case "none":
+				return http.SameSiteNoneMode
+			}
+
+			return http.SameSiteStrictMode
+		}(),
+		SessionTouchInterval: func() time.Duration {
+			var (
+				t   int
+				err error
+			)
+
+			if t, err = strconv.Atoi(os.Getenv("SESSION_TOUCH_INTERVAL")); err != nil {
+				t = 60
+			}
+
+			return time.Duration(t * int(time.Second))
+		}(),
+		ImpersonationExpiredIn: func() time.Duration {
+			var (
+				t   int
+				err error
+			)
+
+			if t, err = strconv.Atoi(os.Getenv("IMPERSONATION_EXPIRED_IN")); err != nil {
+				t = 900
+			}
+
+			return time.Duration(t * int(time.Second))
+		}(),
+		PasswordPolicy: func() userservice.PasswordPolicy {
+			policy := userservice.PasswordPolicy{
+				MinLength:      8,
+				MaxLength:      72,
+				MinCharClasses: 1,
+				DenyList:       userservice.DefaultDenyList,
+			}
+
+			if i, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil {
+				policy.MinLength = i
+			}
+
+			if i, err := strconv.Atoi(os.Getenv("PASSWORD_MAX_LENGTH")); err == nil {
+				policy.MaxLength = i
+			}
+
+			if i, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_CHAR_CLASSES")); err == nil {
+				policy.MinCharClasses = i
+			}
+
+			// one password per line, added to the built-in list
+			if path := os.Getenv("PASSWORD_DENY_LIST_FILE"); path != "" {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					panic(fmt.Sprintf("password deny list is invalid: %v", err))
+				}
+
+				for _, line := range strings.Split(string(data), "\n") {
+					if line = strings.TrimSpace(line); line != "" {
+						policy.DenyList = append(policy.DenyList, line)
+					}
+				}
+			}
+
+			return policy
+		}(),
+		PasswordHasher: func() userservice.PasswordHasher {
+			uintEnv := func(name string, fallback uint64, bits int) uint64 {
+				i, err := strconv.ParseUint(os.Getenv(name), 10, bits)
+				if err != nil {
+					return fallback
+				}
+
+				return i
+			}
+
+			switch algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM"); algorithm {
+			case "", "bcrypt":
+				cost, err := strconv.Atoi(os.Getenv("PASSWORD_BCRYPT_COST"))
+				if err != nil {
+					cost = 10
+				}
+
+				return userservice.BcryptHasher{Cost: cost}
+			case "argon2id":
+				return userservice.Argon2idHasher{
+					Memory:      uint32(uintEnv("PASSWORD_ARGON2_MEMORY", 65536, 32)),
+					Iterations:  uint32(uintEnv("PASSWORD_ARGON2_ITERATIONS", 3, 32)),
+					Parallelism: uint8(uintEnv("PASSWORD_ARGON2_PARALLELISM", 2, 8)),
+					SaltLength:  16,
+					KeyLength:   32,
+				}
+			default:
+				panic(fmt.Sprintf("password hash algorithm %s is not allow", algorithm))
+			}
+		}(),
+		MePasswordUpdate: func() bool {
+			b, err := strconv.ParseBool(os.Getenv("ME_PASSWORD_UPDATE"))
+			if err != nil {
+				return true
+			}
+
+			return b
+		}(),
+		PasswordResetExpiredIn: func() time.Duration {
+			var (
+				t   int
+				err error
+			)
+
+			if t, err = strconv.Atoi(os.Getenv("PASSWORD_RESET_EXPIRED_IN")); err != nil {
+				t = 3600
+			}
+
+			return time.Duration(t * int(time.Second))
+		}(),
+		PasswordResetURL: os.Getenv("PASSWORD_RESET_URL"),
+		MailDriver:       os.Getenv("MAIL_DRIVER"),
+		MailFrom:         os.Getenv("MAIL_FROM"),
+		MailFile:         os.Getenv("MAIL_FILE"),
+		SMTPHost:         os.Getenv("SMTP_HOST"),
+		SMTPPort: func() int {
+			i, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+			if err != nil {
+				return 587
+			}
+
+			return i
+		}(),
+		SMTPUsername:   os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:   os.Getenv("SMTP_PASSWORD"),
+		OAuthIssuerURL: strings.TrimSuffix(os.Getenv("OAUTH_ISSUER_URL"), "/"),
+		OAuthAuthorizeURL: func() string {
+			if u := os.Getenv("OAUTH_AUTHORIZE_URL"); u != "" {
+				return u
+			}
+
+			return strings.TrimSuffix(os.Getenv("OAUTH_ISSUER_URL"), "/") + "/oauth/authorize"
+		}(),
+		OAuthCodeExpiredIn: func() time.Duration {
+			var (
+				t   int
+				err error
+			)
+
+			if t, err = strconv.Atoi(os.Getenv("OAUTH_CODE_EXPIRED_IN")); err != nil {
+				t = 60
+			}
+
+			return time.Duration(t * int(time.Second))
+		}(),
+		OAuthIDTokenExpiredIn: func() time.Duration {
+			var (
+				t   int
+				err error
+			)
+
+			if t, err = strconv.Atoi(os.Getenv("OAUTH_ID_TOKEN_EXPIRED_IN")); err != nil {
+				t = 300
+			}
+
+			return time.Duration(t * int(time.Second))
+		}(),
+		OIDCIssuerURL:    os.Getenv("OIDC_ISSUER_URL"),
+		OIDCClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		OIDCScopes: func() []string {
+			if scopes := strings.Fields(os.Getenv("OIDC_SCOPES")); len(scopes) > 0 {
+				return scopes
+			}
+
+			return []string{"openid", "profile", "email"}
+		}(),
+		OIDCStateExpiredIn: func() time.Duration {
+			var (
+				t   int
+				err error
+			)
+
+			if t, err = strconv.Atoi(os.Getenv("OIDC_STATE_EXPIRED_IN")); err != nil {
+				t = 600
+			}
+
+			return time.Duration(t * int(time.Second))
+		}(),
+		OIDCLinkByEmail: func() bool {
+			b, err := strconv.ParseBool(os.Getenv("OIDC_LINK_BY_EMAIL"))
+			if err != nil {
+				return false
+			}
+
+			return b
+		}(),
+		LoginAuthenticators: func() []string {
+			var authenticators []string
+			for _, a := range strings.Split(os.Getenv("LOGIN_AUTHENTICATORS"), ",") {
+				if a = strings.TrimSpace(a); a != "" {
+					authenticators = append(authenticators, a)
+				}
+			}
+
+			if len(authenticators) == 0 {
+				return []string{"local"}
+			}
+
+			return authenticators
+		}(),
+		LDAPURL: os.Getenv("LDAP_URL"),
+		LDAPStartTLS: func() bool {
+			b, err := strconv.ParseBool(os.Getenv("LDAP_START_TLS"))
+			if err != nil {
+				return false
+			}
+
+			return b
+		}(),
+		LDAPBindDN:       os.Getenv("LDAP_BIND_DN"),
+		LDAPBindPassword: os.Getenv("LDAP_BIND_PASSWORD"),
+		LDAPBaseDN:       os.Getenv("LDAP_BASE_DN"),
+		LDAPUserFilter: func() string {
+			if a := os.Getenv("LDAP_USER_FILTER"); a != "" {
+				return a
+			}
+
+			return "(uid=%s)"
+		}(),
+		LDAPUsernameAttribute: func() string {
+			if a := os.Getenv("LDAP_USERNAME_ATTRIBUTE"); a != "" {
+				return a
+			}
+
+			return "uid"
+		}(),
+		LDAPDisplayNameAttribute: func() string {
+			if a := os.Getenv("LDAP_DISPLAY_NAME_ATTRIBUTE"); a != "" {
+				return a
+			}
+
+			return "cn"
+		}(),
+		LDAPEmailAttribute: func() string {
+			if a := os.Getenv("LDAP_EMAIL_ATTRIBUTE"); a != "" {
+				return a
+			}
+
+			return "mail"
+		}(),
 	}
 
 	log = logrus.WithField("app_name", options.AppName)
 }
 
+// readKey reads key material from the file named by <name>_FILE, falling back
+// to the value of the <name> variable itself.
+func readKey(name string) ([]byte, error) {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		return os.ReadFile(path)
+	}
+
+	return []byte(os.Getenv(name)), nil
+}
+
+func loadSigningKey(method jwt.SigningMethod) (interface{}, error) {
+	data, err := readKey("JWT_SIGNING_KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	return authservice.ParseSigningKey(method, data)
+}
+
+func loadVerifyKey(method jwt.SigningMethod) (interface{}, error) {
+	data, err := readKey("JWT_VERIFY_KEY")
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+
+	return authservice.ParseVerifyKey(method, data)
+}
+
+// reloadOnSignal rotates to the signing key currently on disk every time the
+// process receives SIGHUP.
+func reloadOnSignal(svc *internal.Service) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	for range c {
+		signingKey, err := loadSigningKey(options.JWTSigningMethod)
+		if err != nil {
+			log.WithError(err).Error("reloadOnSignal(): loadSigningKey")
+			continue
+		}
+
+		verifyKey, err := loadVerifyKey(options.JWTSigningMethod)
+		if err != nil {
+			log.WithError(err).Error("reloadOnSignal(): loadVerifyKey")
+			continue
+		}
+
+		svc.RotateSigningKey(authservice.NewSigningKey(options.JWTSigningMethod, signingKey, verifyKey))
+	}
+}
+
 func waitForShutdownSignal() string {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS "public"."refresh_tokens";
+CREATE TABLE IF NOT EXISTS "public"."refresh_tokens" (
+  "id" serial NOT NULL,
+  PRIMARY KEY ("id"),
+  "user_id" integer NOT NULL REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  "family" text NOT NULL,
+  "token_hash" text NOT NULL,
+  "expires_at" timestamp NOT NULL,
+  "used_at" timestamp NULL,
+  "revoked_at" timestamp NULL,
+  "created_at" timestamp NOT NULL DEFAULT current_timestamp,
+  "updated_at" timestamp NOT NULL DEFAULT current_timestamp,
+  "deleted_at" timestamp NULL
+);
+
+ALTER TABLE "public"."refresh_tokens" ADD CONSTRAINT "refresh_tokens_token_hash" UNIQUE ("token_hash");
+CREATE INDEX "refresh_tokens_family" ON "public"."refresh_tokens" ("family");
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "public"."user_revocations";
+DROP TABLE IF EXISTS "public"."revoked_tokens";
@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS "public"."revoked_tokens";
+CREATE TABLE IF NOT EXISTS "public"."revoked_tokens" (
+  "jti" text NOT NULL,
+  PRIMARY KEY ("jti"),
+  "expires_at" timestamp NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT current_timestamp
+);
+
+CREATE INDEX "revoked_tokens_expires_at" ON "public"."revoked_tokens" ("expires_at");
+
+DROP TABLE IF EXISTS "public"."user_revocations";
+CREATE TABLE IF NOT EXISTS "public"."user_revocations" (
+  "user_id" integer NOT NULL REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  PRIMARY KEY ("user_id"),
+  "revoked_at" timestamp NOT NULL
+);
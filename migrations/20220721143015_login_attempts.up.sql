@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS "public"."login_attempts";
+CREATE TABLE IF NOT EXISTS "public"."login_attempts" (
+  "key" text NOT NULL,
+  PRIMARY KEY ("key"),
+  "failures" integer NOT NULL DEFAULT 0,
+  "last_failed_at" timestamp NOT NULL,
+  "locked_until" timestamp NULL
+);
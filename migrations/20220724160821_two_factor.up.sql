@@ -0,0 +1,16 @@
+ALTER TABLE "public"."users"
+  ADD COLUMN IF NOT EXISTS "totp_secret" text NULL,
+  ADD COLUMN IF NOT EXISTS "totp_enabled" boolean NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS "totp_last_step" bigint NOT NULL DEFAULT 0;
+
+DROP TABLE IF EXISTS "public"."recovery_codes";
+CREATE TABLE IF NOT EXISTS "public"."recovery_codes" (
+  "id" serial NOT NULL,
+  PRIMARY KEY ("id"),
+  "user_id" integer NOT NULL REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  "code_hash" text NOT NULL,
+  "used_at" timestamp NULL,
+  "created_at" timestamp NOT NULL DEFAULT current_timestamp
+);
+
+CREATE INDEX "recovery_codes_user_id" ON "public"."recovery_codes" ("user_id");
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "public"."password_resets";
+
+ALTER TABLE "public"."users"
+  DROP COLUMN IF EXISTS "email";
@@ -0,0 +1,15 @@
+ALTER TABLE "public"."users"
+  ADD COLUMN IF NOT EXISTS "email" text NULL;
+
+DROP TABLE IF EXISTS "public"."password_resets";
+CREATE TABLE IF NOT EXISTS "public"."password_resets" (
+  "id" serial NOT NULL,
+  PRIMARY KEY ("id"),
+  "user_id" integer NOT NULL REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  "token_hash" text NOT NULL,
+  "expires_at" timestamp NOT NULL,
+  "used_at" timestamp NULL,
+  "created_at" timestamp NOT NULL DEFAULT current_timestamp
+);
+
+ALTER TABLE "public"."password_resets" ADD CONSTRAINT "password_resets_token_hash" UNIQUE ("token_hash");
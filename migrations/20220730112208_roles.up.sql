@@ -0,0 +1,58 @@
+DROP TABLE IF EXISTS "public"."roles";
+CREATE TABLE IF NOT EXISTS "public"."roles" (
+  "id" serial NOT NULL,
+  PRIMARY KEY ("id"),
+  "name" text NOT NULL,
+  "description" text NOT NULL DEFAULT '',
+  "created_at" timestamp NOT NULL DEFAULT current_timestamp,
+  "updated_at" timestamp NOT NULL DEFAULT current_timestamp
+);
+
+ALTER TABLE "public"."roles" ADD CONSTRAINT "roles_name" UNIQUE ("name");
+
+DROP TABLE IF EXISTS "public"."permissions";
+CREATE TABLE IF NOT EXISTS "public"."permissions" (
+  "id" serial NOT NULL,
+  PRIMARY KEY ("id"),
+  "name" text NOT NULL,
+  "description" text NOT NULL DEFAULT ''
+);
+
+ALTER TABLE "public"."permissions" ADD CONSTRAINT "permissions_name" UNIQUE ("name");
+
+DROP TABLE IF EXISTS "public"."role_permissions";
+CREATE TABLE IF NOT EXISTS "public"."role_permissions" (
+  "role_id" integer NOT NULL REFERENCES "public"."roles" ("id") ON DELETE CASCADE,
+  "permission_id" integer NOT NULL REFERENCES "public"."permissions" ("id") ON DELETE CASCADE,
+  PRIMARY KEY ("role_id", "permission_id")
+);
+
+DROP TABLE IF EXISTS "public"."user_roles";
+CREATE TABLE IF NOT EXISTS "public"."user_roles" (
+  "user_id" integer NOT NULL REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  "role_id" integer NOT NULL REFERENCES "public"."roles" ("id") ON DELETE CASCADE,
+  PRIMARY KEY ("user_id", "role_id")
+);
+
+INSERT INTO "public"."roles" ("name", "description")
+VALUES
+('admin', 'Manages every account'),
+('user', 'Manages their own account');
+
+INSERT INTO "public"."permissions" ("name", "description")
+VALUES
+('users.read', 'List and view users'),
+('users.create', 'Create users'),
+('users.update', 'Update users, including their password'),
+('users.delete', 'Delete users'),
+('users.security', 'Revoke sessions, unlock accounts and reset two-factor authentication');
+
+INSERT INTO "public"."role_permissions" ("role_id", "permission_id")
+SELECT "roles"."id", "permissions"."id"
+FROM "public"."roles", "public"."permissions"
+WHERE "roles"."name" = 'admin';
+
+INSERT INTO "public"."user_roles" ("user_id", "role_id")
+SELECT "users"."id", "roles"."id"
+FROM "public"."users", "public"."roles"
+WHERE "roles"."name" = CASE WHEN "users"."username" = 'admin' THEN 'admin' ELSE 'user' END;
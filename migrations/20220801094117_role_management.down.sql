@@ -0,0 +1,2 @@
+DELETE FROM "public"."permissions"
+WHERE "name" IN ('users.roles', 'roles.read', 'roles.create', 'roles.update', 'roles.delete');
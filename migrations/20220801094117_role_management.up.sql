@@ -0,0 +1,13 @@
+INSERT INTO "public"."permissions" ("name", "description")
+VALUES
+('users.roles', 'Assign roles to users'),
+('roles.read', 'List and view roles'),
+('roles.create', 'Create roles'),
+('roles.update', 'Update roles and the permissions they grant'),
+('roles.delete', 'Delete roles');
+
+INSERT INTO "public"."role_permissions" ("role_id", "permission_id")
+SELECT "roles"."id", "permissions"."id"
+FROM "public"."roles", "public"."permissions"
+WHERE "roles"."name" = 'admin'
+AND "permissions"."name" IN ('users.roles', 'roles.read', 'roles.create', 'roles.update', 'roles.delete');
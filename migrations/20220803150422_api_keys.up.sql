@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS "public"."api_keys";
+CREATE TABLE IF NOT EXISTS "public"."api_keys" (
+  "id" serial NOT NULL,
+  PRIMARY KEY ("id"),
+  "user_id" integer NOT NULL REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  "name" text NOT NULL,
+  "prefix" text NOT NULL,
+  "key_hash" text NOT NULL,
+  "scopes" text NOT NULL DEFAULT '[]',
+  "expires_at" timestamp NULL,
+  "last_used_at" timestamp NULL,
+  "created_at" timestamp NOT NULL DEFAULT current_timestamp
+);
+
+ALTER TABLE "public"."api_keys" ADD CONSTRAINT "api_keys_prefix" UNIQUE ("prefix");
@@ -0,0 +1,5 @@
+DELETE FROM "public"."permissions" WHERE "name" = 'oauth.clients';
+
+DROP TABLE IF EXISTS "public"."consents";
+DROP TABLE IF EXISTS "public"."authorization_codes";
+DROP TABLE IF EXISTS "public"."clients";
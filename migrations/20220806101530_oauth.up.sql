@@ -0,0 +1,51 @@
+DROP TABLE IF EXISTS "public"."clients";
+CREATE TABLE IF NOT EXISTS "public"."clients" (
+  "id" serial NOT NULL,
+  PRIMARY KEY ("id"),
+  "client_id" text NOT NULL,
+  "secret_hash" text NOT NULL DEFAULT '',
+  "name" text NOT NULL,
+  "redirect_uris" text NOT NULL DEFAULT '[]',
+  "first_party" boolean NOT NULL DEFAULT false,
+  "created_at" timestamp NOT NULL DEFAULT current_timestamp,
+  "updated_at" timestamp NOT NULL DEFAULT current_timestamp
+);
+
+ALTER TABLE "public"."clients" ADD CONSTRAINT "clients_client_id" UNIQUE ("client_id");
+
+DROP TABLE IF EXISTS "public"."authorization_codes";
+CREATE TABLE IF NOT EXISTS "public"."authorization_codes" (
+  "id" serial NOT NULL,
+  PRIMARY KEY ("id"),
+  "code_hash" text NOT NULL,
+  "client_id" integer NOT NULL REFERENCES "public"."clients" ("id") ON DELETE CASCADE,
+  "user_id" integer NOT NULL REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  "redirect_uri" text NOT NULL,
+  "scope" text NOT NULL DEFAULT '',
+  "nonce" text NOT NULL DEFAULT '',
+  "code_challenge" text NOT NULL,
+  "expires_at" timestamp NOT NULL,
+  "used_at" timestamp NULL,
+  "created_at" timestamp NOT NULL DEFAULT current_timestamp
+);
+
+ALTER TABLE "public"."authorization_codes" ADD CONSTRAINT "authorization_codes_code_hash" UNIQUE ("code_hash");
+
+DROP TABLE IF EXISTS "public"."consents";
+CREATE TABLE IF NOT EXISTS "public"."consents" (
+  "user_id" integer NOT NULL REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  "client_id" integer NOT NULL REFERENCES "public"."clients" ("id") ON DELETE CASCADE,
+  PRIMARY KEY ("user_id", "client_id"),
+  "scope" text NOT NULL DEFAULT '',
+  "created_at" timestamp NOT NULL DEFAULT current_timestamp,
+  "updated_at" timestamp NOT NULL DEFAULT current_timestamp
+);
+
+INSERT INTO "public"."permissions" ("name", "description")
+VALUES ('oauth.clients', 'Register and remove OAuth clients');
+
+INSERT INTO "public"."role_permissions" ("role_id", "permission_id")
+SELECT "roles"."id", "permissions"."id"
+FROM "public"."roles", "public"."permissions"
+WHERE "roles"."name" = 'admin'
+AND "permissions"."name" = 'oauth.clients';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "public"."identities";
+DROP TABLE IF EXISTS "public"."login_states";
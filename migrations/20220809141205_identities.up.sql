@@ -0,0 +1,24 @@
+DROP TABLE IF EXISTS "public"."login_states";
+CREATE TABLE IF NOT EXISTS "public"."login_states" (
+  "id" serial NOT NULL,
+  PRIMARY KEY ("id"),
+  "state_hash" text NOT NULL,
+  "nonce" text NOT NULL,
+  "code_verifier" text NOT NULL,
+  "expires_at" timestamp NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT current_timestamp
+);
+
+ALTER TABLE "public"."login_states" ADD CONSTRAINT "login_states_state_hash" UNIQUE ("state_hash");
+
+DROP TABLE IF EXISTS "public"."identities";
+CREATE TABLE IF NOT EXISTS "public"."identities" (
+  "id" serial NOT NULL,
+  PRIMARY KEY ("id"),
+  "user_id" integer NOT NULL REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  "issuer" text NOT NULL,
+  "subject" text NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT current_timestamp
+);
+
+ALTER TABLE "public"."identities" ADD CONSTRAINT "identities_issuer_subject" UNIQUE ("issuer", "subject");
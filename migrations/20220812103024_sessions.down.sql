@@ -0,0 +1,2 @@
+ALTER TABLE "public"."refresh_tokens" DROP COLUMN IF EXISTS "session_id";
+DROP TABLE IF EXISTS "public"."sessions";
@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS "public"."sessions";
+CREATE TABLE IF NOT EXISTS "public"."sessions" (
+  "id" serial NOT NULL,
+  PRIMARY KEY ("id"),
+  "user_id" integer NOT NULL REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  "ip" text NOT NULL,
+  "user_agent" text NOT NULL,
+  "last_seen_at" timestamp NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT current_timestamp
+);
+
+CREATE INDEX "sessions_user_id" ON "public"."sessions" ("user_id");
+
+ALTER TABLE "public"."refresh_tokens" ADD COLUMN "session_id" integer NULL REFERENCES "public"."sessions" ("id") ON DELETE SET NULL;
+CREATE INDEX "refresh_tokens_session_id" ON "public"."refresh_tokens" ("session_id");
@@ -0,0 +1,3 @@
+DELETE FROM "public"."permissions" WHERE "name" = 'users.impersonate';
+
+DROP TABLE IF EXISTS "public"."impersonations";
@@ -0,0 +1,23 @@
+DROP TABLE IF EXISTS "public"."impersonations";
+CREATE TABLE IF NOT EXISTS "public"."impersonations" (
+  "id" serial NOT NULL,
+  PRIMARY KEY ("id"),
+  "actor_id" integer NOT NULL REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  "user_id" integer NOT NULL REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  "ip" text NOT NULL,
+  "user_agent" text NOT NULL,
+  "expires_at" timestamp NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT current_timestamp
+);
+
+CREATE INDEX "impersonations_actor_id" ON "public"."impersonations" ("actor_id");
+CREATE INDEX "impersonations_user_id" ON "public"."impersonations" ("user_id");
+
+INSERT INTO "public"."permissions" ("name", "description")
+VALUES ('users.impersonate', 'Act as another user');
+
+INSERT INTO "public"."role_permissions" ("role_id", "permission_id")
+SELECT "roles"."id", "permissions"."id"
+FROM "public"."roles", "public"."permissions"
+WHERE "roles"."name" = 'admin'
+AND "permissions"."name" = 'users.impersonate';
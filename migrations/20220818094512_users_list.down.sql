@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS "public"."users_username_prefix";
+DROP INDEX IF EXISTS "public"."users_display_name";
+DROP INDEX IF EXISTS "public"."users_created_at";
@@ -0,0 +1,3 @@
+CREATE INDEX "users_created_at" ON "public"."users" ("created_at", "id");
+CREATE INDEX "users_display_name" ON "public"."users" ("display_name", "id");
+CREATE INDEX "users_username_prefix" ON "public"."users" ("username" text_pattern_ops);
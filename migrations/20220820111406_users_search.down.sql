@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "public"."users_display_name_trgm";
+DROP INDEX IF EXISTS "public"."users_username_trgm";
@@ -0,0 +1,4 @@
+CREATE EXTENSION IF NOT EXISTS "pg_trgm";
+
+CREATE INDEX "users_username_trgm" ON "public"."users" USING gin ("username" gin_trgm_ops);
+CREATE INDEX "users_display_name_trgm" ON "public"."users" USING gin ("display_name" gin_trgm_ops);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS "public"."users_username";
+
+ALTER TABLE "public"."users" ADD CONSTRAINT "users_username" UNIQUE ("username");
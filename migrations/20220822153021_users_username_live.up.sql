@@ -0,0 +1,3 @@
+ALTER TABLE "public"."users" DROP CONSTRAINT IF EXISTS "users_username";
+
+CREATE UNIQUE INDEX "users_username" ON "public"."users" ("username") WHERE "deleted_at" IS NULL;
@@ -0,0 +1,9 @@
+DELETE FROM "public"."impersonations" WHERE "actor_id" IS NULL OR "user_id" IS NULL;
+
+ALTER TABLE "public"."impersonations"
+  DROP CONSTRAINT IF EXISTS "impersonations_actor_id_fkey",
+  DROP CONSTRAINT IF EXISTS "impersonations_user_id_fkey",
+  ALTER COLUMN "actor_id" SET NOT NULL,
+  ALTER COLUMN "user_id" SET NOT NULL,
+  ADD CONSTRAINT "impersonations_actor_id_fkey" FOREIGN KEY ("actor_id") REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  ADD CONSTRAINT "impersonations_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "public"."users" ("id") ON DELETE CASCADE;
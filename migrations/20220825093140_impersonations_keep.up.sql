@@ -0,0 +1,7 @@
+ALTER TABLE "public"."impersonations"
+  DROP CONSTRAINT IF EXISTS "impersonations_actor_id_fkey",
+  DROP CONSTRAINT IF EXISTS "impersonations_user_id_fkey",
+  ALTER COLUMN "actor_id" DROP NOT NULL,
+  ALTER COLUMN "user_id" DROP NOT NULL,
+  ADD CONSTRAINT "impersonations_actor_id_fkey" FOREIGN KEY ("actor_id") REFERENCES "public"."users" ("id") ON DELETE SET NULL,
+  ADD CONSTRAINT "impersonations_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "public"."users" ("id") ON DELETE SET NULL;
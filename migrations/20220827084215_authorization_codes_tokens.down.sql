@@ -0,0 +1,4 @@
+ALTER TABLE "public"."authorization_codes"
+  DROP COLUMN IF EXISTS "token_jti",
+  DROP COLUMN IF EXISTS "token_expires_at",
+  DROP COLUMN IF EXISTS "revoked_at";
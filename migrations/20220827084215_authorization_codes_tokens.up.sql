@@ -0,0 +1,4 @@
+ALTER TABLE "public"."authorization_codes"
+  ADD COLUMN IF NOT EXISTS "token_jti" text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS "token_expires_at" timestamp NULL,
+  ADD COLUMN IF NOT EXISTS "revoked_at" timestamp NULL;
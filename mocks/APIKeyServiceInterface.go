@@ -0,0 +1,141 @@
+// Code generated by mockery v2.14.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	apikeyservice "github.com/maetad/baroness-api/internal/services/apikeyservice"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// APIKeyServiceInterface is an autogenerated mock type for the APIKeyServiceInterface type
+type APIKeyServiceInterface struct {
+	mock.Mock
+}
+
+// Authenticate provides a mock function with given fields: key
+func (_m *APIKeyServiceInterface) Authenticate(key string) (*apikeyservice.APIKey, error) {
+	ret := _m.Called(key)
+
+	var r0 *apikeyservice.APIKey
+	if rf, ok := ret.Get(0).(func(string) *apikeyservice.APIKey); ok {
+		r0 = rf(key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*apikeyservice.APIKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Create provides a mock function with given fields: userID, r
+func (_m *APIKeyServiceInterface) Create(userID uint, r apikeyservice.APIKeyCreateRequest) (*apikeyservice.APIKey, string, error) {
+	ret := _m.Called(userID, r)
+
+	var r0 *apikeyservice.APIKey
+	if rf, ok := ret.Get(0).(func(uint, apikeyservice.APIKeyCreateRequest) *apikeyservice.APIKey); ok {
+		r0 = rf(userID, r)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*apikeyservice.APIKey)
+		}
+	}
+
+	var r1 string
+	if rf, ok := ret.Get(1).(func(uint, apikeyservice.APIKeyCreateRequest) string); ok {
+		r1 = rf(userID, r)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(uint, apikeyservice.APIKeyCreateRequest) error); ok {
+		r2 = rf(userID, r)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// Delete provides a mock function with given fields: key
+func (_m *APIKeyServiceInterface) Delete(key *apikeyservice.APIKey) error {
+	ret := _m.Called(key)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*apikeyservice.APIKey) error); ok {
+		r0 = rf(key)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Get provides a mock function with given fields: userID, id
+func (_m *APIKeyServiceInterface) Get(userID uint, id uint) (*apikeyservice.APIKey, error) {
+	ret := _m.Called(userID, id)
+
+	var r0 *apikeyservice.APIKey
+	if rf, ok := ret.Get(0).(func(uint, uint) *apikeyservice.APIKey); ok {
+		r0 = rf(userID, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*apikeyservice.APIKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint, uint) error); ok {
+		r1 = rf(userID, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// List provides a mock function with given fields: userID
+func (_m *APIKeyServiceInterface) List(userID uint) ([]apikeyservice.APIKey, error) {
+	ret := _m.Called(userID)
+
+	var r0 []apikeyservice.APIKey
+	if rf, ok := ret.Get(0).(func(uint) []apikeyservice.APIKey); ok {
+		r0 = rf(userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]apikeyservice.APIKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint) error); ok {
+		r1 = rf(userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+type mockConstructorTestingTNewAPIKeyServiceInterface interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+// NewAPIKeyServiceInterface creates a new instance of APIKeyServiceInterface. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+func NewAPIKeyServiceInterface(t mockConstructorTestingTNewAPIKeyServiceInterface) *APIKeyServiceInterface {
+	mock := &APIKeyServiceInterface{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
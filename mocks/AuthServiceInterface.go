@@ -16,6 +16,64 @@ type AuthServiceInterface struct {
 	mock.Mock
 }
 
+// ConsumeToken provides a mock function with given fields: claims
+func (_m *AuthServiceInterface) ConsumeToken(claims jwt.MapClaims) error {
+	ret := _m.Called(claims)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(jwt.MapClaims) error); ok {
+		r0 = rf(claims)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateSession provides a mock function with given fields: userID, ip, userAgent
+func (_m *AuthServiceInterface) CreateSession(userID uint, ip string, userAgent string) (*authservice.Session, error) {
+	ret := _m.Called(userID, ip, userAgent)
+
+	var r0 *authservice.Session
+	if rf, ok := ret.Get(0).(func(uint, string, string) *authservice.Session); ok {
+		r0 = rf(userID, ip, userAgent)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*authservice.Session)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint, string, string) error); ok {
+		r1 = rf(userID, ip, userAgent)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GenerateRefreshToken provides a mock function with given fields: userID, sessionID, expiredIn
+func (_m *AuthServiceInterface) GenerateRefreshToken(userID uint, sessionID uint, expiredIn time.Duration) (string, error) {
+	ret := _m.Called(userID, sessionID, expiredIn)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(uint, uint, time.Duration) string); ok {
+		r0 = rf(userID, sessionID, expiredIn)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint, uint, time.Duration) error); ok {
+		r1 = rf(userID, sessionID, expiredIn)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GenerateToken provides a mock function with given fields: c, expiredIn
 func (_m *AuthServiceInterface) GenerateToken(c authservice.Claimer, expiredIn time.Duration) (string, error) {
 	ret := _m.Called(c, expiredIn)
@@ -37,6 +95,110 @@ func (_m *AuthServiceInterface) GenerateToken(c authservice.Claimer, expiredIn t
 	return r0, r1
 }
 
+// GetSession provides a mock function with given fields: userID, id
+func (_m *AuthServiceInterface) GetSession(userID uint, id uint) (*authservice.Session, error) {
+	ret := _m.Called(userID, id)
+
+	var r0 *authservice.Session
+	if rf, ok := ret.Get(0).(func(uint, uint) *authservice.Session); ok {
+		r0 = rf(userID, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*authservice.Session)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint, uint) error); ok {
+		r1 = rf(userID, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IsTokenRevoked provides a mock function with given fields: claims, userID
+func (_m *AuthServiceInterface) IsTokenRevoked(claims jwt.MapClaims, userID uint) (bool, error) {
+	ret := _m.Called(claims, userID)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(jwt.MapClaims, uint) bool); ok {
+		r0 = rf(claims, userID)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(jwt.MapClaims, uint) error); ok {
+		r1 = rf(claims, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// JWKS provides a mock function with given fields:
+func (_m *AuthServiceInterface) JWKS() authservice.JSONWebKeySet {
+	ret := _m.Called()
+
+	var r0 authservice.JSONWebKeySet
+	if rf, ok := ret.Get(0).(func() authservice.JSONWebKeySet); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(authservice.JSONWebKeySet)
+	}
+
+	return r0
+}
+
+// ListImpersonations provides a mock function with given fields: userID
+func (_m *AuthServiceInterface) ListImpersonations(userID uint) ([]authservice.Impersonation, error) {
+	ret := _m.Called(userID)
+
+	var r0 []authservice.Impersonation
+	if rf, ok := ret.Get(0).(func(uint) []authservice.Impersonation); ok {
+		r0 = rf(userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]authservice.Impersonation)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint) error); ok {
+		r1 = rf(userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListSessions provides a mock function with given fields: userID, idleTimeout
+func (_m *AuthServiceInterface) ListSessions(userID uint, idleTimeout time.Duration) ([]authservice.Session, error) {
+	ret := _m.Called(userID, idleTimeout)
+
+	var r0 []authservice.Session
+	if rf, ok := ret.Get(0).(func(uint, time.Duration) []authservice.Session); ok {
+		r0 = rf(userID, idleTimeout)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]authservice.Session)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint, time.Duration) error); ok {
+		r1 = rf(userID, idleTimeout)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ParseToken provides a mock function with given fields: tokenString
 func (_m *AuthServiceInterface) ParseToken(tokenString string) (jwt.MapClaims, error) {
 	ret := _m.Called(tokenString)
@@ -60,6 +222,129 @@ func (_m *AuthServiceInterface) ParseToken(tokenString string) (jwt.MapClaims, e
 	return r0, r1
 }
 
+// RecordImpersonation provides a mock function with given fields: actorID, userID, ip, userAgent, expiresAt
+func (_m *AuthServiceInterface) RecordImpersonation(actorID uint, userID uint, ip string, userAgent string, expiresAt time.Time) (*authservice.Impersonation, error) {
+	ret := _m.Called(actorID, userID, ip, userAgent, expiresAt)
+
+	var r0 *authservice.Impersonation
+	if rf, ok := ret.Get(0).(func(uint, uint, string, string, time.Time) *authservice.Impersonation); ok {
+		r0 = rf(actorID, userID, ip, userAgent, expiresAt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*authservice.Impersonation)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint, uint, string, string, time.Time) error); ok {
+		r1 = rf(actorID, userID, ip, userAgent, expiresAt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeRefreshToken provides a mock function with given fields: refreshToken
+func (_m *AuthServiceInterface) RevokeRefreshToken(refreshToken string) error {
+	ret := _m.Called(refreshToken)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(refreshToken)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeSession provides a mock function with given fields: session
+func (_m *AuthServiceInterface) RevokeSession(session *authservice.Session) error {
+	ret := _m.Called(session)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*authservice.Session) error); ok {
+		r0 = rf(session)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeToken provides a mock function with given fields: claims
+func (_m *AuthServiceInterface) RevokeToken(claims jwt.MapClaims) error {
+	ret := _m.Called(claims)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(jwt.MapClaims) error); ok {
+		r0 = rf(claims)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeUserTokens provides a mock function with given fields: userID
+func (_m *AuthServiceInterface) RevokeUserTokens(userID uint) error {
+	ret := _m.Called(userID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(uint) error); ok {
+		r0 = rf(userID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RotateRefreshToken provides a mock function with given fields: refreshToken, expiredIn
+func (_m *AuthServiceInterface) RotateRefreshToken(refreshToken string, expiredIn time.Duration) (*authservice.RefreshToken, string, error) {
+	ret := _m.Called(refreshToken, expiredIn)
+
+	var r0 *authservice.RefreshToken
+	if rf, ok := ret.Get(0).(func(string, time.Duration) *authservice.RefreshToken); ok {
+		r0 = rf(refreshToken, expiredIn)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*authservice.RefreshToken)
+		}
+	}
+
+	var r1 string
+	if rf, ok := ret.Get(1).(func(string, time.Duration) string); ok {
+		r1 = rf(refreshToken, expiredIn)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(string, time.Duration) error); ok {
+		r2 = rf(refreshToken, expiredIn)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// TouchSession provides a mock function with given fields: id, interval
+func (_m *AuthServiceInterface) TouchSession(id uint, interval time.Duration) error {
+	ret := _m.Called(id, interval)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(uint, time.Duration) error); ok {
+		r0 = rf(id, interval)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 type mockConstructorTestingTNewAuthServiceInterface interface {
 	mock.TestingT
 	Cleanup(func())
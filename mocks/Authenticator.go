@@ -0,0 +1,51 @@
+// Code generated by mockery v2.14.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	userservice "github.com/maetad/baroness-api/internal/services/userservice"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// Authenticator is an autogenerated mock type for the Authenticator type
+type Authenticator struct {
+	mock.Mock
+}
+
+// Authenticate provides a mock function with given fields: username, password
+func (_m *Authenticator) Authenticate(username string, password string) (userservice.UserInterface, error) {
+	ret := _m.Called(username, password)
+
+	var r0 userservice.UserInterface
+	if rf, ok := ret.Get(0).(func(string, string) userservice.UserInterface); ok {
+		r0 = rf(username, password)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(userservice.UserInterface)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(username, password)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+type mockConstructorTestingTNewAuthenticator interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+// NewAuthenticator creates a new instance of Authenticator. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+func NewAuthenticator(t mockConstructorTestingTNewAuthenticator) *Authenticator {
+	mock := &Authenticator{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
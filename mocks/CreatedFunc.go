@@ -0,0 +1,44 @@
+// Code generated by mockery v2.14.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	database "github.com/maetad/baroness-api/internal/database"
+	mock "github.com/stretchr/testify/mock"
+
+	userservice "github.com/maetad/baroness-api/internal/services/userservice"
+)
+
+// CreatedFunc is an autogenerated mock type for the CreatedFunc type
+type CreatedFunc struct {
+	mock.Mock
+}
+
+// Execute provides a mock function with given fields: tx, user
+func (_m *CreatedFunc) Execute(tx database.DatabaseInterface, user *userservice.User) error {
+	ret := _m.Called(tx, user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(database.DatabaseInterface, *userservice.User) error); ok {
+		r0 = rf(tx, user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+type mockConstructorTestingTNewCreatedFunc interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+// NewCreatedFunc creates a new instance of CreatedFunc. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+func NewCreatedFunc(t mockConstructorTestingTNewCreatedFunc) *CreatedFunc {
+	mock := &CreatedFunc{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	sql "database/sql"
+
 	mock "github.com/stretchr/testify/mock"
 	gorm "gorm.io/gorm"
 )
@@ -66,6 +68,22 @@ func (_m *DatabaseInterface) Find(dest interface{}, conds ...interface{}) *gorm.
 	return r0
 }
 
+// FindInBatches provides a mock function with given fields: dest, batchSize, fc
+func (_m *DatabaseInterface) FindInBatches(dest interface{}, batchSize int, fc func(*gorm.DB, int) error) *gorm.DB {
+	ret := _m.Called(dest, batchSize, fc)
+
+	var r0 *gorm.DB
+	if rf, ok := ret.Get(0).(func(interface{}, int, func(*gorm.DB, int) error) *gorm.DB); ok {
+		r0 = rf(dest, batchSize, fc)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*gorm.DB)
+		}
+	}
+
+	return r0
+}
+
 // First provides a mock function with given fields: dest, conds
 func (_m *DatabaseInterface) First(dest interface{}, conds ...interface{}) *gorm.DB {
 	var _ca []interface{}
@@ -101,6 +119,49 @@ func (_m *DatabaseInterface) Save(value interface{}) *gorm.DB {
 	return r0
 }
 
+// Scopes provides a mock function with given fields: funcs
+func (_m *DatabaseInterface) Scopes(funcs ...func(*gorm.DB) *gorm.DB) *gorm.DB {
+	_va := make([]interface{}, len(funcs))
+	for _i := range funcs {
+		_va[_i] = funcs[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *gorm.DB
+	if rf, ok := ret.Get(0).(func(...func(*gorm.DB) *gorm.DB) *gorm.DB); ok {
+		r0 = rf(funcs...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*gorm.DB)
+		}
+	}
+
+	return r0
+}
+
+// Transaction provides a mock function with given fields: fc, opts
+func (_m *DatabaseInterface) Transaction(fc func(*gorm.DB) error, opts ...*sql.TxOptions) error {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, fc)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(func(*gorm.DB) error, ...*sql.TxOptions) error); ok {
+		r0 = rf(fc, opts...)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 type mockConstructorTestingTNewDatabaseInterface interface {
 	mock.TestingT
 	Cleanup(func())
@@ -0,0 +1,106 @@
+// Code generated by mockery v2.14.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	time "time"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// LockoutServiceInterface is an autogenerated mock type for the LockoutServiceInterface type
+type LockoutServiceInterface struct {
+	mock.Mock
+}
+
+// Attempt provides a mock function with given fields: username, ip
+func (_m *LockoutServiceInterface) Attempt(username string, ip string) (time.Duration, error) {
+	ret := _m.Called(username, ip)
+
+	var r0 time.Duration
+	if rf, ok := ret.Get(0).(func(string, string) time.Duration); ok {
+		r0 = rf(username, ip)
+	} else {
+		r0 = ret.Get(0).(time.Duration)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(username, ip)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RecordFailure provides a mock function with given fields: username, ip
+func (_m *LockoutServiceInterface) RecordFailure(username string, ip string) error {
+	ret := _m.Called(username, ip)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(username, ip)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RecordSuccess provides a mock function with given fields: username, ip
+func (_m *LockoutServiceInterface) RecordSuccess(username string, ip string) error {
+	ret := _m.Called(username, ip)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(username, ip)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Release provides a mock function with given fields: username, ip
+func (_m *LockoutServiceInterface) Release(username string, ip string) error {
+	ret := _m.Called(username, ip)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(username, ip)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Unlock provides a mock function with given fields: username
+func (_m *LockoutServiceInterface) Unlock(username string) error {
+	ret := _m.Called(username)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(username)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+type mockConstructorTestingTNewLockoutServiceInterface interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+// NewLockoutServiceInterface creates a new instance of LockoutServiceInterface. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+func NewLockoutServiceInterface(t mockConstructorTestingTNewLockoutServiceInterface) *LockoutServiceInterface {
+	mock := &LockoutServiceInterface{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,51 @@
+// Code generated by mockery v2.14.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	userservice "github.com/maetad/baroness-api/internal/services/userservice"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// LoginServiceInterface is an autogenerated mock type for the LoginServiceInterface type
+type LoginServiceInterface struct {
+	mock.Mock
+}
+
+// Authenticate provides a mock function with given fields: username, password
+func (_m *LoginServiceInterface) Authenticate(username string, password string) (userservice.UserInterface, error) {
+	ret := _m.Called(username, password)
+
+	var r0 userservice.UserInterface
+	if rf, ok := ret.Get(0).(func(string, string) userservice.UserInterface); ok {
+		r0 = rf(username, password)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(userservice.UserInterface)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(username, password)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+type mockConstructorTestingTNewLoginServiceInterface interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+// NewLoginServiceInterface creates a new instance of LoginServiceInterface. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+func NewLoginServiceInterface(t mockConstructorTestingTNewLoginServiceInterface) *LoginServiceInterface {
+	mock := &LoginServiceInterface{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
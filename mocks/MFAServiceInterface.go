@@ -0,0 +1,102 @@
+// Code generated by mockery v2.14.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	mfaservice "github.com/maetad/baroness-api/internal/services/mfaservice"
+	mock "github.com/stretchr/testify/mock"
+
+	userservice "github.com/maetad/baroness-api/internal/services/userservice"
+)
+
+// MFAServiceInterface is an autogenerated mock type for the MFAServiceInterface type
+type MFAServiceInterface struct {
+	mock.Mock
+}
+
+// Confirm provides a mock function with given fields: user, code
+func (_m *MFAServiceInterface) Confirm(user userservice.UserInterface, code string) ([]string, error) {
+	ret := _m.Called(user, code)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(userservice.UserInterface, string) []string); ok {
+		r0 = rf(user, code)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(userservice.UserInterface, string) error); ok {
+		r1 = rf(user, code)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Disable provides a mock function with given fields: user
+func (_m *MFAServiceInterface) Disable(user userservice.UserInterface) error {
+	ret := _m.Called(user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(userservice.UserInterface) error); ok {
+		r0 = rf(user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Enroll provides a mock function with given fields: user
+func (_m *MFAServiceInterface) Enroll(user userservice.UserInterface) (mfaservice.Enrollment, error) {
+	ret := _m.Called(user)
+
+	var r0 mfaservice.Enrollment
+	if rf, ok := ret.Get(0).(func(userservice.UserInterface) mfaservice.Enrollment); ok {
+		r0 = rf(user)
+	} else {
+		r0 = ret.Get(0).(mfaservice.Enrollment)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(userservice.UserInterface) error); ok {
+		r1 = rf(user)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Verify provides a mock function with given fields: user, code
+func (_m *MFAServiceInterface) Verify(user userservice.UserInterface, code string) error {
+	ret := _m.Called(user, code)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(userservice.UserInterface, string) error); ok {
+		r0 = rf(user, code)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+type mockConstructorTestingTNewMFAServiceInterface interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+// NewMFAServiceInterface creates a new instance of MFAServiceInterface. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+func NewMFAServiceInterface(t mockConstructorTestingTNewMFAServiceInterface) *MFAServiceInterface {
+	mock := &MFAServiceInterface{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,250 @@
+// Code generated by mockery v2.14.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	time "time"
+
+	oauthservice "github.com/maetad/baroness-api/internal/services/oauthservice"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// OAuthServiceInterface is an autogenerated mock type for the OAuthServiceInterface type
+type OAuthServiceInterface struct {
+	mock.Mock
+}
+
+// AttachToken provides a mock function with given fields: code, jti, expiresAt
+func (_m *OAuthServiceInterface) AttachToken(code *oauthservice.AuthorizationCode, jti string, expiresAt time.Time) error {
+	ret := _m.Called(code, jti, expiresAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*oauthservice.AuthorizationCode, string, time.Time) error); ok {
+		r0 = rf(code, jti, expiresAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AuthenticateClient provides a mock function with given fields: client, secret
+func (_m *OAuthServiceInterface) AuthenticateClient(client *oauthservice.Client, secret string) error {
+	ret := _m.Called(client, secret)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*oauthservice.Client, string) error); ok {
+		r0 = rf(client, secret)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateClient provides a mock function with given fields: r
+func (_m *OAuthServiceInterface) CreateClient(r oauthservice.ClientCreateRequest) (*oauthservice.Client, string, error) {
+	ret := _m.Called(r)
+
+	var r0 *oauthservice.Client
+	if rf, ok := ret.Get(0).(func(oauthservice.ClientCreateRequest) *oauthservice.Client); ok {
+		r0 = rf(r)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*oauthservice.Client)
+		}
+	}
+
+	var r1 string
+	if rf, ok := ret.Get(1).(func(oauthservice.ClientCreateRequest) string); ok {
+		r1 = rf(r)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(oauthservice.ClientCreateRequest) error); ok {
+		r2 = rf(r)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// CreateCode provides a mock function with given fields: userID, client, r
+func (_m *OAuthServiceInterface) CreateCode(userID uint, client *oauthservice.Client, r oauthservice.AuthorizeRequest) (string, error) {
+	ret := _m.Called(userID, client, r)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(uint, *oauthservice.Client, oauthservice.AuthorizeRequest) string); ok {
+		r0 = rf(userID, client, r)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint, *oauthservice.Client, oauthservice.AuthorizeRequest) error); ok {
+		r1 = rf(userID, client, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteClient provides a mock function with given fields: client
+func (_m *OAuthServiceInterface) DeleteClient(client *oauthservice.Client) error {
+	ret := _m.Called(client)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*oauthservice.Client) error); ok {
+		r0 = rf(client)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ExchangeCode provides a mock function with given fields: client, code, redirectURI, verifier
+func (_m *OAuthServiceInterface) ExchangeCode(client *oauthservice.Client, code string, redirectURI string, verifier string) (*oauthservice.AuthorizationCode, error) {
+	ret := _m.Called(client, code, redirectURI, verifier)
+
+	var r0 *oauthservice.AuthorizationCode
+	if rf, ok := ret.Get(0).(func(*oauthservice.Client, string, string, string) *oauthservice.AuthorizationCode); ok {
+		r0 = rf(client, code, redirectURI, verifier)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*oauthservice.AuthorizationCode)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*oauthservice.Client, string, string, string) error); ok {
+		r1 = rf(client, code, redirectURI, verifier)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetClient provides a mock function with given fields: id
+func (_m *OAuthServiceInterface) GetClient(id uint) (*oauthservice.Client, error) {
+	ret := _m.Called(id)
+
+	var r0 *oauthservice.Client
+	if rf, ok := ret.Get(0).(func(uint) *oauthservice.Client); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*oauthservice.Client)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetClientByClientID provides a mock function with given fields: clientID
+func (_m *OAuthServiceInterface) GetClientByClientID(clientID string) (*oauthservice.Client, error) {
+	ret := _m.Called(clientID)
+
+	var r0 *oauthservice.Client
+	if rf, ok := ret.Get(0).(func(string) *oauthservice.Client); ok {
+		r0 = rf(clientID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*oauthservice.Client)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(clientID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GrantConsent provides a mock function with given fields: userID, client, scope
+func (_m *OAuthServiceInterface) GrantConsent(userID uint, client *oauthservice.Client, scope []string) error {
+	ret := _m.Called(userID, client, scope)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(uint, *oauthservice.Client, []string) error); ok {
+		r0 = rf(userID, client, scope)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// HasConsent provides a mock function with given fields: userID, client, scope
+func (_m *OAuthServiceInterface) HasConsent(userID uint, client *oauthservice.Client, scope []string) (bool, error) {
+	ret := _m.Called(userID, client, scope)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(uint, *oauthservice.Client, []string) bool); ok {
+		r0 = rf(userID, client, scope)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint, *oauthservice.Client, []string) error); ok {
+		r1 = rf(userID, client, scope)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListClients provides a mock function with given fields:
+func (_m *OAuthServiceInterface) ListClients() ([]oauthservice.Client, error) {
+	ret := _m.Called()
+
+	var r0 []oauthservice.Client
+	if rf, ok := ret.Get(0).(func() []oauthservice.Client); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]oauthservice.Client)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+type mockConstructorTestingTNewOAuthServiceInterface interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+// NewOAuthServiceInterface creates a new instance of OAuthServiceInterface. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+func NewOAuthServiceInterface(t mockConstructorTestingTNewOAuthServiceInterface) *OAuthServiceInterface {
+	mock := &OAuthServiceInterface{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
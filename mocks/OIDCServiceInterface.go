@@ -0,0 +1,79 @@
+// Code generated by mockery v2.14.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	oidcservice "github.com/maetad/baroness-api/internal/services/oidcservice"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// OIDCServiceInterface is an autogenerated mock type for the OIDCServiceInterface type
+type OIDCServiceInterface struct {
+	mock.Mock
+}
+
+// AuthCodeURL provides a mock function with given fields:
+func (_m *OIDCServiceInterface) AuthCodeURL() (string, string, error) {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 string
+	if rf, ok := ret.Get(1).(func() string); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func() error); ok {
+		r2 = rf()
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// Exchange provides a mock function with given fields: state, code
+func (_m *OIDCServiceInterface) Exchange(state string, code string) (*oidcservice.Claims, error) {
+	ret := _m.Called(state, code)
+
+	var r0 *oidcservice.Claims
+	if rf, ok := ret.Get(0).(func(string, string) *oidcservice.Claims); ok {
+		r0 = rf(state, code)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*oidcservice.Claims)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(state, code)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+type mockConstructorTestingTNewOIDCServiceInterface interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+// NewOIDCServiceInterface creates a new instance of OIDCServiceInterface. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+func NewOIDCServiceInterface(t mockConstructorTestingTNewOIDCServiceInterface) *OIDCServiceInterface {
+	mock := &OIDCServiceInterface{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
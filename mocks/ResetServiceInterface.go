@@ -0,0 +1,86 @@
+// Code generated by mockery v2.14.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	resetservice "github.com/maetad/baroness-api/internal/services/resetservice"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// ResetServiceInterface is an autogenerated mock type for the ResetServiceInterface type
+type ResetServiceInterface struct {
+	mock.Mock
+}
+
+// Create provides a mock function with given fields: userID
+func (_m *ResetServiceInterface) Create(userID uint) (string, error) {
+	ret := _m.Called(userID)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(uint) string); ok {
+		r0 = rf(userID)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint) error); ok {
+		r1 = rf(userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Get provides a mock function with given fields: token
+func (_m *ResetServiceInterface) Get(token string) (*resetservice.PasswordReset, error) {
+	ret := _m.Called(token)
+
+	var r0 *resetservice.PasswordReset
+	if rf, ok := ret.Get(0).(func(string) *resetservice.PasswordReset); ok {
+		r0 = rf(token)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*resetservice.PasswordReset)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(token)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Use provides a mock function with given fields: reset
+func (_m *ResetServiceInterface) Use(reset *resetservice.PasswordReset) error {
+	ret := _m.Called(reset)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*resetservice.PasswordReset) error); ok {
+		r0 = rf(reset)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+type mockConstructorTestingTNewResetServiceInterface interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+// NewResetServiceInterface creates a new instance of ResetServiceInterface. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+func NewResetServiceInterface(t mockConstructorTestingTNewResetServiceInterface) *ResetServiceInterface {
+	mock := &ResetServiceInterface{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,120 @@
+// Code generated by mockery v2.14.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	time "time"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// RevocationStoreInterface is an autogenerated mock type for the RevocationStoreInterface type
+type RevocationStoreInterface struct {
+	mock.Mock
+}
+
+// Consume provides a mock function with given fields: jti, expiresAt
+func (_m *RevocationStoreInterface) Consume(jti string, expiresAt time.Time) (bool, error) {
+	ret := _m.Called(jti, expiresAt)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string, time.Time) bool); ok {
+		r0 = rf(jti, expiresAt)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, time.Time) error); ok {
+		r1 = rf(jti, expiresAt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IsRevoked provides a mock function with given fields: jti
+func (_m *RevocationStoreInterface) IsRevoked(jti string) (bool, error) {
+	ret := _m.Called(jti)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = rf(jti)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(jti)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Revoke provides a mock function with given fields: jti, expiresAt
+func (_m *RevocationStoreInterface) Revoke(jti string, expiresAt time.Time) error {
+	ret := _m.Called(jti, expiresAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, time.Time) error); ok {
+		r0 = rf(jti, expiresAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeUser provides a mock function with given fields: userID, revokedAt
+func (_m *RevocationStoreInterface) RevokeUser(userID uint, revokedAt time.Time) error {
+	ret := _m.Called(userID, revokedAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(uint, time.Time) error); ok {
+		r0 = rf(userID, revokedAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UserRevokedAt provides a mock function with given fields: userID
+func (_m *RevocationStoreInterface) UserRevokedAt(userID uint) (time.Time, error) {
+	ret := _m.Called(userID)
+
+	var r0 time.Time
+	if rf, ok := ret.Get(0).(func(uint) time.Time); ok {
+		r0 = rf(userID)
+	} else {
+		r0 = ret.Get(0).(time.Time)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint) error); ok {
+		r1 = rf(userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+type mockConstructorTestingTNewRevocationStoreInterface interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+// NewRevocationStoreInterface creates a new instance of RevocationStoreInterface. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+func NewRevocationStoreInterface(t mockConstructorTestingTNewRevocationStoreInterface) *RevocationStoreInterface {
+	mock := &RevocationStoreInterface{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
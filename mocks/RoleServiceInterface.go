@@ -0,0 +1,233 @@
+// Code generated by mockery v2.14.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	database "github.com/maetad/baroness-api/internal/database"
+	mock "github.com/stretchr/testify/mock"
+
+	roleservice "github.com/maetad/baroness-api/internal/services/roleservice"
+)
+
+// RoleServiceInterface is an autogenerated mock type for the RoleServiceInterface type
+type RoleServiceInterface struct {
+	mock.Mock
+}
+
+// Create provides a mock function with given fields: r
+func (_m *RoleServiceInterface) Create(r roleservice.RoleCreateRequest) (*roleservice.Role, error) {
+	ret := _m.Called(r)
+
+	var r0 *roleservice.Role
+	if rf, ok := ret.Get(0).(func(roleservice.RoleCreateRequest) *roleservice.Role); ok {
+		r0 = rf(r)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roleservice.Role)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(roleservice.RoleCreateRequest) error); ok {
+		r1 = rf(r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Delete provides a mock function with given fields: role
+func (_m *RoleServiceInterface) Delete(role *roleservice.Role) error {
+	ret := _m.Called(role)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*roleservice.Role) error); ok {
+		r0 = rf(role)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Get provides a mock function with given fields: id
+func (_m *RoleServiceInterface) Get(id uint) (*roleservice.Role, error) {
+	ret := _m.Called(id)
+
+	var r0 *roleservice.Role
+	if rf, ok := ret.Get(0).(func(uint) *roleservice.Role); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roleservice.Role)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserAccess provides a mock function with given fields: userID
+func (_m *RoleServiceInterface) GetUserAccess(userID uint) (roleservice.Access, error) {
+	ret := _m.Called(userID)
+
+	var r0 roleservice.Access
+	if rf, ok := ret.Get(0).(func(uint) roleservice.Access); ok {
+		r0 = rf(userID)
+	} else {
+		r0 = ret.Get(0).(roleservice.Access)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint) error); ok {
+		r1 = rf(userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserRoles provides a mock function with given fields: userID
+func (_m *RoleServiceInterface) GetUserRoles(userID uint) ([]roleservice.Role, error) {
+	ret := _m.Called(userID)
+
+	var r0 []roleservice.Role
+	if rf, ok := ret.Get(0).(func(uint) []roleservice.Role); ok {
+		r0 = rf(userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]roleservice.Role)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint) error); ok {
+		r1 = rf(userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// List provides a mock function with given fields:
+func (_m *RoleServiceInterface) List() ([]roleservice.Role, error) {
+	ret := _m.Called()
+
+	var r0 []roleservice.Role
+	if rf, ok := ret.Get(0).(func() []roleservice.Role); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]roleservice.Role)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListPermissions provides a mock function with given fields:
+func (_m *RoleServiceInterface) ListPermissions() ([]roleservice.Permission, error) {
+	ret := _m.Called()
+
+	var r0 []roleservice.Permission
+	if rf, ok := ret.Get(0).(func() []roleservice.Permission); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]roleservice.Permission)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetUserRoles provides a mock function with given fields: userID, roles
+func (_m *RoleServiceInterface) SetUserRoles(userID uint, roles []string) error {
+	ret := _m.Called(userID, roles)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(uint, []string) error); ok {
+		r0 = rf(userID, roles)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Update provides a mock function with given fields: role, r
+func (_m *RoleServiceInterface) Update(role *roleservice.Role, r roleservice.RoleUpdateRequest) (*roleservice.Role, error) {
+	ret := _m.Called(role, r)
+
+	var r0 *roleservice.Role
+	if rf, ok := ret.Get(0).(func(*roleservice.Role, roleservice.RoleUpdateRequest) *roleservice.Role); ok {
+		r0 = rf(role, r)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roleservice.Role)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*roleservice.Role, roleservice.RoleUpdateRequest) error); ok {
+		r1 = rf(role, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WithDB provides a mock function with given fields: db
+func (_m *RoleServiceInterface) WithDB(db database.DatabaseInterface) roleservice.RoleServiceInterface {
+	ret := _m.Called(db)
+
+	var r0 roleservice.RoleServiceInterface
+	if rf, ok := ret.Get(0).(func(database.DatabaseInterface) roleservice.RoleServiceInterface); ok {
+		r0 = rf(db)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(roleservice.RoleServiceInterface)
+		}
+	}
+
+	return r0
+}
+
+type mockConstructorTestingTNewRoleServiceInterface interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+// NewRoleServiceInterface creates a new instance of RoleServiceInterface. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+func NewRoleServiceInterface(t mockConstructorTestingTNewRoleServiceInterface) *RoleServiceInterface {
+	mock := &RoleServiceInterface{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -10,8 +10,17 @@ type UserInterface struct {
 }
 
 // SetPassword provides a mock function with given fields: password
-func (_m *UserInterface) SetPassword(password string) {
-	_m.Called(password)
+func (_m *UserInterface) SetPassword(password string) error {
+	ret := _m.Called(password)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(password)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
 }
 
 // ValidatePassword provides a mock function with given fields: password
@@ -0,0 +1,51 @@
+// Code generated by mockery v2.14.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	userservice "github.com/maetad/baroness-api/internal/services/userservice"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// UserSearcherInterface is an autogenerated mock type for the UserSearcherInterface type
+type UserSearcherInterface struct {
+	mock.Mock
+}
+
+// Search provides a mock function with given fields: query, limit
+func (_m *UserSearcherInterface) Search(query string, limit int) ([]userservice.User, error) {
+	ret := _m.Called(query, limit)
+
+	var r0 []userservice.User
+	if rf, ok := ret.Get(0).(func(string, int) []userservice.User); ok {
+		r0 = rf(query, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]userservice.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, int) error); ok {
+		r1 = rf(query, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+type mockConstructorTestingTNewUserSearcherInterface interface {
+	mock.TestingT
+	Cleanup(func())
+}
+
+// NewUserSearcherInterface creates a new instance of UserSearcherInterface. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+func NewUserSearcherInterface(t mockConstructorTestingTNewUserSearcherInterface) *UserSearcherInterface {
+	mock := &UserSearcherInterface{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
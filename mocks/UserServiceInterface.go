@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	io "io"
+
 	userservice "github.com/maetad/baroness-api/internal/services/userservice"
 	mock "github.com/stretchr/testify/mock"
 )
@@ -12,12 +14,49 @@ type UserServiceInterface struct {
 	mock.Mock
 }
 
-// Create provides a mock function with given fields: r
-func (_m *UserServiceInterface) Create(r userservice.UserCreateRequest) (userservice.UserInterface, error) {
+// ChangePassword provides a mock function with given fields: user, password
+func (_m *UserServiceInterface) ChangePassword(user userservice.UserInterface, password string) error {
+	ret := _m.Called(user, password)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(userservice.UserInterface, string) error); ok {
+		r0 = rf(user, password)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Create provides a mock function with given fields: r, created
+func (_m *UserServiceInterface) Create(r userservice.UserCreateRequest, created userservice.CreatedFunc) (userservice.UserInterface, error) {
+	ret := _m.Called(r, created)
+
+	var r0 userservice.UserInterface
+	if rf, ok := ret.Get(0).(func(userservice.UserCreateRequest, userservice.CreatedFunc) userservice.UserInterface); ok {
+		r0 = rf(r, created)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(userservice.UserInterface)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(userservice.UserCreateRequest, userservice.CreatedFunc) error); ok {
+		r1 = rf(r, created)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateExternal provides a mock function with given fields: r
+func (_m *UserServiceInterface) CreateExternal(r userservice.UserExternalCreateRequest) (userservice.UserInterface, error) {
 	ret := _m.Called(r)
 
 	var r0 userservice.UserInterface
-	if rf, ok := ret.Get(0).(func(userservice.UserCreateRequest) userservice.UserInterface); ok {
+	if rf, ok := ret.Get(0).(func(userservice.UserExternalCreateRequest) userservice.UserInterface); ok {
 		r0 = rf(r)
 	} else {
 		if ret.Get(0) != nil {
@@ -26,7 +65,7 @@ func (_m *UserServiceInterface) Create(r userservice.UserCreateRequest) (userser
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(userservice.UserCreateRequest) error); ok {
+	if rf, ok := ret.Get(1).(func(userservice.UserExternalCreateRequest) error); ok {
 		r1 = rf(r)
 	} else {
 		r1 = ret.Error(1)
@@ -49,6 +88,20 @@ func (_m *UserServiceInterface) Delete(user userservice.UserInterface) error {
 	return r0
 }
 
+// Export provides a mock function with given fields: fn
+func (_m *UserServiceInterface) Export(fn func(userservice.UserInterface) error) error {
+	ret := _m.Called(fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(func(userservice.UserInterface) error) error); ok {
+		r0 = rf(fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Get provides a mock function with given fields: id
 func (_m *UserServiceInterface) Get(id uint) (userservice.UserInterface, error) {
 	ret := _m.Called(id)
@@ -72,6 +125,52 @@ func (_m *UserServiceInterface) Get(id uint) (userservice.UserInterface, error)
 	return r0, r1
 }
 
+// GetByEmail provides a mock function with given fields: email
+func (_m *UserServiceInterface) GetByEmail(email string) (userservice.UserInterface, error) {
+	ret := _m.Called(email)
+
+	var r0 userservice.UserInterface
+	if rf, ok := ret.Get(0).(func(string) userservice.UserInterface); ok {
+		r0 = rf(email)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(userservice.UserInterface)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(email)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetByIdentity provides a mock function with given fields: issuer, subject
+func (_m *UserServiceInterface) GetByIdentity(issuer string, subject string) (userservice.UserInterface, error) {
+	ret := _m.Called(issuer, subject)
+
+	var r0 userservice.UserInterface
+	if rf, ok := ret.Get(0).(func(string, string) userservice.UserInterface); ok {
+		r0 = rf(issuer, subject)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(userservice.UserInterface)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(issuer, subject)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetByUsername provides a mock function with given fields: username
 func (_m *UserServiceInterface) GetByUsername(username string) (userservice.UserInterface, error) {
 	ret := _m.Called(username)
@@ -95,13 +194,138 @@ func (_m *UserServiceInterface) GetByUsername(username string) (userservice.User
 	return r0, r1
 }
 
-// List provides a mock function with given fields:
-func (_m *UserServiceInterface) List() ([]userservice.UserInterface, error) {
-	ret := _m.Called()
+// GetUnscoped provides a mock function with given fields: id
+func (_m *UserServiceInterface) GetUnscoped(id uint) (userservice.UserInterface, error) {
+	ret := _m.Called(id)
+
+	var r0 userservice.UserInterface
+	if rf, ok := ret.Get(0).(func(uint) userservice.UserInterface); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(userservice.UserInterface)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Import provides a mock function with given fields: r, format, options
+func (_m *UserServiceInterface) Import(r io.Reader, format string, options userservice.UserImportOptions) (*userservice.UserImportResult, error) {
+	ret := _m.Called(r, format, options)
+
+	var r0 *userservice.UserImportResult
+	if rf, ok := ret.Get(0).(func(io.Reader, string, userservice.UserImportOptions) *userservice.UserImportResult); ok {
+		r0 = rf(r, format, options)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*userservice.UserImportResult)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(io.Reader, string, userservice.UserImportOptions) error); ok {
+		r1 = rf(r, format, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// LinkIdentity provides a mock function with given fields: user, issuer, subject
+func (_m *UserServiceInterface) LinkIdentity(user userservice.UserInterface, issuer string, subject string) error {
+	ret := _m.Called(user, issuer, subject)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(userservice.UserInterface, string, string) error); ok {
+		r0 = rf(user, issuer, subject)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// List provides a mock function with given fields: r
+func (_m *UserServiceInterface) List(r userservice.UserListRequest) (*userservice.UserList, error) {
+	ret := _m.Called(r)
+
+	var r0 *userservice.UserList
+	if rf, ok := ret.Get(0).(func(userservice.UserListRequest) *userservice.UserList); ok {
+		r0 = rf(r)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*userservice.UserList)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(userservice.UserListRequest) error); ok {
+		r1 = rf(r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Purge provides a mock function with given fields: user
+func (_m *UserServiceInterface) Purge(user userservice.UserInterface) error {
+	ret := _m.Called(user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(userservice.UserInterface) error); ok {
+		r0 = rf(user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RehashPassword provides a mock function with given fields: user, password
+func (_m *UserServiceInterface) RehashPassword(user userservice.UserInterface, password string) error {
+	ret := _m.Called(user, password)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(userservice.UserInterface, string) error); ok {
+		r0 = rf(user, password)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Restore provides a mock function with given fields: user
+func (_m *UserServiceInterface) Restore(user userservice.UserInterface) error {
+	ret := _m.Called(user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(userservice.UserInterface) error); ok {
+		r0 = rf(user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Search provides a mock function with given fields: query, limit
+func (_m *UserServiceInterface) Search(query string, limit int) ([]userservice.UserInterface, error) {
+	ret := _m.Called(query, limit)
 
 	var r0 []userservice.UserInterface
-	if rf, ok := ret.Get(0).(func() []userservice.UserInterface); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(string, int) []userservice.UserInterface); ok {
+		r0 = rf(query, limit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]userservice.UserInterface)
@@ -109,8 +333,8 @@ func (_m *UserServiceInterface) List() ([]userservice.UserInterface, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func() error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(string, int) error); ok {
+		r1 = rf(query, limit)
 	} else {
 		r1 = ret.Error(1)
 	}